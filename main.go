@@ -1,17 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/reimirno/golinks/pkg/config"
 	"github.com/reimirno/golinks/pkg/logging"
 	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
 	"github.com/reimirno/golinks/pkg/version"
 	"github.com/reimirno/golinks/svr/crud"
@@ -20,8 +23,9 @@ import (
 )
 
 var (
-	configFile string
-	logger     *zap.SugaredLogger
+	configFile  string
+	listMappers bool
+	logger      *zap.SugaredLogger
 
 	Version   string
 	Commit    string
@@ -30,8 +34,16 @@ var (
 
 func main() {
 	flag.StringVar(&configFile, "config", "./files/config.yaml", "Path to the config file")
+	flag.BoolVar(&listMappers, "mappers", false, "List the mapper types built in, with their configuration fields, and exit")
 	flag.Parse()
 
+	if listMappers {
+		if err := printMappers(os.Stdout); err != nil {
+			log.Fatalf("Failed to list mappers: %v", err)
+		}
+		return
+	}
+
 	cfg, err := config.NewConfig(configFile)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -50,16 +62,29 @@ func main() {
 	logger.Info("Application starting...")
 	logger.Info(bld)
 
+	shutdownTracing, err := tracing.Initialize(cfg.Tracing, "golinks", Version)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	configurators := make([]types.MapperConfigurer, len(cfg.Mapper.Mappers))
+	managerOpts := make([]mapper.ManagerOption, len(cfg.Mapper.Mappers))
 	for i, wrapper := range cfg.Mapper.Mappers {
 		configurators[i] = wrapper.MapperConfigurer
+		managerOpts[i] = mapper.WithMapperSettings(wrapper.MapperConfigurer.GetName(), wrapper.Settings)
 	}
-	mapperManager, err := mapper.NewMapperManager(cfg.Mapper.Persistor, configurators)
+	managerOpts = append(managerOpts, mapper.WithMirrors(cfg.Mapper.Mirrors, time.Duration(cfg.Mapper.ReconcileInterval)*time.Second))
+	managerOpts = append(managerOpts, mapper.WithReaper(cfg.Mapper.Reaper))
+	managerOpts = append(managerOpts, mapper.WithNamespaces(cfg.Mapper.Namespaces))
+	managerOpts = append(managerOpts, mapper.WithChecker(cfg.Mapper.Checker))
+	managerOpts = append(managerOpts, mapper.WithPatterns(time.Duration(cfg.Mapper.PatternRefreshInterval)*time.Second))
+	managerOpts = append(managerOpts, mapper.WithSuggestRefresh(time.Duration(cfg.Mapper.SuggestRefreshInterval)*time.Second))
+	mapperManager, err := mapper.NewMapperManager(cfg.Mapper.Persistor, configurators, managerOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create mapper manager: %v", err)
 	}
 
-	redirectorServer, err := redirector.NewServer(mapperManager, cfg.Server.Port.Redirector)
+	redirectorServer, err := redirector.NewServer(mapperManager, cfg.Server.Port.Redirector, cfg.Server.PublicUrl)
 	if err != nil {
 		log.Fatalf("Failed to create redirector server: %v", err)
 	}
@@ -86,6 +111,11 @@ func main() {
 	select {
 	case <-sigTermChan:
 		logger.Infof("Received shutdown signal, shutting down...")
+		mapperManager.BeginShutdown()
+		if cfg.Server.ShutdownDelay > 0 {
+			logger.Infof("Reporting not ready for %d seconds before stopping", cfg.Server.ShutdownDelay)
+			time.Sleep(time.Duration(cfg.Server.ShutdownDelay) * time.Second)
+		}
 		err = redirectorServer.Stop()
 		if err != nil {
 			logger.Errorf("Error stopping redirector server: %v", err)
@@ -102,6 +132,10 @@ func main() {
 		if err != nil {
 			logger.Errorf("Error tearing down mapper manager: %v", err)
 		}
+		err = shutdownTracing(context.Background())
+		if err != nil {
+			logger.Errorf("Error flushing traces: %v", err)
+		}
 		os.Exit(0)
 	case err = <-svrErrChan:
 		if err != nil {
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/reimirno/golinks/pkg/config"
+	"github.com/reimirno/golinks/pkg/mapper"
+)
+
+// printMappers lists the mapper types built into this binary, with the fields of their blocks in the config file.
+func printMappers(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "every mapper:")
+	for _, field := range config.MapperCommonSchema() {
+		fmt.Fprintf(w, "  %s\t%s\n", field.Name, field.Type)
+	}
+	for _, typ := range mapper.RegisteredTypes() {
+		fields, err := mapper.ConfigSchema(typ)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\ntype: %s\n", strings.ToLower(typ))
+		for _, field := range fields {
+			fmt.Fprintf(w, "  %s\t%s\n", field.Name, field.Type)
+		}
+	}
+	return w.Flush()
+}
@@ -3,21 +3,22 @@ package config
 import (
 	"fmt"
 	"reflect"
-	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 
-	bolt_mapper "github.com/reimirno/golinks/pkg/mapper/bolt-mapper"
-	file_mapper "github.com/reimirno/golinks/pkg/mapper/file-mapper"
-	mem_mapper "github.com/reimirno/golinks/pkg/mapper/mem-mapper"
-	sql_mapper "github.com/reimirno/golinks/pkg/mapper/sql-mapper"
+	"github.com/reimirno/golinks/pkg/mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/builtin" // registers the built-in mapper types
+	cache_mapper "github.com/reimirno/golinks/pkg/mapper/cache-mapper"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
 type config struct {
-	Server serverConfig `mapstructure:"server"`
-	Mapper mapperConfig `mapstructure:"mapper"`
+	Server  serverConfig   `mapstructure:"server"`
+	Mapper  mapperConfig   `mapstructure:"mapper"`
+	Tracing tracing.Config `mapstructure:"tracing"`
 }
 
 type serverConfig struct {
@@ -26,12 +27,21 @@ type serverConfig struct {
 		Crud       string `mapstructure:"crud"`
 		CrudHttp   string `mapstructure:"crud_http"`
 	} `mapstructure:"port"`
-	Debug bool `mapstructure:"debug"`
+	Debug         bool   `mapstructure:"debug"`
+	ShutdownDelay int    `mapstructure:"shutdownDelay"` // in seconds, time to report not ready before stopping
+	PublicUrl     string `mapstructure:"publicUrl"`     // where users reach the redirector, e.g. https://go.example.com; the host requested when empty
 }
 
 type mapperConfig struct {
-	Persistor string                    `mapstructure:"persistor"`
-	Mappers   []mapperConfigurerWrapper `mapstructure:"mappers"`
+	Persistor              string                     `mapstructure:"persistor"`
+	Mirrors                []mapper.MirrorSettings    `mapstructure:"mirrors"`
+	ReconcileInterval      int                        `mapstructure:"reconcileInterval"` // in seconds; 0 disables reconciliation of mirrors
+	Reaper                 mapper.ReaperSettings      `mapstructure:"reaper"`
+	Checker                mapper.CheckerSettings     `mapstructure:"checker"`
+	PatternRefreshInterval int                        `mapstructure:"patternRefreshInterval"` // in seconds; 0, the default, only loads the patterns at start
+	SuggestRefreshInterval int                        `mapstructure:"suggestRefreshInterval"` // in seconds; 0 only loads the suggestions at start
+	Namespaces             []mapper.NamespaceSettings `mapstructure:"namespaces"`
+	Mappers                []mapperConfigurerWrapper  `mapstructure:"mappers"`
 }
 
 func NewConfig(configFile string) (*config, error) {
@@ -43,6 +53,10 @@ func NewConfig(configFile string) (*config, error) {
 	v.SetDefault("Server.Port.Crud", "8081")
 	v.SetDefault("Server.Port.CrudHttp", "8082")
 	v.SetDefault("Server.Debug", false)
+	v.SetDefault("Server.ShutdownDelay", 0)
+	v.SetDefault("Mapper.SuggestRefreshInterval", 300)
+	v.SetDefault("Tracing.Enabled", false)
+	v.SetDefault("Tracing.Exporter", tracing.ExporterStdout)
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -62,6 +76,23 @@ func NewConfig(configFile string) (*config, error) {
 type mapperConfigurerWrapper struct {
 	Type             string `mapstructure:"type"`
 	MapperConfigurer types.MapperConfigurer
+	Settings         mapper.MapperSettings // type-independent settings, decoded from the same map
+}
+
+type mapperCacheWrapper struct {
+	Cache *cache_mapper.CacheConfig `mapstructure:"cache"`
+}
+
+// mapperCommonFields are the fields of every mapper block, on top of those of its type.
+type mapperCommonFields struct {
+	Type                  string `mapstructure:"type"`
+	mapper.MapperSettings `mapstructure:",squash"`
+	mapperCacheWrapper    `mapstructure:",squash"`
+}
+
+// MapperCommonSchema describes the fields of every mapper block, on top of those of its type (see mapper.ConfigSchema).
+func MapperCommonSchema() []mapper.ConfigField {
+	return mapper.SchemaOf(mapperCommonFields{})
 }
 
 func (w *mapperConfigurerWrapper) DecodeMapstructure(config *mapstructure.DecoderConfig) mapstructure.DecodeHookFunc {
@@ -82,36 +113,39 @@ func (w *mapperConfigurerWrapper) DecodeMapstructure(config *mapstructure.Decode
 
 		var wrapper mapperConfigurerWrapper
 		wrapper.Type = mapperType
+		if err := mapstructure.Decode(raw, &wrapper.Settings); err != nil {
+			return nil, err
+		}
 
-		switch strings.ToUpper(mapperType) {
-		case file_mapper.FileMapperConfigType:
-			var fileMapper file_mapper.FileMapperConfig
-			if err := mapstructure.Decode(raw, &fileMapper); err != nil {
-				return nil, err
-			}
-			wrapper.MapperConfigurer = &fileMapper
-		case bolt_mapper.BoltMapperConfigType:
-			var boltMapper bolt_mapper.BoltMapperConfig
-			if err := mapstructure.Decode(raw, &boltMapper); err != nil {
-				return nil, err
-			}
-			wrapper.MapperConfigurer = &boltMapper
-		case mem_mapper.MemMapperConfigType:
-			var memMapper mem_mapper.MemMapperConfig
-			if err := mapstructure.Decode(raw, &memMapper); err != nil {
-				return nil, err
-			}
-			wrapper.MapperConfigurer = &memMapper
-		case sql_mapper.SqlMapperConfigType:
-			var sqlMapper sql_mapper.SqlMapperConfig
-			if err := mapstructure.Decode(raw, &sqlMapper); err != nil {
-				return nil, err
-			}
-			wrapper.MapperConfigurer = &sqlMapper
-		default:
+		configurer, ok := mapper.NewConfigurer(mapperType)
+		if !ok {
 			return nil, fmt.Errorf("unknown mapper type: %s", mapperType)
 		}
+		if err := decode(raw, configurer); err != nil {
+			return nil, err
+		}
+		wrapper.MapperConfigurer = configurer
+
+		var cache mapperCacheWrapper
+		if err := mapstructure.Decode(raw, &cache); err != nil {
+			return nil, err
+		}
+		if cache.Cache != nil {
+			wrapper.MapperConfigurer = cache_mapper.NewConfigurer(wrapper.MapperConfigurer, *cache.Cache)
+		}
 
 		return wrapper, nil
 	}
 }
+
+// decode decodes a mapper block into out, reading times, such as those of pairs, from RFC 3339 strings.
+func decode(raw map[string]interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339),
+		Result:     out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(raw)
+}
@@ -1,10 +1,24 @@
 package config
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	cache_mapper "github.com/reimirno/golinks/pkg/mapper/cache-mapper"
+	dir_mapper "github.com/reimirno/golinks/pkg/mapper/dir-mapper"
+	git_mapper "github.com/reimirno/golinks/pkg/mapper/git-mapper"
+	mem_mapper "github.com/reimirno/golinks/pkg/mapper/mem-mapper"
+	pebble_mapper "github.com/reimirno/golinks/pkg/mapper/pebble-mapper"
+	raft_mapper "github.com/reimirno/golinks/pkg/mapper/raft-mapper"
+	redis_mapper "github.com/reimirno/golinks/pkg/mapper/redis-mapper"
+	remote_mapper "github.com/reimirno/golinks/pkg/mapper/remote-mapper"
+	sql_mapper "github.com/reimirno/golinks/pkg/mapper/sql-mapper"
+	"github.com/reimirno/golinks/pkg/types"
 )
 
 type tempFileConfig struct {
@@ -21,6 +35,7 @@ server:
     redirector: 8080
     crud: 8081
   debug: true
+  publicUrl: https://go.example.com
 
 mapper:
   persistor: ""
@@ -30,6 +45,234 @@ mapper:
       pairs:
         - path: ggl
           url: https://google.com
+`,
+	}
+	mapperSettingsConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: mem
+      name: memory
+      requestTimeout: 250
+      onError: skip
+      breaker:
+        failures: 3
+        cooldown: 10
+      pairs:
+        - path: ggl
+          url: https://google.com
+    - type: file
+      name: file
+      path: ./maps.yaml
+`,
+	}
+	cacheConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: mem
+      name: memory
+      cache:
+        size: 100
+        ttl: 60
+        negativeTtl: 5
+    - type: mem
+      name: invalid
+      cache:
+        ttl: 60
+`,
+	}
+	raftConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: cluster
+  mappers:
+    - type: raft
+      name: cluster
+      nodeId: node1
+      raftAddress: 10.0.0.1:7000
+      apiAddress: 10.0.0.1:7001
+      dataDir: ./raft
+      applyTimeout: 1000
+      peers:
+        - id: node2
+          raftAddress: 10.0.0.2:7000
+          apiAddress: 10.0.0.2:7001
+`,
+	}
+	remoteConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: remote
+      name: central
+      protocol: grpc
+      address: golinks.example.com:8081
+      tls: true
+      token: secret
+      timeout: 500
+      cache:
+        size: 1000
+        ttl: 60
+`,
+	}
+	pluginConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: plugin
+      name: acme
+      endpoint: https://links.acme.com
+      requestTimeout: 100
+`,
+	}
+	mirrorConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: local
+  mirrors:
+    - name: central
+      mode: async
+      queueSize: 10
+  reconcileInterval: 300
+  patternRefreshInterval: 600
+  mappers:
+    - type: mem
+      name: local
+`,
+	}
+	timedConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: local
+  reaper:
+    interval: 3600
+    grace: 86400
+    archive: archive
+  checker:
+    interval: 86400
+    timeout: 5000
+    concurrency: 8
+    hostDelay: 500
+    allowPrivate: true
+  mappers:
+    - type: mem
+      name: local
+      pairs:
+        - path: offsite
+          url: https://offsite.com
+          activeFrom: 2024-01-01T09:00:00+08:00
+          expiresAt: "2024-01-31T00:00:00Z"
+    - type: mem
+      name: archive
+`,
+	}
+	namespacesConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: shared
+  namespaces:
+    - name: team-a
+      mappers: [teama, shared]
+      persistor: teama
+      members: [alice, bob]
+      private: true
+    - name: team-b
+  mappers:
+    - type: mem
+      name: teama
+    - type: mem
+      name: shared
+`,
+	}
+	unknownConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: nonexistent
+      name: nope
+`,
+	}
+	redisConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: shared
+  mappers:
+    - type: redis
+      name: shared
+      address: localhost:6379
+      password: secret
+      db: 2
+      keyPrefix: "team:"
+`,
+	}
+	pebbleConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: store
+  mappers:
+    - type: pebble
+      name: store
+      path: ./pebble
+      cacheSize: 64
+`,
+	}
+	sqlConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: sql
+      name: database
+      driver: postgres
+      dsn: host=primary
+      replicas:
+        - host=replica1
+        - host=replica2
+      table: links
+      schema: golinks
+      maxOpenConns: 20
+      maxIdleConns: 5
+      connMaxLifetime: 300
+`,
+	}
+	dirConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  mappers:
+    - type: dir
+      name: links
+      path: ./links
+      namespaces: true
+      syncInterval: 30
+`,
+	}
+	gitConfigFileContent = &tempFileConfig{
+		name: "test.yaml",
+		content: `
+mapper:
+  persistor: reviewed
+  mappers:
+    - type: git
+      name: reviewed
+      repository: ./links
+      remote: git@example.com:team/links.git
+      branch: links
+      file: maps.yaml
+      syncInterval: 30
+      readWrite: true
 `,
 	}
 	invalidConfigFileContent = &tempFileConfig{
@@ -59,6 +302,7 @@ func TestNewConfig(t *testing.T) {
 		redirectorPort string
 		crudPort       string
 		debug          bool
+		publicUrl      string
 		numMappers     int
 	}{
 		{
@@ -67,6 +311,7 @@ func TestNewConfig(t *testing.T) {
 			redirectorPort: "8080",
 			crudPort:       "8081",
 			debug:          true,
+			publicUrl:      "https://go.example.com",
 			numMappers:     1,
 		},
 		{
@@ -91,7 +336,247 @@ func TestNewConfig(t *testing.T) {
 			assert.Equal(t, tt.redirectorPort, cfg.Server.Port.Redirector)
 			assert.Equal(t, tt.crudPort, cfg.Server.Port.Crud)
 			assert.Equal(t, tt.debug, cfg.Server.Debug)
+			assert.Equal(t, tt.publicUrl, cfg.Server.PublicUrl)
 			assert.Equal(t, tt.numMappers, len(cfg.Mapper.Mappers))
+			assert.Equal(t, 0, cfg.Mapper.PatternRefreshInterval)
+			assert.Equal(t, 300, cfg.Mapper.SuggestRefreshInterval)
 		})
 	}
 }
+
+func TestNewConfig_MapperSettings(t *testing.T) {
+	tmpfile, err := createTempFile(*mapperSettingsConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cfg.Mapper.Mappers))
+	assert.Equal(t, mapper.MapperSettings{
+		RequestTimeout: 250,
+		OnError:        "skip",
+		Breaker:        mapper.BreakerSettings{Failures: 3, Cooldown: 10},
+	}, cfg.Mapper.Mappers[0].Settings)
+	assert.Equal(t, mapper.MapperSettings{}, cfg.Mapper.Mappers[1].Settings)
+}
+
+func TestNewConfig_MapperCache(t *testing.T) {
+	tmpfile, err := createTempFile(*cacheConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cfg.Mapper.Mappers))
+	cached, ok := cfg.Mapper.Mappers[0].MapperConfigurer.(*cache_mapper.CacheMapperConfigurer)
+	assert.True(t, ok)
+	assert.Equal(t, "memory", cached.GetName())
+	assert.Equal(t, mem_mapper.MemMapperConfigType, cached.GetType())
+	m, err := cached.GetMapper()
+	assert.NoError(t, err)
+	assert.IsType(t, &cache_mapper.CacheMapper{}, m)
+	// a cache without a size is rejected when the mapper is created
+	_, err = cfg.Mapper.Mappers[1].MapperConfigurer.GetMapper()
+	assert.Error(t, err)
+}
+
+func TestNewConfig_Redis(t *testing.T) {
+	tmpfile, err := createTempFile(*redisConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &redis_mapper.RedisMapperConfig{
+		Name:      "shared",
+		Address:   "localhost:6379",
+		Password:  "secret",
+		DB:        2,
+		KeyPrefix: "team:",
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Pebble(t *testing.T) {
+	tmpfile, err := createTempFile(*pebbleConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &pebble_mapper.PebbleMapperConfig{
+		Name:      "store",
+		Path:      "./pebble",
+		CacheSize: 64,
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Sql(t *testing.T) {
+	tmpfile, err := createTempFile(*sqlConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &sql_mapper.SqlMapperConfig{
+		Name:            "database",
+		Driver:          "postgres",
+		DSN:             "host=primary",
+		Replicas:        []string{"host=replica1", "host=replica2"},
+		Table:           "links",
+		Schema:          "golinks",
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 300,
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Dir(t *testing.T) {
+	tmpfile, err := createTempFile(*dirConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &dir_mapper.DirMapperConfig{
+		Name:         "links",
+		Path:         "./links",
+		Namespaces:   true,
+		SyncInterval: 30,
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Git(t *testing.T) {
+	tmpfile, err := createTempFile(*gitConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &git_mapper.GitMapperConfig{
+		Name:         "reviewed",
+		Repository:   "./links",
+		Remote:       "git@example.com:team/links.git",
+		Branch:       "links",
+		File:         "maps.yaml",
+		SyncInterval: 30,
+		ReadWrite:    true,
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Raft(t *testing.T) {
+	tmpfile, err := createTempFile(*raftConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &raft_mapper.RaftMapperConfig{
+		Name:         "cluster",
+		NodeId:       "node1",
+		RaftAddress:  "10.0.0.1:7000",
+		ApiAddress:   "10.0.0.1:7001",
+		DataDir:      "./raft",
+		ApplyTimeout: 1000,
+		Peers: []raft_mapper.RaftPeer{
+			{Id: "node2", RaftAddress: "10.0.0.2:7000", ApiAddress: "10.0.0.2:7001"},
+		},
+	}, cfg.Mapper.Mappers[0].MapperConfigurer)
+}
+
+func TestNewConfig_Remote(t *testing.T) {
+	tmpfile, err := createTempFile(*remoteConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	cached, ok := cfg.Mapper.Mappers[0].MapperConfigurer.(*cache_mapper.CacheMapperConfigurer)
+	assert.True(t, ok)
+	assert.Equal(t, remote_mapper.RemoteMapperConfigType, cached.GetType())
+	assert.Equal(t, "central", cached.GetName())
+}
+
+// pluginConfig stands for a mapper kept out of tree, registered by its own package.
+type pluginConfig struct {
+	Name     string `mapstructure:"name"`
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+func (c *pluginConfig) GetName() string                  { return c.Name }
+func (c *pluginConfig) GetType() string                  { return "PLUGIN" }
+func (c *pluginConfig) Singleton() bool                  { return false }
+func (c *pluginConfig) GetMapper() (types.Mapper, error) { return nil, nil }
+
+func TestNewConfig_RegisteredMapper(t *testing.T) {
+	mapper.Register("plugin", func() types.MapperConfigurer { return &pluginConfig{} })
+	tmpfile, err := createTempFile(*pluginConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, &pluginConfig{Name: "acme", Endpoint: "https://links.acme.com"}, cfg.Mapper.Mappers[0].MapperConfigurer)
+	assert.Equal(t, 100, cfg.Mapper.Mappers[0].Settings.RequestTimeout)
+}
+
+func TestNewConfig_Mirrors(t *testing.T) {
+	tmpfile, err := createTempFile(*mirrorConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []mapper.MirrorSettings{{Name: "central", Mode: "async", QueueSize: 10}}, cfg.Mapper.Mirrors)
+	assert.Equal(t, 300, cfg.Mapper.ReconcileInterval)
+	assert.Equal(t, 600, cfg.Mapper.PatternRefreshInterval)
+}
+
+func TestNewConfig_Namespaces(t *testing.T) {
+	tmpfile, err := createTempFile(*namespacesConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []mapper.NamespaceSettings{
+		{Name: "team-a", Mappers: []string{"teama", "shared"}, Persistor: "teama", Members: []string{"alice", "bob"}, Private: true},
+		{Name: "team-b"},
+	}, cfg.Mapper.Namespaces)
+}
+
+func TestNewConfig_Timed(t *testing.T) {
+	tmpfile, err := createTempFile(*timedConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, mapper.ReaperSettings{Interval: 3600, Grace: 86400, Archive: "archive"}, cfg.Mapper.Reaper)
+	assert.Equal(t, mapper.CheckerSettings{Interval: 86400, Timeout: 5000, Concurrency: 8, HostDelay: 500, AllowPrivate: true}, cfg.Mapper.Checker)
+	m, err := cfg.Mapper.Mappers[0].MapperConfigurer.GetMapper()
+	assert.NoError(t, err)
+	pair, err := m.GetUrl(context.Background(), "/offsite")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), *pair.ActiveFrom)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), *pair.ExpiresAt)
+}
+
+func TestNewConfig_UnknownMapper(t *testing.T) {
+	tmpfile, err := createTempFile(*unknownConfigFileContent)
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = NewConfig(tmpfile.Name())
+	assert.ErrorContains(t, err, "unknown mapper type: nonexistent")
+}
+
+func TestMapperCommonSchema(t *testing.T) {
+	names := []string{}
+	for _, field := range MapperCommonSchema() {
+		names = append(names, field.Name)
+	}
+	assert.Contains(t, names, "type")
+	assert.Contains(t, names, "onError")
+	assert.Contains(t, names, "breaker.failures")
+	assert.Contains(t, names, "cache.ttl")
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+
+	defaultWatchInterval = 5 * time.Second
+)
+
+// RegisterHttp adds the liveness and readiness probes to r, under prefix, e.g. "/d" on the redirector,
+// which the sanitizer reserves so that no link is shadowed. They must be registered before any catch-all route.
+func RegisterHttp(r *mux.Router, m *mapper.MapperManager, prefix string) {
+	r.HandleFunc(prefix+LivenessPath, handleLiveness).Methods("GET")
+	r.HandleFunc(prefix+ReadinessPath, func(rw http.ResponseWriter, r *http.Request) {
+		handleReadiness(rw, r, m)
+	}).Methods("GET")
+}
+
+// handleLiveness only tells that the process can serve requests; it does not look at mappers.
+func handleLiveness(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("ok\n"))
+}
+
+func handleReadiness(rw http.ResponseWriter, r *http.Request, m *mapper.MapperManager) {
+	report := m.Health(r.Context())
+	code := http.StatusOK
+	if !report.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(report)
+}
+
+// GrpcServer implements the standard grpc.health.v1 service on top of the manager's readiness.
+// The overall health ("") and the health of every service in services are the same.
+type GrpcServer struct {
+	healthpb.UnimplementedHealthServer
+	manager  *mapper.MapperManager
+	services map[string]bool
+	interval time.Duration
+}
+
+var _ healthpb.HealthServer = (*GrpcServer)(nil)
+
+func NewGrpcServer(m *mapper.MapperManager, services ...string) *GrpcServer {
+	known := map[string]bool{"": true}
+	for _, service := range services {
+		known[service] = true
+	}
+	return &GrpcServer{
+		manager:  m,
+		services: known,
+		interval: defaultWatchInterval,
+	}
+}
+
+func (s *GrpcServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !s.services[req.GetService()] {
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: s.status(ctx)}, nil
+}
+
+// Watch sends the serving status right away, then every time it changes.
+// Readiness is polled, so changes are seen within the watch interval.
+func (s *GrpcServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	if !s.services[req.GetService()] {
+		return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVICE_UNKNOWN})
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		if current := s.status(ctx); current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *GrpcServer) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if s.manager.Health(ctx).Ready {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	// When using it, please clone it first
+	mockConfigurer = &mapper.MockMapperConfigurer{
+		Name:         "mock",
+		StarterPairs: types.PathUrlPairMap{},
+	}
+	// When using it, please clone it first
+	failingConfigurer = &mapper.MockMapperConfigurer{
+		Name:         "failing",
+		StarterPairs: types.PathUrlPairMap{},
+		Err:          assert.AnError,
+	}
+)
+
+func newManager(t *testing.T, configurers ...*mapper.MockMapperConfigurer) *mapper.MapperManager {
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers(configurers))
+	assert.NoError(t, err)
+	return mm
+}
+
+func TestRegisterHttp(t *testing.T) {
+	tests := []struct {
+		name         string
+		configurers  []*mapper.MockMapperConfigurer
+		shuttingDown bool
+		path         string
+		wantStatus   int
+		wantReady    bool
+	}{
+		{name: "liveness", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, path: LivenessPath, wantStatus: http.StatusOK},
+		{name: "liveness ignores mappers", configurers: []*mapper.MockMapperConfigurer{mockConfigurer, failingConfigurer}, path: LivenessPath, wantStatus: http.StatusOK},
+		{name: "liveness while shutting down", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, shuttingDown: true, path: LivenessPath, wantStatus: http.StatusOK},
+		{name: "ready", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, path: ReadinessPath, wantStatus: http.StatusOK, wantReady: true},
+		{name: "not ready with unhealthy mapper", configurers: []*mapper.MockMapperConfigurer{mockConfigurer, failingConfigurer}, path: ReadinessPath, wantStatus: http.StatusServiceUnavailable},
+		{name: "not ready while shutting down", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, shuttingDown: true, path: ReadinessPath, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mm := newManager(t, test.configurers...)
+			if test.shuttingDown {
+				mm.BeginShutdown()
+			}
+			r := mux.NewRouter()
+			RegisterHttp(r, mm, "")
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+			assert.Equal(t, test.wantStatus, rr.Code)
+			if test.path == ReadinessPath {
+				var report mapper.HealthReport
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+				assert.Equal(t, test.wantReady, report.Ready)
+				assert.Equal(t, test.shuttingDown, report.ShuttingDown)
+				assert.Equal(t, len(test.configurers), len(report.Mappers))
+			}
+		})
+	}
+}
+
+func TestGrpcServer_Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		configurers []*mapper.MockMapperConfigurer
+		service     string
+		want        healthpb.HealthCheckResponse_ServingStatus
+		wantCode    codes.Code
+	}{
+		{name: "overall serving", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, want: healthpb.HealthCheckResponse_SERVING},
+		{name: "service serving", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, service: "pb.Golinks", want: healthpb.HealthCheckResponse_SERVING},
+		{name: "not serving", configurers: []*mapper.MockMapperConfigurer{mockConfigurer, failingConfigurer}, service: "pb.Golinks", want: healthpb.HealthCheckResponse_NOT_SERVING},
+		{name: "unknown service", configurers: []*mapper.MockMapperConfigurer{mockConfigurer}, service: "invalid", wantCode: codes.NotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewGrpcServer(newManager(t, test.configurers...), "pb.Golinks")
+			resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: test.service})
+			if test.wantCode != codes.OK {
+				assert.Equal(t, test.wantCode, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, resp.Status)
+		})
+	}
+}
+
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan healthpb.HealthCheckResponse_ServingStatus
+}
+
+func (s *fakeWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchStream) Send(resp *healthpb.HealthCheckResponse) error {
+	s.sent <- resp.Status
+	return nil
+}
+
+func TestGrpcServer_Watch(t *testing.T) {
+	mm := newManager(t, mockConfigurer)
+	server := NewGrpcServer(mm)
+	server.interval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeWatchStream{ctx: ctx, sent: make(chan healthpb.HealthCheckResponse_ServingStatus, 10)}
+
+	done := make(chan error)
+	go func() {
+		done <- server.Watch(&healthpb.HealthCheckRequest{}, stream)
+	}()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, <-stream.sent)
+	mm.BeginShutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, <-stream.sent)
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-done))
+	assert.Empty(t, stream.sent)
+}
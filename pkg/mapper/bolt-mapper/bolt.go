@@ -1,6 +1,7 @@
 package bolt_mapper
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/boltdb/bolt"
@@ -13,7 +14,13 @@ func (b *BoltMapper) initializeBucket(name string) error {
 	})
 }
 
-func (b *BoltMapper) get(bucketName string, key string) ([]byte, error) {
+// bolt has no notion of contexts, so the helpers below check for cancellation
+// before opening a transaction, and between items when iterating.
+
+func (b *BoltMapper) get(ctx context.Context, bucketName string, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var value []byte
 	err := b.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
@@ -29,7 +36,10 @@ func (b *BoltMapper) get(bucketName string, key string) ([]byte, error) {
 	return value, nil
 }
 
-func (b *BoltMapper) put(bucketName string, key string, value []byte) error {
+func (b *BoltMapper) put(ctx context.Context, bucketName string, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err := b.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
@@ -43,7 +53,10 @@ func (b *BoltMapper) put(bucketName string, key string, value []byte) error {
 	return nil
 }
 
-func (b *BoltMapper) delete(bucketName string, key string) error {
+func (b *BoltMapper) delete(ctx context.Context, bucketName string, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err := b.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
@@ -57,27 +70,42 @@ func (b *BoltMapper) delete(bucketName string, key string) error {
 	return nil
 }
 
-func (b *BoltMapper) foreach(bucketName string, action func(key string, value []byte) error) error {
+func (b *BoltMapper) foreach(ctx context.Context, bucketName string, action func(key string, value []byte) error) error {
 	err := b.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
 			return fmt.Errorf("bucket not found: %s", bucketName)
 		}
 		return b.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			return action(string(k), v)
 		})
 	})
 	return err
 }
 
-func (b *BoltMapper) forsome(bucketName string, action func(key string, value []byte) error, limit int) error {
+// forsome calls action on up to limit items in key order, starting right after the key after,
+// or from the first key if after is empty.
+func (b *BoltMapper) forsome(ctx context.Context, bucketName string, after string, action func(key string, value []byte) error, limit int) error {
 	err := b.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
 			return fmt.Errorf("bucket not found: %s", bucketName)
 		}
 		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+		k, v := c.First()
+		if after != "" {
+			k, v = c.Seek([]byte(after))
+			if k != nil && string(k) == after {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if err := action(string(k), v); err != nil {
 				return err
 			}
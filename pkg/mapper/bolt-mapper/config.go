@@ -5,16 +5,23 @@ import (
 
 	"github.com/boltdb/bolt"
 
+	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
 const (
 	BoltMapperConfigType = "BOLT"
 	urlMapBucketName     = "urlMap"
+	aliasBucketName      = "aliases"    // alias -> path
+	linkCheckBucketName  = "linkChecks" // path -> last check of its urls
 )
 
 var _ types.MapperConfigurer = (*BoltMapperConfig)(nil)
 
+func init() {
+	mapper.Register(BoltMapperConfigType, func() types.MapperConfigurer { return &BoltMapperConfig{} })
+}
+
 type BoltMapperConfig struct {
 	Name    string `mapstructure:"name"`
 	Path    string `mapstructure:"path"`
@@ -44,9 +51,11 @@ func (b *BoltMapperConfig) GetMapper() (types.Mapper, error) {
 		name: b.Name,
 		db:   db,
 	}
-	err = mapper.initializeBucket(urlMapBucketName)
-	if err != nil {
-		return nil, err
+	for _, bucket := range []string{urlMapBucketName, aliasBucketName, linkCheckBucketName} {
+		err = mapper.initializeBucket(bucket)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &mapper, nil
 }
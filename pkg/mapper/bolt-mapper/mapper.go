@@ -1,14 +1,20 @@
 package bolt_mapper
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/boltdb/bolt"
 
 	"github.com/reimirno/golinks/pkg/types"
 )
 
-var _ types.Mapper = (*BoltMapper)(nil)
+var (
+	_ types.Mapper           = (*BoltMapper)(nil)
+	_ types.MapperPinger     = (*BoltMapper)(nil)
+	_ types.MapperLinkChecks = (*BoltMapper)(nil)
+)
 
 type BoltMapper struct {
 	name string
@@ -19,6 +25,16 @@ func (b *BoltMapper) Teardown() error {
 	return b.db.Close() // removes file lock
 }
 
+// Ping fails once the database is closed.
+func (b *BoltMapper) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
 func (b *BoltMapper) GetName() string {
 	return b.name
 }
@@ -27,13 +43,20 @@ func (b *BoltMapper) GetType() string {
 	return BoltMapperConfigType
 }
 
-func (b *BoltMapper) GetUrl(path string) (*types.PathUrlPair, error) {
-	bytes, err := b.get(urlMapBucketName, path)
+func (b *BoltMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	bytes, err := b.get(ctx, urlMapBucketName, path)
 	if err != nil {
 		return nil, err
 	}
 	if bytes == nil {
-		return nil, nil
+		owner, err := b.get(ctx, aliasBucketName, path)
+		if err != nil || owner == nil {
+			return nil, err
+		}
+		// the pair may have been deleted in the meantime
+		if bytes, err = b.get(ctx, urlMapBucketName, string(owner)); err != nil || bytes == nil {
+			return nil, err
+		}
 	}
 	var pair types.PathUrlPair
 	err = json.Unmarshal(bytes, &pair)
@@ -43,10 +66,18 @@ func (b *BoltMapper) GetUrl(path string) (*types.PathUrlPair, error) {
 	return &pair, nil
 }
 
-func (b *BoltMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
+// ListUrls seeks straight to the cursor if there is one. An offset has to step over every skipped pair.
+func (b *BoltMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	after, err := pagination.After()
+	if err != nil {
+		return nil, err
+	}
+	if after != "" {
+		pagination.Offset = 0
+	}
 	var pairs types.PathUrlPairList
 	curIdx := 0
-	err := b.forsome(urlMapBucketName, func(key string, value []byte) error {
+	err = b.forsome(ctx, urlMapBucketName, after, func(key string, value []byte) error {
 		if curIdx < pagination.Offset {
 			curIdx++
 			return nil
@@ -66,18 +97,138 @@ func (b *BoltMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairLis
 	return pairs, nil
 }
 
-func (b *BoltMapper) DeleteUrl(path string) error {
-	return b.delete(urlMapBucketName, path)
+// DeleteUrl deletes the pair at path along with its aliases, in one transaction.
+func (b *BoltMapper) DeleteUrl(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		pairs, aliases, err := buckets(tx)
+		if err != nil {
+			return err
+		}
+		if err := unindexAliases(pairs, aliases, path); err != nil {
+			return err
+		}
+		return pairs.Delete([]byte(path))
+	})
 }
 
-func (b *BoltMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+// PutUrl puts pair, and replaces the aliases of the pair it replaces with its own, in one transaction.
+func (b *BoltMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
 	bytes, err := json.Marshal(pair)
 	if err != nil {
 		return nil, err
 	}
-	return pair, b.put(urlMapBucketName, pair.Path, bytes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		pairs, aliases, err := buckets(tx)
+		if err != nil {
+			return err
+		}
+		if err := unindexAliases(pairs, aliases, pair.Path); err != nil {
+			return err
+		}
+		for _, alias := range pair.Aliases {
+			if err := aliases.Put([]byte(alias), []byte(pair.Path)); err != nil {
+				return err
+			}
+		}
+		return pairs.Put([]byte(pair.Path), bytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func buckets(tx *bolt.Tx) (pairs *bolt.Bucket, aliases *bolt.Bucket, err error) {
+	for name, bucket := range map[string]**bolt.Bucket{urlMapBucketName: &pairs, aliasBucketName: &aliases} {
+		if *bucket = tx.Bucket([]byte(name)); *bucket == nil {
+			return nil, nil, fmt.Errorf("bucket not found: %s", name)
+		}
+	}
+	return pairs, aliases, nil
+}
+
+// unindexAliases drops the aliases of the pair stored at path, if any.
+func unindexAliases(pairs *bolt.Bucket, aliases *bolt.Bucket, path string) error {
+	bytes := pairs.Get([]byte(path))
+	if bytes == nil {
+		return nil
+	}
+	var old types.PathUrlPair
+	if err := json.Unmarshal(bytes, &old); err != nil {
+		return err
+	}
+	for _, alias := range old.Aliases {
+		if err := aliases.Delete([]byte(alias)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *BoltMapper) Readonly() bool {
 	return false
 }
+
+// PutLinkChecks puts checks in one transaction.
+func (b *BoltMapper) PutLinkChecks(ctx context.Context, checks []types.LinkCheck) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(linkCheckBucketName))
+		if bucket == nil {
+			return fmt.Errorf("bucket not found: %s", linkCheckBucketName)
+		}
+		for _, check := range checks {
+			bytes, err := json.Marshal(check)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(check.Path), bytes); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltMapper) ListLinkChecks(ctx context.Context) ([]types.LinkCheck, error) {
+	var checks []types.LinkCheck
+	err := b.foreach(ctx, linkCheckBucketName, func(key string, value []byte) error {
+		var check types.LinkCheck
+		if err := json.Unmarshal(value, &check); err != nil {
+			return fmt.Errorf("invalid link check of %s: %w", key, err)
+		}
+		checks = append(checks, check)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// DeleteLinkChecks deletes the checks of paths in one transaction.
+func (b *BoltMapper) DeleteLinkChecks(ctx context.Context, paths ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(linkCheckBucketName))
+		if bucket == nil {
+			return fmt.Errorf("bucket not found: %s", linkCheckBucketName)
+		}
+		for _, path := range paths {
+			if err := bucket.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.True(t, b.Allow(), "below threshold should stay closed")
+	assert.False(t, b.Open())
+	b.Failure()
+	assert.True(t, b.Open())
+	assert.False(t, b.Allow(), "open breaker should reject calls")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow(), "a trial call is allowed after cooldown")
+	assert.False(t, b.Allow(), "only one trial call at a time")
+	b.Failure()
+	assert.False(t, b.Allow(), "failed trial re-opens the breaker")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.False(t, b.Open())
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	assert.True(t, b.Allow())
+	assert.False(t, b.Open())
+}
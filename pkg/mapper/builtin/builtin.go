@@ -0,0 +1,15 @@
+// Package builtin registers the mappers that ship with golinks. Import it for its side effects.
+package builtin
+
+import (
+	_ "github.com/reimirno/golinks/pkg/mapper/bolt-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/dir-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/file-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/git-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/mem-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/pebble-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/raft-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/redis-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/remote-mapper"
+	_ "github.com/reimirno/golinks/pkg/mapper/sql-mapper"
+)
@@ -0,0 +1,55 @@
+package cache_mapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var _ types.MapperConfigurer = (*CacheMapperConfigurer)(nil)
+
+// CacheConfig is not a mapper type of its own.
+// It is set under the `cache` key of any mapper to put a cache in front of it.
+type CacheConfig struct {
+	Size        int `mapstructure:"size"`        // maximum number of cached paths
+	TTL         int `mapstructure:"ttl"`         // in seconds
+	NegativeTTL int `mapstructure:"negativeTtl"` // in seconds; 0 disables caching of misses
+}
+
+// CacheMapperConfigurer wraps the configurer of another mapper,
+// and decorates the mapper it creates with a cache.
+type CacheMapperConfigurer struct {
+	inner types.MapperConfigurer
+	cfg   CacheConfig
+}
+
+func NewConfigurer(inner types.MapperConfigurer, cfg CacheConfig) *CacheMapperConfigurer {
+	return &CacheMapperConfigurer{inner: inner, cfg: cfg}
+}
+
+func (c *CacheMapperConfigurer) GetName() string {
+	return c.inner.GetName()
+}
+
+func (c *CacheMapperConfigurer) GetType() string {
+	return c.inner.GetType()
+}
+
+func (c *CacheMapperConfigurer) Singleton() bool {
+	return c.inner.Singleton()
+}
+
+func (c *CacheMapperConfigurer) GetMapper() (types.Mapper, error) {
+	if c.cfg.Size <= 0 || c.cfg.TTL <= 0 {
+		return nil, fmt.Errorf("cache of mapper %s needs a positive size and ttl", c.inner.GetName())
+	}
+	if c.cfg.NegativeTTL < 0 {
+		return nil, fmt.Errorf("cache of mapper %s has a negative negativeTtl", c.inner.GetName())
+	}
+	inner, err := c.inner.GetMapper()
+	if err != nil {
+		return nil, err
+	}
+	return NewCacheMapper(inner, c.cfg.Size, time.Duration(c.cfg.TTL)*time.Second, time.Duration(c.cfg.NegativeTTL)*time.Second), nil
+}
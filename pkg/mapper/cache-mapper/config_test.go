@@ -0,0 +1,45 @@
+package cache_mapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func TestCacheMapperConfigurer_GetMapper(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CacheConfig
+		wantErr bool
+	}{
+		{name: "happy path", cfg: CacheConfig{Size: 10, TTL: 60, NegativeTTL: 5}},
+		{name: "no negative caching", cfg: CacheConfig{Size: 10, TTL: 60}},
+		{name: "no size", cfg: CacheConfig{TTL: 60}, wantErr: true},
+		{name: "no ttl", cfg: CacheConfig{Size: 10}, wantErr: true},
+		{name: "negative negativeTtl", cfg: CacheConfig{Size: 10, TTL: 60, NegativeTTL: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &mapper.MockMapperConfigurer{Name: "mock", IsSingleton: true, StarterPairs: types.PathUrlPairMap{}}
+			configurer := NewConfigurer(inner, tt.cfg)
+			assert.Equal(t, "mock", configurer.GetName())
+			assert.Equal(t, inner.GetType(), configurer.GetType())
+			assert.True(t, configurer.Singleton())
+
+			m, err := configurer.GetMapper()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, &CacheMapper{}, m)
+			assert.Equal(t, "mock", m.GetName())
+			assert.Implements(t, (*types.MapperCache)(nil), m)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cache_mapper
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// lru is a fixed-size least-recently-used cache of paths.
+// A nil pair records a miss. It is not safe for concurrent use.
+type lru struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // front is most recently used
+}
+
+type entry struct {
+	path      string
+	pair      *types.PathUrlPair
+	expiresAt time.Time
+}
+
+func newLru(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the entry for path if it has not expired yet.
+func (c *lru) get(path string, now time.Time) (*entry, bool) {
+	el, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expiresAt) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+// add inserts or replaces the entry for path, and tells whether another entry was evicted to make room.
+func (c *lru) add(path string, pair *types.PathUrlPair, expiresAt time.Time) bool {
+	if el, ok := c.items[path]; ok {
+		el.Value = &entry{path: path, pair: pair, expiresAt: expiresAt}
+		c.order.MoveToFront(el)
+		return false
+	}
+	c.items[path] = c.order.PushFront(&entry{path: path, pair: pair, expiresAt: expiresAt})
+	if c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		return true
+	}
+	return false
+}
+
+func (c *lru) remove(path string) {
+	if el, ok := c.items[path]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry).path)
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
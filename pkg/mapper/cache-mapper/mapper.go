@@ -0,0 +1,286 @@
+package cache_mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reimirno/golinks/pkg/tracing"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	_ types.Mapper              = (*CacheMapper)(nil)
+	_ types.MapperCache         = (*CacheMapper)(nil)
+	_ types.MapperPinger        = (*CacheMapper)(nil)
+	_ types.MapperCounter       = (*CacheMapper)(nil)
+	_ types.MapperTargetCounter = (*CacheMapper)(nil)
+	_ types.MapperHistory       = (*CacheMapper)(nil)
+	_ types.MapperLinkChecks    = (*CacheMapper)(nil)
+	_ types.MapperReloader      = (*CacheMapper)(nil)
+)
+
+// CacheMapper is a read-through cache in front of another mapper.
+// Lookups are answered from the cache until they expire; misses can be cached too, for a separate duration.
+// Writes go to the inner mapper and update the cache on success.
+// Listing is not cached, and is always passed on to the inner mapper.
+type CacheMapper struct {
+	inner       types.Mapper
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	cache *lru
+	stats types.CacheStats
+	// generation counts the writes and invalidations, so that a lookup of the inner mapper that one of them overtook
+	// does not bring back what the latter replaced
+	generation uint64
+}
+
+func NewCacheMapper(inner types.Mapper, size int, ttl time.Duration, negativeTTL time.Duration) *CacheMapper {
+	return &CacheMapper{
+		inner:       inner,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		cache:       newLru(size),
+	}
+}
+
+func (c *CacheMapper) GetName() string {
+	return c.inner.GetName()
+}
+
+func (c *CacheMapper) GetType() string {
+	return c.inner.GetType()
+}
+
+func (c *CacheMapper) Readonly() bool {
+	return c.inner.Readonly()
+}
+
+func (c *CacheMapper) Teardown() error {
+	return c.inner.Teardown()
+}
+
+// Ping reports the health of the inner mapper.
+func (c *CacheMapper) Ping(ctx context.Context) error {
+	if pinger, ok := c.inner.(types.MapperPinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// OnReload passes on to the inner mapper, if it reloads its pairs; hook is never called otherwise.
+func (c *CacheMapper) OnReload(hook func()) {
+	if reloader, ok := c.inner.(types.MapperReloader); ok {
+		reloader.OnReload(hook)
+	}
+}
+
+// History passes on to the inner mapper, if it keeps a history.
+func (c *CacheMapper) History(ctx context.Context, path string, limit int) ([]types.HistoryEntry, error) {
+	if history, ok := c.inner.(types.MapperHistory); ok {
+		return history.History(ctx, path, limit)
+	}
+	return nil, nil
+}
+
+// linkChecks returns the inner mapper, if it keeps the checks of links.
+func (c *CacheMapper) linkChecks() (types.MapperLinkChecks, error) {
+	if checks, ok := c.inner.(types.MapperLinkChecks); ok {
+		return checks, nil
+	}
+	return nil, fmt.Errorf("%w: %s does not keep link checks", errors.ErrUnsupported, c.inner.GetName())
+}
+
+// PutLinkChecks passes on to the inner mapper; checks are not cached.
+func (c *CacheMapper) PutLinkChecks(ctx context.Context, checks []types.LinkCheck) error {
+	inner, err := c.linkChecks()
+	if err != nil {
+		return err
+	}
+	return inner.PutLinkChecks(ctx, checks)
+}
+
+func (c *CacheMapper) ListLinkChecks(ctx context.Context) ([]types.LinkCheck, error) {
+	inner, err := c.linkChecks()
+	if err != nil {
+		return nil, err
+	}
+	return inner.ListLinkChecks(ctx)
+}
+
+func (c *CacheMapper) DeleteLinkChecks(ctx context.Context, paths ...string) error {
+	inner, err := c.linkChecks()
+	if err != nil {
+		return err
+	}
+	return inner.DeleteLinkChecks(ctx, paths...)
+}
+
+func (c *CacheMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	span := trace.SpanFromContext(ctx)
+	c.mu.Lock()
+	e, ok := c.cache.get(path, c.now())
+	if ok {
+		if e.pair == nil {
+			c.stats.NegativeHits++
+		} else {
+			c.stats.Hits++
+		}
+		c.mu.Unlock()
+		span.SetAttributes(tracing.AttrCacheHit.Bool(true))
+		return clone(e.pair), nil
+	}
+	c.stats.Misses++
+	generation := c.generation
+	c.mu.Unlock()
+	span.SetAttributes(tracing.AttrCacheHit.Bool(false))
+
+	pair, err := c.inner.GetUrl(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if pair != nil {
+		c.fill(path, pair, c.ttl, generation)
+	} else if c.negativeTTL > 0 {
+		c.fill(path, nil, c.negativeTTL, generation)
+	}
+	return pair, nil
+}
+
+func (c *CacheMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	return c.inner.ListUrls(ctx, pagination)
+}
+
+// PutUrl drops the aliases of the pair from the cache, as they may have been cached as misses.
+// The aliases the pair no longer has are left to expire, or to be invalidated by the caller.
+func (c *CacheMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	path, aliases := pair.Path, slices.Clone(pair.Aliases)
+	put, err := c.inner.PutUrl(ctx, pair)
+	for _, alias := range aliases {
+		c.Invalidate(alias)
+	}
+	if err != nil {
+		c.Invalidate(path)
+		return nil, err
+	}
+	c.store(put.Path, put, c.ttl)
+	return put, nil
+}
+
+func (c *CacheMapper) DeleteUrl(ctx context.Context, path string) error {
+	err := c.inner.DeleteUrl(ctx, path)
+	c.Invalidate(path)
+	return err
+}
+
+// IncrementUseCount keeps the atomic increment of the inner mapper if it has one.
+// Otherwise, it reads the pair from the inner mapper and writes it back.
+func (c *CacheMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	if counter, ok := c.inner.(types.MapperCounter); ok {
+		count, err := counter.IncrementUseCount(ctx, path)
+		c.Invalidate(path)
+		return count, err
+	}
+	pair, err := c.inner.GetUrl(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		c.Invalidate(path)
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	pair.UseCount++
+	pair, err = c.PutUrl(ctx, pair)
+	if err != nil {
+		return 0, err
+	}
+	return pair.UseCount, nil
+}
+
+// IncrementTargetUseCount keeps the atomic increment of the inner mapper if it has one.
+// An inner mapper that counts pairs atomically, but not targets, does not count targets, as with the manager.
+// Otherwise, it reads the pair from the inner mapper and writes it back.
+func (c *CacheMapper) IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error) {
+	if counter, ok := c.inner.(types.MapperTargetCounter); ok {
+		count, err := counter.IncrementTargetUseCount(ctx, path, url)
+		c.Invalidate(path)
+		return count, err
+	}
+	pair, err := c.inner.GetUrl(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		c.Invalidate(path)
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	i := slices.IndexFunc(pair.Targets, func(target types.WeightedTarget) bool { return target.Url == url })
+	if i < 0 {
+		return 0, fmt.Errorf("path %s has no target %s", path, url)
+	}
+	if _, ok := c.inner.(types.MapperCounter); ok {
+		return pair.Targets[i].UseCount, nil
+	}
+	pair.Targets[i].UseCount++
+	pair, err = c.PutUrl(ctx, pair)
+	if err != nil {
+		return 0, err
+	}
+	return pair.Targets[i].UseCount, nil
+}
+
+func (c *CacheMapper) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache.remove(path)
+}
+
+func (c *CacheMapper) CacheStats() types.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.cache.len()
+	return stats
+}
+
+// store caches the pair just written to path.
+func (c *CacheMapper) store(path string, pair *types.PathUrlPair, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.add(path, pair, ttl)
+}
+
+// fill caches the pair looked up at path, unless something was written or invalidated since generation:
+// the lookup may have read what was there before.
+func (c *CacheMapper) fill(path string, pair *types.PathUrlPair, ttl time.Duration, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	c.add(path, pair, ttl)
+}
+
+func (c *CacheMapper) add(path string, pair *types.PathUrlPair, ttl time.Duration) {
+	if c.cache.add(path, clone(pair), c.now().Add(ttl)) {
+		c.stats.Evictions++
+	}
+}
+
+func clone(pair *types.PathUrlPair) *types.PathUrlPair {
+	if pair == nil {
+		return nil
+	}
+	return pair.Clone()
+}
@@ -0,0 +1,332 @@
+package cache_mapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "fk",
+		Url:  "https://fake.com",
+	}
+	fakePair2 = &types.PathUrlPair{
+		Path: "fk2",
+		Url:  "https://fake2.com",
+	}
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCache(size int, ttl time.Duration, negativeTTL time.Duration) (*CacheMapper, *mapper.MockMapper, *fakeClock) {
+	inner := &mapper.MockMapper{
+		Name:  "mock",
+		Pairs: types.PathUrlPairMap{"fk": fakePair.Clone(), "fk2": fakePair2.Clone()},
+	}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewCacheMapper(inner, size, ttl, negativeTTL)
+	c.now = clock.Now
+	return c, inner, clock
+}
+
+func TestCacheMapper_GetUrl(t *testing.T) {
+	ctx := context.Background()
+	c, inner, clock := newTestCache(10, time.Minute, 0)
+
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+
+	// served from the cache, even though the inner mapper changed
+	inner.Pairs["fk"] = &types.PathUrlPair{Path: "fk", Url: "https://changed.com"}
+	got, err = c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+
+	// callers get their own copy
+	got.Url = "https://mutated.com"
+	got, err = c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+
+	// expired
+	clock.now = clock.now.Add(time.Minute)
+	got, err = c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://changed.com", got.Url)
+
+	assert.Equal(t, types.CacheStats{Hits: 2, Misses: 2, Size: 1}, c.CacheStats())
+}
+
+func TestCacheMapper_NegativeCaching(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		wantCached  bool
+	}{
+		{name: "disabled", negativeTTL: 0, wantCached: false},
+		{name: "enabled", negativeTTL: time.Second, wantCached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, inner, clock := newTestCache(10, time.Minute, tt.negativeTTL)
+
+			got, err := c.GetUrl(ctx, "new")
+			assert.NoError(t, err)
+			assert.Nil(t, got)
+
+			inner.Pairs["new"] = &types.PathUrlPair{Path: "new", Url: "https://new.com"}
+			got, err = c.GetUrl(ctx, "new")
+			assert.NoError(t, err)
+			if tt.wantCached {
+				assert.Nil(t, got)
+				assert.Equal(t, int64(1), c.CacheStats().NegativeHits)
+			} else {
+				assert.NotNil(t, got)
+			}
+
+			// misses expire sooner than hits
+			clock.now = clock.now.Add(tt.negativeTTL)
+			got, err = c.GetUrl(ctx, "new")
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestCacheMapper_Eviction(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(1, time.Minute, 0)
+
+	_, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	_, err = c.GetUrl(ctx, "fk2")
+	assert.NoError(t, err)
+
+	inner.Pairs["fk"] = &types.PathUrlPair{Path: "fk", Url: "https://changed.com"}
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://changed.com", got.Url)
+	assert.Equal(t, types.CacheStats{Misses: 3, Evictions: 2, Size: 1}, c.CacheStats())
+}
+
+func TestCacheMapper_Writes(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, time.Minute)
+
+	_, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	_, err = c.GetUrl(ctx, "new")
+	assert.NoError(t, err)
+
+	// puts replace cached pairs and misses
+	_, err = c.PutUrl(ctx, &types.PathUrlPair{Path: "fk", Url: "https://changed.com"})
+	assert.NoError(t, err)
+	_, err = c.PutUrl(ctx, &types.PathUrlPair{Path: "new", Url: "https://new.com"})
+	assert.NoError(t, err)
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://changed.com", got.Url)
+	got, err = c.GetUrl(ctx, "new")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://new.com", got.Url)
+
+	// and the misses of their aliases
+	_, err = c.GetUrl(ctx, "k8s")
+	assert.NoError(t, err)
+	_, err = c.PutUrl(ctx, &types.PathUrlPair{Path: "kubernetes", Url: "https://kubernetes.io", Aliases: []string{"k8s"}})
+	assert.NoError(t, err)
+	got, err = c.GetUrl(ctx, "k8s")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://kubernetes.io", got.Url)
+
+	// deletes drop them
+	assert.NoError(t, c.DeleteUrl(ctx, "fk"))
+	got, err = c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	// failed writes drop them too, since we cannot tell what the inner mapper holds
+	inner.Err = assert.AnError
+	_, err = c.PutUrl(ctx, &types.PathUrlPair{Path: "new", Url: "https://failed.com"})
+	assert.ErrorIs(t, err, assert.AnError)
+	inner.Err = nil
+	inner.Pairs["new"].Url = "https://external.com"
+	got, err = c.GetUrl(ctx, "new")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://external.com", got.Url)
+}
+
+func TestCacheMapper_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, 0)
+
+	_, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	inner.Pairs["fk"] = &types.PathUrlPair{Path: "fk", Url: "https://changed.com"}
+	c.Invalidate("fk")
+	c.Invalidate("unknown")
+
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://changed.com", got.Url)
+	assert.Equal(t, 1, c.CacheStats().Size)
+}
+
+// slowMapper holds every lookup after reading the pair, until release is closed.
+type slowMapper struct {
+	*mapper.MockMapper
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	pair, err := s.MockMapper.GetUrl(ctx, path)
+	s.read <- struct{}{}
+	<-s.release
+	return pair, err
+}
+
+func TestCacheMapper_SlowLookup(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		write func(c *CacheMapper, inner *mapper.MockMapper)
+		want  *types.PathUrlPair
+	}{
+		{
+			name: "put",
+			write: func(c *CacheMapper, inner *mapper.MockMapper) {
+				_, err := c.PutUrl(ctx, &types.PathUrlPair{Path: "fk", Url: "https://changed.com"})
+				assert.NoError(t, err)
+			},
+			want: &types.PathUrlPair{Path: "fk", Url: "https://changed.com"},
+		},
+		{
+			name: "delete",
+			write: func(c *CacheMapper, inner *mapper.MockMapper) {
+				assert.NoError(t, c.DeleteUrl(ctx, "fk"))
+			},
+		},
+		{
+			name: "invalidate",
+			write: func(c *CacheMapper, inner *mapper.MockMapper) {
+				inner.Pairs["fk"] = &types.PathUrlPair{Path: "fk", Url: "https://changed.com"}
+				c.Invalidate("fk")
+			},
+			want: &types.PathUrlPair{Path: "fk", Url: "https://changed.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, inner, _ := newTestCache(10, time.Minute, time.Minute)
+			slow := &slowMapper{MockMapper: inner, read: make(chan struct{}, 10), release: make(chan struct{})}
+			c := NewCacheMapper(slow, 10, time.Minute, time.Minute)
+
+			// a lookup reads the pair, then is overtaken by a write
+			done := make(chan *types.PathUrlPair)
+			go func() {
+				pair, err := c.GetUrl(ctx, "fk")
+				assert.NoError(t, err)
+				done <- pair
+			}()
+			<-slow.read
+			test.write(c, inner)
+			close(slow.release)
+			assert.Equal(t, fakePair.Url, (<-done).Url)
+
+			// what the lookup read is not cached over the write
+			got, err := c.GetUrl(ctx, "fk")
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestCacheMapper_Errors(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, time.Minute)
+
+	inner.Err = assert.AnError
+	_, err := c.GetUrl(ctx, "fk")
+	assert.ErrorIs(t, err, assert.AnError)
+
+	// errors are not cached as misses
+	inner.Err = nil
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+}
+
+func TestCacheMapper_IncrementUseCount(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, time.Minute)
+
+	_, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	count, err := c.IncrementUseCount(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, inner.Pairs["fk"].UseCount)
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got.UseCount)
+
+	_, err = c.IncrementUseCount(ctx, "invalid")
+	assert.Error(t, err)
+}
+
+func TestCacheMapper_IncrementTargetUseCount(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, time.Minute)
+	inner.Pairs["fk"].Targets = []types.WeightedTarget{{Url: "https://a.com", Weight: 1}}
+
+	_, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	count, err := c.IncrementTargetUseCount(ctx, "fk", "https://a.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, inner.Pairs["fk"].Targets[0].UseCount)
+	got, err := c.GetUrl(ctx, "fk")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got.Targets[0].UseCount)
+
+	_, err = c.IncrementTargetUseCount(ctx, "fk", "https://b.com")
+	assert.Error(t, err)
+	_, err = c.IncrementTargetUseCount(ctx, "invalid", "https://a.com")
+	assert.Error(t, err)
+}
+
+func TestCacheMapper_LinkChecks(t *testing.T) {
+	ctx := context.Background()
+	c, inner, _ := newTestCache(10, time.Minute, time.Minute)
+
+	assert.NoError(t, c.PutLinkChecks(ctx, []types.LinkCheck{{Path: "fk", Status: types.LinkStatusOk}, {Path: "fk2", Status: types.LinkStatusOk}}))
+	assert.Len(t, inner.Checks, 2)
+	assert.NoError(t, c.DeleteLinkChecks(ctx, "fk"))
+	checks, err := c.ListLinkChecks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.LinkCheck{{Path: "fk2", Status: types.LinkStatusOk}}, checks)
+
+	// the inner mapper does not keep them
+	c = NewCacheMapper(struct{ types.Mapper }{inner}, 10, time.Minute, time.Minute)
+	_, err = c.ListLinkChecks(ctx)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	assert.ErrorIs(t, c.PutLinkChecks(ctx, nil), errors.ErrUnsupported)
+}
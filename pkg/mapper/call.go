@@ -0,0 +1,282 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/tracing"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// The helpers below are the only place where the manager calls into an individual mapper.
+// Every call gets its own span, so that a slow backend shows up as a distinct child of the manager operation,
+// is bounded by the mapper's request timeout if one is configured,
+// and goes through the mapper's circuit breaker.
+
+func (m *MapperManager) startMapperSpan(ctx context.Context, operation string, mapper types.Mapper, attrs ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts := append([]trace.SpanStartOption{
+		trace.WithAttributes(
+			tracing.AttrMapperName.String(mapper.GetName()),
+			tracing.AttrMapperType.String(mapper.GetType()),
+		),
+	}, attrs...)
+	return m.tracer.Start(ctx, "Mapper."+operation, opts...)
+}
+
+func (m *MapperManager) withMapperTimeout(ctx context.Context, mapper types.Mapper) (context.Context, context.CancelFunc) {
+	timeout := m.state(mapper).settings.RequestTimeout
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+}
+
+func (m *MapperManager) allow(mapper types.Mapper) error {
+	if !m.state(mapper).breaker.Allow() {
+		return ErrCircuitOpen(mapper.GetName())
+	}
+	return nil
+}
+
+// record feeds the outcome of a call to the mapper's circuit breaker.
+// A call interrupted because the caller gave up says nothing about the mapper's health.
+func (m *MapperManager) record(ctx context.Context, mapper types.Mapper, err error) {
+	breaker := m.state(mapper).breaker
+	switch {
+	case err == nil:
+		breaker.Success()
+	case ctx.Err() != nil:
+	default:
+		if breaker.Failure(); breaker.Open() {
+			m.logger.Warnf("Circuit breaker open for mapper %s: %v", mapper.GetName(), err)
+		}
+	}
+}
+
+func (m *MapperManager) getFromMapper(ctx context.Context, mapper types.Mapper, path string) (*types.PathUrlPair, error) {
+	ctx, span := m.startMapperSpan(ctx, "GetUrl", mapper, trace.WithAttributes(tracing.AttrCanonicalPath.String(path)))
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	pair, err := mapper.GetUrl(callCtx, path)
+	err = wrapMapperError(mapper, err)
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	span.SetAttributes(tracing.AttrFound.Bool(pair != nil))
+	if stale := m.state(mapper).stale; stale != nil && err == nil {
+		stale.putPair(path, pair)
+	}
+	return pair, err
+}
+
+func (m *MapperManager) listFromMapper(ctx context.Context, mapper types.Mapper, pagination types.Pagination) (types.PathUrlPairList, error) {
+	ctx, span := m.startMapperSpan(ctx, "ListUrls", mapper)
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	pairs, err := mapper.ListUrls(callCtx, pagination)
+	err = wrapMapperError(mapper, err)
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	if stale := m.state(mapper).stale; stale != nil && err == nil {
+		stale.putList(pagination, pairs)
+	}
+	return pairs, err
+}
+
+func (m *MapperManager) putToMapper(ctx context.Context, mapper types.Mapper, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	ctx, span := m.startMapperSpan(ctx, "PutUrl", mapper, trace.WithAttributes(tracing.AttrCanonicalPath.String(pair.Path)))
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	pair, err := mapper.PutUrl(callCtx, pair)
+	err = wrapMapperError(mapper, err)
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	if stale := m.state(mapper).stale; stale != nil && err == nil {
+		stale.putPair(pair.Path, pair)
+	}
+	if err == nil && patterns.IsPattern(pair.Path) {
+		m.patternStore.put(mapper.GetName(), pair.Path)
+	} else if err == nil {
+		m.suggestIndex.put(mapper.GetName(), pair)
+	}
+	return pair, err
+}
+
+// incrementInMapper bumps the use count of pair, atomically if the mapper supports it.
+func (m *MapperManager) incrementInMapper(ctx context.Context, mapper types.Mapper, pair *types.PathUrlPair) error {
+	counter, ok := mapper.(types.MapperCounter)
+	if !ok {
+		pair.UseCount = pair.UseCount + 1
+		_, err := m.putToMapper(ctx, mapper, pair)
+		return err
+	}
+	ctx, span := m.startMapperSpan(ctx, "IncrementUseCount", mapper, trace.WithAttributes(tracing.AttrCanonicalPath.String(pair.Path)))
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	count, err := counter.IncrementUseCount(callCtx, pair.Path)
+	// a mapper that does not count is not at fault, and its pair keeps the count it was indexed with
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	err = wrapMapperError(mapper, err)
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return err
+	}
+	pair.UseCount = count
+	if stale := m.state(mapper).stale; stale != nil {
+		stale.putPair(pair.Path, pair)
+	}
+	m.suggestIndex.put(mapper.GetName(), pair)
+	return nil
+}
+
+// incrementTargetInMapper bumps the use count of the target of pair with url, atomically if the mapper supports it.
+// A mapper that counts pairs atomically, but not targets, does not count targets.
+func (m *MapperManager) incrementTargetInMapper(ctx context.Context, mapper types.Mapper, pair *types.PathUrlPair, url string) error {
+	i := slices.IndexFunc(pair.Targets, func(target types.WeightedTarget) bool { return target.Url == url })
+	if i < 0 {
+		return fmt.Errorf("pair %s has no target %s", pair.Path, url)
+	}
+	counter, ok := mapper.(types.MapperTargetCounter)
+	if !ok {
+		if _, ok := mapper.(types.MapperCounter); ok {
+			return nil
+		}
+		pair.Targets[i].UseCount++
+		_, err := m.putToMapper(ctx, mapper, pair)
+		return err
+	}
+	ctx, span := m.startMapperSpan(ctx, "IncrementTargetUseCount", mapper, trace.WithAttributes(tracing.AttrCanonicalPath.String(pair.Path)))
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	count, err := counter.IncrementTargetUseCount(callCtx, pair.Path, url)
+	err = wrapMapperError(mapper, err)
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return err
+	}
+	pair.Targets[i].UseCount = count
+	if stale := m.state(mapper).stale; stale != nil {
+		stale.putPair(pair.Path, pair)
+	}
+	return nil
+}
+
+func (m *MapperManager) deleteFromMapper(ctx context.Context, mapper types.Mapper, path string) error {
+	ctx, span := m.startMapperSpan(ctx, "DeleteUrl", mapper, trace.WithAttributes(tracing.AttrCanonicalPath.String(path)))
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	err := wrapMapperError(mapper, mapper.DeleteUrl(callCtx, path))
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	if stale := m.state(mapper).stale; stale != nil && err == nil {
+		stale.putPair(path, nil)
+	}
+	if err == nil && patterns.IsPattern(path) {
+		m.patternStore.delete(mapper.GetName(), path)
+	} else if err == nil {
+		m.suggestIndex.delete(mapper.GetName(), path)
+	}
+	return err
+}
+
+// The link checks are kept by the persistor, when it implements types.MapperLinkChecks.
+
+func (m *MapperManager) putChecksToMapper(ctx context.Context, mapper types.Mapper, checks []types.LinkCheck) error {
+	ctx, span := m.startMapperSpan(ctx, "PutLinkChecks", mapper)
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	err := wrapMapperError(mapper, mapper.(types.MapperLinkChecks).PutLinkChecks(callCtx, checks))
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (m *MapperManager) listChecksFromMapper(ctx context.Context, mapper types.Mapper) ([]types.LinkCheck, error) {
+	ctx, span := m.startMapperSpan(ctx, "ListLinkChecks", mapper)
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	checks, err := mapper.(types.MapperLinkChecks).ListLinkChecks(callCtx)
+	err = wrapMapperError(mapper, err)
+	// a mapper that wraps one that does not keep checks is not at fault
+	if !errors.Is(err, errors.ErrUnsupported) {
+		m.record(ctx, mapper, err)
+	}
+	tracing.RecordError(span, err)
+	return checks, err
+}
+
+func (m *MapperManager) deleteChecksFromMapper(ctx context.Context, mapper types.Mapper, paths ...string) error {
+	ctx, span := m.startMapperSpan(ctx, "DeleteLinkChecks", mapper)
+	defer span.End()
+	if err := m.allow(mapper); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	err := wrapMapperError(mapper, mapper.(types.MapperLinkChecks).DeleteLinkChecks(callCtx, paths...))
+	m.record(ctx, mapper, err)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// wrapMapperError attaches the mapper name to errors caused by a context deadline or cancellation,
+// so that callers can both tell which mapper was slow and match the error with errors.Is.
+func wrapMapperError(mapper types.Mapper, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ErrMapperInterrupted(mapper.GetName(), err)
+	}
+	return err
+}
@@ -0,0 +1,489 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// CheckerSettings configure the background checks of the urls that pairs redirect to.
+type CheckerSettings struct {
+	Interval    int `mapstructure:"interval"`    // in seconds; the checker is off when not positive
+	Timeout     int `mapstructure:"timeout"`     // in milliseconds, per request; 10 seconds by default
+	Concurrency int `mapstructure:"concurrency"` // pairs checked at once; 4 by default
+	HostDelay   int `mapstructure:"hostDelay"`   // in milliseconds between two requests to the same host; 1 second by default
+	// AllowPrivate lets the checker reach loopback, link-local and private addresses,
+	// which anyone who can write a link could otherwise have it probe
+	AllowPrivate bool `mapstructure:"allowPrivate"`
+}
+
+const (
+	defaultCheckTimeout     = 10 * time.Second
+	defaultCheckConcurrency = 4
+	defaultCheckHostDelay   = time.Second
+	checkPageSize           = 500
+	checkUserAgent          = "golinks-checker"
+)
+
+// errPrivateAddress refuses the connections of the checker to the addresses it may not reach.
+var errPrivateAddress = errors.New("private address")
+
+// newCheckClient returns the client that the checker sends its requests with. Unless allowPrivate is set,
+// it refuses to connect to loopback, link-local, private and unspecified addresses once the host is resolved,
+// redirects included, and ignores the proxy of the environment, which would connect on its behalf.
+func newCheckClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := addrPort.Addr().Unmap(); !ip.IsGlobalUnicast() || ip.IsPrivate() {
+					return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+				}
+				return nil
+			},
+		}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	return &http.Client{Transport: transport}
+}
+
+// HeaderBrokenUrl tells, when redirecting, that the last check of the pair found one of its urls broken, and why.
+const HeaderBrokenUrl = "X-Golinks-Broken-Url"
+
+// CheckerStatus sums up the last checks.
+type CheckerStatus struct {
+	Checked int        `json:"checked"`
+	Broken  int        `json:"broken"`
+	LastRun *time.Time `json:"lastRun,omitempty"`
+}
+
+type checker struct {
+	client      *http.Client
+	timeout     time.Duration
+	concurrency int
+	limiter     *hostLimiter
+	store       types.Mapper // the persistor, if it keeps the checks (see types.MapperLinkChecks)
+
+	mu      sync.RWMutex
+	checks  map[string]*types.LinkCheck // by path
+	lastRun *time.Time
+}
+
+// hostLimiter spaces the requests to every host by at least delay.
+type hostLimiter struct {
+	delay  time.Duration
+	mu     sync.Mutex
+	next   map[string]time.Time
+	pruned time.Time
+}
+
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if l.delay <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	// the hosts last requested more than delay ago are not held back anymore, so they are dropped once in a while
+	if now.Sub(l.pruned) >= l.delay {
+		for other, at := range l.next {
+			if at.Before(now) {
+				delete(l.next, other)
+			}
+		}
+		l.pruned = now
+	}
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.delay)
+	l.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithChecker checks the urls of every pair when the manager starts, then every interval, and keeps the outcome
+// of the last check of every pair, until the pair is written again. Patterns are not checked, as their urls
+// are only complete once expanded. If the persistor keeps link checks (see types.MapperLinkChecks),
+// they are saved there, and read back from there, so that they outlive restarts and every server agrees on them.
+func WithChecker(settings CheckerSettings) ManagerOption {
+	return func(m *MapperManager) error {
+		if settings.Interval <= 0 {
+			return nil
+		}
+		if settings.Timeout < 0 || settings.Concurrency < 0 || settings.HostDelay < 0 {
+			return ErrMapConfigSetup("negative settings for the checker")
+		}
+		c := &checker{
+			client:      newCheckClient(settings.AllowPrivate),
+			timeout:     defaultCheckTimeout,
+			concurrency: defaultCheckConcurrency,
+			limiter:     &hostLimiter{delay: defaultCheckHostDelay, next: make(map[string]time.Time)},
+			checks:      make(map[string]*types.LinkCheck),
+		}
+		if settings.Timeout > 0 {
+			c.timeout = time.Duration(settings.Timeout) * time.Millisecond
+		}
+		if settings.Concurrency > 0 {
+			c.concurrency = settings.Concurrency
+		}
+		if settings.HostDelay > 0 {
+			c.limiter.delay = time.Duration(settings.HostDelay) * time.Millisecond
+		}
+		m.checker = c
+		if _, ok := m.getPersistor().(types.MapperLinkChecks); ok {
+			c.store = m.getPersistor()
+			if err := m.loadChecks(context.Background()); errors.Is(err, errors.ErrUnsupported) {
+				c.store = nil
+			} else if err != nil {
+				m.logger.Warnf("Failed to load the link checks kept by %s: %v", m.getPersistor().GetName(), err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(settings.Interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				checked, err := m.CheckLinks(ctx)
+				if err != nil && ctx.Err() == nil {
+					m.logger.Errorf("Failed to check links: %v", err)
+				}
+				m.logger.Infof("Checked %d links", checked)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+		m.stopChecker = func() {
+			cancel()
+			wg.Wait()
+		}
+		return nil
+	}
+}
+
+// CheckLinks checks the urls of every pair now, and returns how many pairs it checked.
+// A url is broken if it cannot be reached in time, or answers 404, 410 or a server error;
+// other answers, such as those asking to sign in, tell that it is still there.
+// The checks of the pairs that are gone are dropped, unless some mappers could not be listed.
+func (m *MapperManager) CheckLinks(ctx context.Context) (int, error) {
+	c := m.checker
+	if c == nil {
+		return 0, nil
+	}
+	var mu sync.Mutex
+	checks := make(map[string]*types.LinkCheck)
+	jobs := make(chan *types.PathUrlPair)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range jobs {
+				if check := c.check(ctx, pair); check != nil {
+					mu.Lock()
+					checks[pair.Path] = check
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var err error
+	complete := true
+	page := types.Pagination{Limit: checkPageSize}
+listing:
+	for {
+		pairs, status, listErr := m.ListUrlsWithStatus(ctx, page)
+		if listErr != nil {
+			err = listErr
+			break
+		}
+		complete = complete && !status.Incomplete()
+		for _, pair := range pairs {
+			if patterns.IsPattern(pair.Path) {
+				continue
+			}
+			select {
+			case jobs <- pair:
+			case <-ctx.Done():
+				err = ctx.Err()
+				break listing
+			}
+		}
+		if len(pairs) < page.Limit {
+			break
+		}
+		page.Cursor = types.NewCursor(pairs[len(pairs)-1].Path)
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	now := time.Now()
+	complete = complete && err == nil
+	// an interrupted run cannot reach the store anymore
+	if c.store != nil && ctx.Err() == nil {
+		saveErr := m.saveChecks(ctx, checks, complete)
+		if saveErr == nil {
+			if complete {
+				c.mu.Lock()
+				c.lastRun = &now
+				c.mu.Unlock()
+			}
+			return len(checks), err
+		}
+		m.logger.Warnf("Failed to save link checks to %s, they are only kept by this server until the next run: %v", m.getPersistor().GetName(), saveErr)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !complete {
+		for path, check := range checks {
+			c.checks[path] = check
+		}
+	} else {
+		c.checks = checks
+		c.lastRun = &now
+	}
+	return len(checks), err
+}
+
+// saveChecks saves checks to the store, drops the stored checks of the pairs that are gone if the run was complete,
+// then takes every stored check, which other servers sharing the store may have saved too.
+func (m *MapperManager) saveChecks(ctx context.Context, checks map[string]*types.LinkCheck, complete bool) error {
+	c := m.checker
+	saved := make([]types.LinkCheck, 0, len(checks))
+	for _, check := range checks {
+		saved = append(saved, *check)
+	}
+	if err := m.putChecksToMapper(ctx, c.store, saved); err != nil {
+		return err
+	}
+	stored, err := m.listChecksFromMapper(ctx, c.store)
+	if err != nil {
+		return err
+	}
+	if complete {
+		var gone []string
+		kept := stored[:0]
+		for _, check := range stored {
+			if checks[check.Path] == nil {
+				gone = append(gone, check.Path)
+			} else {
+				kept = append(kept, check)
+			}
+		}
+		if len(gone) > 0 {
+			if err := m.deleteChecksFromMapper(ctx, c.store, gone...); err != nil {
+				return err
+			}
+		}
+		stored = kept
+	}
+	c.set(stored)
+	return nil
+}
+
+// loadChecks takes the checks kept by the store.
+func (m *MapperManager) loadChecks(ctx context.Context) error {
+	stored, err := m.listChecksFromMapper(ctx, m.checker.store)
+	if err != nil {
+		return err
+	}
+	m.checker.set(stored)
+	return nil
+}
+
+func (c *checker) set(stored []types.LinkCheck) {
+	checks := make(map[string]*types.LinkCheck, len(stored))
+	for i := range stored {
+		checks[stored[i].Path] = &stored[i]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = checks
+}
+
+// check checks the urls of pair, up to the first broken one, or returns nil if it was interrupted.
+func (c *checker) check(ctx context.Context, pair *types.PathUrlPair) *types.LinkCheck {
+	check := &types.LinkCheck{Path: pair.Path, Mapper: pair.Mapper, Status: types.LinkStatusOk}
+	for _, u := range pairUrls(pair) {
+		code, err := c.checkUrl(ctx, u)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			check.Status, check.Url, check.Reason = types.LinkStatusBroken, u, err.Error()
+			break
+		}
+		if code == http.StatusNotFound || code == http.StatusGone || code >= http.StatusInternalServerError {
+			check.Status, check.Url, check.StatusCode, check.Reason = types.LinkStatusBroken, u, code, http.StatusText(code)
+			break
+		}
+	}
+	check.CheckedAt = time.Now()
+	return check
+}
+
+// pairUrls returns every url that pair may redirect to, once.
+func pairUrls(pair *types.PathUrlPair) []string {
+	var urls []string
+	add := func(u string) {
+		if u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	add(pair.Url)
+	for _, rule := range pair.Rules {
+		add(rule.Url)
+	}
+	for _, target := range pair.Targets {
+		add(target.Url)
+	}
+	return urls
+}
+
+// checkUrl returns the status that u answers a HEAD request with, or a GET request if HEAD is not supported.
+// The urls that are not http, or that lead to addresses the checker may not reach, are not checked, and answer 200.
+func (c *checker) checkUrl(ctx context.Context, u string) (int, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0, fmt.Errorf("invalid url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return http.StatusOK, nil
+	}
+	if err := c.limiter.wait(ctx, parsed.Host); err != nil {
+		return 0, err
+	}
+	code, err := c.request(ctx, http.MethodHead, u)
+	if errors.Is(err, errPrivateAddress) {
+		return http.StatusOK, nil
+	}
+	if err != nil || (code != http.StatusMethodNotAllowed && code != http.StatusNotImplemented) {
+		return code, err
+	}
+	if err := c.limiter.wait(ctx, parsed.Host); err != nil {
+		return 0, err
+	}
+	return c.request(ctx, http.MethodGet, u)
+}
+
+func (c *checker) request(ctx context.Context, method string, u string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", checkUserAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, nil
+}
+
+// forgetChecks drops the checks of the pairs at paths, just written, whose urls may have changed,
+// here and from the store. The write is done, so a store that fails only leaves a check behind until the next run.
+func (m *MapperManager) forgetChecks(ctx context.Context, paths ...string) {
+	c := m.checker
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	for _, path := range paths {
+		delete(c.checks, path)
+	}
+	c.mu.Unlock()
+	if c.store == nil {
+		return
+	}
+	if err := m.deleteChecksFromMapper(ctx, c.store, paths...); err != nil {
+		m.logger.Warnf("Failed to forget the link checks of %v: %v", paths, err)
+	}
+}
+
+// LinkCheck returns the last check of the urls of the pair with the given canonical path,
+// or nil if it was not checked since it was last written.
+func (m *MapperManager) LinkCheck(path string) *types.LinkCheck {
+	if m.checker == nil {
+		return nil
+	}
+	m.checker.mu.RLock()
+	defer m.checker.mu.RUnlock()
+	if check := m.checker.checks[path]; check != nil {
+		c := *check
+		return &c
+	}
+	return nil
+}
+
+// BrokenLinks returns the last checks that found broken urls, in path order,
+// but for those of the pairs that the actor of ctx may not read.
+func (m *MapperManager) BrokenLinks(ctx context.Context) []types.LinkCheck {
+	broken := []types.LinkCheck{}
+	if m.checker == nil {
+		return broken
+	}
+	m.checker.mu.RLock()
+	defer m.checker.mu.RUnlock()
+	for _, check := range m.checker.checks {
+		if check.Broken() && m.authorize(ctx, m.namespaceOf(check.Path), false) == nil {
+			broken = append(broken, *check)
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool { return broken[i].Path < broken[j].Path })
+	return broken
+}
+
+// CheckerStatus sums up the last checks, or returns nil if the checker is off.
+func (m *MapperManager) CheckerStatus() *CheckerStatus {
+	if m.checker == nil {
+		return nil
+	}
+	m.checker.mu.RLock()
+	defer m.checker.mu.RUnlock()
+	status := &CheckerStatus{Checked: len(m.checker.checks), LastRun: m.checker.lastRun}
+	for _, check := range m.checker.checks {
+		if check.Broken() {
+			status.Broken++
+		}
+	}
+	return status
+}
@@ -0,0 +1,278 @@
+package mapper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+// newTargetServer serves the targets of the checked pairs.
+func newTargetServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusGone) })
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newCheckedManager sets up a persistor with a pair for every target of server, checked every hour.
+func newCheckedManager(t *testing.T, server *httptest.Server, opts ...ManagerOption) *MapperManager {
+	configurer := &MockMapperConfigurer{
+		Name: "checked",
+		StarterPairs: types.PathUrlPairMap{
+			"ok":       {Path: "ok", Url: server.URL + "/ok"},
+			"gone":     {Path: "gone", Url: server.URL + "/gone"},
+			"login":    {Path: "login", Url: server.URL + "/login"},
+			"get-only": {Path: "get-only", Url: server.URL + "/get-only"},
+			"slow":     {Path: "slow", Url: server.URL + "/slow"},
+			"mail":     {Path: "mail", Url: "mailto:team@example.com"},
+			"rules": {Path: "rules", Url: server.URL + "/ok", Rules: []types.RedirectRule{
+				{Url: server.URL + "/missing", Headers: map[string]string{"X-Beta": "1"}},
+			}},
+			"pattern/*": {Path: "pattern/*", Url: server.URL + "/missing/$1"},
+		},
+	}
+	opts = append(opts, WithChecker(CheckerSettings{Interval: 3600, Timeout: 100, Concurrency: 2, HostDelay: 1, AllowPrivate: true}))
+	mm, err := NewMapperManager(configurer.Name, CloneConfigurers([]*MockMapperConfigurer{configurer}), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	// the first run starts with the manager
+	require.Eventually(t, func() bool { return mm.CheckerStatus().LastRun != nil }, 5*time.Second, 10*time.Millisecond)
+	return mm
+}
+
+func TestWithChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings CheckerSettings
+		wantErr  bool
+	}{
+		{name: "happy path", settings: CheckerSettings{Interval: 3600, Timeout: 1000, Concurrency: 2, HostDelay: 10}},
+		{name: "disabled", settings: CheckerSettings{Timeout: -1}},
+		{name: "negative timeout should fail", settings: CheckerSettings{Interval: 3600, Timeout: -1}, wantErr: true},
+		{name: "negative concurrency should fail", settings: CheckerSettings{Interval: 3600, Concurrency: -1}, wantErr: true},
+		{name: "negative host delay should fail", settings: CheckerSettings{Interval: 3600, HostDelay: -1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// nothing to check, so that the first run does not reach out
+			configurers := CloneConfigurers([]*MockMapperConfigurer{{Name: "empty"}})
+			mm, err := NewMapperManager("", configurers, WithChecker(test.settings))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, mm)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, mm.Teardown())
+		})
+	}
+}
+
+func TestMapperManager_CheckLinks(t *testing.T) {
+	server := newTargetServer(t)
+	mm := newCheckedManager(t, server)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus string
+		wantUrl    string
+		wantCode   int
+	}{
+		{name: "ok", path: "ok", wantStatus: types.LinkStatusOk},
+		{name: "gone", path: "gone", wantStatus: types.LinkStatusBroken, wantUrl: server.URL + "/gone", wantCode: http.StatusGone},
+		{name: "sign in is alive", path: "login", wantStatus: types.LinkStatusOk},
+		{name: "falls back to get", path: "get-only", wantStatus: types.LinkStatusOk},
+		{name: "timeout", path: "slow", wantStatus: types.LinkStatusBroken, wantUrl: server.URL + "/slow"},
+		{name: "not http is not checked", path: "mail", wantStatus: types.LinkStatusOk},
+		{name: "rule urls are checked", path: "rules", wantStatus: types.LinkStatusBroken, wantUrl: server.URL + "/missing", wantCode: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check := mm.LinkCheck(canonical(t, test.path))
+			require.NotNil(t, check)
+			assert.Equal(t, test.wantStatus, check.Status)
+			assert.Equal(t, test.wantUrl, check.Url)
+			assert.Equal(t, test.wantCode, check.StatusCode)
+			assert.Equal(t, check.Broken(), check.Reason != "")
+			assert.False(t, check.CheckedAt.IsZero())
+		})
+	}
+
+	assert.Nil(t, mm.LinkCheck(canonical(t, "pattern/*")), "patterns are not checked")
+	status := mm.CheckerStatus()
+	assert.Equal(t, 7, status.Checked)
+	assert.Equal(t, 3, status.Broken)
+	broken := mm.BrokenLinks(context.Background())
+	require.Len(t, broken, 3)
+	assert.Equal(t, canonical(t, "gone"), broken[0].Path)
+
+	checked, err := mm.CheckLinks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, checked)
+}
+
+func TestMapperManager_CheckLinksForgetsWrites(t *testing.T) {
+	ctx := context.Background()
+	server := newTargetServer(t)
+	mm := newCheckedManager(t, server)
+
+	_, err := mm.PutUrl(ctx, &types.PathUrlPair{Path: "gone", Url: server.URL + "/ok"})
+	require.NoError(t, err)
+	assert.Nil(t, mm.LinkCheck(canonical(t, "gone")), "the urls of a written pair may have changed")
+	require.NoError(t, mm.DeleteUrl(ctx, "slow"))
+	assert.Nil(t, mm.LinkCheck(canonical(t, "slow")))
+	assert.NotNil(t, mm.LinkCheck(canonical(t, "ok")))
+
+	_, err = mm.CheckLinks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.LinkStatusOk, mm.LinkCheck(canonical(t, "gone")).Status)
+	assert.Equal(t, 6, mm.CheckerStatus().Checked, "deleted pairs are dropped")
+}
+
+func TestMapperManager_CheckLinksStore(t *testing.T) {
+	ctx := context.Background()
+	server := newTargetServer(t)
+	// a check saved for a pair that is gone since
+	gone := func(m *MapperManager) error {
+		return m.getPersistor().(*MockMapper).PutLinkChecks(ctx, []types.LinkCheck{{Path: "/deleted", Status: types.LinkStatusBroken}})
+	}
+	mm := newCheckedManager(t, server, gone)
+	store := mm.getPersistor().(*MockMapper)
+
+	checks, err := store.ListLinkChecks(ctx)
+	require.NoError(t, err)
+	assert.Len(t, checks, 7, "the checks are saved, and those of the pairs that are gone dropped")
+	assert.Equal(t, types.LinkStatusBroken, store.Checks[canonical(t, "gone")].Status)
+
+	// another server sharing the store checked mail since
+	require.NoError(t, store.PutLinkChecks(ctx, []types.LinkCheck{{Path: canonical(t, "mail"), Status: types.LinkStatusBroken, Reason: "elsewhere"}}))
+	require.NoError(t, mm.loadChecks(ctx))
+	assert.Equal(t, "elsewhere", mm.LinkCheck(canonical(t, "mail")).Reason)
+
+	// writes forget the saved checks too
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "gone", Url: server.URL + "/ok"})
+	require.NoError(t, err)
+	assert.NotContains(t, store.Checks, canonical(t, "gone"))
+	// but failed ones do not
+	store.Err = assert.AnError
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "ok", Url: server.URL + "/gone"})
+	assert.Error(t, err)
+	store.Err = nil
+	assert.NotNil(t, mm.LinkCheck(canonical(t, "ok")))
+	assert.Contains(t, store.Checks, canonical(t, "ok"))
+
+	// the checks outlive the run when the store fails
+	store.Err = assert.AnError
+	_, err = mm.CheckLinks(ctx)
+	assert.Error(t, err)
+	store.Err = nil
+	assert.NotNil(t, mm.LinkCheck(canonical(t, "ok")))
+}
+
+func TestMapperManager_BrokenLinksPrivate(t *testing.T) {
+	ctx := context.Background()
+	server := newTargetServer(t)
+	mm := newCheckedManager(t, server)
+	alice := utils.WithActor(ctx, "alice")
+
+	_, err := mm.PutUrl(alice, &types.PathUrlPair{Path: "~/gone", Url: server.URL + "/gone"})
+	require.NoError(t, err)
+	_, err = mm.CheckLinks(ctx)
+	require.NoError(t, err)
+
+	assert.Len(t, mm.BrokenLinks(alice), 4)
+	assert.Len(t, mm.BrokenLinks(utils.WithActor(ctx, "bob")), 3, "personal links are private")
+	assert.Len(t, mm.BrokenLinks(ctx), 3)
+}
+
+func TestMapperManager_CheckLinksPrivate(t *testing.T) {
+	ctx := context.Background()
+	server := newTargetServer(t)
+	configurer := &MockMapperConfigurer{
+		Name:         "checked",
+		StarterPairs: types.PathUrlPairMap{"gone": {Path: "gone", Url: server.URL + "/gone"}},
+	}
+	mm, err := NewMapperManager(configurer.Name, CloneConfigurers([]*MockMapperConfigurer{configurer}),
+		WithChecker(CheckerSettings{Interval: 3600, HostDelay: 1}))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+
+	_, err = mm.CheckLinks(ctx)
+	require.NoError(t, err)
+	check := mm.LinkCheck(canonical(t, "gone"))
+	require.NotNil(t, check)
+	assert.Equal(t, types.LinkStatusOk, check.Status, "loopback is not reached")
+	assert.Empty(t, check.Reason)
+}
+
+func TestNewCheckClient(t *testing.T) {
+	server := newTargetServer(t)
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{name: "loopback is refused", wantErr: true},
+		{name: "loopback is allowed", allowPrivate: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := newCheckClient(test.allowPrivate).Get(server.URL + "/ok")
+			if test.wantErr {
+				assert.ErrorIs(t, err, errPrivateAddress)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := &hostLimiter{delay: 50 * time.Millisecond, next: make(map[string]time.Time)}
+
+	start := time.Now()
+	require.NoError(t, limiter.wait(ctx, "a.com"))
+	require.NoError(t, limiter.wait(ctx, "b.com"))
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "hosts are limited apart")
+	require.NoError(t, limiter.wait(ctx, "a.com"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, limiter.wait(cancelled, "a.com"))
+
+	// the hosts that are not held back anymore are dropped
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, limiter.wait(ctx, "c.com"))
+	assert.Len(t, limiter.next, 1)
+	assert.Contains(t, limiter.next, "c.com")
+}
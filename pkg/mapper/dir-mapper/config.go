@@ -0,0 +1,75 @@
+package dir_mapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/logging"
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	DirMapperConfigType = "DIR"
+)
+
+var _ types.MapperConfigurer = (*DirMapperConfig)(nil)
+
+func init() {
+	mapper.Register(DirMapperConfigType, func() types.MapperConfigurer { return &DirMapperConfig{} })
+}
+
+type DirMapperConfig struct {
+	Name         string `mapstructure:"name"`
+	Path         string `mapstructure:"path"`
+	Namespaces   bool   `mapstructure:"namespaces"`   // prefix paths with the subdirectory of their file
+	SyncInterval int    `mapstructure:"syncInterval"` // in seconds
+}
+
+func (d *DirMapperConfig) GetName() string {
+	return d.Name
+}
+
+func (d *DirMapperConfig) GetType() string {
+	return DirMapperConfigType
+}
+
+func (d *DirMapperConfig) Singleton() bool {
+	return false
+}
+
+func (d *DirMapperConfig) GetMapper() (types.Mapper, error) {
+	mm := &DirMapper{
+		name:       d.Name,
+		root:       d.Path,
+		namespaces: d.Namespaces,
+		files:      make(map[string]*source),
+		logger:     logging.NewLogger(fmt.Sprintf("dir-mapper-%s", d.Name)),
+	}
+	if err := mm.reload(); err != nil {
+		return nil, err
+	}
+
+	// start a ticker that reloads the changed files every d.SyncInterval seconds
+	if d.SyncInterval > 0 {
+		done := make(chan bool)
+		ticker := time.NewTicker(time.Duration(d.SyncInterval) * time.Second)
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					if err := mm.reload(); err != nil {
+						mm.logger.Errorf("Failed to hot reload directory %s: %v", d.Path, err)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+		mm.stop = func() {
+			ticker.Stop()
+			done <- true
+		}
+	}
+	return mm, nil
+}
@@ -0,0 +1,57 @@
+package dir_mapper
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirMapperConfig_GetName(t *testing.T) {
+	config := &DirMapperConfig{Name: "dir"}
+	assert.Equal(t, "dir", config.GetName())
+}
+
+func TestDirMapperConfig_GetType(t *testing.T) {
+	config := &DirMapperConfig{Name: "dir"}
+	assert.Equal(t, DirMapperConfigType, config.GetType())
+}
+
+func TestDirMapperConfig_Singleton(t *testing.T) {
+	config := &DirMapperConfig{Name: "dir"}
+	assert.False(t, config.Singleton())
+}
+
+func TestDirMapperConfig_GetMapper(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, tree)
+	broken := t.TempDir()
+	writeTree(t, broken, map[string]string{"maps.yaml": "data: [broken"})
+	invalid := t.TempDir()
+	writeTree(t, invalid, map[string]string{"team/maps.yaml": "data:\n  - path: gh\n    url: https://gh.com\n  - path: d\n    url: https://d.com\n"})
+
+	tests := []struct {
+		name    string
+		config  *DirMapperConfig
+		wantErr string
+	}{
+		{name: "happy path", config: &DirMapperConfig{Name: "dir", Path: root, SyncInterval: 60}},
+		{name: "empty directory", config: &DirMapperConfig{Name: "dir", Path: t.TempDir()}},
+		{name: "missing directory", config: &DirMapperConfig{Name: "dir", Path: filepath.Join(root, "missing")}, wantErr: "no such file"},
+		{name: "broken file", config: &DirMapperConfig{Name: "dir", Path: broken}, wantErr: "maps.yaml"},
+		{name: "invalid path", config: &DirMapperConfig{Name: "dir", Path: invalid}, wantErr: "team/maps.yaml:4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.config.GetMapper()
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, m)
+			assert.NoError(t, m.Teardown())
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package dir_mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	file_mapper "github.com/reimirno/golinks/pkg/mapper/file-mapper"
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+var (
+	_ types.Mapper         = (*DirMapper)(nil)
+	_ types.MapperPinger   = (*DirMapper)(nil)
+	_ types.MapperReloader = (*DirMapper)(nil)
+)
+
+// DirMapper serves every yaml and json file under a directory tree, so that links can be split across files.
+// Files and directories whose name starts with a dot are ignored.
+type DirMapper struct {
+	mapper.ReloadHooks
+	logger     *zap.SugaredLogger
+	name       string
+	root       string
+	namespaces bool
+	stop       func()
+	files      map[string]*source // by slash-separated path relative to root; only touched by reload
+
+	mu        sync.RWMutex
+	pairs     types.PathUrlPairMap
+	aliases   map[string]string     // alias -> path
+	list      types.PathUrlPairList // sorted by path
+	reloadErr error                 // outcome of the last reload
+}
+
+// source is the last successfully parsed version of a file.
+type source struct {
+	modTime time.Time
+	size    int64
+	pairs   types.PathUrlPairList // sanitized, and namespaced
+	lines   []int
+}
+
+func (d *DirMapper) GetType() string {
+	return DirMapperConfigType
+}
+
+func (d *DirMapper) GetName() string {
+	return d.name
+}
+
+func (d *DirMapper) Teardown() error {
+	if d.stop != nil {
+		d.stop()
+	}
+	return nil
+}
+
+// Ping fails while the last reload failed, be it a single file that does not parse or a duplicate path.
+// The pairs loaded before keep being served in the meantime.
+func (d *DirMapper) Ping(ctx context.Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.reloadErr
+}
+
+func (d *DirMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	pair, ok := d.pairs[path]
+	if !ok {
+		pair, ok = d.pairs[d.aliases[path]]
+	}
+	if !ok {
+		return nil, nil
+	}
+	return pair.Clone(), nil
+}
+
+func (d *DirMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	page, err := utils.PaginatePairs(d.list, pagination)
+	if err != nil {
+		return nil, err
+	}
+	return *page.Clone(), nil
+}
+
+func (d *DirMapper) DeleteUrl(ctx context.Context, path string) error {
+	return mapper.ErrOperationNotSupported("delete")
+}
+
+func (d *DirMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	return nil, mapper.ErrOperationNotSupported("put")
+}
+
+func (d *DirMapper) Readonly() bool {
+	return true
+}
+
+// reload parses the files that were added or changed since the last reload, and drops the removed ones.
+// A file that fails to parse keeps its previous pairs; if paths are duplicated, all previous pairs are kept.
+// The reload hooks are called when the pairs changed.
+func (d *DirMapper) reload() error {
+	var errs []error
+	changed := false
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(d.root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != d.root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !isLinksFile(file) {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if old, ok := d.files[rel]; ok && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			return nil
+		}
+		src, err := d.parse(file, rel)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		src.modTime, src.size = info.ModTime(), info.Size()
+		d.files[rel] = src
+		changed = true
+		d.logger.Debugf("Loaded file %s", rel)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for rel := range d.files {
+		if !seen[rel] {
+			delete(d.files, rel)
+			changed = true
+		}
+	}
+
+	d.mu.Lock()
+	swapped := false
+	if changed || d.pairs == nil {
+		pairs, aliases, list, err := d.merge()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			d.pairs, d.aliases, d.list = pairs, aliases, list
+			swapped = true
+		}
+	} else if errors.Is(d.reloadErr, errDuplicate) {
+		// nothing changed since the duplicates were found
+		errs = append(errs, d.reloadErr)
+	}
+	d.reloadErr = errors.Join(errs...)
+	err = d.reloadErr
+	d.mu.Unlock()
+	if swapped {
+		d.Reloaded()
+	}
+	return err
+}
+
+func isLinksFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// parse reads a file, and sanitizes its pairs under the namespace of its directory.
+func (d *DirMapper) parse(file string, rel string) (*source, error) {
+	pairs, lines, err := file_mapper.ParseFileLines(file)
+	if err != nil {
+		return nil, err
+	}
+	namespace := ""
+	if dir := path.Dir(rel); d.namespaces && dir != "." {
+		namespace = dir + "/"
+	}
+	for i, pair := range pairs {
+		pair.Path = namespaced(namespace, pair.Path)
+		for j, alias := range pair.Aliases {
+			pair.Aliases[j] = namespaced(namespace, alias)
+		}
+		if err := sanitizer.SanitizeInput(d, pair); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", rel, lines[i], err)
+		}
+	}
+	return &source{pairs: pairs, lines: lines}, nil
+}
+
+// namespaced prefixes a path or a pattern with namespace. A regex is matched against canonical paths,
+// so it is prefixed with the canonical namespace.
+func namespaced(namespace string, p string) string {
+	if trimmed := strings.TrimSpace(p); namespace != "" && patterns.IsRegex(trimmed) {
+		if canonical, err := sanitizer.CanonicalizePath(namespace); err == nil {
+			namespace = strings.TrimPrefix(canonical, "/") + "/"
+		}
+		return "^" + regexp.QuoteMeta(namespace) + "(?:" + strings.TrimPrefix(trimmed, "^") + ")"
+	}
+	return namespace + strings.TrimPrefix(p, "/")
+}
+
+var errDuplicate = errors.New("duplicate path")
+
+// merge builds the pairs served, and their aliases, from the pairs of every file, and fails if a path is found
+// more than once, be it as a path or as an alias. The caller must hold the lock.
+func (d *DirMapper) merge() (types.PathUrlPairMap, map[string]string, types.PathUrlPairList, error) {
+	rels := make([]string, 0, len(d.files))
+	for rel := range d.files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	pairs := make(types.PathUrlPairMap)
+	aliases := make(map[string]string)
+	locations := make(map[string]string)
+	var errs []error
+	claim := func(path string, location string) bool {
+		if first, ok := locations[path]; ok {
+			errs = append(errs, fmt.Errorf("%w %s in %s and %s", errDuplicate, path, first, location))
+			return false
+		}
+		locations[path] = location
+		return true
+	}
+	for _, rel := range rels {
+		src := d.files[rel]
+		for i, pair := range src.pairs {
+			location := fmt.Sprintf("%s:%d", rel, src.lines[i])
+			if !claim(pair.Path, location) {
+				continue
+			}
+			pairs[pair.Path] = pair
+			for _, alias := range pair.Aliases {
+				if claim(alias, location) {
+					aliases[alias] = pair.Path
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, nil, errors.Join(errs...)
+	}
+	list := make(types.PathUrlPairList, 0, len(pairs))
+	for _, pair := range pairs {
+		list = append(list, pair)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return pairs, aliases, list, nil
+}
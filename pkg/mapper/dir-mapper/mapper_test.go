@@ -0,0 +1,205 @@
+package dir_mapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// writeTree writes files under root, by slash-separated relative path.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for rel, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+}
+
+// touch moves the modification time of a file forward, as a later write would.
+func touch(t *testing.T, root string, rel string) {
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(root, filepath.FromSlash(rel)), later, later))
+}
+
+var tree = map[string]string{
+	"maps.yaml": `
+data:
+  - path: gh
+    url: https://github.com
+`,
+	"infra/maps.yaml": `
+data:
+  - path: grafana
+    url: https://grafana.com
+  - path: /prom
+    url: https://prometheus.io
+`,
+	"infra/oncall/maps.json": `{"data": [{"path": "pager", "url": "https://pager.com"}]}`,
+	".git/maps.yaml":         `data: [{path: hidden, url: https://hidden.com}]`,
+	"README.md":              "not links",
+}
+
+func newTestMapper(t *testing.T, root string, namespaces bool) *DirMapper {
+	config := &DirMapperConfig{Name: "dir", Path: root, Namespaces: namespaces}
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Teardown() })
+	return m.(*DirMapper)
+}
+
+func paths(t *testing.T, m *DirMapper) []string {
+	pairs, err := m.ListUrls(context.Background(), types.Pagination{Offset: 0, Limit: 100})
+	require.NoError(t, err)
+	result := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		result = append(result, pair.Path)
+	}
+	return result
+}
+
+func TestDirMapper_Load(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces bool
+		want       []string
+	}{
+		{
+			name: "flat",
+			want: []string{"/gh", "/grafana", "/pager", "/prom"},
+		},
+		{
+			name:       "namespaces",
+			namespaces: true,
+			want:       []string{"/gh", "/infra/grafana", "/infra/oncall/pager", "/infra/prom"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tree)
+			m := newTestMapper(t, root, test.namespaces)
+			assert.Equal(t, test.want, paths(t, m))
+
+			got, err := m.GetUrl(context.Background(), test.want[1])
+			assert.NoError(t, err)
+			assert.Equal(t, &types.PathUrlPair{Path: test.want[1], Url: "https://grafana.com", Mapper: "dir"}, got)
+			assert.NoError(t, m.Ping(context.Background()))
+		})
+	}
+}
+
+func TestDirMapper_Duplicates(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, tree)
+	writeTree(t, root, map[string]string{"other.yaml": "data:\n  - path: x\n    url: https://x.com\n  - path: g-h\n    url: https://gh.com\n"})
+
+	_, err := (&DirMapperConfig{Name: "dir", Path: root}).GetMapper()
+	assert.ErrorContains(t, err, "duplicate path /gh in maps.yaml:3 and other.yaml:4")
+
+	// namespaces tell apart the same path in different directories
+	require.NoError(t, os.Remove(filepath.Join(root, "other.yaml")))
+	writeTree(t, root, map[string]string{"infra/other.yaml": "data:\n  - path: gh\n    url: https://gh.com\n"})
+	_, err = (&DirMapperConfig{Name: "dir", Path: root}).GetMapper()
+	assert.ErrorContains(t, err, "duplicate path /gh in infra/other.yaml:2 and maps.yaml:3")
+	m := newTestMapper(t, root, true)
+	assert.Subset(t, paths(t, m), []string{"/gh", "/infra/gh"})
+}
+
+func TestDirMapper_Aliases(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, tree)
+	writeTree(t, root, map[string]string{"infra/aliases.yaml": "data:\n  - path: loki\n    url: https://loki.com\n    aliases: [logs]\n"})
+
+	// aliases are namespaced like paths
+	m := newTestMapper(t, root, true)
+	got, err := m.GetUrl(context.Background(), "/infra/logs")
+	assert.NoError(t, err)
+	assert.Equal(t, "/infra/loki", got.Path)
+	assert.NotContains(t, paths(t, m), "/infra/logs")
+
+	writeTree(t, root, map[string]string{"infra/aliases.yaml": "data:\n  - path: loki\n    url: https://loki.com\n    aliases: [gh]\n"})
+	_, err = (&DirMapperConfig{Name: "dir", Path: root}).GetMapper()
+	assert.ErrorContains(t, err, "duplicate path /gh in infra/aliases.yaml:2 and maps.yaml:3")
+}
+
+func TestDirMapper_Patterns(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"my-team/patterns.yaml": "data:\n  - path: pr/*\n    url: https://github.com/pull/$1\n  - path: '^bug(\\d+)$'\n    url: https://tracker/issue/$1\n"})
+
+	// patterns are namespaced like paths, regexes with the canonical namespace
+	m := newTestMapper(t, root, true)
+	assert.Equal(t, []string{"/myteam/pr/*", `^myteam/(?:bug(\d+)$)`}, paths(t, m))
+	p, err := patterns.Compile(`^myteam/(?:bug(\d+)$)`)
+	require.NoError(t, err)
+	assert.True(t, p.Matches("/myteam/bug12"))
+	assert.False(t, p.Matches("/bug12"))
+}
+
+func TestDirMapper_Reload(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	writeTree(t, root, tree)
+	m := newTestMapper(t, root, true)
+	unchanged := m.files["maps.yaml"]
+	reloads := 0
+	m.OnReload(func() { reloads++ })
+	assert.NoError(t, m.reload())
+	assert.Zero(t, reloads, "nothing changed")
+
+	// only the changed file is parsed again
+	writeTree(t, root, map[string]string{"infra/maps.yaml": "data:\n  - path: grafana\n    url: https://grafana.net\n"})
+	touch(t, root, "infra/maps.yaml")
+	assert.NoError(t, m.reload())
+	assert.Same(t, unchanged, m.files["maps.yaml"])
+	assert.Equal(t, 1, reloads)
+	assert.Equal(t, []string{"/gh", "/infra/grafana", "/infra/oncall/pager"}, paths(t, m))
+	got, err := m.GetUrl(ctx, "/infra/grafana")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://grafana.net", got.Url)
+
+	// a broken file keeps its previous pairs
+	writeTree(t, root, map[string]string{"infra/maps.yaml": "data: [broken"})
+	touch(t, root, "infra/maps.yaml")
+	assert.Error(t, m.reload())
+	assert.Error(t, m.Ping(ctx))
+	assert.Equal(t, 1, reloads)
+	got, err = m.GetUrl(ctx, "/infra/grafana")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+
+	// a duplicate keeps all previous pairs, until it is fixed
+	writeTree(t, root, map[string]string{
+		"infra/maps.yaml": "data:\n  - path: grafana\n    url: https://grafana.net\n",
+		"infra/more.yaml": "data:\n  - path: grafana\n    url: https://other.com\n",
+	})
+	touch(t, root, "infra/maps.yaml")
+	assert.ErrorContains(t, m.reload(), "infra/maps.yaml:2 and infra/more.yaml:2")
+	assert.ErrorContains(t, m.reload(), "duplicate path")
+	assert.NotContains(t, paths(t, m), "/infra/more")
+	require.NoError(t, os.Remove(filepath.Join(root, "infra", "more.yaml")))
+	assert.NoError(t, m.reload())
+	assert.NoError(t, m.Ping(ctx))
+
+	// removed files are dropped
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "infra")))
+	assert.NoError(t, m.reload())
+	assert.Equal(t, []string{"/gh"}, paths(t, m))
+}
+
+func TestDirMapper_Readonly(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, tree)
+	m := newTestMapper(t, root, false)
+	assert.True(t, m.Readonly())
+	_, err := m.PutUrl(context.Background(), &types.PathUrlPair{Path: "/x", Url: "https://x.com"})
+	assert.Error(t, err)
+	assert.Error(t, m.DeleteUrl(context.Background(), "/gh"))
+}
@@ -2,6 +2,9 @@ package mapper
 
 import (
 	"fmt"
+
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/utils"
 )
 
 func ErrMapConfigSetup(message string) error {
@@ -15,3 +18,42 @@ func ErrOperationNotSupported(operation string) error {
 func ErrInvalidMapper(name string) error {
 	return fmt.Errorf("invalid mapper: %s", name)
 }
+
+func ErrMapperInterrupted(name string, err error) error {
+	return fmt.Errorf("mapper %s interrupted: %w", name, err)
+}
+
+func ErrCircuitOpen(name string) error {
+	return fmt.Errorf("mapper %s is temporarily bypassed after repeated failures", name)
+}
+
+func ErrIncompleteLookup(path string, status LookupStatus) error {
+	return fmt.Errorf("cannot safely modify %s while some mappers are unavailable: skipped %v, stale %v", path, status.Skipped, status.Stale)
+}
+
+func ErrMirrorFailed(name string, err error) error {
+	return fmt.Errorf("written to the persistor, but not to mirror %s: %w", name, err)
+}
+
+func ErrAliasTaken(alias string, path string) error {
+	return fmt.Errorf("%w: %s is already taken by %s", sanitizer.ErrInvalidInput, alias, path)
+}
+
+func ErrIsAlias(alias string, path string) error {
+	return fmt.Errorf("%w: %s is an alias of %s; change the aliases of %s instead", sanitizer.ErrInvalidInput, alias, path, path)
+}
+
+func ErrNotMember(actor string, namespace string) error {
+	if actor == "" {
+		actor = "anonymous"
+	}
+	return fmt.Errorf("%w: %s is not a member of namespace %s", utils.ErrPermissionDenied, actor, namespace)
+}
+
+func ErrAnonymous(path string) error {
+	return fmt.Errorf("%w: %s is personal, but the request has no actor", utils.ErrPermissionDenied, path)
+}
+
+func ErrUnknownNamespace(namespace string) error {
+	return fmt.Errorf("%w: unknown namespace: %s", sanitizer.ErrInvalidInput, namespace)
+}
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/reimirno/golinks/pkg/logging"
-	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
@@ -15,6 +15,10 @@ const (
 
 var _ types.MapperConfigurer = (*FileMapperConfig)(nil)
 
+func init() {
+	mapper.Register(FileMapperConfigType, func() types.MapperConfigurer { return &FileMapperConfig{} })
+}
+
 type FileMapperConfig struct {
 	Name         string `mapstructure:"name"`
 	Path         string `mapstructure:"path"`
@@ -30,7 +34,7 @@ func (f *FileMapperConfig) GetType() string {
 }
 
 func (f *FileMapperConfig) GetMapper() (types.Mapper, error) {
-	pairs, err := parseFile(f.Path)
+	pairs, err := ParseFile(f.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -38,10 +42,9 @@ func (f *FileMapperConfig) GetMapper() (types.Mapper, error) {
 	logger := logging.NewLogger(fmt.Sprintf("file-mapper-%s", f.Name))
 	mm := &FileMapper{
 		name:   f.Name,
-		pairs:  pairs.ToMap(),
 		logger: logger,
 	}
-	err = sanitizer.SanitizeInputMap(mm, &mm.pairs)
+	err = mm.load(pairs)
 	if err != nil {
 		return nil, err
 	}
@@ -55,16 +58,16 @@ func (f *FileMapperConfig) GetMapper() (types.Mapper, error) {
 			for {
 				select {
 				case <-ticker.C:
-					pairs, err = parseFile(f.Path)
+					pairs, err = ParseFile(f.Path)
+					if err == nil {
+						err = mm.load(pairs)
+					}
+					mm.setReloadErr(err)
 					if err != nil {
 						mm.logger.Errorf("Failed to hot reload file %s: %v", f.Path, err)
 					} else {
 						mm.logger.Infof("Hot reloaded file %s", f.Path)
-						mm.pairs = pairs.ToMap()
-						err = sanitizer.SanitizeInputMap(mm, &mm.pairs)
-						if err != nil {
-							mm.logger.Errorf("Failed to sanitize file %s: %v", f.Path, err)
-						}
+						mm.Reloaded()
 					}
 				case <-done:
 					return
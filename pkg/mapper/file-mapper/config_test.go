@@ -1,6 +1,7 @@
 package file_mapper
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
 )
 
 var fakeConfigEmptyPath = FileMapperConfig{
@@ -72,6 +74,7 @@ func TestFileMapperConfig_GetMapper(t *testing.T) {
 		syncInterval                int
 		tempFileConfigNextWrite     string
 		expectedPairCountAfterWrite int
+		expectedPingErrorAfterWrite bool
 		expectedError               bool
 	}{
 		{
@@ -112,6 +115,25 @@ func TestFileMapperConfig_GetMapper(t *testing.T) {
 			syncInterval:                1,
 			tempFileConfigNextWrite:     malformedYamlFileConfig.content,
 			expectedPairCountAfterWrite: 2, // don't error, still keep original pairs
+			expectedPingErrorAfterWrite: true,
+			want: &FileMapper{
+				name:  yamlFileConfig.name,
+				pairs: pairList.ToMap(),
+			},
+		},
+		{
+			name:           "test config with sync interval, invalid pairs",
+			tempFileConfig: yamlFileConfig,
+			syncInterval:   1,
+			tempFileConfigNextWrite: `
+data:
+  - path: "me"
+    url: "https://me.com"
+  - path: "d"
+    url: "https://reserved.com"
+`,
+			expectedPairCountAfterWrite: 2, // keep original pairs, not the valid part of the new ones
+			expectedPingErrorAfterWrite: true,
 			want: &FileMapper{
 				name:  yamlFileConfig.name,
 				pairs: pairList.ToMap(),
@@ -148,12 +170,20 @@ func TestFileMapperConfig_GetMapper(t *testing.T) {
 			err = sanitizer.SanitizeInputMap(fileMapper, wantClone)
 			assert.NoError(t, err)
 			assert.True(t, wantClone.Equals(&fileMapper.pairs), "Expected %v, got %v", wantClone, fileMapper.pairs)
+			assert.NoError(t, fileMapper.Ping(context.Background()))
 			if tt.syncInterval > 0 {
 				assert.NotNil(t, fileMapper.stop)
 				err = os.WriteFile(tmpfile.Name(), []byte(tt.tempFileConfigNextWrite), 0o644)
 				assert.NoError(t, err)
 				time.Sleep(time.Duration(tt.syncInterval+1) * time.Second)
-				assert.Equal(t, tt.expectedPairCountAfterWrite, len(fileMapper.pairs))
+				list, err := fileMapper.ListUrls(context.Background(), types.Pagination{Limit: 10})
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedPairCountAfterWrite, len(list))
+				if tt.expectedPingErrorAfterWrite {
+					assert.Error(t, fileMapper.Ping(context.Background()))
+				} else {
+					assert.NoError(t, fileMapper.Ping(context.Background()))
+				}
 			} else {
 				assert.Nil(t, fileMapper.stop)
 			}
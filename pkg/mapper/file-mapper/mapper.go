@@ -1,20 +1,33 @@
 package file_mapper
 
 import (
+	"context"
+	"sync"
+
 	"go.uber.org/zap"
 
 	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/sanitizer"
 	"github.com/reimirno/golinks/pkg/types"
 	"github.com/reimirno/golinks/pkg/utils"
 )
 
-var _ types.Mapper = (*FileMapper)(nil)
+var (
+	_ types.Mapper         = (*FileMapper)(nil)
+	_ types.MapperPinger   = (*FileMapper)(nil)
+	_ types.MapperReloader = (*FileMapper)(nil)
+)
 
 type FileMapper struct {
+	mapper.ReloadHooks
 	logger *zap.SugaredLogger
 	name   string
-	pairs  types.PathUrlPairMap
 	stop   func()
+
+	mu        sync.RWMutex
+	pairs     types.PathUrlPairMap
+	aliases   map[string]string // alias -> path
+	reloadErr error             // outcome of the last hot reload
 }
 
 func (f *FileMapper) GetType() string {
@@ -32,23 +45,56 @@ func (f *FileMapper) Teardown() error {
 	return nil
 }
 
-func (f *FileMapper) GetUrl(path string) (*types.PathUrlPair, error) {
-	pair, ok := f.pairs[path]
-	if !ok {
-		return nil, nil
+// Ping fails while the last hot reload of the file failed.
+// The pairs loaded before keep being served in the meantime.
+func (f *FileMapper) Ping(ctx context.Context) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.reloadErr
+}
+
+func (f *FileMapper) setReloadErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloadErr = err
+}
+
+// load sanitizes pairs and serves them in place of the pairs loaded before, which are kept if pairs are invalid.
+func (f *FileMapper) load(pairs types.PathUrlPairList) error {
+	loaded := pairs.ToMap()
+	if err := sanitizer.SanitizeInputMap(f, &loaded); err != nil {
+		return err
+	}
+	aliases := loaded.Aliases()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pairs, f.aliases = loaded, aliases
+	return nil
+}
+
+func (f *FileMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if pair, ok := f.pairs[path]; ok {
+		return pair, nil
+	}
+	if owner, ok := f.aliases[path]; ok {
+		return f.pairs[owner], nil
 	}
-	return pair, nil
+	return nil, nil
 }
 
-func (f *FileMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
-	return utils.Paginate(f.pairs.ToList(), pagination), nil
+func (f *FileMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return utils.PaginatePairs(f.pairs.ToList(), pagination)
 }
 
-func (f *FileMapper) DeleteUrl(path string) error {
+func (f *FileMapper) DeleteUrl(ctx context.Context, path string) error {
 	return mapper.ErrOperationNotSupported("delete")
 }
 
-func (f *FileMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+func (f *FileMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
 	return nil, mapper.ErrOperationNotSupported("put")
 }
 
@@ -1,7 +1,18 @@
 package file_mapper
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 
 	"github.com/reimirno/golinks/pkg/types"
 )
@@ -10,14 +21,123 @@ type pathUrlPairWrapper struct {
 	Data []types.PathUrlPair `yaml:"data" json:"data"`
 }
 
-func parseFile(file string) (types.PathUrlPairList, error) {
+// ParseFile reads pairs from a yaml or json file, in the format of files/maps.yaml.
+func ParseFile(file string) (types.PathUrlPairList, error) {
 	v := viper.New()
 	v.SetConfigFile(file)
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
+	return unmarshal(v)
+}
+
+// Parse reads pairs in the same format as ParseFile, from content of the given format ("yaml" or "json").
+func Parse(r io.Reader, format string) (types.PathUrlPairList, error) {
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(r); err != nil {
+		return nil, err
+	}
+	return unmarshal(v)
+}
+
+// ParseFileLines reads pairs like ParseFile, along with the line each pair starts on, so that errors can point at it.
+// Only yaml and json files are supported.
+func ParseFileLines(file string) (types.PathUrlPairList, []int, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines []int
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	switch format {
+	case "yaml", "yml":
+		format = "yaml"
+		lines, err = yamlLines(content)
+	case "json":
+		lines, err = jsonLines(content)
+	default:
+		return nil, nil, fmt.Errorf("unsupported file format: %s", file)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	pairs, err := Parse(bytes.NewReader(content), format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	if len(lines) != len(pairs) {
+		return nil, nil, fmt.Errorf("failed to locate pairs in %s", file)
+	}
+	return pairs, lines, nil
+}
+
+// yamlLines returns the line of every item of the data sequence.
+func yamlLines(content []byte) ([]int, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if !strings.EqualFold(doc.Content[i].Value, "data") {
+			continue
+		}
+		lines := make([]int, 0, len(doc.Content[i+1].Content))
+		for _, item := range doc.Content[i+1].Content {
+			lines = append(lines, item.Line)
+		}
+		return lines, nil
+	}
+	return nil, nil
+}
+
+// jsonLines returns the line of every item of the data array.
+func jsonLines(content []byte) ([]int, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if _, err := dec.Token(); err != nil { // opening brace
+		return nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if name, _ := key.(string); !strings.EqualFold(name, "data") {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := dec.Token(); err != nil { // opening bracket
+			return nil, err
+		}
+		lines := []int{}
+		for dec.More() {
+			// the offset is right after the previous token; the item starts after the separators
+			offset := int(dec.InputOffset())
+			for offset < len(content) && strings.ContainsRune(" \t\r\n,", rune(content[offset])) {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(content[:offset], []byte("\n")))
+			var item json.RawMessage
+			if err := dec.Decode(&item); err != nil {
+				return nil, err
+			}
+		}
+		return lines, nil
+	}
+	return nil, nil
+}
+
+func unmarshal(v *viper.Viper) (types.PathUrlPairList, error) {
 	var parsed pathUrlPairWrapper
-	if err := v.Unmarshal(&parsed); err != nil {
+	// yaml timestamps arrive as times already, json ones as strings
+	if err := v.Unmarshal(&parsed, viper.DecodeHook(mapstructure.StringToTimeHookFunc(time.RFC3339))); err != nil {
 		return nil, err
 	}
 	pairs := make(types.PathUrlPairList, len(parsed.Data))
@@ -26,3 +146,54 @@ func parseFile(file string) (types.PathUrlPairList, error) {
 	}
 	return pairs, nil
 }
+
+// rawPair is what WriteFile writes for every pair: use counts and mapper names are not part of the file format.
+type rawPair struct {
+	Path       string               `yaml:"path" json:"path"`
+	Url        string               `yaml:"url" json:"url"`
+	ActiveFrom *time.Time           `yaml:"activeFrom,omitempty" json:"activeFrom,omitempty"`
+	ExpiresAt  *time.Time           `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	Rules      []types.RedirectRule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Targets    []rawTarget          `yaml:"targets,omitempty" json:"targets,omitempty"`
+	Sticky     string               `yaml:"sticky,omitempty" json:"sticky,omitempty"`
+	Aliases    []string             `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+}
+
+type rawTarget struct {
+	Url    string `yaml:"url" json:"url"`
+	Weight int    `yaml:"weight" json:"weight"`
+}
+
+type rawPairWrapper struct {
+	Data []rawPair `yaml:"data" json:"data"`
+}
+
+// WriteFile writes pairs to a yaml or json file, in the format ParseFile reads.
+// The format is picked from the file extension.
+func WriteFile(file string, pairs types.PathUrlPairList) error {
+	wrapper := rawPairWrapper{Data: make([]rawPair, len(pairs))}
+	for i, pair := range pairs {
+		wrapper.Data[i] = rawPair{Path: strings.TrimPrefix(pair.Path, "/"), Url: pair.Url, ActiveFrom: pair.ActiveFrom, ExpiresAt: pair.ExpiresAt, Rules: pair.Rules, Sticky: pair.Sticky}
+		for _, target := range pair.Targets {
+			wrapper.Data[i].Targets = append(wrapper.Data[i].Targets, rawTarget{Url: target.Url, Weight: target.Weight})
+		}
+		for _, alias := range pair.Aliases {
+			wrapper.Data[i].Aliases = append(wrapper.Data[i].Aliases, strings.TrimPrefix(alias, "/"))
+		}
+	}
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(&wrapper)
+	case ".json":
+		data, err = json.MarshalIndent(&wrapper, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unsupported file format: %s", file)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
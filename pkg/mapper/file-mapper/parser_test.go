@@ -2,7 +2,10 @@ package file_mapper
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -151,7 +154,7 @@ func TestParseFile(t *testing.T) {
 			}
 			defer os.Remove(tmpfile.Name())
 
-			pairs, err := parseFile(tmpfile.Name())
+			pairs, err := ParseFile(tmpfile.Name())
 			if test.expectedError {
 				assert.Error(t, err)
 				return
@@ -161,3 +164,115 @@ func TestParseFile(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		expectedError bool
+	}{
+		{name: "yaml file", file: "maps.yaml"},
+		{name: "yml file", file: "maps.yml"},
+		{name: "json file", file: "maps.json"},
+		{name: "unsupported file", file: "maps.txt", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.file)
+			expiresAt := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+			written := types.PathUrlPairList{
+				{Path: "/fk", Url: "https://fake.com", UseCount: 3, Mapper: "file", Aliases: []string{"/fake", "/f"}},
+				{Path: "fk2", Url: "https://fake2.com", ExpiresAt: &expiresAt},
+				{Path: "fk3", Url: "https://a.com", Sticky: types.StickyCookie, Targets: []types.WeightedTarget{
+					{Url: "https://a.com", Weight: 9, UseCount: 90}, {Url: "https://b.com", Weight: 1, UseCount: 10},
+				}},
+			}
+			err := WriteFile(file, written)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			pairs, err := ParseFile(file)
+			assert.NoError(t, err)
+			want := types.PathUrlPairList{
+				{Path: "fk", Url: "https://fake.com", Aliases: []string{"fake", "f"}},
+				{Path: "fk2", Url: "https://fake2.com", ExpiresAt: &expiresAt},
+				{Path: "fk3", Url: "https://a.com", Sticky: types.StickyCookie, Targets: []types.WeightedTarget{
+					{Url: "https://a.com", Weight: 9}, {Url: "https://b.com", Weight: 1},
+				}},
+			}
+			assert.True(t, want.Equals(&pairs), "Expected %v, got %v", want, pairs)
+			assert.Zero(t, pairs[2].Targets[0].UseCount, "use counts of targets are not written")
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	pairs, err := Parse(strings.NewReader(yamlFileConfig.content), "yaml")
+	assert.NoError(t, err)
+	assert.True(t, pairList.Equals(&pairs), "Expected %v, got %v", pairList, pairs)
+
+	pairs, err = Parse(strings.NewReader(jsonFileConfig.content), "json")
+	assert.NoError(t, err)
+	assert.True(t, pairList.Equals(&pairs), "Expected %v, got %v", pairList, pairs)
+
+	_, err = Parse(strings.NewReader(malformedYamlFileConfig.content), "yaml")
+	assert.Error(t, err)
+}
+
+func TestParseFileLines(t *testing.T) {
+	tests := []struct {
+		name           string
+		tempFileConfig *tempFileConfig
+		expectedLines  []int
+		expectedError  bool
+	}{
+		{
+			name:           "yaml file",
+			tempFileConfig: yamlFileConfig,
+			expectedLines:  []int{3, 5},
+		},
+		{
+			name:           "json file",
+			tempFileConfig: jsonFileConfig,
+			expectedLines:  []int{4, 8},
+		},
+		{
+			name:           "empty file",
+			tempFileConfig: emptyFileConfig,
+			expectedLines:  nil,
+		},
+		{
+			name:           "malformed yaml file",
+			tempFileConfig: malformedYamlFileConfig,
+			expectedError:  true,
+		},
+		{
+			name:           "unsupported file",
+			tempFileConfig: unsupportedFileConfig,
+			expectedError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpfile, err := createTempFile(*test.tempFileConfig)
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			pairs, lines, err := ParseFileLines(tmpfile.Name())
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedLines, lines)
+			assert.Len(t, pairs, len(test.expectedLines))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package git_mapper
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/reimirno/golinks/pkg/logging"
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	GitMapperConfigType = "GIT"
+
+	defaultBranch = "main"
+	remoteName    = "origin"
+)
+
+var _ types.MapperConfigurer = (*GitMapperConfig)(nil)
+
+func init() {
+	mapper.Register(GitMapperConfigType, func() types.MapperConfigurer { return &GitMapperConfig{} })
+}
+
+type GitMapperConfig struct {
+	Name         string `mapstructure:"name"`
+	Repository   string `mapstructure:"repository"`   // path of the local clone
+	Remote       string `mapstructure:"remote"`       // url or path to clone, fetch and push; optional
+	Branch       string `mapstructure:"branch"`       // defaults to main
+	File         string `mapstructure:"file"`         // yaml or json links file, relative to the repository
+	SyncInterval int    `mapstructure:"syncInterval"` // in seconds, how often to fetch from the remote
+	ReadWrite    bool   `mapstructure:"readWrite"`    // readonly unless set
+}
+
+func (g *GitMapperConfig) GetName() string {
+	return g.Name
+}
+
+func (g *GitMapperConfig) GetType() string {
+	return GitMapperConfigType
+}
+
+func (g *GitMapperConfig) Singleton() bool {
+	return false
+}
+
+func (g *GitMapperConfig) GetMapper() (types.Mapper, error) {
+	if g.Repository == "" || g.File == "" {
+		return nil, fmt.Errorf("git mapper %s needs a repository and a file", g.Name)
+	}
+	if filepath.IsAbs(g.File) || strings.HasPrefix(filepath.Clean(g.File), "..") {
+		return nil, fmt.Errorf("file of git mapper %s must be inside the repository: %s", g.Name, g.File)
+	}
+	branch := g.Branch
+	if branch == "" {
+		branch = defaultBranch
+	}
+	ref := plumbing.NewBranchReferenceName(branch)
+
+	repo, err := git.PlainOpen(g.Repository)
+	if errors.Is(err, git.ErrRepositoryNotExists) && g.Remote != "" {
+		repo, err = git.PlainClone(g.Repository, false, &git.CloneOptions{
+			URL:           g.Remote,
+			RemoteName:    remoteName,
+			ReferenceName: ref,
+			SingleBranch:  true,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository of git mapper %s: %w", g.Name, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head.Name() != ref {
+		if err := worktree.Checkout(&git.CheckoutOptions{Branch: ref}); err != nil {
+			return nil, fmt.Errorf("failed to check out branch %s: %w", branch, err)
+		}
+	}
+
+	mapper := &GitMapper{
+		name:     g.Name,
+		logger:   logging.NewLogger(fmt.Sprintf("git-mapper-%s", g.Name)),
+		repo:     repo,
+		worktree: worktree,
+		file:     filepath.ToSlash(filepath.Clean(g.File)),
+		root:     g.Repository,
+		ref:      ref,
+		remote:   g.Remote != "",
+		readonly: !g.ReadWrite,
+	}
+	if err := mapper.reload(); err != nil {
+		return nil, err
+	}
+
+	if g.SyncInterval > 0 && mapper.remote {
+		done := make(chan bool)
+		ticker := time.NewTicker(time.Duration(g.SyncInterval) * time.Second)
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					mapper.sync()
+				case <-done:
+					return
+				}
+			}
+		}()
+		mapper.stop = func() {
+			ticker.Stop()
+			done <- true
+		}
+	}
+	return mapper, nil
+}
@@ -0,0 +1,88 @@
+package git_mapper
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitMapperConfig_GetName(t *testing.T) {
+	config := &GitMapperConfig{Name: "git"}
+	assert.Equal(t, "git", config.GetName())
+}
+
+func TestGitMapperConfig_GetType(t *testing.T) {
+	config := &GitMapperConfig{Name: "git"}
+	assert.Equal(t, GitMapperConfigType, config.GetType())
+}
+
+func TestGitMapperConfig_Singleton(t *testing.T) {
+	config := &GitMapperConfig{Name: "git"}
+	assert.False(t, config.Singleton())
+}
+
+func TestGitMapperConfig_GetMapper(t *testing.T) {
+	remote := newRemote(t)
+	// a clone made by a previous run is opened as is
+	existing := filepath.Join(t.TempDir(), "clone")
+	m, err := (&GitMapperConfig{Name: "git", Repository: existing, Remote: remote, File: testFile}).GetMapper()
+	assert.NoError(t, err)
+	m.Teardown()
+
+	tests := []struct {
+		name     string
+		config   *GitMapperConfig
+		wantErr  bool
+		wantPath string
+	}{
+		{
+			name:     "clone",
+			config:   &GitMapperConfig{Name: "git", Repository: filepath.Join(t.TempDir(), "clone"), Remote: remote, File: testFile, SyncInterval: 60},
+			wantPath: "/fk",
+		},
+		{
+			name:     "existing clone without remote",
+			config:   &GitMapperConfig{Name: "git", Repository: existing, File: testFile},
+			wantPath: "/fk",
+		},
+		{
+			name:    "missing repository without remote",
+			config:  &GitMapperConfig{Name: "git", Repository: filepath.Join(t.TempDir(), "missing"), File: testFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing branch",
+			config:  &GitMapperConfig{Name: "git", Repository: filepath.Join(t.TempDir(), "clone"), Remote: remote, Branch: "other", File: testFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			config:  &GitMapperConfig{Name: "git", Repository: existing, File: "other.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "file outside of the repository",
+			config:  &GitMapperConfig{Name: "git", Repository: existing, File: "../maps.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "no file",
+			config:  &GitMapperConfig{Name: "git", Repository: existing},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.config.GetMapper()
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			defer m.Teardown()
+			assert.Contains(t, m.(*GitMapper).pairs, test.wantPath)
+		})
+	}
+}
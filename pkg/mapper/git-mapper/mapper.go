@@ -0,0 +1,373 @@
+package git_mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"go.uber.org/zap"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	file_mapper "github.com/reimirno/golinks/pkg/mapper/file-mapper"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+var (
+	_ types.Mapper         = (*GitMapper)(nil)
+	_ types.MapperPinger   = (*GitMapper)(nil)
+	_ types.MapperCounter  = (*GitMapper)(nil)
+	_ types.MapperHistory  = (*GitMapper)(nil)
+	_ types.MapperReloader = (*GitMapper)(nil)
+)
+
+const (
+	committerName  = "golinks"
+	committerEmail = "golinks@localhost"
+)
+
+// GitMapper serves the links file of a git repository, at the head of a branch.
+// Every write is a commit authored by the actor of the request, and pushed to the remote if there is one,
+// so that links can be reviewed and reverted like code.
+type GitMapper struct {
+	mapper.ReloadHooks
+	name     string
+	logger   *zap.SugaredLogger
+	repo     *git.Repository
+	worktree *git.Worktree
+	root     string
+	file     string // slash-separated, relative to root
+	ref      plumbing.ReferenceName
+	remote   bool
+	readonly bool
+	stop     func()
+
+	mu      sync.RWMutex
+	pairs   types.PathUrlPairMap
+	aliases map[string]string // alias -> path
+	syncErr error             // outcome of the last sync with the remote
+}
+
+func (g *GitMapper) GetName() string {
+	return g.name
+}
+
+func (g *GitMapper) GetType() string {
+	return GitMapperConfigType
+}
+
+func (g *GitMapper) Readonly() bool {
+	return g.readonly
+}
+
+func (g *GitMapper) Teardown() error {
+	if g.stop != nil {
+		g.stop()
+	}
+	return nil
+}
+
+// Ping fails while the last sync with the remote failed, for example because the branch diverged.
+func (g *GitMapper) Ping(ctx context.Context) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.syncErr
+}
+
+func (g *GitMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	pair, ok := g.pairs[path]
+	if !ok {
+		pair, ok = g.pairs[g.aliases[path]]
+	}
+	if !ok {
+		return nil, nil
+	}
+	return pair.Clone(), nil
+}
+
+func (g *GitMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return utils.PaginatePairs(g.pairs.ToList(), pagination)
+}
+
+func (g *GitMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	if g.readonly {
+		return nil, mapper.ErrOperationNotSupported("put")
+	}
+	err := g.commit(ctx, fmt.Sprintf("Put %s -> %s", pair.Path, pair.Url), func(raw types.PathUrlPairList) (types.PathUrlPairList, bool) {
+		for _, existing := range raw {
+			if canonical, err := sanitizer.CanonicalizePath(existing.Path); err == nil && canonical == pair.Path {
+				updated := &types.PathUrlPair{Path: existing.Path, Url: pair.Url, ActiveFrom: pair.ActiveFrom, ExpiresAt: pair.ExpiresAt, Rules: pair.Rules,
+					Targets: pair.Targets, Sticky: pair.Sticky, Aliases: pair.Aliases, UseCount: existing.UseCount}
+				changed := !existing.Equals(updated)
+				*existing = *updated
+				return raw, changed
+			}
+		}
+		return append(raw, &types.PathUrlPair{Path: pair.Path, Url: pair.Url, ActiveFrom: pair.ActiveFrom, ExpiresAt: pair.ExpiresAt, Rules: pair.Rules,
+			Targets: pair.Targets, Sticky: pair.Sticky, Aliases: pair.Aliases}), true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (g *GitMapper) DeleteUrl(ctx context.Context, path string) error {
+	if g.readonly {
+		return mapper.ErrOperationNotSupported("delete")
+	}
+	return g.commit(ctx, fmt.Sprintf("Delete %s", path), func(raw types.PathUrlPairList) (types.PathUrlPairList, bool) {
+		kept := make(types.PathUrlPairList, 0, len(raw))
+		for _, existing := range raw {
+			if canonical, err := sanitizer.CanonicalizePath(existing.Path); err == nil && canonical == path {
+				continue
+			}
+			kept = append(kept, existing)
+		}
+		return kept, len(kept) != len(raw)
+	})
+}
+
+// IncrementUseCount does not count: committing every click would bury the changes worth reviewing.
+func (g *GitMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	return 0, fmt.Errorf("%w: git mapper %s does not count clicks", errors.ErrUnsupported, g.name)
+}
+
+// History walks the commits that changed the links file, and keeps those that changed the url of path.
+func (g *GitMapper) History(ctx context.Context, path string, limit int) ([]types.HistoryEntry, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	head, err := g.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commits, err := g.repo.Log(&git.LogOptions{From: head.Hash(), FileName: &g.file})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	// commits come newest first: a commit is a change if its url differs from the one of the next, older commit
+	entries := []types.HistoryEntry{}
+	var pending *types.HistoryEntry
+	err = commits.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		url, ok, err := g.urlAt(c, path)
+		if err != nil || !ok {
+			return err
+		}
+		if pending != nil && pending.Url != url {
+			entries = append(entries, *pending)
+			if limit > 0 && len(entries) >= limit {
+				pending = nil
+				return storer.ErrStop
+			}
+		}
+		pending = &types.HistoryEntry{
+			Revision: c.Hash.String(),
+			Author:   c.Author.Name,
+			Time:     c.Author.When,
+			Message:  strings.TrimSpace(c.Message),
+			Url:      url,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil && pending.Url != "" {
+		entries = append(entries, *pending)
+	}
+	return entries, nil
+}
+
+// urlAt returns the url of path in the links file as of commit c, or an empty string if it is not there.
+// It is not ok if that revision of the file cannot be parsed, as it tells nothing about path.
+func (g *GitMapper) urlAt(c *object.Commit, path string) (string, bool, error) {
+	file, err := c.File(g.file)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+	pairs, err := file_mapper.Parse(reader, g.format())
+	if err != nil {
+		return "", false, nil
+	}
+	for _, pair := range pairs {
+		if canonical, err := sanitizer.CanonicalizePath(pair.Path); err == nil && canonical == path {
+			return pair.Url, true, nil
+		}
+	}
+	return "", true, nil
+}
+
+func (g *GitMapper) format() string {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(g.file), "."))
+	if format == "yml" {
+		return "yaml"
+	}
+	return format
+}
+
+// commit applies change to the links file as last committed, then commits and pushes it.
+// The paths in the file are left as written, except for the changed entry.
+// A change that leaves the file invalid is not committed. If the push is rejected, the commit is undone,
+// and the write fails until the next sync.
+func (g *GitMapper) commit(ctx context.Context, message string, change func(types.PathUrlPairList) (types.PathUrlPairList, bool)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(g.root, filepath.FromSlash(g.file))
+	raw, err := file_mapper.ParseFile(path)
+	if err != nil {
+		return err
+	}
+	raw, changed := change(raw)
+	if !changed {
+		return nil
+	}
+	// validated before anything is committed, as nothing can be undone once pushed
+	pairs, err := g.sanitize(raw)
+	if err != nil {
+		return err
+	}
+	head, err := g.repo.Head()
+	if err != nil {
+		return err
+	}
+	if err := file_mapper.WriteFile(path, raw); err != nil {
+		return err
+	}
+	if _, err := g.worktree.Add(g.file); err != nil {
+		g.resetTo(head.Hash())
+		return err
+	}
+	now := time.Now()
+	_, err = g.worktree.Commit(message, &git.CommitOptions{
+		Author:    author(ctx, now),
+		Committer: &object.Signature{Name: committerName, Email: committerEmail, When: now},
+	})
+	if err != nil {
+		g.resetTo(head.Hash())
+		return err
+	}
+	if g.remote {
+		err = g.repo.PushContext(ctx, &git.PushOptions{
+			RemoteName: remoteName,
+			RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", g.ref, g.ref))},
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			g.resetTo(head.Hash())
+			return fmt.Errorf("failed to push to the remote of git mapper %s: %w", g.name, err)
+		}
+	}
+	g.pairs, g.aliases = pairs, pairs.Aliases()
+	return nil
+}
+
+func (g *GitMapper) resetTo(hash plumbing.Hash) {
+	if err := g.worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		g.logger.Errorf("Failed to undo commit: %v", err)
+	}
+}
+
+// author names the actor of the request, or golinks itself for anonymous requests.
+func author(ctx context.Context, when time.Time) *object.Signature {
+	actor := utils.ActorFromContext(ctx)
+	if actor == "" {
+		return &object.Signature{Name: committerName, Email: committerEmail, When: when}
+	}
+	email := ""
+	if strings.Contains(actor, "@") {
+		email = actor
+	}
+	return &object.Signature{Name: actor, Email: email, When: when}
+}
+
+// sync fast-forwards the branch to the remote, and reloads the links file.
+// A branch that cannot be fast-forwarded keeps being served as is, and makes the mapper unhealthy.
+// The reload hooks are called when the remote had new commits.
+func (g *GitMapper) sync() {
+	g.mu.Lock()
+	err := g.worktree.Pull(&git.PullOptions{
+		RemoteName:    remoteName,
+		ReferenceName: g.ref,
+		SingleBranch:  true,
+	})
+	pulled := err == nil
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		err = nil
+	}
+	if err == nil {
+		err = g.load()
+	}
+	if err != nil {
+		g.logger.Errorf("Failed to sync with remote: %v", err)
+	} else {
+		g.logger.Debugf("Synced with remote")
+	}
+	g.syncErr = err
+	g.mu.Unlock()
+	if pulled && err == nil {
+		g.Reloaded()
+	}
+}
+
+func (g *GitMapper) reload() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.load()
+}
+
+// load parses the links file from the worktree. The caller must hold the lock.
+func (g *GitMapper) load() error {
+	list, err := file_mapper.ParseFile(filepath.Join(g.root, filepath.FromSlash(g.file)))
+	if err != nil {
+		return err
+	}
+	pairs, err := g.sanitize(list)
+	if err != nil {
+		return err
+	}
+	g.pairs, g.aliases = pairs, pairs.Aliases()
+	return nil
+}
+
+// sanitize returns the pairs of list as they are served, leaving list as written.
+func (g *GitMapper) sanitize(list types.PathUrlPairList) (types.PathUrlPairMap, error) {
+	cloned := make(types.PathUrlPairList, len(list))
+	for i, pair := range list {
+		cloned[i] = pair.Clone()
+	}
+	pairs := cloned.ToMap()
+	if err := sanitizer.SanitizeInputMap(g, &pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
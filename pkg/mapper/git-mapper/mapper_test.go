@@ -0,0 +1,282 @@
+package git_mapper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	file_mapper "github.com/reimirno/golinks/pkg/mapper/file-mapper"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+const (
+	testFile   = "links/maps.yaml"
+	testBranch = "main"
+)
+
+var (
+	seedPairs = types.PathUrlPairList{
+		{Path: "zz", Url: "https://last.com"},
+		{Path: "fk", Url: "https://fake.com"},
+	}
+	newPair = &types.PathUrlPair{Path: "/fk2", Url: "https://fake2.com"}
+)
+
+// commitFile writes pairs to the links file of a worktree, and commits it as someone else than golinks.
+func commitFile(t *testing.T, dir string, pairs types.PathUrlPairList, message string) {
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(testFile)), 0o755))
+	require.NoError(t, file_mapper.WriteFile(filepath.Join(dir, testFile), pairs))
+	_, err = wt.Add(testFile)
+	require.NoError(t, err)
+	_, err = wt.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: "seed", Email: "seed@example.com", When: time.Now()}})
+	require.NoError(t, err)
+}
+
+// newRemote creates a bare repository with the seed pairs on the main branch, and returns its path.
+func newRemote(t *testing.T) string {
+	ref := plumbing.NewBranchReferenceName(testBranch)
+	remote := t.TempDir()
+	_, err := git.PlainInitWithOptions(remote, &git.PlainInitOptions{Bare: true, InitOptions: git.InitOptions{DefaultBranch: ref}})
+	require.NoError(t, err)
+
+	seed := t.TempDir()
+	repo, err := git.PlainInitWithOptions(seed, &git.PlainInitOptions{InitOptions: git.InitOptions{DefaultBranch: ref}})
+	require.NoError(t, err)
+	commitFile(t, seed, seedPairs, "Seed links")
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: remoteName, URLs: []string{remote}})
+	require.NoError(t, err)
+	require.NoError(t, repo.Push(&git.PushOptions{RemoteName: remoteName}))
+	return remote
+}
+
+func newTestMapper(t *testing.T, remote string, readWrite bool) *GitMapper {
+	cfg := &GitMapperConfig{
+		Name:       "git",
+		Repository: filepath.Join(t.TempDir(), "clone"),
+		Remote:     remote,
+		File:       testFile,
+		ReadWrite:  readWrite,
+	}
+	m, err := cfg.GetMapper()
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Teardown() })
+	return m.(*GitMapper)
+}
+
+func remoteHead(t *testing.T, remote string) *object.Commit {
+	repo, err := git.PlainOpen(remote)
+	require.NoError(t, err)
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(testBranch), true)
+	require.NoError(t, err)
+	commit, err := repo.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	return commit
+}
+
+func TestGitMapper_Read(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, newRemote(t), false)
+	assert.True(t, m.Readonly())
+
+	got, err := m.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.PathUrlPair{Path: "/fk", Url: "https://fake.com", Mapper: "git"}, got)
+	got, err = m.GetUrl(ctx, "/missing")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	pairs, err := m.ListUrls(ctx, types.Pagination{Offset: 0, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+	assert.Equal(t, "/fk", pairs[0].Path)
+	assert.Equal(t, "/zz", pairs[1].Path)
+
+	_, err = m.PutUrl(ctx, newPair.Clone())
+	assert.Error(t, err)
+	assert.Error(t, m.DeleteUrl(ctx, "/fk"))
+	assert.NoError(t, m.Ping(ctx))
+}
+
+func TestGitMapper_WritesAreCommits(t *testing.T) {
+	ctx := utils.WithActor(context.Background(), "alice@example.com")
+	remote := newRemote(t)
+	m := newTestMapper(t, remote, true)
+
+	_, err := m.PutUrl(ctx, newPair.Clone())
+	assert.NoError(t, err)
+	head := remoteHead(t, remote)
+	assert.Equal(t, "alice@example.com", head.Author.Name)
+	assert.Equal(t, "alice@example.com", head.Author.Email)
+	assert.Equal(t, committerName, head.Committer.Name)
+	assert.Contains(t, head.Message, "/fk2")
+
+	got, err := m.GetUrl(ctx, newPair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, newPair.Url, got.Url)
+
+	// paths that are not changed are written back as they were
+	pairs, err := file_mapper.ParseFile(filepath.Join(m.root, testFile))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"zz", "fk", "fk2"}, []string{pairs[0].Path, pairs[1].Path, pairs[2].Path})
+
+	// writing the same url again does not make an empty commit
+	_, err = m.PutUrl(ctx, newPair.Clone())
+	assert.NoError(t, err)
+	assert.Equal(t, head.Hash, remoteHead(t, remote).Hash)
+
+	// aliases are written to the file, and resolve once it is reloaded
+	aliased := newPair.Clone()
+	aliased.Aliases = []string{"/fake2"}
+	_, err = m.PutUrl(ctx, aliased)
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, "/fake2")
+	assert.NoError(t, err)
+	assert.Equal(t, newPair.Path, got.Path)
+
+	// anonymous writes are authored by golinks
+	assert.NoError(t, m.DeleteUrl(context.Background(), "/fk"))
+	assert.Equal(t, committerName, remoteHead(t, remote).Author.Name)
+	got, err = m.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestGitMapper_History(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, newRemote(t), true)
+
+	_, err := m.PutUrl(utils.WithActor(ctx, "alice"), &types.PathUrlPair{Path: "/fk", Url: "https://changed.com"})
+	assert.NoError(t, err)
+	// a change to another path is not part of the history of /fk
+	_, err = m.PutUrl(ctx, newPair.Clone())
+	assert.NoError(t, err)
+	assert.NoError(t, m.DeleteUrl(utils.WithActor(ctx, "bob"), "/fk"))
+
+	entries, err := m.History(ctx, "/fk", 10)
+	assert.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "bob", entries[0].Author)
+	assert.Equal(t, "", entries[0].Url)
+	assert.Equal(t, "alice", entries[1].Author)
+	assert.Equal(t, "https://changed.com", entries[1].Url)
+	assert.Equal(t, "seed", entries[2].Author)
+	assert.Equal(t, "https://fake.com", entries[2].Url)
+	assert.Equal(t, "Seed links", entries[2].Message)
+
+	entries, err = m.History(ctx, "/fk", 1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = m.History(ctx, "/missing", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestGitMapper_Sync(t *testing.T) {
+	ctx := context.Background()
+	remote := newRemote(t)
+	a := newTestMapper(t, remote, true)
+	b := newTestMapper(t, remote, true)
+	reloads := 0
+	b.OnReload(func() { reloads++ })
+
+	b.sync()
+	assert.Zero(t, reloads, "nothing to pull")
+	_, err := a.PutUrl(ctx, newPair.Clone())
+	assert.NoError(t, err)
+	got, err := b.GetUrl(ctx, newPair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	b.sync()
+	assert.Equal(t, 1, reloads)
+	assert.NoError(t, b.Ping(ctx))
+	got, err = b.GetUrl(ctx, newPair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, newPair.Url, got.Url)
+
+	// b diverges from the remote: it keeps serving its own copy, and reports itself unhealthy
+	commitFile(t, b.root, seedPairs, "Local change")
+	assert.NoError(t, a.DeleteUrl(ctx, "/fk"))
+	b.sync()
+	assert.Error(t, b.Ping(ctx))
+	assert.Equal(t, 1, reloads)
+	got, err = b.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+}
+
+func TestGitMapper_InvalidChange(t *testing.T) {
+	ctx := context.Background()
+	remote := newRemote(t)
+	m := newTestMapper(t, remote, true)
+	before := remoteHead(t, remote)
+
+	// the alias is the path of another pair: nothing is committed, and the file is left as it was
+	_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: "/fk2", Url: "https://fake2.com", Aliases: []string{"/zz"}})
+	assert.Error(t, err)
+	assert.Equal(t, before.Hash, remoteHead(t, remote).Hash)
+	head, err := m.repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, before.Hash, head.Hash())
+	raw, err := file_mapper.ParseFile(filepath.Join(m.root, testFile))
+	require.NoError(t, err)
+	assert.Len(t, raw, len(seedPairs))
+	got, err := m.GetUrl(ctx, "/fk2")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestGitMapper_UseCount(t *testing.T) {
+	m := newTestMapper(t, newRemote(t), true)
+	before, err := m.repo.Head()
+	require.NoError(t, err)
+
+	// clicks are not committed
+	_, err = m.IncrementUseCount(context.Background(), "/fk")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	after, err := m.repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, before.Hash(), after.Hash())
+}
+
+func TestGitMapper_RejectedPush(t *testing.T) {
+	ctx := context.Background()
+	remote := newRemote(t)
+	a := newTestMapper(t, remote, true)
+	b := newTestMapper(t, remote, true)
+
+	_, err := a.PutUrl(ctx, newPair.Clone())
+	assert.NoError(t, err)
+
+	// b is behind: its commit cannot be pushed, and is undone
+	before, err := b.repo.Head()
+	require.NoError(t, err)
+	assert.Error(t, b.DeleteUrl(ctx, "/fk"))
+	after, err := b.repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, before.Hash(), after.Hash())
+	got, err := b.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+
+	// once synced, the write goes through
+	b.sync()
+	assert.NoError(t, b.DeleteUrl(ctx, "/fk"))
+	assert.Contains(t, remoteHead(t, remote).Message, "/fk")
+}
@@ -0,0 +1,70 @@
+package mapper
+
+import (
+	"context"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+type MapperHealth struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Healthy  bool   `json:"healthy"`
+	Required bool   `json:"required"` // an unhealthy required mapper makes the whole service not ready
+	Error    string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Ready        bool           `json:"ready"`
+	ShuttingDown bool           `json:"shuttingDown"`
+	Mappers      []MapperHealth `json:"mappers"`
+}
+
+// BeginShutdown marks the manager as shutting down, so that every service reports not ready
+// while it drains. It cannot be undone.
+func (m *MapperManager) BeginShutdown() {
+	m.shuttingDown.Store(true)
+}
+
+func (m *MapperManager) ShuttingDown() bool {
+	return m.shuttingDown.Load()
+}
+
+// Health pings every mapper that supports it, within the mapper's request timeout.
+// The manager is ready unless it is shutting down, or a mapper that fails lookups under its
+// failure policy (fail) is unhealthy. Mappers that are skipped or served stale on error are
+// reported, but do not affect readiness.
+func (m *MapperManager) Health(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Ready:        !m.ShuttingDown(),
+		ShuttingDown: m.ShuttingDown(),
+		Mappers:      make([]MapperHealth, 0, len(m.mappers)),
+	}
+	for _, mapper := range m.mappers {
+		health := MapperHealth{
+			Name:     mapper.GetName(),
+			Type:     mapper.GetType(),
+			Healthy:  true,
+			Required: m.state(mapper).policy == FailurePolicy_FailFast,
+		}
+		if err := m.ping(ctx, mapper); err != nil {
+			health.Healthy = false
+			health.Error = err.Error()
+			if health.Required {
+				report.Ready = false
+			}
+		}
+		report.Mappers = append(report.Mappers, health)
+	}
+	return report
+}
+
+func (m *MapperManager) ping(ctx context.Context, mapper types.Mapper) error {
+	pinger, ok := mapper.(types.MapperPinger)
+	if !ok {
+		return nil
+	}
+	callCtx, cancel := m.withMapperTimeout(ctx, mapper)
+	defer cancel()
+	return wrapMapperError(mapper, pinger.Ping(callCtx))
+}
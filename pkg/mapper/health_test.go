@@ -0,0 +1,58 @@
+package mapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapperManager_Health(t *testing.T) {
+	tests := []struct {
+		name      string
+		failing   string
+		settings  MapperSettings
+		wantReady bool
+	}{
+		{name: "all healthy", wantReady: true},
+		{name: "required mapper unhealthy", failing: mockConfigurer.Name, wantReady: false},
+		{name: "skipped mapper unhealthy", failing: mockConfigurer.Name, settings: MapperSettings{OnError: "skip"}, wantReady: true},
+		{name: "stale mapper unhealthy", failing: mockConfigurer.Name, settings: MapperSettings{OnError: "stale"}, wantReady: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mm, err := NewMapperManager(mockConfigurer.Name,
+				CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}),
+				WithMapperSettings(mockConfigurer.Name, test.settings))
+			assert.NoError(t, err)
+			if test.failing != "" {
+				findMapper(mm.mappers, test.failing).(*MockMapper).Err = assert.AnError
+			}
+
+			report := mm.Health(context.Background())
+			assert.Equal(t, test.wantReady, report.Ready)
+			assert.False(t, report.ShuttingDown)
+			assert.Equal(t, 2, len(report.Mappers))
+			for _, health := range report.Mappers {
+				assert.Equal(t, health.Name != test.failing, health.Healthy)
+				assert.Equal(t, health.Name == mockConfigurer2.Name || test.settings.OnError == "", health.Required)
+				if !health.Healthy {
+					assert.Contains(t, health.Error, assert.AnError.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestMapperManager_BeginShutdown(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer}))
+	assert.NoError(t, err)
+	assert.True(t, mm.Health(context.Background()).Ready)
+
+	mm.BeginShutdown()
+	report := mm.Health(context.Background())
+	assert.False(t, report.Ready)
+	assert.True(t, report.ShuttingDown)
+	assert.True(t, report.Mappers[0].Healthy)
+}
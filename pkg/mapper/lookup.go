@@ -0,0 +1,63 @@
+package mapper
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	HeaderIncomplete     = "X-Golinks-Incomplete"
+	HeaderSkippedMappers = "X-Golinks-Skipped-Mappers"
+	HeaderStaleMappers   = "X-Golinks-Stale-Mappers"
+)
+
+// LookupStatus tells how complete the answer of a read is.
+// A lookup is incomplete when some mapper could not be consulted,
+// either because it failed or because its circuit breaker is open,
+// or when some mapper answered from stale data.
+type LookupStatus struct {
+	Skipped []string
+	Stale   []string
+}
+
+func (s LookupStatus) Incomplete() bool {
+	return len(s.Skipped) > 0 || len(s.Stale) > 0
+}
+
+func (s *LookupStatus) markSkipped(name string) {
+	if !slices.Contains(s.Skipped, name) {
+		s.Skipped = append(s.Skipped, name)
+	}
+}
+
+func (s *LookupStatus) markStale(name string) {
+	if !slices.Contains(s.Stale, name) {
+		s.Stale = append(s.Stale, name)
+	}
+}
+
+// merge adds the mappers of a lookup that is part of the same read.
+func (s *LookupStatus) merge(other LookupStatus) {
+	for _, name := range other.Skipped {
+		s.markSkipped(name)
+	}
+	for _, name := range other.Stale {
+		s.markStale(name)
+	}
+}
+
+// WriteHeaders reports an incomplete lookup on an HTTP response.
+// Nothing is written for a complete lookup.
+func (s LookupStatus) WriteHeaders(h http.Header) {
+	if !s.Incomplete() {
+		return
+	}
+	h.Set(HeaderIncomplete, "true")
+	if len(s.Skipped) > 0 {
+		h.Set(HeaderSkippedMappers, strings.Join(s.Skipped, ","))
+	}
+	if len(s.Stale) > 0 {
+		h.Set(HeaderStaleMappers, strings.Join(s.Stale, ","))
+	}
+}
@@ -1,22 +1,47 @@
 package mapper
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/reimirno/golinks/pkg/logging"
 	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
 )
 
+// listInStatesPageSize is how many pairs ListUrlsInStates reads at once, at least.
+const listInStatesPageSize = 100
+
 type MapperManager struct {
-	mappers   []types.Mapper
-	persistor types.Mapper
-	logger    *zap.SugaredLogger
+	mappers      []types.Mapper
+	persistor    types.Mapper
+	logger       *zap.SugaredLogger
+	tracer       trace.Tracer
+	states       map[string]*mapperState
+	mirrors      []*mirror
+	stopMirrors  func()
+	reaper       *reaper
+	stopReaper   func()
+	patternStore *patternStore
+	suggestIndex *suggestIndex
+	stopPatterns func()
+	stopSuggest  func()
+	namespaces   []*namespace
+	checker      *checker
+	stopChecker  func()
+	shuttingDown atomic.Bool
 }
 
-func NewMapperManager(persistorName string, mapConfigs []types.MapperConfigurer) (*MapperManager, error) {
+func NewMapperManager(persistorName string, mapConfigs []types.MapperConfigurer, opts ...ManagerOption) (*MapperManager, error) {
 	l := logging.NewLogger("mapper")
 
 	m, err := validateAndGetMappers(mapConfigs)
@@ -40,14 +65,47 @@ func NewMapperManager(persistorName string, mapConfigs []types.MapperConfigurer)
 		l.Warn("No persistor is configured")
 	}
 
-	return &MapperManager{
+	manager := &MapperManager{
 		mappers:   m,
 		persistor: p,
 		logger:    l,
-	}, nil
+		tracer:    tracing.Tracer("mapper"),
+		states:    make(map[string]*mapperState),
+
+		patternStore: newPatternStore(),
+		suggestIndex: newSuggestIndex(),
+	}
+	for _, mapper := range m {
+		manager.states[mapper.GetName()], _ = newMapperState(MapperSettings{})
+	}
+	for _, opt := range opts {
+		if err = opt(manager); err != nil {
+			l.Errorf("Failed to apply manager option: %v", err)
+			_ = manager.Teardown()
+			return nil, err
+		}
+	}
+	return manager, nil
 }
 
 func (m *MapperManager) Teardown() error {
+	m.BeginShutdown()
+	if m.stopChecker != nil {
+		m.stopChecker()
+	}
+	if m.stopPatterns != nil {
+		m.stopPatterns()
+	}
+	if m.stopSuggest != nil {
+		m.stopSuggest()
+	}
+	// the reaper replicates its deletes, so it stops before the mirrors
+	if m.stopReaper != nil {
+		m.stopReaper()
+	}
+	if m.stopMirrors != nil {
+		m.stopMirrors()
+	}
 	for _, mapper := range m.mappers {
 		err := mapper.Teardown()
 		if err != nil {
@@ -59,28 +117,107 @@ func (m *MapperManager) Teardown() error {
 	return nil
 }
 
-func (m *MapperManager) GetUrl(path string, incrementCounter bool) (*types.PathUrlPair, error) {
+func (m *MapperManager) GetUrl(ctx context.Context, path string, incrementCounter bool) (*types.PathUrlPair, error) {
+	pair, _, err := m.GetUrlWithStatus(ctx, path, incrementCounter)
+	return pair, err
+}
+
+// GetUrlWithStatus is GetUrl, but also tells whether some mappers were skipped or answered from stale data.
+// A miss in an incomplete lookup does not mean that the path is unmapped.
+// A path outside of the namespaces is looked up in the default namespace of the actor first (see WithNamespaces),
+// and a path that no path or alias matches is matched against the patterns (see MatchPattern).
+func (m *MapperManager) GetUrlWithStatus(ctx context.Context, path string, incrementCounter bool) (*types.PathUrlPair, LookupStatus, error) {
+	return m.getUrl(ctx, path, incrementCounter, true)
+}
+
+// getUrl is GetUrlWithStatus, but only looks up the path itself, without the patterns, unless resolve is set,
+// for writes that must tell whether a path itself is taken.
+func (m *MapperManager) getUrl(ctx context.Context, path string, incrementCounter bool, resolve bool) (*types.PathUrlPair, LookupStatus, error) {
+	ctx, span := m.tracer.Start(ctx, "MapperManager.GetUrl", trace.WithAttributes(tracing.AttrPath.String(path)))
+	defer span.End()
+
+	var status LookupStatus
 	m.logger.Debugf("Getting url: %s", path)
 	canonicalPath, err := sanitizer.CanonicalizePath(path)
 	if err != nil {
-		return nil, err
+		tracing.RecordError(span, err)
+		return nil, status, err
 	}
+	if canonicalPath, err = m.ownPath(ctx, canonicalPath); err != nil {
+		tracing.RecordError(span, err)
+		return nil, status, err
+	}
+	span.SetAttributes(tracing.AttrCanonicalPath.String(canonicalPath))
 	m.logger.Debugf("Path canonicalized: %s -> %s", path, canonicalPath)
+	candidates := []string{canonicalPath}
+	if resolve {
+		if candidates, err = m.candidates(ctx, canonicalPath); err != nil {
+			tracing.RecordError(span, err)
+			return nil, status, err
+		}
+	}
+	for _, candidate := range candidates {
+		pair, err := m.lookup(ctx, candidate, incrementCounter, &status)
+		if err != nil {
+			tracing.RecordError(span, err)
+			return nil, status, err
+		}
+		if pair != nil {
+			span.SetAttributes(tracing.AttrFound.Bool(true), tracing.AttrMapperName.String(pair.Mapper), tracing.AttrIncomplete.Bool(status.Incomplete()))
+			return pair, status, nil
+		}
+	}
+	if resolve {
+		for _, candidate := range candidates {
+			pair, err := m.matchPattern(ctx, candidate, incrementCounter, &status)
+			if err != nil {
+				tracing.RecordError(span, err)
+				return nil, status, err
+			}
+			if pair != nil {
+				m.logger.Debugf("Pattern %s of mapper %s used", pair.Path, pair.Mapper)
+				span.SetAttributes(tracing.AttrFound.Bool(true), tracing.AttrMapperName.String(pair.Mapper), tracing.AttrIncomplete.Bool(status.Incomplete()))
+				return pair, status, nil
+			}
+		}
+	}
+	span.SetAttributes(tracing.AttrFound.Bool(false), tracing.AttrIncomplete.Bool(status.Incomplete()))
+	m.logger.Debugf("No mapper is available for path %s (raw: %s)", canonicalPath, path)
+	return nil, status, nil
+}
+
+// lookup returns the pair that canonicalPath is the path or an alias of, from the mappers of its namespace,
+// or nil if none has it.
+func (m *MapperManager) lookup(ctx context.Context, canonicalPath string, incrementCounter bool, status *LookupStatus) (*types.PathUrlPair, error) {
 	// mapper order is important here
 	// mappers in the front takes precedence over mappers in the back
-	for _, mapper := range m.mappers {
+	for _, mapper := range m.mappersOf(m.namespaceOf(canonicalPath)) {
 		m.logger.Debugf("Trying mapper %s for path %s", mapper.GetName(), canonicalPath)
-		pair, err := mapper.GetUrl(canonicalPath)
+		pair, err := m.getFromMapper(ctx, mapper, canonicalPath)
 		if err != nil {
-			m.logger.Errorf("Failed to get url at mapper %s: %v", mapper.GetName(), err)
-			return nil, err
+			if !m.tolerate(ctx, mapper) {
+				m.logger.Errorf("Failed to get url at mapper %s: %v", mapper.GetName(), err)
+				return nil, err
+			}
+			m.logger.Warnf("Skipping mapper %s for path %s: %v", mapper.GetName(), canonicalPath, err)
+			if pair = m.stalePair(mapper, canonicalPath); pair == nil {
+				status.markSkipped(mapper.GetName())
+				continue
+			}
+			status.markStale(mapper.GetName())
+			sanitizer.SanitizeOutput(mapper, pair)
+			return pair, nil
 		}
 		if pair != nil {
 			m.logger.Debugf("Mapper %s used", mapper.GetName())
-			if incrementCounter && !mapper.Readonly() {
+			// only clicks that redirect are counted; those of readonly mappers are only recorded as recent uses
+			clicked := incrementCounter && pair.State(time.Now()) == types.LinkState_Active
+			if clicked {
+				m.suggestIndex.used(pair.Path)
+			}
+			if clicked && !mapper.Readonly() {
 				m.logger.Debugf("Try to increment counter at mapper %s: %d -> %d", mapper.GetName(), pair.UseCount, pair.UseCount+1)
-				pair.UseCount = pair.UseCount + 1
-				_, err = mapper.PutUrl(pair)
+				err = m.incrementInMapper(ctx, mapper, pair)
 				if err != nil {
 					m.logger.Errorf("Failed to increment counter at mapper %s: %v", mapper.GetName(), err)
 				}
@@ -89,19 +226,61 @@ func (m *MapperManager) GetUrl(path string, incrementCounter bool) (*types.PathU
 			return pair, nil
 		}
 	}
-	m.logger.Debugf("No mapper is available for path %s (raw: %s)", canonicalPath, path)
 	return nil, nil
 }
 
-func (m *MapperManager) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
+// IncrementTargetUseCount counts a request sent to the target of pair with url, in the mapper that pair came from,
+// which is left alone if it is readonly. Pair is one returned by GetUrl, and gets the new count.
+func (m *MapperManager) IncrementTargetUseCount(ctx context.Context, pair *types.PathUrlPair, url string) error {
+	ctx, span := m.tracer.Start(ctx, "MapperManager.IncrementTargetUseCount", trace.WithAttributes(tracing.AttrPath.String(pair.Path)))
+	defer span.End()
+
+	mapper := findMapper(m.mappers, pair.Mapper)
+	if mapper == nil {
+		return ErrInvalidMapper(pair.Mapper)
+	}
+	if mapper.Readonly() {
+		return nil
+	}
+	m.logger.Debugf("Try to increment counter of target %s of %s at mapper %s", url, pair.Path, mapper.GetName())
+	err := m.incrementTargetInMapper(ctx, mapper, pair, url)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (m *MapperManager) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	pairs, _, err := m.ListUrlsWithStatus(ctx, pagination)
+	return pairs, err
+}
+
+// ListUrlsWithStatus is ListUrls, but also tells whether some mappers were skipped or answered from stale data.
+func (m *MapperManager) ListUrlsWithStatus(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, LookupStatus, error) {
+	return m.listUrls(ctx, m.mappers, pagination)
+}
+
+func (m *MapperManager) listUrls(ctx context.Context, mappers []types.Mapper, pagination types.Pagination) (types.PathUrlPairList, LookupStatus, error) {
+	ctx, span := m.tracer.Start(ctx, "MapperManager.ListUrls")
+	defer span.End()
+
+	var status LookupStatus
 	m.logger.Debugf("Listing urls")
 	// mapper order is important here
 	// mappers in the front takes precedence over mappers in the back
 	urlMap := make(types.PathUrlPairMap)
-	for _, mapper := range m.mappers {
-		urls, err := mapper.ListUrls(pagination)
+	for _, mapper := range mappers {
+		urls, err := m.listFromMapper(ctx, mapper, pagination)
 		if err != nil {
-			return nil, err
+			if !m.tolerate(ctx, mapper) {
+				tracing.RecordError(span, err)
+				return nil, status, err
+			}
+			m.logger.Warnf("Skipping mapper %s for listing: %v", mapper.GetName(), err)
+			var ok bool
+			if urls, ok = m.staleList(mapper, pagination); !ok {
+				status.markSkipped(mapper.GetName())
+				continue
+			}
+			status.markStale(mapper.GetName())
 		}
 		for _, url := range urls {
 			if urlMap[url.Path] == nil {
@@ -110,82 +289,292 @@ func (m *MapperManager) ListUrls(pagination types.Pagination) (types.PathUrlPair
 			}
 		}
 	}
+	span.SetAttributes(tracing.AttrIncomplete.Bool(status.Incomplete()))
 	m.logger.Debugf("found %d urls", len(urlMap))
-	return urlMap.ToList(), nil
+	// every mapper lists in path order: the first pairs of the merged pages are the first pairs overall,
+	// so that the next page can resume after the last of them
+	pairs := urlMap.ToList()
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Path < pairs[j].Path })
+	if pagination.Cursor != "" || pagination.Offset == 0 {
+		pairs = utils.Paginate(pairs, types.Pagination{Offset: 0, Limit: pagination.Limit})
+	}
+	return pairs, status, nil
+}
+
+// ListUrlsInStates is ListUrlsWithStatus, keeping only the pairs that are in one of states now;
+// every pair is kept if states is empty. Offset and Limit count the kept pairs.
+func (m *MapperManager) ListUrlsInStates(ctx context.Context, pagination types.Pagination, states []types.LinkState) (types.PathUrlPairList, LookupStatus, error) {
+	return m.ListUrlsInNamespace(ctx, "", pagination, states)
+}
+
+func (m *MapperManager) state(mapper types.Mapper) *mapperState {
+	return m.states[mapper.GetName()]
+}
+
+// tolerate tells whether a failed call may be worked around under the mapper's failure policy.
+// Nothing is tolerated once the caller has given up, as there is nobody left to serve.
+func (m *MapperManager) tolerate(ctx context.Context, mapper types.Mapper) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return m.state(mapper).policy != FailurePolicy_FailFast
+}
+
+func (m *MapperManager) stalePair(mapper types.Mapper, path string) *types.PathUrlPair {
+	if stale := m.state(mapper).stale; stale != nil {
+		return stale.getPair(path)
+	}
+	return nil
+}
+
+func (m *MapperManager) staleList(mapper types.Mapper, pagination types.Pagination) (types.PathUrlPairList, bool) {
+	if stale := m.state(mapper).stale; stale != nil {
+		return stale.getList(pagination)
+	}
+	return nil, false
 }
 
 func (m *MapperManager) getPersistor() types.Mapper {
 	return m.persistor
 }
 
-func (m *MapperManager) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+func (m *MapperManager) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	ctx, span := m.tracer.Start(ctx, "MapperManager.PutUrl", trace.WithAttributes(tracing.AttrPath.String(pair.Path)))
+	defer span.End()
+
+	pair, err := m.putUrl(ctx, pair)
+	tracing.RecordError(span, err)
+	return pair, err
+}
+
+func (m *MapperManager) putUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
 	m.logger.Debugf("Setting url: %s -> %s", pair.Path, pair.Url)
-	if m.getPersistor() == nil {
-		return nil, ErrOperationNotSupported("set")
-	}
 	canonicalPath, err := sanitizer.CanonicalizePath(pair.Path)
 	if err != nil {
 		return nil, err
 	}
+	if canonicalPath, err = m.ownPath(ctx, canonicalPath); err != nil {
+		return nil, err
+	}
 	m.logger.Debugf("Path canonicalized: %s -> %s", pair.Path, canonicalPath)
-	old, err := m.GetUrl(canonicalPath, false)
+	ns := m.namespaceOf(canonicalPath)
+	persistor := m.persistorOf(ns)
+	if persistor == nil {
+		return nil, ErrOperationNotSupported("set")
+	}
+	pair.Path = canonicalPath
+	if err := sanitizer.CanonicalizeAliases(pair); err != nil {
+		return nil, err
+	}
+	if err := m.authorize(ctx, ns, true); err != nil {
+		return nil, err
+	}
+	for i, alias := range pair.Aliases {
+		if pair.Aliases[i], err = m.ownPath(ctx, alias); err != nil {
+			return nil, err
+		}
+		aliasNs := m.namespaceOf(pair.Aliases[i])
+		// personal links stay out of the shared ones
+		if ns != nil && ns.personal && nameOf(aliasNs) != ns.name {
+			return nil, sanitizer.ErrInvalidAliases(canonicalPath, fmt.Sprintf("alias %s of a personal link must be personal too", pair.Aliases[i]))
+		}
+		if err := m.authorize(ctx, aliasNs, true); err != nil {
+			return nil, err
+		}
+	}
+	invalidated := append([]string{canonicalPath}, pair.Aliases...)
+	defer func() { m.invalidate(invalidated...) }()
+	old, status, err := m.getUrl(ctx, canonicalPath, false, false)
 	if err != nil {
 		return nil, err
 	}
+	// without a complete lookup, we cannot tell an insert from an update
+	if m.blocksWrites(status) {
+		return nil, ErrIncompleteLookup(canonicalPath, status)
+	}
+	if old != nil && old.Path != canonicalPath {
+		return nil, ErrIsAlias(canonicalPath, old.Path)
+	}
+	if err := m.checkAliases(ctx, pair); err != nil {
+		return nil, err
+	}
+	if old != nil {
+		// the aliases dropped by the update must not be served from caches either
+		invalidated = append(invalidated, old.Aliases...)
+	}
 	if old == nil {
 		// Create path
 		pair.UseCount = 0
-		persistor := m.getPersistor()
 		err = sanitizer.SanitizeInput(persistor, pair)
 		if err != nil {
 			return nil, err
 		}
-		pair, err = persistor.PutUrl(pair)
+		pair, err = m.putToMapper(ctx, persistor, pair)
 		if err != nil {
 			return nil, err
 		}
+		m.forgetChecks(ctx, canonicalPath)
+		// the mirrors only replicate the persistor, not those of the namespaces
+		if persistor == m.getPersistor() {
+			err = m.replicate(ctx, canonicalPath, pair)
+		}
 		sanitizer.SanitizeOutput(persistor, pair)
-		return pair, nil
+		return pair, err
 	}
 	// Update path
 	mapper := findMapper(m.mappers, old.Mapper)
 	if mapper == nil {
 		return nil, ErrInvalidMapper(old.Mapper)
 	}
+	archived := m.isArchive(mapper)
+	if m.mirrorOf(mapper) != nil || archived {
+		mapper = persistor
+	}
 	err = sanitizer.SanitizeInput(mapper, pair)
 	if err != nil {
 		return nil, err
 	}
-	pair, err = mapper.PutUrl(pair)
+	pair, err = m.putToMapper(ctx, mapper, pair)
 	if err != nil {
 		return nil, err
 	}
+	m.forgetChecks(ctx, canonicalPath)
+	if mapper == m.getPersistor() {
+		err = m.replicate(ctx, canonicalPath, pair)
+	}
+	if archived {
+		err = errors.Join(err, m.unarchive(ctx, canonicalPath))
+	}
 	sanitizer.SanitizeOutput(mapper, pair)
-	return pair, nil
+	return pair, err
+}
+
+func (m *MapperManager) DeleteUrl(ctx context.Context, path string) error {
+	ctx, span := m.tracer.Start(ctx, "MapperManager.DeleteUrl", trace.WithAttributes(tracing.AttrPath.String(path)))
+	defer span.End()
+
+	err := m.deleteUrl(ctx, path)
+	tracing.RecordError(span, err)
+	return err
 }
 
-func (m *MapperManager) DeleteUrl(path string) error {
+func (m *MapperManager) deleteUrl(ctx context.Context, path string) error {
 	m.logger.Debugf("Deleting url: %s", path)
-	if m.getPersistor() == nil {
-		return ErrOperationNotSupported("delete")
-	}
 	canonicalPath, err := sanitizer.CanonicalizePath(path)
 	if err != nil {
 		return err
 	}
+	if canonicalPath, err = m.ownPath(ctx, canonicalPath); err != nil {
+		return err
+	}
 	m.logger.Debugf("Path canonicalized: %s -> %s", path, canonicalPath)
-	old, err := m.GetUrl(canonicalPath, false)
+	ns := m.namespaceOf(canonicalPath)
+	if m.persistorOf(ns) == nil {
+		return ErrOperationNotSupported("delete")
+	}
+	if err := m.authorize(ctx, ns, true); err != nil {
+		return err
+	}
+	defer m.invalidate(canonicalPath)
+	old, status, err := m.getUrl(ctx, canonicalPath, false, false)
 	if err != nil {
 		return err
 	}
+	if m.blocksWrites(status) {
+		return ErrIncompleteLookup(canonicalPath, status)
+	}
 	if old == nil {
 		return nil
 	}
+	if old.Path != canonicalPath {
+		return ErrIsAlias(canonicalPath, old.Path)
+	}
+	defer m.invalidate(old.Aliases...)
 	mapper := findMapper(m.mappers, old.Mapper)
 	if mapper == nil {
 		return ErrInvalidMapper(old.Mapper)
 	}
-	return mapper.DeleteUrl(canonicalPath)
+	if m.mirrorOf(mapper) != nil {
+		mapper = m.persistorOf(ns)
+	}
+	if err := m.deleteFromMapper(ctx, mapper, canonicalPath); err != nil {
+		return err
+	}
+	m.forgetChecks(ctx, canonicalPath)
+	if mapper == m.getPersistor() {
+		return m.replicate(ctx, canonicalPath, nil)
+	}
+	return nil
+}
+
+// History returns the changes to path recorded by every mapper that keeps a history, in mapper order.
+func (m *MapperManager) History(ctx context.Context, path string, limit int) ([]types.HistoryEntry, error) {
+	canonicalPath, err := sanitizer.CanonicalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if canonicalPath, err = m.ownPath(ctx, canonicalPath); err != nil {
+		return nil, err
+	}
+	if err := m.authorize(ctx, m.namespaceOf(canonicalPath), false); err != nil {
+		return nil, err
+	}
+	entries := []types.HistoryEntry{}
+	for _, mapper := range m.mappers {
+		history, ok := mapper.(types.MapperHistory)
+		if !ok {
+			continue
+		}
+		mapperEntries, err := history.History(ctx, canonicalPath, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range mapperEntries {
+			entry.Mapper = mapper.GetName()
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// checkAliases fails if an alias of pair is the path or an alias of another pair, in any mapper.
+// Aliases may only be checked once pair has a canonical path.
+func (m *MapperManager) checkAliases(ctx context.Context, pair *types.PathUrlPair) error {
+	for _, alias := range pair.Aliases {
+		owner, status, err := m.getUrl(ctx, alias, false, false)
+		if err != nil {
+			return err
+		}
+		if m.blocksWrites(status) {
+			return ErrIncompleteLookup(alias, status)
+		}
+		if owner != nil && owner.Path != pair.Path {
+			return ErrAliasTaken(alias, owner.Path)
+		}
+	}
+	return nil
+}
+
+// invalidate drops paths from every cached mapper, so that no mapper serves a copy older than a write.
+func (m *MapperManager) invalidate(paths ...string) {
+	for _, mapper := range m.mappers {
+		if cache, ok := mapper.(types.MapperCache); ok {
+			for _, path := range paths {
+				cache.Invalidate(path)
+			}
+		}
+	}
+}
+
+// CacheStats returns the cache statistics of every cached mapper, by mapper name.
+func (m *MapperManager) CacheStats() map[string]types.CacheStats {
+	stats := make(map[string]types.CacheStats)
+	for _, mapper := range m.mappers {
+		if cache, ok := mapper.(types.MapperCache); ok {
+			stats[mapper.GetName()] = cache.CacheStats()
+		}
+	}
+	return stats
 }
 
 func validateAndGetMappers(mapConfigs []types.MapperConfigurer) ([]types.Mapper, error) {
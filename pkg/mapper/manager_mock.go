@@ -1,6 +1,10 @@
 package mapper
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/reimirno/golinks/pkg/sanitizer"
@@ -11,11 +15,19 @@ import (
 // MockMapper is a mock implementation of the Mapper interface for testing purposes.
 // It uses a in-memory map to store PathUrlPair objects.
 // Supports all operations, but does persist anything.
+// If Delay is set, reads take that long unless the context is done first.
+// If Err is set, every operation, including Ping, fails with it.
+// Link checks are kept in Checks, by path.
 type MockMapper struct {
 	mock.Mock
 	Pairs      types.PathUrlPairMap
 	IsReadOnly bool
 	Name       string
+	Delay      time.Duration
+	Err        error
+
+	checksMu sync.Mutex
+	Checks   map[string]types.LinkCheck
 }
 
 func (m *MockMapper) GetType() string {
@@ -30,18 +42,45 @@ func (m *MockMapper) Readonly() bool {
 	return m.IsReadOnly
 }
 
-func (m *MockMapper) GetUrl(path string) (*types.PathUrlPair, error) {
+func (m *MockMapper) wait(ctx context.Context) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.Delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(m.Delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MockMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
 	if pair, ok := m.Pairs[path]; ok {
 		return pair, nil
 	}
+	if owner, ok := m.Pairs.Aliases()[path]; ok {
+		return m.Pairs[owner], nil
+	}
 	return nil, nil
 }
 
-func (m *MockMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
-	return utils.Paginate(m.Pairs.ToList(), pagination), nil
+func (m *MockMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	return utils.PaginatePairs(m.Pairs.ToList(), pagination)
 }
 
-func (m *MockMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+func (m *MockMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
 	if m.IsReadOnly {
 		return nil, ErrOperationNotSupported("put")
 	}
@@ -49,7 +88,10 @@ func (m *MockMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error)
 	return pair, nil
 }
 
-func (m *MockMapper) DeleteUrl(path string) error {
+func (m *MockMapper) DeleteUrl(ctx context.Context, path string) error {
+	if m.Err != nil {
+		return m.Err
+	}
 	if m.IsReadOnly {
 		return ErrOperationNotSupported("delete")
 	}
@@ -57,11 +99,59 @@ func (m *MockMapper) DeleteUrl(path string) error {
 	return nil
 }
 
+func (m *MockMapper) PutLinkChecks(ctx context.Context, checks []types.LinkCheck) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.checksMu.Lock()
+	defer m.checksMu.Unlock()
+	if m.Checks == nil {
+		m.Checks = make(map[string]types.LinkCheck)
+	}
+	for _, check := range checks {
+		m.Checks[check.Path] = check
+	}
+	return nil
+}
+
+func (m *MockMapper) ListLinkChecks(ctx context.Context) ([]types.LinkCheck, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.checksMu.Lock()
+	defer m.checksMu.Unlock()
+	checks := make([]types.LinkCheck, 0, len(m.Checks))
+	for _, check := range m.Checks {
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (m *MockMapper) DeleteLinkChecks(ctx context.Context, paths ...string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.checksMu.Lock()
+	defer m.checksMu.Unlock()
+	for _, path := range paths {
+		delete(m.Checks, path)
+	}
+	return nil
+}
+
+func (m *MockMapper) Ping(ctx context.Context) error {
+	return m.Err
+}
+
 func (m *MockMapper) Teardown() error {
 	return nil
 }
 
-var _ types.Mapper = (*MockMapper)(nil)
+var (
+	_ types.Mapper           = (*MockMapper)(nil)
+	_ types.MapperPinger     = (*MockMapper)(nil)
+	_ types.MapperLinkChecks = (*MockMapper)(nil)
+)
 
 // MockMapperConfigurer is a mock implementation of the MapperConfigurer interface for testing purposes.
 // It just returns a new MockMapper instance.
@@ -71,6 +161,8 @@ type MockMapperConfigurer struct {
 	IsSingleton  bool
 	IsReadOnly   bool
 	StarterPairs types.PathUrlPairMap
+	Delay        time.Duration
+	Err          error
 }
 
 func (m *MockMapperConfigurer) GetType() string {
@@ -90,6 +182,8 @@ func (m *MockMapperConfigurer) GetMapper() (types.Mapper, error) {
 		return nil, err
 	}
 	mapper.IsReadOnly = m.IsReadOnly
+	mapper.Delay = m.Delay
+	mapper.Err = m.Err
 	if mapper.Pairs == nil {
 		mapper.Pairs = make(types.PathUrlPairMap)
 	}
@@ -110,6 +204,8 @@ func CloneConfigurers(configurers []*MockMapperConfigurer) []types.MapperConfigu
 			IsSingleton:  configurer.IsSingleton,
 			IsReadOnly:   configurer.IsReadOnly,
 			StarterPairs: make(types.PathUrlPairMap),
+			Delay:        configurer.Delay,
+			Err:          configurer.Err,
 		}
 		for path, pair := range configurer.StarterPairs {
 			element.StarterPairs[path] = pair.Clone()
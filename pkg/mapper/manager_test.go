@@ -1,9 +1,14 @@
 package mapper
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/reimirno/golinks/pkg/sanitizer"
 	"github.com/reimirno/golinks/pkg/types"
@@ -162,13 +167,53 @@ func TestMapperManager_ListUrls(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mm, err := NewMapperManager(test.configurers[0].GetName(), test.configurers)
 			assert.NoError(t, err)
-			urls, err := mm.ListUrls(utils.DefaultPagination)
+			urls, err := mm.ListUrls(context.Background(), utils.DefaultPagination)
 			assert.NoError(t, err)
 			assert.Equal(t, test.numUrls, len(urls))
 		})
 	}
 }
 
+func TestMapperManager_ListUrlsInStates(t *testing.T) {
+	ctx := context.Background()
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}))
+	require.NoError(t, err)
+	for path, pair := range map[string]*types.PathUrlPair{
+		"expired1":  {Url: "https://expired.com", ExpiresAt: hoursFromNow(-1)},
+		"expired2":  {Url: "https://expired.com", ExpiresAt: hoursFromNow(-1)},
+		"scheduled": {Url: "https://scheduled.com", ActiveFrom: hoursFromNow(1)},
+	} {
+		pair.Path = path
+		_, err := mm.PutUrl(ctx, pair)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name       string
+		pagination types.Pagination
+		states     []types.LinkState
+		wantPaths  []string
+	}{
+		{name: "all states", pagination: utils.DefaultPagination, wantPaths: []string{"/expired1", "/expired2", "/fk", "/fk2", "/fk3", "/scheduled"}},
+		{name: "active", pagination: utils.DefaultPagination, states: []types.LinkState{types.LinkState_Active}, wantPaths: []string{"/fk", "/fk2", "/fk3"}},
+		{name: "several states", pagination: utils.DefaultPagination, states: []types.LinkState{types.LinkState_Expired, types.LinkState_Scheduled}, wantPaths: []string{"/expired1", "/expired2", "/scheduled"}},
+		{name: "offset counts kept pairs", pagination: types.Pagination{Offset: 1, Limit: 1}, states: []types.LinkState{types.LinkState_Active}, wantPaths: []string{"/fk2"}},
+		{name: "cursor", pagination: types.Pagination{Limit: 5, Cursor: types.NewCursor("/expired1")}, states: []types.LinkState{types.LinkState_Expired}, wantPaths: []string{"/expired2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pairs, _, err := mm.ListUrlsInStates(ctx, test.pagination, test.states)
+			assert.NoError(t, err)
+			paths := make([]string, len(pairs))
+			for i, pair := range pairs {
+				paths[i] = pair.Path
+			}
+			assert.Equal(t, test.wantPaths, paths)
+		})
+	}
+}
+
 func TestMapperManager_GetUrl(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -214,7 +259,7 @@ func TestMapperManager_GetUrl(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mm, err := NewMapperManager(test.persistorName, test.configurers)
 			assert.NoError(t, err)
-			pair, err := mm.GetUrl(test.path, false)
+			pair, err := mm.GetUrl(context.Background(), test.path, false)
 			if test.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, pair)
@@ -275,14 +320,14 @@ func TestMapperManager_PutUrl(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mm, err := NewMapperManager(test.persistorName, CloneConfigurers(test.configurers))
 			assert.NoError(t, err)
-			pair, err := mm.PutUrl(test.pair)
+			pair, err := mm.PutUrl(context.Background(), test.pair)
 			if test.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, pair)
 			} else {
 				assert.NoError(t, err)
 				assert.True(t, test.pair.Equals(pair), "Expected %v, got %v", test.pair, pair)
-				pair, err := mm.GetUrl(test.pair.Path, false)
+				pair, err := mm.GetUrl(context.Background(), test.pair.Path, false)
 				assert.NoError(t, err)
 				// sanitize test.finalPair before comparing
 				err = sanitizer.SanitizeInput(mm.getPersistor(), test.finalPair)
@@ -338,12 +383,12 @@ func TestMapperManager_DeleteUrl(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mm, err := NewMapperManager(test.persistorName, CloneConfigurers(test.configurers))
 			assert.NoError(t, err)
-			err = mm.DeleteUrl(test.path)
+			err = mm.DeleteUrl(context.Background(), test.path)
 			if test.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				pair, err := mm.GetUrl(test.path, false)
+				pair, err := mm.GetUrl(context.Background(), test.path, false)
 				assert.NoError(t, err)
 				assert.True(t, test.finalPair.Equals(pair), "Expected %v, got %v", test.finalPair, pair)
 			}
@@ -379,3 +424,555 @@ func TestMapperManager_Teardown(t *testing.T) {
 		})
 	}
 }
+
+func TestMapperManager_RequestTimeout(t *testing.T) {
+	slowConfigurer := &MockMapperConfigurer{
+		Name:         "slow",
+		StarterPairs: types.PathUrlPairMap{"fk3": fakePair3},
+		Delay:        time.Second,
+	}
+	tests := []struct {
+		name        string
+		configurers []*MockMapperConfigurer
+		settings    map[string]MapperSettings
+		ctxTimeout  time.Duration
+		path        string
+		wantErr     error
+		wantPair    bool
+	}{
+		{
+			name:        "fast mapper within timeout",
+			configurers: []*MockMapperConfigurer{mockConfigurer},
+			settings:    map[string]MapperSettings{mockConfigurer.Name: {RequestTimeout: 500}},
+			path:        "fk",
+			wantPair:    true,
+		},
+		{
+			name:        "slow mapper exceeds its own timeout",
+			configurers: []*MockMapperConfigurer{slowConfigurer},
+			settings:    map[string]MapperSettings{slowConfigurer.Name: {RequestTimeout: 10}},
+			path:        "fk3",
+			wantErr:     context.DeadlineExceeded,
+		},
+		{
+			name:        "caller deadline applies without mapper timeout",
+			configurers: []*MockMapperConfigurer{slowConfigurer},
+			ctxTimeout:  10 * time.Millisecond,
+			path:        "fk3",
+			wantErr:     context.DeadlineExceeded,
+		},
+		{
+			name:        "slow mapper is not reached when an earlier one matches",
+			configurers: []*MockMapperConfigurer{mockConfigurer, slowConfigurer},
+			settings:    map[string]MapperSettings{slowConfigurer.Name: {RequestTimeout: 10}},
+			path:        "fk",
+			wantPair:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := []ManagerOption{}
+			for name, settings := range test.settings {
+				opts = append(opts, WithMapperSettings(name, settings))
+			}
+			mm, err := NewMapperManager("", CloneConfigurers(test.configurers), opts...)
+			assert.NoError(t, err)
+
+			ctx := context.Background()
+			if test.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.ctxTimeout)
+				defer cancel()
+			}
+			start := time.Now()
+			pair, err := mm.GetUrl(ctx, test.path, false)
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				assert.Nil(t, pair)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.wantPair, pair != nil)
+			}
+		})
+	}
+}
+
+func TestWithMapperSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapperName string
+		settings   MapperSettings
+		wantErr    bool
+	}{
+		{name: "happy path", mapperName: mockConfigurer.Name, settings: MapperSettings{RequestTimeout: 100}},
+		{name: "unknown mapper should fail", mapperName: "invalid", wantErr: true},
+		{name: "negative timeout should fail", mapperName: mockConfigurer.Name, settings: MapperSettings{RequestTimeout: -1}, wantErr: true},
+		{name: "known failure policy", mapperName: mockConfigurer.Name, settings: MapperSettings{OnError: "Stale"}},
+		{name: "unknown failure policy should fail", mapperName: mockConfigurer.Name, settings: MapperSettings{OnError: "retry"}, wantErr: true},
+		{name: "negative breaker should fail", mapperName: mockConfigurer.Name, settings: MapperSettings{Breaker: BreakerSettings{Failures: -1}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer}),
+				WithMapperSettings(test.mapperName, test.settings))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, mm)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.settings, mm.states[test.mapperName].settings)
+			}
+		})
+	}
+}
+
+func TestMapperManager_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		onError      string
+		warmUp       bool // look the path up once before the mapper starts failing
+		path         string
+		wantErr      bool
+		wantPair     *types.PathUrlPair
+		wantSkipped  []string
+		wantStale    []string
+		wantListSize int
+	}{
+		{
+			name:    "fail fast aborts the lookup",
+			onError: "fail",
+			path:    "fk3",
+			wantErr: true,
+		},
+		{
+			name:         "skip falls through to the next mapper",
+			onError:      "skip",
+			path:         "fk3",
+			wantPair:     fakePair3,
+			wantSkipped:  []string{mockConfigurer.Name},
+			wantListSize: len(mockConfigurer2.StarterPairs),
+		},
+		{
+			name:         "skip reports a miss as incomplete",
+			onError:      "skip",
+			path:         "fk",
+			wantSkipped:  []string{mockConfigurer.Name},
+			wantListSize: len(mockConfigurer2.StarterPairs),
+		},
+		{
+			name:         "stale serves the last known answer",
+			onError:      "stale",
+			warmUp:       true,
+			path:         "fk",
+			wantPair:     fakePair,
+			wantStale:    []string{mockConfigurer.Name},
+			wantListSize: len(mockConfigurer.StarterPairs) + len(mockConfigurer2.StarterPairs),
+		},
+		{
+			name:         "stale without a known answer skips",
+			onError:      "stale",
+			path:         "fk",
+			wantSkipped:  []string{mockConfigurer.Name},
+			wantListSize: len(mockConfigurer2.StarterPairs),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mm, err := NewMapperManager(mockConfigurer2.Name,
+				CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}),
+				WithMapperSettings(mockConfigurer.Name, MapperSettings{OnError: test.onError}))
+			assert.NoError(t, err)
+			ctx := context.Background()
+			if test.warmUp {
+				_, err = mm.GetUrl(ctx, test.path, false)
+				assert.NoError(t, err)
+				_, err = mm.ListUrls(ctx, utils.DefaultPagination)
+				assert.NoError(t, err)
+			}
+			mm.mappers[0].(*MockMapper).Err = assert.AnError
+
+			pair, status, err := mm.GetUrlWithStatus(ctx, test.path, false)
+			if test.wantErr {
+				assert.ErrorIs(t, err, assert.AnError)
+				assert.Nil(t, pair)
+				_, _, err = mm.ListUrlsWithStatus(ctx, utils.DefaultPagination)
+				assert.ErrorIs(t, err, assert.AnError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, test.wantPair.Equals(pair), "Expected %v, got %v", test.wantPair, pair)
+			assert.Equal(t, test.wantSkipped, status.Skipped)
+			assert.Equal(t, test.wantStale, status.Stale)
+			assert.True(t, status.Incomplete())
+
+			urls, status, err := mm.ListUrlsWithStatus(ctx, utils.DefaultPagination)
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantListSize, len(urls))
+			assert.True(t, status.Incomplete())
+
+			// writes cannot tell an insert from an update without every mapper
+			_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: test.path, Url: "https://new.com"})
+			assert.Error(t, err)
+			assert.Error(t, mm.DeleteUrl(ctx, test.path))
+		})
+	}
+}
+
+func TestMapperManager_CircuitBreaker(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer2.Name,
+		CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}),
+		WithMapperSettings(mockConfigurer.Name, MapperSettings{OnError: "skip", Breaker: BreakerSettings{Failures: 2, Cooldown: 60}}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	failing := mm.mappers[0].(*MockMapper)
+	failing.Err = assert.AnError
+
+	for i := 0; i < 2; i++ {
+		_, status, err := mm.GetUrlWithStatus(ctx, "fk3", false)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{mockConfigurer.Name}, status.Skipped)
+	}
+	assert.True(t, mm.states[mockConfigurer.Name].breaker.Open())
+
+	// the mapper recovers, but stays bypassed until the cooldown is over
+	failing.Err = nil
+	pair, status, err := mm.GetUrlWithStatus(ctx, "fk", false)
+	assert.NoError(t, err)
+	assert.Nil(t, pair)
+	assert.Equal(t, []string{mockConfigurer.Name}, status.Skipped)
+}
+
+func TestMapperManager_CallerCancellationIsNotTolerated(t *testing.T) {
+	mm, err := NewMapperManager("",
+		CloneConfigurers([]*MockMapperConfigurer{{Name: "slow", Delay: time.Second}, mockConfigurer2}),
+		WithMapperSettings("slow", MapperSettings{OnError: "skip", Breaker: BreakerSettings{Failures: 1}}))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = mm.GetUrl(ctx, "fk3", false)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, mm.states["slow"].breaker.Open(), "caller giving up should not count against the mapper")
+}
+
+// recordingCache is a MockMapper that records the paths it is asked to invalidate.
+type recordingCache struct {
+	*MockMapper
+	invalidated []string
+}
+
+func (c *recordingCache) Invalidate(path string) {
+	c.invalidated = append(c.invalidated, path)
+}
+
+func (c *recordingCache) CacheStats() types.CacheStats {
+	return types.CacheStats{Hits: int64(len(c.invalidated))}
+}
+
+func TestMapperManager_InvalidatesCaches(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer2.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	cache := &recordingCache{MockMapper: mm.mappers[0].(*MockMapper)}
+	mm.mappers[0] = cache
+
+	_, err = mm.GetUrl(ctx, "fk", true)
+	assert.NoError(t, err)
+	assert.Empty(t, cache.invalidated)
+
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "new-path", Url: "https://new.com"})
+	assert.NoError(t, err)
+	assert.NoError(t, mm.DeleteUrl(ctx, "fk"))
+	assert.Equal(t, []string{"/newpath", "/fk"}, cache.invalidated)
+
+	assert.Equal(t, map[string]types.CacheStats{mockConfigurer.Name: {Hits: 2}}, mm.CacheStats())
+}
+
+func TestMapperManager_Aliases(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	cache := &recordingCache{MockMapper: mm.mappers[0].(*MockMapper)}
+	mm.mappers[0] = cache
+	mm.persistor = cache
+
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "kubernetes", Url: "https://kubernetes.io", Aliases: []string{"k-8-s", "kube"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/kubernetes", "/k8s", "/kube"}, cache.invalidated)
+
+	// an alias resolves to its pair, which counts the click
+	pair, err := mm.GetUrl(ctx, "k8s", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "/kubernetes", pair.Path)
+	pair, err = mm.GetUrl(ctx, "kubernetes", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pair.UseCount)
+
+	taken := []*types.PathUrlPair{
+		{Path: "k8s", Url: "https://other.com"},                                   // path that is an alias
+		{Path: "kubectl", Url: "https://other.com", Aliases: []string{"kube"}},    // alias of another pair
+		{Path: "kubectl", Url: "https://other.com", Aliases: []string{"fk2"}},     // path of another pair
+		{Path: "kubectl", Url: "https://other.com", Aliases: []string{"fk3"}},     // path in another mapper
+		{Path: "kubectl", Url: "https://other.com", Aliases: []string{"kubectl"}}, // itself
+	}
+	for _, pair := range taken {
+		_, err = mm.PutUrl(ctx, pair)
+		assert.ErrorIs(t, err, sanitizer.ErrInvalidInput, "%v", pair.Aliases)
+	}
+	assert.ErrorIs(t, mm.DeleteUrl(ctx, "k8s"), sanitizer.ErrInvalidInput)
+
+	// updates are served under every alias, and dropped aliases stop resolving
+	cache.invalidated = nil
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "kubernetes", Url: "https://kubernetes.io/docs", Aliases: []string{"kube"}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"/kubernetes", "/kube", "/k8s", "/kube"}, cache.invalidated)
+	pair, err = mm.GetUrl(ctx, "kube", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://kubernetes.io/docs", pair.Url)
+	pair, err = mm.GetUrl(ctx, "k8s", false)
+	assert.NoError(t, err)
+	assert.Nil(t, pair)
+
+	cache.invalidated = nil
+	assert.NoError(t, mm.DeleteUrl(ctx, "kubernetes"))
+	assert.Equal(t, []string{"/kube", "/kubernetes"}, cache.invalidated)
+	pair, err = mm.GetUrl(ctx, "kube", false)
+	assert.NoError(t, err)
+	assert.Nil(t, pair)
+}
+
+func TestMapperManager_Patterns(t *testing.T) {
+	patterned := &MockMapperConfigurer{
+		Name: "patterned",
+		StarterPairs: types.PathUrlPairMap{
+			"/pr/*":     {Path: "/pr/*", Url: "https://github.com/org/repo/pull/$1"},
+			"^pr(.*)$":  {Path: "^pr(.*)$", Url: "https://regex.com/$1"},
+			"/fk2/*":    {Path: "/fk2/*", Url: "https://fake2.com/$1"},
+			"/pr/*/log": {Path: "/pr/*/log", Url: "https://github.com/org/repo/pull/$1/commits"},
+		},
+	}
+	other := &MockMapperConfigurer{
+		Name: "other",
+		StarterPairs: types.PathUrlPairMap{
+			"/*": {Path: "/*", Url: "https://search.com/?q=$1"},
+		},
+	}
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, patterned, other}), WithPatterns(0))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// paths and aliases take precedence over patterns; patterns follow the order of their mappers,
+	// then globs come before regexes, and longer patterns before shorter ones
+	tests := []struct {
+		path    string
+		pattern string
+		url     string
+	}{
+		{path: "fk2", pattern: "/fk2", url: fakePair2.Url},
+		{path: "pr/12", pattern: "/pr/*", url: "https://github.com/org/repo/pull/12"},
+		{path: "pr/12/log", pattern: "/pr/*/log", url: "https://github.com/org/repo/pull/12/commits"},
+		{path: "pr-12", pattern: "^pr(.*)$", url: "https://regex.com/12"},
+		{path: "fk2/x", pattern: "/fk2/*", url: "https://fake2.com/x"},
+		{path: "anything", pattern: "/*", url: "https://search.com/?q=anything"},
+	}
+	for _, test := range tests {
+		pair, err := mm.GetUrl(ctx, test.path, true)
+		assert.NoError(t, err)
+		require.NotNil(t, pair, test.path)
+		assert.Equal(t, test.pattern, pair.Path, test.path)
+		assert.Equal(t, test.url, pair.Url, test.path)
+	}
+
+	// the pattern is counted, and left as it is stored
+	pair, err := mm.GetUrl(ctx, "pr/*", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/pull/$1", pair.Url)
+	assert.Equal(t, 1, pair.UseCount)
+
+	// a path under a pattern is a link of its own, not the pattern
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "pr/1", Url: "https://first.com"})
+	assert.NoError(t, err)
+	pair, err = mm.GetUrl(ctx, "pr/1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "/pr/1", pair.Path)
+
+	// patterns written through the manager are matched right away, and invalid ones are refused
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: `^bug(\d+)$`, Url: "https://tracker/issue/$1"})
+	assert.NoError(t, err)
+	pair, err = mm.MatchPattern(ctx, "bug42")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://tracker/issue/42", pair.Url)
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: `^bug(\d+$`, Url: "https://tracker/issue/$1"})
+	assert.ErrorIs(t, err, sanitizer.ErrInvalidInput)
+	assert.NoError(t, mm.DeleteUrl(ctx, `^bug(\d+)$`))
+	pair, err = mm.MatchPattern(ctx, "bug42")
+	assert.NoError(t, err)
+	assert.Equal(t, "/*", pair.Path)
+
+	// the patterns written elsewhere are picked up once reloaded
+	delete(mm.mappers[2].(*MockMapper).Pairs, "/*")
+	pair, err = mm.GetUrl(ctx, "anything", false)
+	assert.NoError(t, err)
+	assert.Nil(t, pair)
+	mm.mappers[2].(*MockMapper).Pairs["/x*"] = &types.PathUrlPair{Path: "/x*", Url: "https://x.com/$1"}
+	mm.LoadPatterns(ctx)
+	pair, err = mm.MatchPattern(ctx, "xyz")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://x.com/yz", pair.Url)
+}
+
+// countingMapper is a MockMapper with an atomic use count, like a shared store would have.
+type countingMapper struct {
+	*MockMapper
+	increments int
+}
+
+func (c *countingMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	c.increments++
+	c.Pairs[path].UseCount += 10 // tell apart from a read-modify-write
+	return c.Pairs[path].UseCount, nil
+}
+
+func TestMapperManager_IncrementsWithCounter(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer}))
+	assert.NoError(t, err)
+	counter := &countingMapper{MockMapper: mm.mappers[0].(*MockMapper)}
+	mm.mappers[0] = counter
+	mm.persistor = counter
+
+	pair, err := mm.GetUrl(context.Background(), "fk", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, pair.UseCount)
+	assert.Equal(t, 1, counter.increments)
+
+	_, err = mm.GetUrl(context.Background(), "fk", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counter.increments)
+
+	// links that do not redirect are not counted
+	counter.Pairs[canonical(t, "fk")].ActiveFrom = hoursFromNow(1)
+	_, err = mm.GetUrl(context.Background(), "fk", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counter.increments)
+}
+
+// uncountedMapper is a MockMapper that does not count clicks at all, like a git repository.
+type uncountedMapper struct {
+	*MockMapper
+}
+
+func (u *uncountedMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func TestMapperManager_IncrementsWithoutCounting(t *testing.T) {
+	ctx := context.Background()
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer}), WithPatterns(0))
+	require.NoError(t, err)
+	uncounted := &uncountedMapper{MockMapper: mm.mappers[0].(*MockMapper)}
+	mm.mappers[0] = uncounted
+	mm.persistor = uncounted
+	mm.suggestIndex.put(uncounted.Name, &types.PathUrlPair{Path: canonical(t, "fk"), Url: "https://fake.com", UseCount: 5})
+
+	// the click is not an error, and the pair keeps the count it was indexed with
+	_, err = mm.GetUrl(ctx, "fk", true)
+	require.NoError(t, err)
+	suggestions, err := mm.Suggest(ctx, "fk", 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, suggestions)
+	assert.Equal(t, canonical(t, "fk"), suggestions[0].Path)
+	assert.Equal(t, 5, suggestions[0].UseCount)
+	assert.NotNil(t, suggestions[0].LastUsed)
+	assert.True(t, mm.Health(ctx).Ready)
+}
+
+// targetCountingMapper is a countingMapper that also counts targets atomically.
+type targetCountingMapper struct {
+	*countingMapper
+}
+
+func (c *targetCountingMapper) IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error) {
+	for i := range c.Pairs[path].Targets {
+		if c.Pairs[path].Targets[i].Url == url {
+			c.Pairs[path].Targets[i].UseCount += 10
+			return c.Pairs[path].Targets[i].UseCount, nil
+		}
+	}
+	return 0, fmt.Errorf("path %s has no target %s", path, url)
+}
+
+func TestMapperManager_IncrementTargetUseCount(t *testing.T) {
+	ctx := context.Background()
+	split := func(mapper types.Mapper) *types.PathUrlPair {
+		pair, err := mapper.GetUrl(ctx, canonical(t, "fk"))
+		require.NoError(t, err)
+		pair.Targets = []types.WeightedTarget{{Url: "https://a.com", Weight: 1}, {Url: "https://b.com", Weight: 1}}
+		return pair
+	}
+	newManager := func(wrap func(*MockMapper) types.Mapper) (*MapperManager, types.Mapper) {
+		mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurerReadonly}))
+		require.NoError(t, err)
+		mm.mappers[0] = wrap(mm.mappers[0].(*MockMapper))
+		mm.persistor = mm.mappers[0]
+		return mm, mm.mappers[0]
+	}
+
+	// without an atomic counter, the pair is written back
+	mm, mapper := newManager(func(m *MockMapper) types.Mapper { return m })
+	pair := split(mapper)
+	assert.NoError(t, mm.IncrementTargetUseCount(ctx, pair, "https://b.com"))
+	stored, err := mapper.GetUrl(ctx, canonical(t, "fk"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stored.Targets[1].UseCount)
+	assert.Error(t, mm.IncrementTargetUseCount(ctx, pair, "https://c.com"))
+
+	// an atomic counter of targets is preferred
+	mm, mapper = newManager(func(m *MockMapper) types.Mapper {
+		return &targetCountingMapper{countingMapper: &countingMapper{MockMapper: m}}
+	})
+	pair = split(mapper)
+	assert.NoError(t, mm.IncrementTargetUseCount(ctx, pair, "https://b.com"))
+	assert.Equal(t, 10, pair.Targets[1].UseCount)
+
+	// a mapper that counts pairs atomically, but not targets, does not count targets
+	mm, mapper = newManager(func(m *MockMapper) types.Mapper { return &countingMapper{MockMapper: m} })
+	pair = split(mapper)
+	assert.NoError(t, mm.IncrementTargetUseCount(ctx, pair, "https://b.com"))
+	assert.Zero(t, pair.Targets[1].UseCount)
+
+	// nor do readonly mappers
+	pair = &types.PathUrlPair{Path: "/fk", Mapper: mockConfigurerReadonly.Name, Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}}}
+	assert.NoError(t, mm.IncrementTargetUseCount(ctx, pair, "https://a.com"))
+	assert.Zero(t, pair.Targets[0].UseCount)
+
+	assert.Error(t, mm.IncrementTargetUseCount(ctx, &types.PathUrlPair{Path: "/fk", Mapper: "invalid"}, "https://a.com"))
+}
+
+// historyMapper is a MockMapper with one change recorded for every path.
+type historyMapper struct {
+	*MockMapper
+	paths []string
+}
+
+func (h *historyMapper) History(ctx context.Context, path string, limit int) ([]types.HistoryEntry, error) {
+	h.paths = append(h.paths, path)
+	return []types.HistoryEntry{{Revision: "r1", Url: "https://history.com"}}, nil
+}
+
+func TestMapperManager_History(t *testing.T) {
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}))
+	assert.NoError(t, err)
+	history := &historyMapper{MockMapper: mm.mappers[1].(*MockMapper)}
+	mm.mappers[1] = history
+
+	entries, err := mm.History(context.Background(), "f-k", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.HistoryEntry{{Mapper: mockConfigurer2.Name, Revision: "r1", Url: "https://history.com"}}, entries)
+	assert.Equal(t, []string{"/fk"}, history.paths)
+
+	_, err = mm.History(context.Background(), "/", 10)
+	assert.Error(t, err)
+}
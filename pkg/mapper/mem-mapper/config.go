@@ -1,6 +1,7 @@
 package mem_mapper
 
 import (
+	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/sanitizer"
 	"github.com/reimirno/golinks/pkg/types"
 )
@@ -11,6 +12,10 @@ const (
 
 var _ types.MapperConfigurer = (*MemMapperConfig)(nil)
 
+func init() {
+	mapper.Register(MemMapperConfigType, func() types.MapperConfigurer { return &MemMapperConfig{} })
+}
+
 type MemMapperConfig struct {
 	Name  string              `mapstructure:"name"`
 	Pairs []types.PathUrlPair `mapstructure:"pairs"`
@@ -37,6 +42,7 @@ func (m *MemMapperConfig) GetMapper() (types.Mapper, error) {
 	if err != nil {
 		return nil, err
 	}
+	mm.aliases = mm.pairs.Aliases()
 	return mm, nil
 }
 
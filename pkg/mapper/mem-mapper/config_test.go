@@ -1,6 +1,7 @@
 package mem_mapper
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,10 +10,17 @@ import (
 	"github.com/reimirno/golinks/pkg/types"
 )
 
-var fakePair = &types.PathUrlPair{
-	Path: "fk",
-	Url:  "https://fake.com",
-}
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "fk",
+		Url:  "https://fake.com",
+	}
+	fakePairAliased = &types.PathUrlPair{
+		Path:    "/kubernetes",
+		Url:     "https://kubernetes.io",
+		Aliases: []string{"/k8s"},
+	}
+)
 
 var (
 	fakeConfig = MemMapperConfig{
@@ -128,3 +136,33 @@ func TestMemMapperConfig_GetMapper(t *testing.T) {
 		})
 	}
 }
+
+func TestMemMapperConfig_GetMapperAliases(t *testing.T) {
+	config := MemMapperConfig{Name: "fake", Pairs: []types.PathUrlPair{{Path: "kubernetes", Url: "https://kubernetes.io", Aliases: []string{"k8s"}}}}
+	got, err := config.GetMapper()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/k8s": "/kubernetes"}, got.(*MemMapper).aliases)
+
+	config.Pairs = append(config.Pairs, types.PathUrlPair{Path: "k8s", Url: "https://k8s.io"})
+	_, err = config.GetMapper()
+	assert.ErrorIs(t, err, sanitizer.ErrInvalidInput, "an alias cannot also be a path")
+}
+
+func TestMemMapperConfig_GetMapperPatterns(t *testing.T) {
+	config := MemMapperConfig{Name: "fake", Pairs: []types.PathUrlPair{
+		{Path: "pr/*", Url: "https://github.com/org/repo/pull/$1"},
+		{Path: `^bug(\d+)$`, Url: "https://tracker/issue/$1"},
+	}}
+	got, err := config.GetMapper()
+	assert.NoError(t, err)
+	pair, err := got.GetUrl(context.Background(), "/pr/*")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/pull/$1", pair.Url)
+	pair, err = got.GetUrl(context.Background(), `^bug(\d+)$`)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://tracker/issue/$1", pair.Url)
+
+	config.Pairs = append(config.Pairs, types.PathUrlPair{Path: "^bug(", Url: "https://tracker"})
+	_, err = config.GetMapper()
+	assert.ErrorIs(t, err, sanitizer.ErrInvalidInput, "patterns are compiled when loaded")
+}
@@ -1,6 +1,8 @@
 package mem_mapper
 
 import (
+	"context"
+
 	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/types"
 	"github.com/reimirno/golinks/pkg/utils"
@@ -9,8 +11,9 @@ import (
 var _ types.Mapper = (*MemMapper)(nil)
 
 type MemMapper struct {
-	name  string
-	pairs types.PathUrlPairMap
+	name    string
+	pairs   types.PathUrlPairMap
+	aliases map[string]string // alias -> path
 }
 
 func (m *MemMapper) GetName() string {
@@ -29,21 +32,24 @@ func (m *MemMapper) Teardown() error {
 	return nil
 }
 
-func (m *MemMapper) GetUrl(path string) (*types.PathUrlPair, error) {
+func (m *MemMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
 	if pair, ok := m.pairs[path]; ok {
 		return pair, nil
 	}
+	if owner, ok := m.aliases[path]; ok {
+		return m.pairs[owner], nil
+	}
 	return nil, nil
 }
 
-func (m *MemMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
-	return utils.Paginate(m.pairs.ToList(), pagination), nil
+func (m *MemMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	return utils.PaginatePairs(m.pairs.ToList(), pagination)
 }
 
-func (m *MemMapper) DeleteUrl(path string) error {
+func (m *MemMapper) DeleteUrl(ctx context.Context, path string) error {
 	return mapper.ErrOperationNotSupported("delete")
 }
 
-func (m *MemMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+func (m *MemMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
 	return nil, mapper.ErrOperationNotSupported("put")
 }
@@ -1,6 +1,7 @@
 package mem_mapper
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,6 +27,13 @@ var (
 		name:  "fakeEmpty",
 		pairs: types.PathUrlPairMap{},
 	}
+	fakeMapperAliased = &MemMapper{
+		name: "fakeAliased",
+		pairs: types.PathUrlPairMap{
+			"/kubernetes": fakePairAliased,
+		},
+		aliases: map[string]string{"/k8s": "/kubernetes"},
+	}
 )
 
 func TestMemMapper_GetName(t *testing.T) {
@@ -90,11 +98,12 @@ func TestMemMapper_GetUrl(t *testing.T) {
 		{name: "path not found", mapper: fakeMapper, path: "none", want: nil},
 		{name: "empty name still happy", mapper: fakeMapperEmptyName, path: "fk", want: fakePair},
 		{name: "empty pairs", mapper: fakeMapperEmptyPairs, path: "fk", want: nil},
+		{name: "alias", mapper: fakeMapperAliased, path: "/k8s", want: fakePairAliased},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.mapper.GetUrl(tt.path)
+			got, err := tt.mapper.GetUrl(context.Background(), tt.path)
 			assert.NoError(t, err)
 			assert.True(t, tt.want.Equals(got), "Expected %v, got %v", tt.want, got)
 		})
@@ -112,7 +121,7 @@ func TestMemMapper_ListUrls(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.mapper.ListUrls(utils.DefaultPagination)
+			got, err := tt.mapper.ListUrls(context.Background(), utils.DefaultPagination)
 			assert.NoError(t, err)
 			assert.True(t, tt.want.Equals(&got), "Expected %v, got %v", tt.want, got)
 		})
@@ -130,7 +139,7 @@ func TestMemMapper_PutUrl(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.mapper.PutUrl(tt.pair)
+			_, err := tt.mapper.PutUrl(context.Background(), tt.pair)
 			assert.Error(t, err)
 		})
 	}
@@ -147,7 +156,7 @@ func TestMemMapper_DeleteUrl(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.mapper.DeleteUrl(tt.path)
+			err := tt.mapper.DeleteUrl(context.Background(), tt.path)
 			assert.Error(t, err)
 		})
 	}
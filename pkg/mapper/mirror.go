@@ -0,0 +1,407 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orsinium-labs/enum"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// MirrorSettings name a writable mapper that the writes of the persistor are replicated to.
+type MirrorSettings struct {
+	Name      string `mapstructure:"name"`
+	Mode      string `mapstructure:"mode"`      // sync or async; defaults to sync
+	QueueSize int    `mapstructure:"queueSize"` // async only: writes waiting to be replicated before new ones are dropped
+}
+
+// MirrorMode decides whether a write waits for its replication to a mirror.
+type MirrorMode enum.Member[string]
+
+var (
+	// MirrorMode_Sync replicates a write before answering it; the write fails if the mirror does,
+	// although the persistor keeps it.
+	MirrorMode_Sync = MirrorMode{"sync"}
+	// MirrorMode_Async answers a write once the persistor has it, and replicates it in the background, in order.
+	MirrorMode_Async = MirrorMode{"async"}
+
+	mirrorModes = enum.New(MirrorMode_Sync, MirrorMode_Async)
+)
+
+const (
+	defaultMirrorQueueSize = 1000
+	reconcilePageSize      = 500
+)
+
+// MirrorStatus reports how far a mirror is behind the persistor.
+type MirrorStatus struct {
+	Name          string     `json:"name"`
+	Mode          string     `json:"mode"`
+	Pending       int        `json:"pending"`    // writes waiting to be replicated
+	LagSeconds    float64    `json:"lagSeconds"` // age of the oldest pending write
+	Dropped       int        `json:"dropped"`    // writes given up on because the queue was full
+	Failed        int        `json:"failed"`     // writes the mirror refused
+	LastError     string     `json:"lastError,omitempty"`
+	LastReconcile *time.Time `json:"lastReconcile,omitempty"`
+	Repaired      int        `json:"repaired"` // pairs fixed by reconciliation so far
+}
+
+// mirrorOp replicates the current state of a path: a put, or a delete if pair is nil.
+type mirrorOp struct {
+	path   string
+	pair   *types.PathUrlPair
+	queued time.Time
+}
+
+// mirror replicates writes to one mapper. Replication and reconciliation hold mu while they write to the mirror,
+// so that a reconciliation never undoes a newer write.
+type mirror struct {
+	mapper    types.Mapper
+	mode      MirrorMode
+	queueSize int
+	mu        sync.Mutex
+
+	statusMu sync.Mutex
+	queue    []mirrorOp // async only
+	wake     chan struct{}
+	status   MirrorStatus
+}
+
+// WithMirrors replicates every write made to the persistor to the given mappers, which must be writable,
+// and reconciles them with the persistor every interval if it is positive.
+// Writes to a path held by a mirror are made to the persistor, which is the reference for its mirrors.
+func WithMirrors(settings []MirrorSettings, reconcileInterval time.Duration) ManagerOption {
+	return func(m *MapperManager) error {
+		if len(settings) == 0 {
+			return nil
+		}
+		if m.persistor == nil {
+			return ErrMapConfigSetup("mirrors need a persistor")
+		}
+		for _, s := range settings {
+			mapper := findMapper(m.mappers, s.Name)
+			if mapper == nil {
+				return ErrMapConfigSetup(fmt.Sprintf("mirror not found: %s", s.Name))
+			}
+			if mapper == m.persistor {
+				return ErrMapConfigSetup(fmt.Sprintf("persistor cannot mirror itself: %s", s.Name))
+			}
+			if mapper.Readonly() {
+				return ErrMapConfigSetup(fmt.Sprintf("mirror is readonly: %s", s.Name))
+			}
+			if m.mirrorOf(mapper) != nil {
+				return ErrMapConfigSetup(fmt.Sprintf("duplicate mirror: %s", s.Name))
+			}
+			mode := MirrorMode_Sync
+			if s.Mode != "" {
+				parsed := mirrorModes.Parse(strings.ToLower(s.Mode))
+				if parsed == nil {
+					return ErrMapConfigSetup(fmt.Sprintf("unknown mode %q for mirror %s, expected one of %v", s.Mode, s.Name, mirrorModes.Values()))
+				}
+				mode = *parsed
+			}
+			if s.QueueSize < 0 {
+				return ErrMapConfigSetup(fmt.Sprintf("negative queue size for mirror %s", s.Name))
+			}
+			queueSize := s.QueueSize
+			if queueSize == 0 {
+				queueSize = defaultMirrorQueueSize
+			}
+			m.mirrors = append(m.mirrors, &mirror{
+				mapper:    mapper,
+				mode:      mode,
+				queueSize: queueSize,
+				wake:      make(chan struct{}, 1),
+				status:    MirrorStatus{Name: mapper.GetName(), Mode: mode.Value},
+			})
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for _, mi := range m.mirrors {
+			if mi.mode == MirrorMode_Async {
+				wg.Add(1)
+				go func(mi *mirror) {
+					defer wg.Done()
+					m.replicateQueued(ctx, mi)
+				}(mi)
+			}
+		}
+		if reconcileInterval > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(reconcileInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if err := m.ReconcileMirrors(ctx); err != nil {
+							m.logger.Errorf("Failed to reconcile mirrors: %v", err)
+						}
+					}
+				}
+			}()
+		}
+		m.stopMirrors = func() {
+			cancel()
+			wg.Wait()
+			for _, mi := range m.mirrors {
+				if pending := mi.snapshot().Pending; pending > 0 {
+					m.logger.Warnf("%d writes were not replicated to mirror %s; the next reconciliation will repair them", pending, mi.mapper.GetName())
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// MirrorStatus reports the replication status of every mirror, in configuration order.
+func (m *MapperManager) MirrorStatus() []MirrorStatus {
+	statuses := make([]MirrorStatus, 0, len(m.mirrors))
+	for _, mi := range m.mirrors {
+		statuses = append(statuses, mi.snapshot())
+	}
+	return statuses
+}
+
+func (m *MapperManager) mirrorOf(mapper types.Mapper) *mirror {
+	for _, mi := range m.mirrors {
+		if mi.mapper == mapper {
+			return mi
+		}
+	}
+	return nil
+}
+
+// blocksWrites tells whether a lookup is too incomplete to write after it. Mirrors do not count,
+// as the persistor is the reference for whatever they hold.
+func (m *MapperManager) blocksWrites(status LookupStatus) bool {
+	for _, name := range slices.Concat(status.Skipped, status.Stale) {
+		if m.mirrorOf(findMapper(m.mappers, name)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// replicate sends the write of path just made to the persistor to every mirror.
+// pair is nil for a delete. Only sync mirrors can make it fail.
+func (m *MapperManager) replicate(ctx context.Context, path string, pair *types.PathUrlPair) error {
+	op := mirrorOp{path: path, queued: time.Now()}
+	if pair != nil {
+		op.pair = pair.Clone()
+	}
+	var errs []error
+	for _, mi := range m.mirrors {
+		if mi.mode == MirrorMode_Async {
+			if !mi.enqueue(op) {
+				m.logger.Warnf("Replication queue of mirror %s is full, dropping write of %s", mi.mapper.GetName(), path)
+			}
+			continue
+		}
+		if err := m.applyToMirror(ctx, mi, op); err != nil {
+			errs = append(errs, ErrMirrorFailed(mi.mapper.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replicateQueued applies the queued writes of an async mirror in order, until ctx is done.
+// A write that fails is not retried: the mirror is left to the next reconciliation.
+func (m *MapperManager) replicateQueued(ctx context.Context, mi *mirror) {
+	for ctx.Err() == nil {
+		op, ok := mi.peek()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-mi.wake:
+				continue
+			}
+		}
+		if err := m.applyToMirror(ctx, mi, op); err != nil {
+			m.logger.Errorf("Failed to replicate %s to mirror %s: %v", op.path, mi.mapper.GetName(), err)
+		}
+		mi.pop()
+	}
+}
+
+func (m *MapperManager) applyToMirror(ctx context.Context, mi *mirror, op mirrorOp) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	var err error
+	if op.pair == nil {
+		err = m.deleteFromMapper(ctx, mi.mapper, op.path)
+	} else {
+		pair := op.pair.Clone()
+		pair.Mapper = mi.mapper.GetName()
+		_, err = m.putToMapper(ctx, mi.mapper, pair)
+	}
+	if cache, ok := mi.mapper.(types.MapperCache); ok {
+		cache.Invalidate(op.path)
+	}
+	mi.recordError(err)
+	return err
+}
+
+// ReconcileMirrors compares every mirror with the persistor, and repairs the pairs that differ.
+// Use counts are left alone, as every mapper counts the clicks it serves.
+func (m *MapperManager) ReconcileMirrors(ctx context.Context) error {
+	if len(m.mirrors) == 0 {
+		return nil
+	}
+	reference, err := m.listAll(ctx, m.persistor)
+	if err != nil {
+		return err
+	}
+	for _, mi := range m.mirrors {
+		repaired, err := m.reconcile(ctx, mi, reference)
+		if err != nil {
+			return fmt.Errorf("failed to reconcile mirror %s: %w", mi.mapper.GetName(), err)
+		}
+		if repaired > 0 {
+			m.logger.Warnf("Repaired %d pairs of mirror %s", repaired, mi.mapper.GetName())
+		}
+	}
+	return nil
+}
+
+// reconcile repairs mi against reference, a listing of the persistor. The listing may be older than
+// the mirror, so every difference is checked against the persistor again before it is repaired.
+func (m *MapperManager) reconcile(ctx context.Context, mi *mirror, reference types.PathUrlPairMap) (int, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mirrored, err := m.listAll(ctx, mi.mapper)
+	if err != nil {
+		return 0, err
+	}
+	differs := []string{}
+	for path, pair := range reference {
+		if other, ok := mirrored[path]; !ok || !other.Equals(pair) {
+			differs = append(differs, path)
+		}
+	}
+	for path := range mirrored {
+		if _, ok := reference[path]; !ok {
+			differs = append(differs, path)
+		}
+	}
+
+	repaired := 0
+	for _, path := range differs {
+		current, err := m.getFromMapper(ctx, m.persistor, path)
+		if err != nil {
+			return repaired, err
+		}
+		other := mirrored[path]
+		switch {
+		case current == nil && other == nil:
+			continue
+		case current == nil:
+			err = m.deleteFromMapper(ctx, mi.mapper, path)
+		case other != nil && other.Equals(current):
+			continue
+		default:
+			pair := current.Clone()
+			pair.Mapper = mi.mapper.GetName()
+			if other != nil {
+				pair.UseCount = other.UseCount
+			}
+			_, err = m.putToMapper(ctx, mi.mapper, pair)
+		}
+		if err != nil {
+			return repaired, err
+		}
+		if cache, ok := mi.mapper.(types.MapperCache); ok {
+			cache.Invalidate(path)
+		}
+		repaired++
+	}
+
+	now := time.Now()
+	mi.statusMu.Lock()
+	mi.status.LastReconcile = &now
+	mi.status.Repaired += repaired
+	mi.statusMu.Unlock()
+	return repaired, nil
+}
+
+// listAll lists every pair of mapper, a page at a time.
+func (m *MapperManager) listAll(ctx context.Context, mapper types.Mapper) (types.PathUrlPairMap, error) {
+	all := make(types.PathUrlPairMap)
+	pagination := types.Pagination{Limit: reconcilePageSize}
+	for {
+		pairs, err := m.listFromMapper(ctx, mapper, pagination)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			all[pair.Path] = pair
+		}
+		if len(pairs) < reconcilePageSize {
+			return all, nil
+		}
+		pagination.Cursor = types.NewCursor(pairs[len(pairs)-1].Path)
+	}
+}
+
+func (mi *mirror) enqueue(op mirrorOp) bool {
+	mi.statusMu.Lock()
+	defer mi.statusMu.Unlock()
+	if len(mi.queue) >= mi.queueSize {
+		mi.status.Dropped++
+		return false
+	}
+	mi.queue = append(mi.queue, op)
+	select {
+	case mi.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// peek returns the oldest queued write, which stays queued, and counts in the lag, until it is popped.
+func (mi *mirror) peek() (mirrorOp, bool) {
+	mi.statusMu.Lock()
+	defer mi.statusMu.Unlock()
+	if len(mi.queue) == 0 {
+		return mirrorOp{}, false
+	}
+	return mi.queue[0], true
+}
+
+func (mi *mirror) pop() {
+	mi.statusMu.Lock()
+	defer mi.statusMu.Unlock()
+	mi.queue[0] = mirrorOp{}
+	mi.queue = mi.queue[1:]
+}
+
+func (mi *mirror) recordError(err error) {
+	mi.statusMu.Lock()
+	defer mi.statusMu.Unlock()
+	if err != nil {
+		mi.status.Failed++
+		mi.status.LastError = err.Error()
+	}
+}
+
+func (mi *mirror) snapshot() MirrorStatus {
+	mi.statusMu.Lock()
+	defer mi.statusMu.Unlock()
+	status := mi.status
+	status.Pending = len(mi.queue)
+	if len(mi.queue) > 0 {
+		status.LagSeconds = time.Since(mi.queue[0].queued).Seconds()
+	}
+	return status
+}
@@ -0,0 +1,213 @@
+package mapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+// newMirroredManager sets up mockConfigurer as the persistor, mirrored to mockConfigurer2.
+func newMirroredManager(t *testing.T, mode string, opts ...ManagerOption) (*MapperManager, *MockMapper, *MockMapper) {
+	opts = append(opts, WithMirrors([]MirrorSettings{{Name: mockConfigurer2.Name, Mode: mode}}, 0))
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	return mm, mm.mappers[0].(*MockMapper), mm.mappers[1].(*MockMapper)
+}
+
+func canonical(t *testing.T, path string) string {
+	canonicalPath, err := sanitizer.CanonicalizePath(path)
+	require.NoError(t, err)
+	return canonicalPath
+}
+
+func waitReplicated(t *testing.T, mm *MapperManager) {
+	assert.Eventually(t, func() bool {
+		for _, status := range mm.MirrorStatus() {
+			if status.Pending > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWithMirrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		persistorName string
+		mirrors       []MirrorSettings
+		wantErr       bool
+	}{
+		{name: "happy path", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurer2.Name, Mode: "Async"}}},
+		{name: "no mirrors", persistorName: ""},
+		{name: "no persistor should fail", mirrors: []MirrorSettings{{Name: mockConfigurer2.Name}}, wantErr: true},
+		{name: "unknown mirror should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: "invalid"}}, wantErr: true},
+		{name: "persistor should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurer.Name}}, wantErr: true},
+		{name: "readonly mirror should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurerReadonly.Name}}, wantErr: true},
+		{name: "duplicate mirror should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurer2.Name}, {Name: mockConfigurer2.Name}}, wantErr: true},
+		{name: "unknown mode should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurer2.Name, Mode: "eventually"}}, wantErr: true},
+		{name: "negative queue size should fail", persistorName: mockConfigurer.Name, mirrors: []MirrorSettings{{Name: mockConfigurer2.Name, QueueSize: -1}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configurers := CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2, mockConfigurerReadonly})
+			mm, err := NewMapperManager(test.persistorName, configurers, WithMirrors(test.mirrors, time.Hour))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, mm)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, mm.MirrorStatus(), len(test.mirrors))
+			assert.NoError(t, mm.Teardown())
+		})
+	}
+}
+
+func TestMapperManager_MirrorWrites(t *testing.T) {
+	for _, mode := range []string{"sync", "async"} {
+		t.Run(mode, func(t *testing.T) {
+			ctx := context.Background()
+			mm, persistor, mirror := newMirroredManager(t, mode)
+
+			// inserts and updates of the persistor are replicated
+			_, err := mm.PutUrl(ctx, &types.PathUrlPair{Path: "new", Url: "https://new.com"})
+			assert.NoError(t, err)
+			_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "fk", Url: "https://updated.com"})
+			assert.NoError(t, err)
+			waitReplicated(t, mm)
+			assert.Equal(t, "https://new.com", mirror.Pairs[canonical(t, "new")].Url)
+			assert.Equal(t, "https://updated.com", mirror.Pairs[canonical(t, "fk")].Url)
+			assert.Equal(t, mirror.Name, mirror.Pairs[canonical(t, "fk")].Mapper)
+
+			// a path only held by the mirror is written to the persistor too
+			_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "fk3", Url: "https://moved.com"})
+			assert.NoError(t, err)
+			waitReplicated(t, mm)
+			assert.Equal(t, "https://moved.com", persistor.Pairs[canonical(t, "fk3")].Url)
+			assert.Equal(t, "https://moved.com", mirror.Pairs[canonical(t, "fk3")].Url)
+
+			// deletes are replicated
+			assert.NoError(t, mm.DeleteUrl(ctx, "fk"))
+			waitReplicated(t, mm)
+			assert.NotContains(t, persistor.Pairs, canonical(t, "fk"))
+			assert.NotContains(t, mirror.Pairs, canonical(t, "fk"))
+
+			status := mm.MirrorStatus()[0]
+			assert.Equal(t, mode, status.Mode)
+			assert.Zero(t, status.Failed)
+		})
+	}
+}
+
+func TestMapperManager_MirrorNamespaces(t *testing.T) {
+	ctx := context.Background()
+	alice := utils.WithActor(ctx, "alice")
+	configurers := CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2, mockConfigurerAlt})
+	mm, err := NewMapperManager(mockConfigurer.Name, configurers,
+		WithMirrors([]MirrorSettings{{Name: mockConfigurer2.Name, Mode: "sync"}}, 0),
+		WithNamespaces([]NamespaceSettings{{Name: "team", Mappers: []string{mockConfigurerAlt.Name}, Persistor: mockConfigurerAlt.Name}}))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	mirror, team := mm.mappers[1].(*MockMapper), mm.mappers[2].(*MockMapper)
+	require.NoError(t, mm.ReconcileMirrors(ctx))
+	repaired := mm.MirrorStatus()[0].Repaired
+
+	// the writes of a namespace with a persistor of its own are not replicated
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "team/new", Url: "https://new.com"})
+	assert.NoError(t, err)
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "team/new", Url: "https://updated.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://updated.com", team.Pairs[canonical(t, "team/new")].Url)
+	assert.NotContains(t, mirror.Pairs, canonical(t, "team/new"))
+
+	// personal links are written to the persistor, so they are
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "~/me", Url: "https://alice.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://alice.com", mirror.Pairs["/~alice/me"].Url)
+
+	// so that reconciliation has nothing to repair
+	assert.NoError(t, mm.ReconcileMirrors(ctx))
+	assert.Equal(t, repaired, mm.MirrorStatus()[0].Repaired)
+	assert.Contains(t, team.Pairs, canonical(t, "team/new"))
+
+	assert.NoError(t, mm.DeleteUrl(ctx, "team/new"))
+	assert.NotContains(t, team.Pairs, canonical(t, "team/new"))
+	assert.Zero(t, mm.MirrorStatus()[0].Failed)
+}
+
+func TestMapperManager_MirrorFailure(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, mirror := newMirroredManager(t, "sync", WithMapperSettings(mockConfigurer2.Name, MapperSettings{OnError: "skip"}))
+	mirror.Err = assert.AnError
+
+	// a mirror that is down does not keep the persistor from taking writes,
+	// but the caller is told that the mirror missed it
+	_, err := mm.PutUrl(ctx, &types.PathUrlPair{Path: "new", Url: "https://new.com"})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, persistor.Pairs, canonical(t, "new"))
+	status := mm.MirrorStatus()[0]
+	assert.Equal(t, 1, status.Failed)
+	assert.Contains(t, status.LastError, assert.AnError.Error())
+
+	// until reconciliation repairs the mirror
+	mirror.Err = nil
+	assert.NoError(t, mm.ReconcileMirrors(ctx))
+	assert.Equal(t, "https://new.com", mirror.Pairs[canonical(t, "new")].Url)
+}
+
+func TestMapperManager_ReconcileMirrors(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, mirror := newMirroredManager(t, "async")
+	// the mirror has diverged: fk is missing, fk2 is outdated, fk3 was deleted from the persistor,
+	// and timed has lost its expiry
+	fk, fk2, timed := canonical(t, "fk"), canonical(t, "fk2"), canonical(t, "timed")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	persistor.Pairs[timed] = &types.PathUrlPair{Path: timed, Url: "https://timed.com", Mapper: persistor.Name, ExpiresAt: &expiresAt}
+	mirror.Pairs[timed] = &types.PathUrlPair{Path: timed, Url: "https://timed.com", Mapper: mirror.Name}
+	mirror.Pairs[fk2] = &types.PathUrlPair{Path: fk2, Url: "https://outdated.com", Mapper: mirror.Name, UseCount: 7}
+
+	assert.NoError(t, mm.ReconcileMirrors(ctx))
+	assert.Len(t, mirror.Pairs, len(persistor.Pairs))
+	assert.Equal(t, persistor.Pairs[fk].Url, mirror.Pairs[fk].Url)
+	assert.Equal(t, persistor.Pairs[fk2].Url, mirror.Pairs[fk2].Url)
+	assert.Equal(t, 7, mirror.Pairs[fk2].UseCount, "use counts are left alone")
+	assert.NotContains(t, mirror.Pairs, canonical(t, "fk3"))
+	assert.Equal(t, &expiresAt, mirror.Pairs[timed].ExpiresAt)
+
+	status := mm.MirrorStatus()[0]
+	assert.Equal(t, 4, status.Repaired)
+	assert.NotNil(t, status.LastReconcile)
+
+	// nothing left to repair
+	assert.NoError(t, mm.ReconcileMirrors(ctx))
+	assert.Equal(t, 4, mm.MirrorStatus()[0].Repaired)
+}
+
+func TestMirror_Queue(t *testing.T) {
+	mi := &mirror{queueSize: 1, wake: make(chan struct{}, 1), status: MirrorStatus{Name: "mirror"}}
+	assert.True(t, mi.enqueue(mirrorOp{path: "/a", queued: time.Now().Add(-time.Minute)}))
+	assert.False(t, mi.enqueue(mirrorOp{path: "/b", queued: time.Now()}))
+
+	status := mi.snapshot()
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, 1, status.Dropped)
+	assert.GreaterOrEqual(t, status.LagSeconds, 60.0)
+
+	op, ok := mi.peek()
+	assert.True(t, ok)
+	assert.Equal(t, "/a", op.path)
+	mi.pop()
+	_, ok = mi.peek()
+	assert.False(t, ok)
+	assert.Zero(t, mi.snapshot().LagSeconds)
+}
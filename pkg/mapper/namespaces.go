@@ -0,0 +1,285 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+// NamespaceSettings give the paths of a namespace, those whose first segment is its name,
+// their own mappers and members, so that teams sharing golinks do not fight over the same keywords.
+// The default namespace of an actor is the first one that has it as a member.
+type NamespaceSettings struct {
+	Name      string   `mapstructure:"name"`
+	Mappers   []string `mapstructure:"mappers"`   // searched for the paths of the namespace, in this order; every mapper when empty
+	Persistor string   `mapstructure:"persistor"` // where new paths of the namespace are written; the persistor when empty
+	Members   []string `mapstructure:"members"`   // actors that may write to the namespace; anyone when empty
+	Private   bool     `mapstructure:"private"`   // only members may resolve and list the paths of the namespace
+}
+
+type namespace struct {
+	name      string         // canonical, without slashes
+	mappers   []types.Mapper // every mapper of the manager when empty
+	persistor types.Mapper   // the persistor of the manager when nil
+	members   []string
+	private   bool
+	personal  bool   // the only member is actor
+	actor     string // of a personal namespace, as the requests name it; empty if the name stands for no actor
+}
+
+// prefix is what the paths of the namespace start with.
+func (n *namespace) prefix() string {
+	return "/" + n.name + "/"
+}
+
+func (n *namespace) isMember(actor string) bool {
+	if n.personal {
+		return actor != "" && actor == n.actor
+	}
+	return actor != "" && slices.Contains(n.members, actor)
+}
+
+// nameOf returns the name of ns, or an empty string for the paths outside of the namespaces.
+func nameOf(ns *namespace) string {
+	if ns == nil {
+		return ""
+	}
+	return ns.name
+}
+
+// WithNamespaces configures namespaces. A path outside of them is looked up in the default namespace
+// of the actor first, then as it is; the paths of a namespace are only looked up in its mappers,
+// and only matched by its own patterns.
+func WithNamespaces(settings []NamespaceSettings) ManagerOption {
+	return func(m *MapperManager) error {
+		for _, s := range settings {
+			name, err := sanitizer.CanonicalizeNamespace(s.Name)
+			if err != nil {
+				return ErrMapConfigSetup(fmt.Sprintf("invalid namespace %s: %v", s.Name, err))
+			}
+			if sanitizer.IsPersonal(name) {
+				return ErrMapConfigSetup(fmt.Sprintf("namespace %s is reserved for personal links", name))
+			}
+			if m.findNamespace(name) != nil {
+				return ErrMapConfigSetup(fmt.Sprintf("duplicate namespace: %s", name))
+			}
+			ns := &namespace{name: name, members: slices.Clone(s.Members), private: s.Private}
+			for _, mapperName := range s.Mappers {
+				mapper := findMapper(m.mappers, mapperName)
+				if mapper == nil {
+					return ErrMapConfigSetup(fmt.Sprintf("mapper %s of namespace %s not found", mapperName, name))
+				}
+				ns.mappers = append(ns.mappers, mapper)
+			}
+			if s.Persistor != "" {
+				if ns.persistor = findMapper(m.mappers, s.Persistor); ns.persistor == nil {
+					return ErrMapConfigSetup(fmt.Sprintf("persistor %s of namespace %s not found", s.Persistor, name))
+				}
+				if ns.persistor.Readonly() {
+					return ErrMapConfigSetup(fmt.Sprintf("persistor %s of namespace %s is readonly", s.Persistor, name))
+				}
+			}
+			// new paths must be found where they are written
+			if persistor := m.persistorOf(ns); persistor != nil && len(ns.mappers) > 0 && !slices.Contains(ns.mappers, persistor) {
+				return ErrMapConfigSetup(fmt.Sprintf("persistor %s of namespace %s is not one of its mappers", persistor.GetName(), name))
+			}
+			if ns.private && len(ns.members) == 0 {
+				return ErrMapConfigSetup(fmt.Sprintf("private namespace %s has no members", name))
+			}
+			m.namespaces = append(m.namespaces, ns)
+		}
+		return nil
+	}
+}
+
+func (m *MapperManager) findNamespace(name string) *namespace {
+	if name == "" {
+		return nil
+	}
+	if sanitizer.IsPersonal(name) {
+		return m.personalNamespace(name)
+	}
+	for _, ns := range m.namespaces {
+		if ns.name == name {
+			return ns
+		}
+	}
+	return nil
+}
+
+// namespaceOf returns the namespace of a canonical path, or nil if it is in none that is configured.
+func (m *MapperManager) namespaceOf(path string) *namespace {
+	return m.findNamespace(sanitizer.NamespaceOf(path))
+}
+
+// personalNamespace returns the namespace of the personal links with the given canonical name,
+// which are private to their actor and kept in the persistor, or nil if there is no persistor to keep them.
+func (m *MapperManager) personalNamespace(name string) *namespace {
+	persistor := m.getPersistor()
+	if persistor == nil {
+		return nil
+	}
+	actor, _ := sanitizer.PersonalActor(name)
+	return &namespace{name: name, mappers: []types.Mapper{persistor}, persistor: persistor, private: true, personal: true, actor: actor}
+}
+
+// ownPath returns canonicalPath with its ~ namespace, if it has one, replaced by the personal namespace
+// of the actor of ctx.
+func (m *MapperManager) ownPath(ctx context.Context, canonicalPath string) (string, error) {
+	if sanitizer.NamespaceOf(canonicalPath) != sanitizer.PersonalPrefix {
+		return canonicalPath, nil
+	}
+	if m.getPersistor() == nil {
+		return "", ErrOperationNotSupported("personal links")
+	}
+	name, err := sanitizer.PersonalNamespace(utils.ActorFromContext(ctx))
+	if err != nil {
+		return "", ErrAnonymous(canonicalPath)
+	}
+	return "/" + name + strings.TrimPrefix(canonicalPath, "/"+sanitizer.PersonalPrefix), nil
+}
+
+// defaultNamespace returns the first namespace that has the actor of ctx as a member, or nil.
+func (m *MapperManager) defaultNamespace(ctx context.Context) *namespace {
+	actor := utils.ActorFromContext(ctx)
+	for _, ns := range m.namespaces {
+		if ns.isMember(actor) {
+			return ns
+		}
+	}
+	return nil
+}
+
+// mappersOf returns the mappers that hold the paths of ns, in order of precedence.
+func (m *MapperManager) mappersOf(ns *namespace) []types.Mapper {
+	if ns == nil || len(ns.mappers) == 0 {
+		return m.mappers
+	}
+	return ns.mappers
+}
+
+// persistorOf returns the mapper that new paths of ns are written to, or nil if there is none.
+func (m *MapperManager) persistorOf(ns *namespace) types.Mapper {
+	if ns == nil || ns.persistor == nil {
+		return m.getPersistor()
+	}
+	return ns.persistor
+}
+
+// authorize fails if the actor of ctx may not read the paths of ns, or write them if write is set.
+// The paths outside of the namespaces are open to anyone.
+func (m *MapperManager) authorize(ctx context.Context, ns *namespace, write bool) error {
+	if ns == nil {
+		return nil
+	}
+	actor := utils.ActorFromContext(ctx)
+	if (ns.private || write && len(ns.members) > 0) && !ns.isMember(actor) {
+		return ErrNotMember(actor, ns.name)
+	}
+	return nil
+}
+
+// candidates returns the canonical paths that a request for canonicalPath looks up, in order:
+// the path among the personal links of the actor, unless it is personal itself,
+// then the path in the default namespace of the actor if it is in none, then the path as it is.
+func (m *MapperManager) candidates(ctx context.Context, canonicalPath string) ([]string, error) {
+	ns := m.namespaceOf(canonicalPath)
+	if err := m.authorize(ctx, ns, false); err != nil {
+		return nil, err
+	}
+	if patterns.IsPattern(canonicalPath) {
+		return []string{canonicalPath}, nil
+	}
+	var candidates []string
+	if name, err := sanitizer.PersonalNamespace(utils.ActorFromContext(ctx)); err == nil && m.getPersistor() != nil && !sanitizer.IsPersonal(nameOf(ns)) {
+		candidates = append(candidates, "/"+name+canonicalPath)
+	}
+	if def := m.defaultNamespace(ctx); ns == nil && def != nil {
+		candidates = append(candidates, def.prefix()+strings.TrimPrefix(canonicalPath, "/"))
+	}
+	return append(candidates, canonicalPath), nil
+}
+
+// ListUrlsInNamespace is ListUrlsInStates, keeping only the pairs of the namespace with the given name,
+// as its mappers hold them, or every pair if name is empty; ~ names the personal links of the actor.
+// The pairs of the private namespaces that the actor is not a member of, such as the personal links
+// of other actors, are left out either way.
+func (m *MapperManager) ListUrlsInNamespace(ctx context.Context, name string, pagination types.Pagination, states []types.LinkState) (types.PathUrlPairList, LookupStatus, error) {
+	var status LookupStatus
+	var ns *namespace
+	if name != "" {
+		canonicalName, err := sanitizer.CanonicalizeNamespace(name)
+		if err != nil {
+			return nil, status, err
+		}
+		if canonicalName == sanitizer.PersonalPrefix {
+			if canonicalName, err = sanitizer.PersonalNamespace(utils.ActorFromContext(ctx)); err != nil {
+				return nil, status, ErrAnonymous(name)
+			}
+		}
+		if ns = m.findNamespace(canonicalName); ns == nil {
+			return nil, status, ErrUnknownNamespace(canonicalName)
+		}
+		if err := m.authorize(ctx, ns, false); err != nil {
+			return nil, status, err
+		}
+	}
+	// personal links are private, and kept in the persistor
+	hasPrivate := m.getPersistor() != nil || slices.ContainsFunc(m.namespaces, func(other *namespace) bool { return other.private })
+	if ns == nil && len(states) == 0 && !hasPrivate {
+		return m.ListUrlsWithStatus(ctx, pagination)
+	}
+	now := time.Now()
+	keep := func(pair *types.PathUrlPair) bool {
+		pairNs := m.namespaceOf(pair.Path)
+		if ns != nil && nameOf(pairNs) != ns.name || m.authorize(ctx, pairNs, false) != nil {
+			return false
+		}
+		return len(states) == 0 || slices.Contains(states, pair.State(now))
+	}
+	skip := pagination.Offset
+	if pagination.Cursor != "" {
+		skip = 0
+	}
+	kept := types.PathUrlPairList{}
+	page := types.Pagination{Limit: max(pagination.Limit, listInStatesPageSize), Cursor: pagination.Cursor}
+	if ns != nil && page.Cursor == "" {
+		// the paths of the namespace are listed together, right after its name
+		page.Cursor = types.NewCursor(strings.TrimSuffix(ns.prefix(), "/"))
+	}
+	for len(kept) < pagination.Limit {
+		pairs, pageStatus, err := m.listUrls(ctx, m.mappersOf(ns), page)
+		if err != nil {
+			return nil, status, err
+		}
+		status.merge(pageStatus)
+		for _, pair := range pairs {
+			if len(kept) == pagination.Limit || !keep(pair) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		if len(pairs) < page.Limit {
+			break
+		}
+		last := pairs[len(pairs)-1].Path
+		if ns != nil && last > ns.prefix() && !strings.HasPrefix(last, ns.prefix()) && !patterns.IsRegex(last) {
+			// past the paths of the namespace, only its regexes are left, which come after every path
+			page.Cursor = types.NewCursor("^")
+			continue
+		}
+		page.Cursor = types.NewCursor(last)
+	}
+	return kept, status, nil
+}
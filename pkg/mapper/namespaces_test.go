@@ -0,0 +1,296 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+func TestWithNamespaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []NamespaceSettings
+		wantErr  bool
+	}{
+		{name: "happy path", settings: []NamespaceSettings{{Name: "team-a", Mappers: []string{mockConfigurer2.Name}, Persistor: mockConfigurer2.Name, Members: []string{"alice"}, Private: true}, {Name: "team-b"}}},
+		{name: "invalid name should fail", settings: []NamespaceSettings{{Name: "team/a"}}, wantErr: true},
+		{name: "duplicate namespace should fail", settings: []NamespaceSettings{{Name: "team-a"}, {Name: "teama"}}, wantErr: true},
+		{name: "unknown mapper should fail", settings: []NamespaceSettings{{Name: "team-a", Mappers: []string{"invalid"}}}, wantErr: true},
+		{name: "unknown persistor should fail", settings: []NamespaceSettings{{Name: "team-a", Persistor: "invalid"}}, wantErr: true},
+		{name: "readonly persistor should fail", settings: []NamespaceSettings{{Name: "team-a", Persistor: mockConfigurerReadonly.Name}}, wantErr: true},
+		{name: "persistor outside of the mappers should fail", settings: []NamespaceSettings{{Name: "team-a", Mappers: []string{mockConfigurer2.Name}}}, wantErr: true},
+		{name: "private namespace without members should fail", settings: []NamespaceSettings{{Name: "team-a", Private: true}}, wantErr: true},
+		{name: "personal namespace should fail", settings: []NamespaceSettings{{Name: "~team-a"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2, mockConfigurerReadonly}),
+				WithNamespaces(test.settings))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, mm)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, mm.namespaces, len(test.settings))
+			}
+		})
+	}
+}
+
+func TestMapperManager_Namespaces(t *testing.T) {
+	shared := &MockMapperConfigurer{
+		Name: "shared",
+		StarterPairs: types.PathUrlPairMap{
+			"/fk":          {Path: "/fk", Url: "https://fake.com"},
+			"/fk2":         {Path: "/fk2", Url: "https://fake2.com"},
+			"/*":           {Path: "/*", Url: "https://search.com/?q=$1"},
+			"/teama/stray": {Path: "/teama/stray", Url: "https://stray.com"},
+		},
+	}
+	teamA := &MockMapperConfigurer{
+		Name: "teama",
+		StarterPairs: types.PathUrlPairMap{
+			"/teama/fk":        {Path: "/teama/fk", Url: "https://a.com/fk"},
+			"/teama/pr/*":      {Path: "/teama/pr/*", Url: "https://a.com/pr/$1"},
+			`^teama/bug(\d+)$`: {Path: `^teama/bug(\d+)$`, Url: "https://a.com/bug/$1"},
+		},
+	}
+	secret := &MockMapperConfigurer{
+		Name: "secret",
+		StarterPairs: types.PathUrlPairMap{
+			"/secret/plan": {Path: "/secret/plan", Url: "https://secret.com/plan"},
+		},
+	}
+	mm, err := NewMapperManager(shared.Name, CloneConfigurers([]*MockMapperConfigurer{shared, teamA, secret}),
+		WithNamespaces([]NamespaceSettings{
+			{Name: "team-a", Mappers: []string{teamA.Name}, Persistor: teamA.Name, Members: []string{"alice"}},
+			{Name: "team-b", Members: []string{"bob"}},
+			{Name: "secret", Mappers: []string{secret.Name}, Persistor: secret.Name, Members: []string{"carol"}, Private: true},
+		}),
+		WithPatterns(0))
+	require.NoError(t, err)
+	anonymous := context.Background()
+	alice := utils.WithActor(anonymous, "alice")
+	bob := utils.WithActor(anonymous, "bob")
+	carol := utils.WithActor(anonymous, "carol")
+
+	// the default namespace of the actor is searched before the global one
+	tests := []struct {
+		name string
+		ctx  context.Context
+		path string
+		url  string
+	}{
+		{name: "global path", ctx: anonymous, path: "fk", url: "https://fake.com"},
+		{name: "default namespace first", ctx: alice, path: "fk", url: "https://a.com/fk"},
+		{name: "global path when missing from the default namespace", ctx: alice, path: "fk2", url: "https://fake2.com"},
+		{name: "explicit namespace", ctx: bob, path: "team-a/fk", url: "https://a.com/fk"},
+		{name: "pattern of the default namespace", ctx: alice, path: "pr/1", url: "https://a.com/pr/1"},
+		{name: "regex of the default namespace", ctx: alice, path: "bug4", url: "https://a.com/bug/4"},
+		{name: "global pattern", ctx: anonymous, path: "x", url: "https://search.com/?q=x"},
+		{name: "not found in the mappers of the namespace", ctx: anonymous, path: "team-a/stray"},
+		{name: "global patterns do not match the paths of namespaces", ctx: anonymous, path: "team-a/x"},
+		{name: "private namespace to a member", ctx: carol, path: "secret/plan", url: "https://secret.com/plan"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pair, err := mm.GetUrl(test.ctx, test.path, false)
+			assert.NoError(t, err)
+			if test.url == "" {
+				assert.Nil(t, pair)
+				return
+			}
+			require.NotNil(t, pair)
+			assert.Equal(t, test.url, pair.Url)
+		})
+	}
+	_, err = mm.GetUrl(anonymous, "secret/plan", false)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, err = mm.History(alice, "secret/plan", 10)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+
+	// only members write to a namespace with members, and new paths go to the persistor of the namespace
+	_, err = mm.PutUrl(anonymous, &types.PathUrlPair{Path: "team-a/new", Url: "https://a.com/new"})
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	pair, err := mm.PutUrl(alice, &types.PathUrlPair{Path: "team-a/new", Url: "https://a.com/new"})
+	assert.NoError(t, err)
+	assert.Equal(t, teamA.Name, pair.Mapper)
+	pair, err = mm.PutUrl(bob, &types.PathUrlPair{Path: "team-b/new", Url: "https://b.com/new"})
+	assert.NoError(t, err)
+	assert.Equal(t, shared.Name, pair.Mapper)
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "global", Url: "https://global.com", Aliases: []string{"team-b/global"}})
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, err = mm.PutUrl(anonymous, &types.PathUrlPair{Path: "global", Url: "https://global.com"})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, mm.DeleteUrl(bob, "team-a/new"), utils.ErrPermissionDenied)
+
+	// listing a namespace only lists its own mappers, and private namespaces are only listed to their members
+	pairs, _, err := mm.ListUrlsInNamespace(bob, "team-a", utils.DefaultPagination, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/teama/fk", "/teama/new", "/teama/pr/*", `^teama/bug(\d+)$`}, paths(pairs))
+	pairs, _, err = mm.ListUrlsInNamespace(anonymous, "", utils.DefaultPagination, nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, paths(pairs), "/secret/plan")
+	pairs, _, err = mm.ListUrlsInNamespace(carol, "", utils.DefaultPagination, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, paths(pairs), "/secret/plan")
+	_, _, err = mm.ListUrlsInNamespace(anonymous, "secret", utils.DefaultPagination, nil)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, _, err = mm.ListUrlsInNamespace(anonymous, "team-c", utils.DefaultPagination, nil)
+	assert.ErrorIs(t, err, sanitizer.ErrInvalidInput)
+
+	assert.NoError(t, mm.DeleteUrl(alice, "team-a/new"))
+	pair, err = mm.GetUrl(alice, "team-a/new", false)
+	assert.NoError(t, err)
+	assert.Nil(t, pair)
+}
+
+func TestMapperManager_ListUrlsInNamespace(t *testing.T) {
+	// more pairs after the paths of the namespace than fit in a page, before its regexes
+	pairs := types.PathUrlPairMap{
+		"/teama/fk":     {Path: "/teama/fk", Url: "https://a.com/fk"},
+		`^teama/(\d+)$`: {Path: `^teama/(\d+)$`, Url: "https://a.com/$1"},
+		`^other(\d+)$`:  {Path: `^other(\d+)$`, Url: "https://other.com/$1"},
+	}
+	for i := 0; i < 2*listInStatesPageSize; i++ {
+		path := fmt.Sprintf("/zz%d", i)
+		pairs[path] = &types.PathUrlPair{Path: path, Url: "https://zz.com"}
+	}
+	mm, err := NewMapperManager("many", CloneConfigurers([]*MockMapperConfigurer{{Name: "many", StarterPairs: pairs}}),
+		WithNamespaces([]NamespaceSettings{{Name: "team-a"}}))
+	require.NoError(t, err)
+
+	got, _, err := mm.ListUrlsInNamespace(context.Background(), "team-a", types.Pagination{Limit: 10}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/teama/fk", `^teama/(\d+)$`}, paths(got))
+	got, _, err = mm.ListUrlsInNamespace(context.Background(), "team-a", types.Pagination{Offset: 1, Limit: 10}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`^teama/(\d+)$`}, paths(got))
+}
+
+func TestMapperManager_PersonalLinks(t *testing.T) {
+	shared := &MockMapperConfigurer{
+		Name: "shared",
+		StarterPairs: types.PathUrlPairMap{
+			"/fk": {Path: "/fk", Url: "https://fake.com"},
+		},
+	}
+	mm, err := NewMapperManager(shared.Name, CloneConfigurers([]*MockMapperConfigurer{shared, mockConfigurer2}), WithPatterns(0))
+	require.NoError(t, err)
+	anonymous := context.Background()
+	alice := utils.WithActor(anonymous, "alice")
+	bob := utils.WithActor(anonymous, "bob")
+
+	// personal links are kept in the persistor, under the namespace of their actor
+	pair, err := mm.PutUrl(alice, &types.PathUrlPair{Path: "~/fk", Url: "https://alice.com/fk"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/~alice/fk", pair.Path)
+	assert.Equal(t, shared.Name, pair.Mapper)
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "~/pr/*", Url: "https://alice.com/pr/$1"})
+	assert.NoError(t, err)
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "~/y", Url: "https://alice.com/y", Aliases: []string{"~/z"}})
+	assert.NoError(t, err)
+
+	// and shadow the shared links for their actor only
+	tests := []struct {
+		name string
+		ctx  context.Context
+		path string
+		url  string
+	}{
+		{name: "personal link first", ctx: alice, path: "fk", url: "https://alice.com/fk"},
+		{name: "shared link to others", ctx: bob, path: "fk", url: "https://fake.com"},
+		{name: "shared link to anonymous", ctx: anonymous, path: "fk", url: "https://fake.com"},
+		{name: "shared link when no personal one", ctx: alice, path: "fk3", url: "https://fake3.com"},
+		{name: "explicitly personal", ctx: alice, path: "~/fk", url: "https://alice.com/fk"},
+		{name: "personal alias", ctx: alice, path: "z", url: "https://alice.com/y"},
+		{name: "personal pattern", ctx: alice, path: "pr/3", url: "https://alice.com/pr/3"},
+		{name: "no personal pattern of others", ctx: bob, path: "pr/3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pair, err := mm.GetUrl(test.ctx, test.path, false)
+			assert.NoError(t, err)
+			if test.url == "" {
+				assert.Nil(t, pair)
+				return
+			}
+			require.NotNil(t, pair)
+			assert.Equal(t, test.url, pair.Url)
+		})
+	}
+	_, err = mm.GetUrl(bob, "~alice/fk", false)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, err = mm.GetUrl(anonymous, "~/fk", false)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, err = mm.PutUrl(bob, &types.PathUrlPair{Path: "~alice/fk", Url: "https://bob.com"})
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "~/w", Url: "https://alice.com/w", Aliases: []string{"w"}})
+	assert.ErrorIs(t, err, sanitizer.ErrInvalidInput)
+
+	// personal links are only listed to their actor
+	pairs, _, err := mm.ListUrlsInNamespace(bob, "", utils.DefaultPagination, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/fk", "/fk3"}, paths(pairs))
+	pairs, _, err = mm.ListUrlsInNamespace(alice, "~", utils.DefaultPagination, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/~alice/fk", "/~alice/pr/*", "/~alice/y"}, paths(pairs))
+	_, _, err = mm.ListUrlsInNamespace(bob, "~alice", utils.DefaultPagination, nil)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	_, _, err = mm.ListUrlsInNamespace(anonymous, "~", utils.DefaultPagination, nil)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+
+	assert.NoError(t, mm.DeleteUrl(alice, "~/fk"))
+	pair, err = mm.GetUrl(alice, "fk", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fake.com", pair.Url)
+
+	// actors whose names canonicalize alike are kept apart
+	jdoe := utils.WithActor(anonymous, "jdoe")
+	jDotDoe := utils.WithActor(anonymous, "j.doe")
+	pair, err = mm.PutUrl(jdoe, &types.PathUrlPair{Path: "~/notes", Url: "https://jdoe.com/notes"})
+	require.NoError(t, err)
+	assert.Equal(t, "/~jdoe/notes", pair.Path)
+	pair, err = mm.PutUrl(jDotDoe, &types.PathUrlPair{Path: "~/notes", Url: "https://j.doe.com/notes"})
+	require.NoError(t, err)
+	assert.Equal(t, "/~j~2edoe/notes", pair.Path)
+	for _, ctx := range []context.Context{jDotDoe, utils.WithActor(anonymous, "j-doe"), utils.WithActor(anonymous, "j_doe")} {
+		_, err = mm.GetUrl(ctx, "~jdoe/notes", false)
+		assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+		_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "~jdoe/notes", Url: "https://evil.com"})
+		assert.ErrorIs(t, err, utils.ErrPermissionDenied)
+	}
+	pair, err = mm.GetUrl(jdoe, "notes", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://jdoe.com/notes", pair.Url)
+	pair, err = mm.GetUrl(jDotDoe, "notes", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://j.doe.com/notes", pair.Url)
+	_, err = mm.GetUrl(jDotDoe, "~j~2Edoe/notes", false)
+	assert.ErrorIs(t, err, utils.ErrPermissionDenied, "only one name stands for an actor")
+
+	// without a persistor, there is nowhere to keep personal links
+	readonly, err := NewMapperManager("", CloneConfigurers([]*MockMapperConfigurer{shared}))
+	require.NoError(t, err)
+	pair, err = readonly.GetUrl(alice, "fk", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fake.com", pair.Url)
+	_, err = readonly.PutUrl(alice, &types.PathUrlPair{Path: "~/fk", Url: "https://alice.com/fk"})
+	assert.Error(t, err)
+}
+
+func paths(pairs types.PathUrlPairList) []string {
+	out := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		out = append(out, pair.Path)
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+package mapper
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// patternStore keeps the compiled patterns of every mapper, in precedence order,
+// so that a lookup that no path matched does not list the mappers. It only holds the paths of the patterns:
+// their pairs are read from their mapper when they match.
+type patternStore struct {
+	mu       sync.RWMutex
+	patterns map[string][]*patterns.Pattern // by mapper name
+}
+
+func newPatternStore() *patternStore {
+	return &patternStore{patterns: make(map[string][]*patterns.Pattern)}
+}
+
+// set replaces the patterns of mapper with those among paths.
+func (s *patternStore) set(mapper string, paths []string) {
+	var compiled []*patterns.Pattern
+	for _, path := range paths {
+		if p, err := patterns.Compile(path); err == nil {
+			compiled = append(compiled, p)
+		}
+	}
+	slices.SortFunc(compiled, patterns.Compare)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.patterns[mapper] = compiled
+}
+
+func (s *patternStore) put(mapper string, path string) {
+	p, err := patterns.Compile(path)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	compiled := slices.DeleteFunc(slices.Clone(s.patterns[mapper]), func(other *patterns.Pattern) bool { return other.Path == path })
+	compiled = append(compiled, p)
+	slices.SortFunc(compiled, patterns.Compare)
+	s.patterns[mapper] = compiled
+}
+
+func (s *patternStore) delete(mapper string, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.patterns[mapper] = slices.DeleteFunc(slices.Clone(s.patterns[mapper]), func(p *patterns.Pattern) bool { return p.Path == path })
+}
+
+// matching returns the patterns of mapper that path matches, in precedence order.
+func (s *patternStore) matching(mapper string, path string) []*patterns.Pattern {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matching []*patterns.Pattern
+	for _, p := range s.patterns[mapper] {
+		if p.Matches(path) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+// WithPatterns loads the patterns of every mapper, along with the index of its paths that Suggest reads,
+// and reloads them every refresh interval if it is positive, to pick up the pairs that were not written
+// through the manager, such as those of other servers sharing a database. The pairs written through
+// the manager are picked up right away, and those of a mapper that reloads its own source, such as an edited file,
+// as soon as it reloads.
+func WithPatterns(refreshInterval time.Duration) ManagerOption {
+	return func(m *MapperManager) error {
+		m.LoadPatterns(context.Background())
+		for _, mapper := range m.mappers {
+			if reloader, ok := mapper.(types.MapperReloader); ok {
+				reloader.OnReload(func() { m.loadPatterns(context.Background(), mapper) })
+			}
+		}
+		if refreshInterval <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(refreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					m.LoadPatterns(ctx)
+				}
+			}
+		}()
+		m.stopPatterns = func() {
+			cancel()
+			wg.Wait()
+		}
+		return nil
+	}
+}
+
+// LoadPatterns lists every mapper for its patterns and the index of its paths.
+// A mapper that fails keeps the patterns and the paths it had.
+func (m *MapperManager) LoadPatterns(ctx context.Context) {
+	for _, mapper := range m.mappers {
+		m.loadPatterns(ctx, mapper)
+	}
+}
+
+func (m *MapperManager) loadPatterns(ctx context.Context, mapper types.Mapper) {
+	pairs, err := m.listAll(ctx, mapper)
+	if err != nil {
+		m.logger.Warnf("Failed to load the patterns of mapper %s: %v", mapper.GetName(), err)
+		return
+	}
+	var paths []string
+	for path := range pairs {
+		if patterns.IsPattern(path) {
+			paths = append(paths, path)
+		}
+	}
+	m.patternStore.set(mapper.GetName(), paths)
+	m.suggestIndex.set(mapper.GetName(), pairs)
+	m.logger.Debugf("Loaded %d patterns of mapper %s", len(paths), mapper.GetName())
+}
+
+// MatchPattern returns the pair of the pattern that path would hit if no path or alias matched it,
+// with its urls expanded for path, or nil if no pattern matches. Nothing is counted.
+func (m *MapperManager) MatchPattern(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	canonicalPath, err := sanitizer.CanonicalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if canonicalPath, err = m.ownPath(ctx, canonicalPath); err != nil {
+		return nil, err
+	}
+	candidates, err := m.candidates(ctx, canonicalPath)
+	if err != nil {
+		return nil, err
+	}
+	var status LookupStatus
+	for _, candidate := range candidates {
+		if pair, err := m.matchPattern(ctx, candidate, false, &status); pair != nil || err != nil {
+			return pair, err
+		}
+	}
+	return nil, nil
+}
+
+// matchPattern tries the patterns that canonicalPath matches, in mapper order then in precedence order,
+// and returns the pair of the first one that its mapper still has, with its urls expanded.
+// Only the mappers and the patterns of the namespace of canonicalPath are tried.
+// Mappers are tolerated like in GetUrl.
+func (m *MapperManager) matchPattern(ctx context.Context, canonicalPath string, incrementCounter bool, status *LookupStatus) (*types.PathUrlPair, error) {
+	if patterns.IsPattern(canonicalPath) {
+		return nil, nil
+	}
+	ns := m.namespaceOf(canonicalPath)
+	for _, mapper := range m.mappersOf(ns) {
+		for _, p := range m.patternStore.matching(mapper.GetName(), canonicalPath) {
+			if nameOf(m.namespaceOf(p.Path)) != nameOf(ns) {
+				continue
+			}
+			m.logger.Debugf("Trying pattern %s of mapper %s for path %s", p.Path, mapper.GetName(), canonicalPath)
+			pair, err := m.getFromMapper(ctx, mapper, p.Path)
+			if err != nil {
+				if !m.tolerate(ctx, mapper) {
+					return nil, err
+				}
+				m.logger.Warnf("Skipping mapper %s for pattern %s: %v", mapper.GetName(), p.Path, err)
+				if pair = m.stalePair(mapper, p.Path); pair == nil {
+					status.markSkipped(mapper.GetName())
+					break
+				}
+				status.markStale(mapper.GetName())
+			} else if pair == nil || pair.Path != p.Path {
+				// deleted since the patterns were loaded
+				continue
+			} else if incrementCounter && !mapper.Readonly() && pair.State(time.Now()) == types.LinkState_Active {
+				// the pair of the pattern is counted as it is stored, before its urls are expanded
+				if err := m.incrementInMapper(ctx, mapper, pair); err != nil {
+					m.logger.Errorf("Failed to increment counter at mapper %s: %v", mapper.GetName(), err)
+				}
+			}
+			applied := p.Apply(pair, canonicalPath)
+			sanitizer.SanitizeOutput(mapper, applied)
+			return applied, nil
+		}
+	}
+	return nil, nil
+}
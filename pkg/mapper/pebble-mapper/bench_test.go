@@ -0,0 +1,114 @@
+package pebble_mapper
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	bolt_mapper "github.com/reimirno/golinks/pkg/mapper/bolt-mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const benchLinks = 2000
+
+var benchStores = []string{"bolt", "pebble"}
+
+// newBenchManager returns a manager of a single store, in a fresh directory, with benchLinks links.
+func newBenchManager(b *testing.B, store string) (*mapper.MapperManager, []string) {
+	var configurer types.MapperConfigurer = &PebbleMapperConfig{Name: "store", Path: filepath.Join(b.TempDir(), "pebble")}
+	if store == "bolt" {
+		configurer = &bolt_mapper.BoltMapperConfig{Name: "store", Path: filepath.Join(b.TempDir(), "bolt.db"), Timeout: 1}
+	}
+	mm, err := mapper.NewMapperManager("store", []types.MapperConfigurer{configurer})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { mm.Teardown() })
+	paths := make([]string, benchLinks)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("link%d", i)
+		if _, err := mm.PutUrl(context.Background(), &types.PathUrlPair{Path: paths[i], Url: fmt.Sprintf("https://%d.example.com", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return mm, paths
+}
+
+// BenchmarkRedirect resolves links and counts the clicks, as the redirector does, from concurrent clients.
+func BenchmarkRedirect(b *testing.B) {
+	for _, store := range benchStores {
+		b.Run(store, func(b *testing.B) {
+			mm, paths := newBenchManager(b, store)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := mm.GetUrl(context.Background(), paths[i%len(paths)], true); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLookup resolves links without counting them, as the CRUD services do.
+func BenchmarkLookup(b *testing.B) {
+	for _, store := range benchStores {
+		b.Run(store, func(b *testing.B) {
+			mm, paths := newBenchManager(b, store)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := mm.GetUrl(context.Background(), paths[i%len(paths)], false); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLastPage lists the last page of links, by offset for both stores, and by seeking for pebble.
+func BenchmarkLastPage(b *testing.B) {
+	for _, store := range benchStores {
+		b.Run(store, func(b *testing.B) {
+			mm, _ := newBenchManager(b, store)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := mm.ListUrls(context.Background(), types.Pagination{Offset: benchLinks - 10, Limit: 10}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Run("pebble seek", func(b *testing.B) {
+		configured, err := (&PebbleMapperConfig{Name: "store", Path: b.TempDir()}).GetMapper()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { configured.Teardown() })
+		m := configured.(*PebbleMapper)
+		pairs := make(types.PathUrlPairList, benchLinks)
+		for i := range pairs {
+			pairs[i] = &types.PathUrlPair{Path: fmt.Sprintf("/link%05d", i), Url: "https://example.com"}
+		}
+		if err := m.PutUrls(context.Background(), pairs); err != nil {
+			b.Fatal(err)
+		}
+		after := pairs[benchLinks-11].Path
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := m.list(context.Background(), after, 0, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package pebble_mapper
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/reimirno/golinks/pkg/logging"
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	PebbleMapperConfigType = "PEBBLE"
+)
+
+var _ types.MapperConfigurer = (*PebbleMapperConfig)(nil)
+
+func init() {
+	mapper.Register(PebbleMapperConfigType, func() types.MapperConfigurer { return &PebbleMapperConfig{} })
+}
+
+type PebbleMapperConfig struct {
+	Name      string `mapstructure:"name"`
+	Path      string `mapstructure:"path"`      // directory of the database
+	CacheSize int    `mapstructure:"cacheSize"` // in megabytes, 8 by default
+}
+
+func (p *PebbleMapperConfig) GetType() string {
+	return PebbleMapperConfigType
+}
+
+func (p *PebbleMapperConfig) GetName() string {
+	return p.Name
+}
+
+func (p *PebbleMapperConfig) Singleton() bool {
+	return true
+}
+
+func (p *PebbleMapperConfig) GetMapper() (types.Mapper, error) {
+	if p.Path == "" {
+		return nil, fmt.Errorf("pebble mapper %s needs a path", p.Name)
+	}
+	logger := logging.NewLogger(fmt.Sprintf("pebble-mapper-%s", p.Name))
+	opts := &pebble.Options{
+		Merger: merger,
+		Logger: logger,
+	}
+	if p.CacheSize > 0 {
+		cache := pebble.NewCache(int64(p.CacheSize) << 20)
+		defer cache.Unref() // the database keeps its own reference
+		opts.Cache = cache
+	}
+	db, err := pebble.Open(p.Path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &PebbleMapper{
+		name: p.Name,
+		db:   db,
+	}, nil
+}
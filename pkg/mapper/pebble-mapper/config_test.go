@@ -0,0 +1,47 @@
+package pebble_mapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPebbleMapperConfig_GetName(t *testing.T) {
+	config := &PebbleMapperConfig{Name: "pebble"}
+	assert.Equal(t, "pebble", config.GetName())
+}
+
+func TestPebbleMapperConfig_GetType(t *testing.T) {
+	config := &PebbleMapperConfig{Name: "pebble"}
+	assert.Equal(t, PebbleMapperConfigType, config.GetType())
+}
+
+func TestPebbleMapperConfig_Singleton(t *testing.T) {
+	config := &PebbleMapperConfig{Name: "pebble"}
+	assert.True(t, config.Singleton())
+}
+
+func TestPebbleMapperConfig_GetMapper(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		config  *PebbleMapperConfig
+		wantErr bool
+	}{
+		{name: "happy path", config: &PebbleMapperConfig{Name: "pebble", Path: dir}},
+		{name: "with cache", config: &PebbleMapperConfig{Name: "pebble", Path: dir, CacheSize: 16}},
+		{name: "missing path", config: &PebbleMapperConfig{Name: "pebble"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.config.GetMapper()
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, m.Teardown())
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package pebble_mapper
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// Pairs are stored under keyPrefix followed by their path, so that other kinds of keys can be added later.
+// A value is either a pair, or a use count increment waiting to be merged into a pair:
+//
+//	pair:          tagPair         | uvarint use count | url
+//	extended pair: tagExtendedPair | uvarint use count | flags | varint active from | varint expires at | rules | targets | sticky | aliases | url
+//	increment:     tagDelta        | uvarint delta
+//
+// An extended pair is a pair with ActiveFrom, ExpiresAt, Rules, Targets, Sticky or Aliases; flags tell which of them follow.
+// Times are in unix seconds; rules, targets and aliases are JSON, and every variable-length field is preceded by its uvarint length.
+// Increments are written as merge operands, so that counting a click does not need to read the pair first.
+// An increment with no pair below it is what is left of a click on a deleted pair, and reads as not found.
+//
+// The use counts of the targets of a pair are kept apart from it, as increments under targetKeyPrefix
+// followed by the path, a zero byte and the url of the target, so that they are counted the same way.
+//
+// Every alias of a pair is kept under aliasKeyPrefix followed by the alias, with the path of the pair as value.
+// The alias keys of a pair are written along with it, but concurrent writes of a pair may leave some behind,
+// so an alias only resolves to a pair that still has it.
+const (
+	tagPair         byte = 1
+	tagDelta        byte = 2
+	tagExtendedPair byte = 3
+
+	flagActiveFrom byte = 1 << 0
+	flagExpiresAt  byte = 1 << 1
+	flagRules      byte = 1 << 2
+	flagTargets    byte = 1 << 3
+	flagSticky     byte = 1 << 4
+	flagAliases    byte = 1 << 5
+
+	mergerName = "golinks.pair.v1" // must not change once databases exist
+)
+
+var (
+	keyPrefix     = []byte("p:")
+	keyUpperBound = []byte("p;") // the first key after every key with keyPrefix
+
+	targetKeyPrefix = []byte("t:")
+	aliasKeyPrefix  = []byte("a:")
+
+	errCorrupted = errors.New("corrupted value")
+)
+
+func key(path string) []byte {
+	return append(append(make([]byte, 0, len(keyPrefix)+len(path)), keyPrefix...), path...)
+}
+
+func pathOf(key []byte) string {
+	return string(key[len(keyPrefix):])
+}
+
+func aliasKey(alias string) []byte {
+	return append(append(make([]byte, 0, len(aliasKeyPrefix)+len(alias)), aliasKeyPrefix...), alias...)
+}
+
+// targetKey is where the use count of the target of the pair at path with url is kept.
+func targetKey(path string, url string) []byte {
+	lower, _ := targetKeys(path)
+	return append(lower, url...)
+}
+
+// targetKeys bounds the keys of the use counts of the targets of the pair at path.
+func targetKeys(path string) (lower []byte, upper []byte) {
+	lower = append(append(make([]byte, 0, len(targetKeyPrefix)+len(path)+1), targetKeyPrefix...), path...)
+	upper = append(append([]byte(nil), lower...), 1)
+	return append(lower, 0), upper
+}
+
+func encodePair(pair *types.PathUrlPair) ([]byte, error) {
+	if pair.ActiveFrom == nil && pair.ExpiresAt == nil && len(pair.Rules) == 0 && len(pair.Targets) == 0 && pair.Sticky == "" && len(pair.Aliases) == 0 {
+		return encodeValue(tagPair, uint64(pair.UseCount), []byte(pair.Url)), nil
+	}
+	body := make([]byte, 1, 1+2*binary.MaxVarintLen64+len(pair.Url))
+	if pair.ActiveFrom != nil {
+		body[0] |= flagActiveFrom
+		body = binary.AppendVarint(body, pair.ActiveFrom.Unix())
+	}
+	if pair.ExpiresAt != nil {
+		body[0] |= flagExpiresAt
+		body = binary.AppendVarint(body, pair.ExpiresAt.Unix())
+	}
+	if len(pair.Rules) > 0 {
+		rules, err := json.Marshal(pair.Rules)
+		if err != nil {
+			return nil, err
+		}
+		body[0] |= flagRules
+		body = appendBytes(body, rules)
+	}
+	if len(pair.Targets) > 0 {
+		targets := make([]types.WeightedTarget, len(pair.Targets))
+		for i, target := range pair.Targets {
+			targets[i] = types.WeightedTarget{Url: target.Url, Weight: target.Weight}
+		}
+		encoded, err := json.Marshal(targets)
+		if err != nil {
+			return nil, err
+		}
+		body[0] |= flagTargets
+		body = appendBytes(body, encoded)
+	}
+	if pair.Sticky != "" {
+		body[0] |= flagSticky
+		body = appendBytes(body, []byte(pair.Sticky))
+	}
+	if len(pair.Aliases) > 0 {
+		aliases, err := json.Marshal(pair.Aliases)
+		if err != nil {
+			return nil, err
+		}
+		body[0] |= flagAliases
+		body = appendBytes(body, aliases)
+	}
+	return encodeValue(tagExtendedPair, uint64(pair.UseCount), append(body, pair.Url...)), nil
+}
+
+// encodeValue encodes a pair or an increment from its parts; body is what follows the use count.
+func encodeValue(tag byte, count uint64, body []byte) []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64+len(body))
+	buf[0] = tag
+	buf = binary.AppendUvarint(buf, count)
+	return append(buf, body...)
+}
+
+func encodeDelta(delta uint64) []byte {
+	return encodeValue(tagDelta, delta, nil)
+}
+
+// decode returns the pair stored at path, or nil if the value is a lone increment.
+func decode(path string, value []byte) (*types.PathUrlPair, error) {
+	if len(value) == 0 {
+		return nil, errCorrupted
+	}
+	count, n := binary.Uvarint(value[1:])
+	if n <= 0 {
+		return nil, errCorrupted
+	}
+	body := value[1+n:]
+	switch value[0] {
+	case tagPair:
+		return &types.PathUrlPair{Path: path, Url: string(body), UseCount: int(count)}, nil
+	case tagExtendedPair:
+		pair := &types.PathUrlPair{Path: path, UseCount: int(count)}
+		if len(body) == 0 {
+			return nil, errCorrupted
+		}
+		flags := body[0]
+		body = body[1:]
+		for _, field := range []struct {
+			flag byte
+			time **time.Time
+		}{{flagActiveFrom, &pair.ActiveFrom}, {flagExpiresAt, &pair.ExpiresAt}} {
+			if flags&field.flag == 0 {
+				continue
+			}
+			unix, n := binary.Varint(body)
+			if n <= 0 {
+				return nil, errCorrupted
+			}
+			t := time.Unix(unix, 0).UTC()
+			*field.time = &t
+			body = body[n:]
+		}
+		var field []byte
+		var ok bool
+		if flags&flagRules != 0 {
+			if field, body, ok = readBytes(body); !ok || json.Unmarshal(field, &pair.Rules) != nil {
+				return nil, errCorrupted
+			}
+		}
+		if flags&flagTargets != 0 {
+			if field, body, ok = readBytes(body); !ok || json.Unmarshal(field, &pair.Targets) != nil {
+				return nil, errCorrupted
+			}
+		}
+		if flags&flagSticky != 0 {
+			if field, body, ok = readBytes(body); !ok {
+				return nil, errCorrupted
+			}
+			pair.Sticky = string(field)
+		}
+		if flags&flagAliases != 0 {
+			if field, body, ok = readBytes(body); !ok || json.Unmarshal(field, &pair.Aliases) != nil {
+				return nil, errCorrupted
+			}
+		}
+		pair.Url = string(body)
+		return pair, nil
+	case tagDelta:
+		return nil, nil
+	default:
+		return nil, errCorrupted
+	}
+}
+
+// decodeCount returns the use count of a target, which is only ever made of increments.
+func decodeCount(value []byte) (int, error) {
+	if len(value) == 0 || value[0] != tagDelta {
+		return 0, errCorrupted
+	}
+	count, n := binary.Uvarint(value[1:])
+	if n <= 0 {
+		return 0, errCorrupted
+	}
+	return int(count), nil
+}
+
+func appendBytes(buf []byte, field []byte) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(field))), field...)
+}
+
+// readBytes reads a field written by appendBytes, and returns it with what follows it.
+func readBytes(buf []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < size {
+		return nil, nil, false
+	}
+	return buf[n : n+int(size)], buf[n+int(size):], true
+}
+
+var merger = &pebble.Merger{
+	Name: mergerName,
+	Merge: func(key, value []byte) (pebble.ValueMerger, error) {
+		m := &valueMerger{}
+		return m, m.MergeNewer(value)
+	},
+}
+
+// valueMerger folds increments into the pair below them.
+// Operands older than a pair are ignored, as the pair replaced them.
+// The merger does not look into what follows the use count of a pair, and carries it over as is.
+type valueMerger struct {
+	tag   byte // tagPair or tagExtendedPair once a pair is merged
+	body  []byte
+	count uint64
+}
+
+func (m *valueMerger) MergeNewer(value []byte) error {
+	tag, count, body, err := split(value)
+	if err != nil {
+		return err
+	}
+	if tag != tagDelta {
+		m.tag, m.body, m.count = tag, body, count
+		return nil
+	}
+	m.count += count
+	return nil
+}
+
+func (m *valueMerger) MergeOlder(value []byte) error {
+	if m.tag != 0 {
+		return nil
+	}
+	tag, count, body, err := split(value)
+	if err != nil {
+		return err
+	}
+	if tag != tagDelta {
+		m.tag, m.body = tag, body
+	}
+	m.count += count
+	return nil
+}
+
+func (m *valueMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	if m.tag == 0 {
+		return encodeDelta(m.count), nil, nil
+	}
+	return encodeValue(m.tag, m.count, m.body), nil, nil
+}
+
+// split decodes an operand into its tag, use count and what follows the count.
+// The rest is copied, as the caller of the merger retains the operand.
+func split(value []byte) (byte, uint64, []byte, error) {
+	if len(value) == 0 {
+		return 0, 0, nil, errCorrupted
+	}
+	count, n := binary.Uvarint(value[1:])
+	if n <= 0 || (value[0] != tagPair && value[0] != tagDelta && value[0] != tagExtendedPair) {
+		return 0, 0, nil, errCorrupted
+	}
+	return value[0], count, append([]byte(nil), value[1+n:]...), nil
+}
@@ -0,0 +1,127 @@
+package pebble_mapper
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func mustEncodePair(t *testing.T, pair *types.PathUrlPair) []byte {
+	value, err := encodePair(pair)
+	assert.NoError(t, err)
+	return value
+}
+
+func TestEncoding(t *testing.T) {
+	activeFrom, expiresAt := time.Unix(1700000000, 0).UTC(), time.Unix(1800000000, 0).UTC()
+	rules := []types.RedirectRule{{Url: "https://fake.com/mac", OS: []string{"macos"}}}
+	for _, pair := range []*types.PathUrlPair{
+		{Path: "/fk", Url: "https://fake.com", UseCount: 300},
+		{Path: "/fk", Url: "https://fake.com", UseCount: 3, ActiveFrom: &activeFrom, ExpiresAt: &expiresAt},
+		{Path: "/fk", Url: "https://fake.com", ExpiresAt: &expiresAt},
+		{Path: "/fk", Url: "https://fake.com", Rules: rules},
+		{Path: "/fk", Url: "https://fake.com", UseCount: 3, ActiveFrom: &activeFrom, Rules: rules},
+		{Path: "/fk", Url: "https://fake.com", Sticky: types.StickyClient, Rules: rules,
+			Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}, {Url: "https://b.com"}}},
+		{Path: "/fk", Url: "https://fake.com", Aliases: []string{"/f", "/fake"}},
+	} {
+		got, err := decode("/fk", mustEncodePair(t, pair))
+		assert.NoError(t, err)
+		assert.Equal(t, pair, got)
+	}
+
+	got, err := decode("/fk", encodeDelta(1))
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	for _, value := range [][]byte{nil, {tagPair}, {9, 1}, {tagExtendedPair, 0}, {tagExtendedPair, 0, flagExpiresAt},
+		{tagExtendedPair, 0, flagRules, 10, '['}, {tagExtendedPair, 0, flagRules, 1, '['}} {
+		_, err = decode("/fk", value)
+		assert.ErrorIs(t, err, errCorrupted)
+	}
+	assert.Equal(t, []byte("/fk"), []byte(pathOf(key("/fk"))))
+
+	// target counts are not part of the pair, and their keys do not overlap between paths
+	got, err = decode("/fk", mustEncodePair(t, &types.PathUrlPair{Url: "https://fake.com", Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1, UseCount: 5}}}))
+	assert.NoError(t, err)
+	assert.Zero(t, got.Targets[0].UseCount)
+	lower, upper := targetKeys("/fk")
+	assert.True(t, bytes.Compare(lower, targetKey("/fk", "https://a.com")) <= 0 && bytes.Compare(targetKey("/fk", "https://a.com"), upper) < 0)
+	assert.True(t, bytes.Compare(targetKey("/fk2", "https://a.com"), upper) >= 0)
+	count, err := decodeCount(encodeDelta(7))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
+
+func TestMerger(t *testing.T) {
+	pair := func(url string, count int) []byte {
+		return mustEncodePair(t, &types.PathUrlPair{Url: url, UseCount: count})
+	}
+	expiresAt := time.Unix(1800000000, 0)
+	extended := func(url string, count int) []byte {
+		return mustEncodePair(t, &types.PathUrlPair{Url: url, UseCount: count, ExpiresAt: &expiresAt,
+			Rules: []types.RedirectRule{{Url: url + "/mac", OS: []string{"macos"}}}})
+	}
+	tests := []struct {
+		name     string
+		newest   []byte
+		newer    [][]byte // from oldest to newest, after newest
+		older    [][]byte // from newest to oldest
+		expected []byte
+	}{
+		{
+			name:     "increments on a pair",
+			newest:   encodeDelta(1),
+			older:    [][]byte{encodeDelta(2), pair("https://a.com", 10)},
+			expected: pair("https://a.com", 13),
+		},
+		{
+			name:     "operands older than a pair are ignored",
+			newest:   encodeDelta(1),
+			older:    [][]byte{pair("https://b.com", 0), encodeDelta(5), pair("https://a.com", 10)},
+			expected: pair("https://b.com", 1),
+		},
+		{
+			name:     "newer pair replaces everything",
+			newest:   encodeDelta(1),
+			newer:    [][]byte{pair("https://b.com", 2), encodeDelta(1)},
+			older:    [][]byte{pair("https://a.com", 10)},
+			expected: pair("https://b.com", 3),
+		},
+		{
+			name:     "increments on an extended pair",
+			newest:   encodeDelta(1),
+			older:    [][]byte{extended("https://a.com", 10)},
+			expected: extended("https://a.com", 11),
+		},
+		{
+			name:     "increments without a pair",
+			newest:   encodeDelta(1),
+			older:    [][]byte{encodeDelta(1)},
+			expected: encodeDelta(2),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := merger.Merge(key("/fk"), test.newest)
+			assert.NoError(t, err)
+			for _, value := range test.newer {
+				assert.NoError(t, m.MergeNewer(value))
+			}
+			for _, value := range test.older {
+				assert.NoError(t, m.MergeOlder(value))
+			}
+			got, closer, err := m.Finish(true)
+			assert.NoError(t, err)
+			assert.Nil(t, closer)
+			assert.Equal(t, test.expected, got)
+		})
+	}
+
+	_, err := merger.Merge(key("/fk"), []byte{9})
+	assert.ErrorIs(t, err, errCorrupted)
+}
@@ -0,0 +1,333 @@
+package pebble_mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	_ types.Mapper              = (*PebbleMapper)(nil)
+	_ types.MapperPinger        = (*PebbleMapper)(nil)
+	_ types.MapperCounter       = (*PebbleMapper)(nil)
+	_ types.MapperTargetCounter = (*PebbleMapper)(nil)
+)
+
+var errClosed = errors.New("database is closed")
+
+// PebbleMapper stores pairs in pebble, an embedded LSM-tree store.
+// Unlike bolt, writers do not wait on a single global lock, and counting a click is a blind write.
+// Puts and deletes are synced to disk before returning; use counts are not, so a crash may lose the last clicks.
+type PebbleMapper struct {
+	name   string
+	db     *pebble.DB
+	closed atomic.Bool // pebble panics when used after closing
+}
+
+func (p *PebbleMapper) Teardown() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// Ping fails once the database is closed.
+func (p *PebbleMapper) Ping(ctx context.Context) error {
+	return p.check(ctx)
+}
+
+func (p *PebbleMapper) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.closed.Load() {
+		return errClosed
+	}
+	return nil
+}
+
+func (p *PebbleMapper) GetName() string {
+	return p.name
+}
+
+func (p *PebbleMapper) GetType() string {
+	return PebbleMapperConfigType
+}
+
+func (p *PebbleMapper) Readonly() bool {
+	return false
+}
+
+func (p *PebbleMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	pair, err := getPair(p.db, path)
+	if err != nil || pair != nil {
+		return p.withCounts(pair, err)
+	}
+	owner, closer, err := p.db.Get(aliasKey(path))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pair, err = getPair(p.db, string(owner))
+	closer.Close()
+	if pair != nil && !slices.Contains(pair.Aliases, path) {
+		return nil, nil // left behind by a concurrent write
+	}
+	return p.withCounts(pair, err)
+}
+
+func (p *PebbleMapper) withCounts(pair *types.PathUrlPair, err error) (*types.PathUrlPair, error) {
+	if err != nil || pair == nil {
+		return nil, err
+	}
+	pair.Mapper = p.name
+	return pair, p.readTargetCounts(pair)
+}
+
+// getPair reads the pair at path from r, which is the database or an indexed batch; it returns nil if there is none.
+func getPair(r pebble.Reader, path string) (*types.PathUrlPair, error) {
+	value, closer, err := r.Get(key(path))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	pair, err := decode(path, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return pair, nil
+}
+
+// readTargetCounts fills in the use counts of the targets of pair.
+func (p *PebbleMapper) readTargetCounts(pair *types.PathUrlPair) error {
+	for i, target := range pair.Targets {
+		value, closer, err := p.db.Get(targetKey(pair.Path, target.Url))
+		if errors.Is(err, pebble.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		count, err := decodeCount(value)
+		closer.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode the use count of target %s of %s: %w", target.Url, pair.Path, err)
+		}
+		pair.Targets[i].UseCount = count
+	}
+	return nil
+}
+
+func (p *PebbleMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	after, err := pagination.After()
+	if err != nil {
+		return nil, err
+	}
+	if after != "" {
+		return p.list(ctx, after, 0, pagination.Limit)
+	}
+	return p.list(ctx, "", pagination.Offset, pagination.Limit)
+}
+
+// list returns up to limit pairs in path order, starting after the path after (or from the first path if empty),
+// and skipping offset pairs first.
+// Starting after a path seeks straight to it, where an offset has to step over every skipped pair.
+func (p *PebbleMapper) list(ctx context.Context, after string, offset int, limit int) (types.PathUrlPairList, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	pairs := types.PathUrlPairList{}
+	if limit <= 0 {
+		return pairs, nil
+	}
+	iter, err := p.db.NewIter(&pebble.IterOptions{LowerBound: keyPrefix, UpperBound: keyUpperBound})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	valid := iter.First()
+	if after != "" {
+		valid = iter.SeekGE(append(key(after), 0))
+	}
+	for ; valid; valid = iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		value := iter.Value()
+		if len(value) > 0 && value[0] == tagDelta {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		path := pathOf(iter.Key())
+		pair, err := decode(path, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		pair.Mapper = p.name
+		if err := p.readTargetCounts(pair); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+		if len(pairs) == limit {
+			break
+		}
+	}
+	return pairs, iter.Error()
+}
+
+func (p *PebbleMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	batch := p.db.NewIndexedBatch()
+	defer batch.Close()
+	if err := setPair(batch, pair); err != nil {
+		return nil, err
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// PutUrls writes pairs in a single batch, which is much faster than one PutUrl per pair for imports.
+// Either all pairs are written, or none.
+func (p *PebbleMapper) PutUrls(ctx context.Context, pairs types.PathUrlPairList) error {
+	if err := p.check(ctx); err != nil {
+		return err
+	}
+	batch := p.db.NewIndexedBatch()
+	defer batch.Close()
+	for _, pair := range pairs {
+		if err := setPair(batch, pair); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func (p *PebbleMapper) DeleteUrl(ctx context.Context, path string) error {
+	if err := p.check(ctx); err != nil {
+		return err
+	}
+	batch := p.db.NewIndexedBatch()
+	defer batch.Close()
+	if err := deleteAliases(batch, path); err != nil {
+		return err
+	}
+	if err := batch.Delete(key(path), nil); err != nil {
+		return err
+	}
+	lower, upper := targetKeys(path)
+	if err := batch.DeleteRange(lower, upper, nil); err != nil {
+		return err
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// setPair writes pair in batch, along with the use counts of its targets and its aliases,
+// replacing those of the pair it replaces. Batch must be indexed, to read the pair it replaces.
+func setPair(batch *pebble.Batch, pair *types.PathUrlPair) error {
+	value, err := encodePair(pair)
+	if err != nil {
+		return err
+	}
+	if err := deleteAliases(batch, pair.Path); err != nil {
+		return err
+	}
+	if err := batch.Set(key(pair.Path), value, nil); err != nil {
+		return err
+	}
+	for _, alias := range pair.Aliases {
+		if err := batch.Set(aliasKey(alias), []byte(pair.Path), nil); err != nil {
+			return err
+		}
+	}
+	lower, upper := targetKeys(pair.Path)
+	if err := batch.DeleteRange(lower, upper, nil); err != nil {
+		return err
+	}
+	for _, target := range pair.Targets {
+		if target.UseCount == 0 {
+			continue
+		}
+		if err := batch.Set(targetKey(pair.Path, target.Url), encodeDelta(uint64(target.UseCount)), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAliases deletes in batch the alias keys of the pair at path, as batch reads it.
+func deleteAliases(batch *pebble.Batch, path string) error {
+	old, err := getPair(batch, path)
+	if err != nil || old == nil {
+		return err
+	}
+	for _, alias := range old.Aliases {
+		if err := batch.Delete(aliasKey(alias), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncrementUseCount merges an increment into the pair, and reads back the count.
+func (p *PebbleMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	if err := p.check(ctx); err != nil {
+		return 0, err
+	}
+	if err := p.db.Merge(key(path), encodeDelta(1), pebble.NoSync); err != nil {
+		return 0, err
+	}
+	pair, err := p.GetUrl(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	return pair.UseCount, nil
+}
+
+// IncrementTargetUseCount merges an increment into the use count of the target, and reads back the count.
+func (p *PebbleMapper) IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error) {
+	pair, err := p.GetUrl(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	if !slices.ContainsFunc(pair.Targets, func(target types.WeightedTarget) bool { return target.Url == url }) {
+		return 0, fmt.Errorf("path %s has no target %s", path, url)
+	}
+	key := targetKey(path, url)
+	if err := p.db.Merge(key, encodeDelta(1), pebble.NoSync); err != nil {
+		return 0, err
+	}
+	value, closer, err := p.db.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	return decodeCount(value)
+}
@@ -0,0 +1,252 @@
+package pebble_mapper
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "/fk",
+		Url:  "https://fake.com",
+	}
+	fakePair2 = &types.PathUrlPair{
+		Path: "/fk2",
+		Url:  "https://fake2.com",
+	}
+)
+
+func newTestMapper(t *testing.T, dir string) *PebbleMapper {
+	config := &PebbleMapperConfig{Name: "pebble", Path: dir}
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Teardown() })
+	return m.(*PebbleMapper)
+}
+
+func TestPebbleMapper_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, t.TempDir())
+
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "pebble"}, got)
+
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestPebbleMapper_Aliases(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, t.TempDir())
+
+	aliased := &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}}
+	_, err := m.PutUrl(ctx, aliased.Clone())
+	require.NoError(t, err)
+	got, err := m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.Equal(t, "/kubernetes", got.Path)
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 1, "aliases are not listed")
+
+	aliased.Aliases = []string{"/kube"}
+	_, err = m.PutUrl(ctx, aliased.Clone())
+	require.NoError(t, err)
+	got, err = m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.Nil(t, got, "dropped aliases stop resolving")
+
+	// an alias key left behind by a concurrent write does not resolve
+	require.NoError(t, m.db.Set(aliasKey("/k8s"), []byte("/kubernetes"), nil))
+	got, err = m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	assert.NoError(t, m.DeleteUrl(ctx, "/kubernetes"))
+	got, err = m.GetUrl(ctx, "/kube")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestPebbleMapper_List(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, t.TempDir())
+	pairs := types.PathUrlPairList{}
+	for i := 0; i < 10; i++ {
+		pairs = append(pairs, &types.PathUrlPair{Path: fmt.Sprintf("/p%d", i), Url: fmt.Sprintf("https://%d.com", i)})
+	}
+	assert.NoError(t, m.PutUrls(ctx, pairs))
+	// a lone increment is not listed
+	_, err := m.IncrementUseCount(ctx, "/p45")
+	assert.Error(t, err)
+
+	tests := []struct {
+		name   string
+		after  string
+		offset int
+		limit  int
+		want   []string
+	}{
+		{name: "first page", limit: 3, want: []string{"/p0", "/p1", "/p2"}},
+		{name: "offset", offset: 8, limit: 3, want: []string{"/p8", "/p9"}},
+		{name: "after", after: "/p4", limit: 3, want: []string{"/p5", "/p6", "/p7"}},
+		{name: "after a missing path", after: "/p45", limit: 2, want: []string{"/p5", "/p6"}},
+		{name: "after and offset", after: "/p4", offset: 1, limit: 2, want: []string{"/p6", "/p7"}},
+		{name: "past the end", after: "/p9", limit: 3, want: []string{}},
+		{name: "no limit", limit: 0, want: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := m.list(ctx, test.after, test.offset, test.limit)
+			assert.NoError(t, err)
+			paths := []string{}
+			for _, pair := range got {
+				paths = append(paths, pair.Path)
+				assert.Equal(t, "pebble", pair.Mapper)
+			}
+			assert.Equal(t, test.want, paths)
+		})
+	}
+
+	got, err := m.ListUrls(ctx, types.Pagination{Offset: 9, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, types.PathUrlPairList{{Path: "/p9", Url: "https://9.com", Mapper: "pebble"}}, got)
+}
+
+func TestPebbleMapper_IncrementUseCount(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	m := newTestMapper(t, dir)
+	_, err := m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.IncrementUseCount(ctx, fakePair.Path)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	count, err := m.IncrementUseCount(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 51, count)
+
+	// a put replaces the count, and a delete drops it
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, UseCount: 5})
+	assert.NoError(t, err)
+	count, err = m.IncrementUseCount(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, count)
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	_, err = m.IncrementUseCount(ctx, fakePair.Path)
+	assert.Error(t, err)
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	count, err = m.IncrementUseCount(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// counts survive a restart, including compactions of the merged increments
+	_, err = m.PutUrl(ctx, fakePair2.Clone())
+	assert.NoError(t, err)
+	assert.NoError(t, m.db.Compact(keyPrefix, keyUpperBound, true))
+	assert.NoError(t, m.Teardown())
+	m = newTestMapper(t, dir)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got.UseCount)
+	got, err = m.GetUrl(ctx, fakePair2.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair2.Url, got.Url)
+}
+
+func TestPebbleMapper_IncrementTargetUseCount(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	m := newTestMapper(t, dir)
+	split := &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "pebble", Sticky: types.StickyCookie,
+		Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 9}, {Url: "https://b.com", Weight: 1}}}
+	_, err := m.PutUrl(ctx, split.Clone())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.IncrementTargetUseCount(ctx, fakePair.Path, "https://b.com")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	count, err := m.IncrementTargetUseCount(ctx, fakePair.Path, "https://a.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = m.IncrementTargetUseCount(ctx, fakePair.Path, "https://c.com")
+	assert.Error(t, err)
+
+	// counts are listed and survive a restart
+	assert.NoError(t, m.Teardown())
+	m = newTestMapper(t, dir)
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.True(t, split.Equals(pairs[0]))
+		assert.Equal(t, []int{1, 20}, []int{pairs[0].Targets[0].UseCount, pairs[0].Targets[1].UseCount})
+	}
+
+	// a put replaces the counts, and a delete drops them
+	_, err = m.PutUrl(ctx, split.Clone())
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, split.Targets, got.Targets)
+	_, err = m.IncrementTargetUseCount(ctx, fakePair.Path, "https://a.com")
+	assert.NoError(t, err)
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	_, err = m.PutUrl(ctx, split.Clone())
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Zero(t, got.Targets[0].UseCount)
+	_, err = m.IncrementTargetUseCount(ctx, fakePair2.Path, "https://a.com")
+	assert.Error(t, err)
+}
+
+func TestPebbleMapper_Closed(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, filepath.Join(t.TempDir(), "db"))
+	assert.NoError(t, m.Ping(ctx))
+
+	assert.NoError(t, m.Teardown())
+	assert.NoError(t, m.Teardown())
+	assert.ErrorIs(t, m.Ping(ctx), errClosed)
+	_, err := m.GetUrl(ctx, fakePair.Path)
+	assert.ErrorIs(t, err, errClosed)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	m = newTestMapper(t, t.TempDir())
+	assert.ErrorIs(t, m.Ping(canceled), context.Canceled)
+}
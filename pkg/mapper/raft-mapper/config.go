@@ -0,0 +1,184 @@
+package raft_mapper
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	RaftMapperConfigType = "RAFT"
+
+	defaultApplyTimeout = 5000 // in milliseconds
+	retainSnapshots     = 2
+	transportPoolSize   = 3
+	transportTimeout    = 10 * time.Second
+)
+
+var _ types.MapperConfigurer = (*RaftMapperConfig)(nil)
+
+func init() {
+	mapper.Register(RaftMapperConfigType, func() types.MapperConfigurer { return &RaftMapperConfig{} })
+}
+
+type RaftPeer struct {
+	Id          string `mapstructure:"id"`
+	RaftAddress string `mapstructure:"raftAddress"` // host:port of the raft transport
+	ApiAddress  string `mapstructure:"apiAddress"`  // host:port where the node accepts forwarded writes
+}
+
+// RaftMapperConfig configures one node of a raft cluster.
+// Every node lists the other nodes in Peers; the cluster is bootstrapped from them on first start.
+type RaftMapperConfig struct {
+	Name         string     `mapstructure:"name"`
+	NodeId       string     `mapstructure:"nodeId"`
+	RaftAddress  string     `mapstructure:"raftAddress"`
+	ApiAddress   string     `mapstructure:"apiAddress"`
+	DataDir      string     `mapstructure:"dataDir"`
+	Peers        []RaftPeer `mapstructure:"peers"`
+	Secret       string     `mapstructure:"secret"`       // shared by all nodes to authenticate forwarded writes
+	Insecure     bool       `mapstructure:"insecure"`     // accept forwarded writes without a secret, on a trusted network only
+	ApplyTimeout int        `mapstructure:"applyTimeout"` // in milliseconds
+
+	tune func(*raft.Config) // lets tests speed up elections
+}
+
+func (r *RaftMapperConfig) GetName() string {
+	return r.Name
+}
+
+func (r *RaftMapperConfig) GetType() string {
+	return RaftMapperConfigType
+}
+
+// A process is a single node of the cluster.
+func (r *RaftMapperConfig) Singleton() bool {
+	return true
+}
+
+func (r *RaftMapperConfig) self() RaftPeer {
+	return RaftPeer{Id: r.NodeId, RaftAddress: r.RaftAddress, ApiAddress: r.ApiAddress}
+}
+
+func (r *RaftMapperConfig) validate() error {
+	if r.NodeId == "" || r.RaftAddress == "" || r.ApiAddress == "" || r.DataDir == "" {
+		return fmt.Errorf("raft mapper %s needs nodeId, raftAddress, apiAddress and dataDir", r.Name)
+	}
+	seen := map[string]bool{r.NodeId: true}
+	for _, peer := range r.Peers {
+		if peer.Id == "" || peer.RaftAddress == "" || peer.ApiAddress == "" {
+			return fmt.Errorf("raft mapper %s has a peer without id, raftAddress or apiAddress", r.Name)
+		}
+		if seen[peer.Id] {
+			return fmt.Errorf("raft mapper %s has duplicate node id %s", r.Name, peer.Id)
+		}
+		seen[peer.Id] = true
+	}
+	if len(r.Peers) > 0 && r.Secret == "" && !r.Insecure {
+		return fmt.Errorf("raft mapper %s needs a secret to authenticate the writes forwarded by its peers, or insecure to accept them from anyone", r.Name)
+	}
+	return nil
+}
+
+func (r *RaftMapperConfig) GetMapper() (types.Mapper, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(r.DataDir, 0o700); err != nil {
+		return nil, err
+	}
+	applyTimeout := r.ApplyTimeout
+	if applyTimeout <= 0 {
+		applyTimeout = defaultApplyTimeout
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(r.NodeId)
+	config.Logger = hclog.New(&hclog.LoggerOptions{Name: fmt.Sprintf("raft-mapper-%s", r.Name), Level: hclog.Warn})
+	if r.tune != nil {
+		r.tune(config)
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(r.DataDir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStore(r.DataDir, retainSnapshots, os.Stderr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	advertise, err := net.ResolveTCPAddr("tcp", r.RaftAddress)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(r.RaftAddress, advertise, transportPoolSize, transportTimeout, os.Stderr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	state := newFsm()
+	node, err := raft.NewRaft(config, state, store, store, snapshots, transport)
+	if err != nil {
+		transport.Close()
+		store.Close()
+		return nil, err
+	}
+
+	// every node bootstraps with the same configuration, which raft allows;
+	// nodes that already have state skip it
+	hasState, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		node.Shutdown()
+		store.Close()
+		return nil, err
+	}
+	peers := map[raft.ServerID]RaftPeer{raft.ServerID(r.NodeId): r.self()}
+	if !hasState {
+		servers := []raft.Server{{ID: config.LocalID, Address: transport.LocalAddr()}}
+		for _, peer := range r.Peers {
+			servers = append(servers, raft.Server{ID: raft.ServerID(peer.Id), Address: raft.ServerAddress(peer.RaftAddress)})
+		}
+		if err := node.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil && err != raft.ErrCantBootstrap {
+			node.Shutdown()
+			store.Close()
+			return nil, err
+		}
+	}
+	for _, peer := range r.Peers {
+		peers[raft.ServerID(peer.Id)] = peer
+	}
+
+	listener, err := net.Listen("tcp", r.ApiAddress)
+	if err != nil {
+		node.Shutdown()
+		store.Close()
+		return nil, err
+	}
+	mapper := &RaftMapper{
+		name:         r.Name,
+		raft:         node,
+		store:        store,
+		fsm:          state,
+		peers:        peers,
+		secret:       r.Secret,
+		insecure:     r.Insecure,
+		applyTimeout: time.Duration(applyTimeout) * time.Millisecond,
+		client:       &http.Client{},
+	}
+	mapper.api = &http.Server{Handler: mapper.apiHandler()}
+	go mapper.api.Serve(listener)
+	return mapper, nil
+}
@@ -0,0 +1,101 @@
+package raft_mapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	applyPath    = "/raft/apply"
+	secretHeader = "X-Golinks-Raft-Secret"
+)
+
+// forward sends cmd to the API of the current leader.
+func (r *RaftMapper) forward(ctx context.Context, cmd *command) (*commandResult, error) {
+	_, leaderId := r.raft.LeaderWithID()
+	if leaderId == "" {
+		return nil, fmt.Errorf("raft mapper %s has no leader to forward to", r.name)
+	}
+	leader, ok := r.peers[leaderId]
+	if !ok {
+		return nil, fmt.Errorf("raft mapper %s does not know the api address of leader %s", r.name, leaderId)
+	}
+
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+leader.ApiAddress+applyPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.secret != "" {
+		req.Header.Set(secretHeader, r.secret)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward to leader %s: %w", leaderId, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("leader %s refused forwarded write: %s: %s", leaderId, resp.Status, bytes.TrimSpace(msg))
+	}
+	var result commandResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, result.err()
+}
+
+// authorized tells whether req carries the shared secret. Without a secret, only an insecure node accepts writes.
+func (r *RaftMapper) authorized(req *http.Request) bool {
+	if r.secret == "" {
+		return r.insecure
+	}
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get(secretHeader)), []byte(r.secret)) == 1
+}
+
+// apiHandler accepts writes forwarded by followers.
+// Command errors, such as incrementing a missing path, are returned in the result with a 200,
+// so that the follower can tell them apart from transport failures.
+func (r *RaftMapper) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(applyPath, func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !r.authorized(req) {
+			http.Error(rw, "invalid secret", http.StatusUnauthorized)
+			return
+		}
+		if r.raft.State() != raft.Leader {
+			// leadership moved while the request was in flight; the follower retries on its next write
+			http.Error(rw, "not the leader", http.StatusServiceUnavailable)
+			return
+		}
+		var cmd command
+		if err := json.NewDecoder(req.Body).Decode(&cmd); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := r.applyLocally(req.Context(), &cmd)
+		if err != nil && result == nil {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(result)
+	})
+	return mux
+}
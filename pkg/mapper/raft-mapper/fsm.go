@@ -0,0 +1,164 @@
+package raft_mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+const (
+	opPut       = "put"
+	opDelete    = "delete"
+	opIncrement = "increment"
+	// opIncrementTarget increments the use count of the target of the pair at Path with Url
+	opIncrementTarget = "incrementTarget"
+)
+
+// command is a write, replicated through the raft log and applied in order by every node.
+type command struct {
+	Op   string             `json:"op"`
+	Pair *types.PathUrlPair `json:"pair,omitempty"`
+	Path string             `json:"path,omitempty"`
+	Url  string             `json:"url,omitempty"`
+}
+
+type commandResult struct {
+	Pair  *types.PathUrlPair `json:"pair,omitempty"`
+	Count int                `json:"count,omitempty"`
+	Error string             `json:"error,omitempty"`
+}
+
+func (r *commandResult) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", r.Error)
+}
+
+var _ raft.FSM = (*fsm)(nil)
+
+// fsm is the replicated state of a node: all pairs, in memory, and the paths of their aliases.
+// Reads are served from it directly, so they may lag behind the leader.
+type fsm struct {
+	mu      sync.RWMutex
+	pairs   types.PathUrlPairMap
+	aliases map[string]string
+}
+
+func newFsm() *fsm {
+	return &fsm{pairs: make(types.PathUrlPairMap), aliases: make(map[string]string)}
+}
+
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return &commandResult{Error: fmt.Sprintf("invalid command: %v", err)}
+	}
+	return f.apply(&cmd)
+}
+
+func (f *fsm) apply(cmd *command) *commandResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch cmd.Op {
+	case opPut:
+		f.unindex(cmd.Pair.Path)
+		f.pairs[cmd.Pair.Path] = cmd.Pair.Clone()
+		for _, alias := range cmd.Pair.Aliases {
+			f.aliases[alias] = cmd.Pair.Path
+		}
+		return &commandResult{Pair: cmd.Pair}
+	case opDelete:
+		f.unindex(cmd.Path)
+		delete(f.pairs, cmd.Path)
+		return &commandResult{}
+	case opIncrement:
+		pair, ok := f.pairs[cmd.Path]
+		if !ok {
+			return &commandResult{Error: fmt.Sprintf("path %s not found", cmd.Path)}
+		}
+		pair.UseCount++
+		return &commandResult{Count: pair.UseCount}
+	case opIncrementTarget:
+		pair, ok := f.pairs[cmd.Path]
+		if !ok {
+			return &commandResult{Error: fmt.Sprintf("path %s not found", cmd.Path)}
+		}
+		for i := range pair.Targets {
+			if pair.Targets[i].Url == cmd.Url {
+				pair.Targets[i].UseCount++
+				return &commandResult{Count: pair.Targets[i].UseCount}
+			}
+		}
+		return &commandResult{Error: fmt.Sprintf("path %s has no target %s", cmd.Path, cmd.Url)}
+	default:
+		return &commandResult{Error: fmt.Sprintf("unknown command: %s", cmd.Op)}
+	}
+}
+
+// unindex drops the aliases of the pair at path, if there is one.
+func (f *fsm) unindex(path string) {
+	if pair, ok := f.pairs[path]; ok {
+		for _, alias := range pair.Aliases {
+			delete(f.aliases, alias)
+		}
+	}
+}
+
+func (f *fsm) get(path string) *types.PathUrlPair {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if pair, ok := f.pairs[path]; ok {
+		return pair.Clone()
+	}
+	if pair, ok := f.pairs[f.aliases[path]]; ok {
+		return pair.Clone()
+	}
+	return nil
+}
+
+// list is sorted by path, so that pages are the same on every node.
+func (f *fsm) list(pagination types.Pagination) (types.PathUrlPairList, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return utils.PaginatePairs(f.pairs.ToList(), pagination)
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return &snapshot{pairs: *f.pairs.Clone()}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	pairs := make(types.PathUrlPairMap)
+	if err := json.NewDecoder(rc).Decode(&pairs); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pairs = pairs
+	f.aliases = pairs.Aliases()
+	return nil
+}
+
+type snapshot struct {
+	pairs types.PathUrlPairMap
+}
+
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.pairs); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
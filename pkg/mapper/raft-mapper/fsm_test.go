@@ -0,0 +1,133 @@
+package raft_mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "/fk",
+		Url:  "https://fake.com",
+	}
+	fakePair2 = &types.PathUrlPair{
+		Path: "/fk2",
+		Url:  "https://fake2.com",
+	}
+)
+
+func applyCommand(t *testing.T, f *fsm, cmd command) *commandResult {
+	data, err := json.Marshal(cmd)
+	assert.NoError(t, err)
+	return f.Apply(&raft.Log{Data: data}).(*commandResult)
+}
+
+func TestFsm_Apply(t *testing.T) {
+	f := newFsm()
+
+	result := applyCommand(t, f, command{Op: opPut, Pair: fakePair})
+	assert.NoError(t, result.err())
+	assert.True(t, fakePair.Equals(f.get(fakePair.Path)))
+
+	result = applyCommand(t, f, command{Op: opIncrement, Path: fakePair.Path})
+	assert.NoError(t, result.err())
+	assert.Equal(t, 1, result.Count)
+	assert.Equal(t, 1, f.get(fakePair.Path).UseCount)
+
+	result = applyCommand(t, f, command{Op: opIncrement, Path: "/invalid"})
+	assert.Error(t, result.err())
+
+	split := &types.PathUrlPair{Path: "/split", Url: "https://a.com", Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}}}
+	applyCommand(t, f, command{Op: opPut, Pair: split})
+	result = applyCommand(t, f, command{Op: opIncrementTarget, Path: split.Path, Url: "https://a.com"})
+	assert.NoError(t, result.err())
+	assert.Equal(t, 1, result.Count)
+	assert.Equal(t, 1, f.get(split.Path).Targets[0].UseCount)
+	result = applyCommand(t, f, command{Op: opIncrementTarget, Path: split.Path, Url: "https://b.com"})
+	assert.Error(t, result.err())
+
+	aliased := &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}}
+	applyCommand(t, f, command{Op: opPut, Pair: aliased})
+	assert.True(t, aliased.Equals(f.get("/kube")))
+	applyCommand(t, f, command{Op: opPut, Pair: &types.PathUrlPair{Path: aliased.Path, Url: aliased.Url, Aliases: []string{"/k8s"}}})
+	assert.Nil(t, f.get("/kube"))
+	assert.Equal(t, aliased.Path, f.get("/k8s").Path)
+	applyCommand(t, f, command{Op: opDelete, Path: aliased.Path})
+	assert.Nil(t, f.get("/k8s"))
+
+	result = applyCommand(t, f, command{Op: opDelete, Path: fakePair.Path})
+	assert.NoError(t, result.err())
+	assert.Nil(t, f.get(fakePair.Path))
+
+	result = applyCommand(t, f, command{Op: "invalid"})
+	assert.Error(t, result.err())
+
+	result = f.Apply(&raft.Log{Data: []byte("invalid")}).(*commandResult)
+	assert.Error(t, result.err())
+}
+
+func TestFsm_List(t *testing.T) {
+	f := newFsm()
+	applyCommand(t, f, command{Op: opPut, Pair: fakePair2})
+	applyCommand(t, f, command{Op: opPut, Pair: fakePair})
+
+	pairs, err := f.list(types.Pagination{Offset: 0, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pairs))
+	assert.Equal(t, fakePair.Path, pairs[0].Path)
+	assert.Equal(t, fakePair2.Path, pairs[1].Path)
+
+	pairs, err = f.list(types.Pagination{Offset: 1, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pairs))
+	assert.Equal(t, fakePair2.Path, pairs[0].Path)
+
+	pairs, err = f.list(types.Pagination{Limit: 10, Cursor: types.NewCursor(fakePair.Path)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pairs))
+	assert.Equal(t, fakePair2.Path, pairs[0].Path)
+}
+
+type bufferSink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Close() error  { return nil }
+func (s *bufferSink) Cancel() error { s.cancelled = true; return nil }
+
+func TestFsm_SnapshotRestore(t *testing.T) {
+	f := newFsm()
+	applyCommand(t, f, command{Op: opPut, Pair: fakePair})
+	applyCommand(t, f, command{Op: opPut, Pair: fakePair2})
+	applyCommand(t, f, command{Op: opIncrement, Path: fakePair2.Path})
+	applyCommand(t, f, command{Op: opPut, Pair: &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s"}}})
+
+	snap, err := f.Snapshot()
+	assert.NoError(t, err)
+	// writes after the snapshot is taken are not part of it
+	applyCommand(t, f, command{Op: opDelete, Path: fakePair.Path})
+
+	sink := &bufferSink{}
+	assert.NoError(t, snap.Persist(sink))
+	snap.Release()
+	assert.False(t, sink.cancelled)
+
+	restored := newFsm()
+	applyCommand(t, restored, command{Op: opPut, Pair: &types.PathUrlPair{Path: "/old", Url: "https://old.com"}})
+	assert.NoError(t, restored.Restore(io.NopCloser(&sink.Buffer)))
+	assert.Nil(t, restored.get("/old"))
+	assert.True(t, fakePair.Equals(restored.get(fakePair.Path)))
+	assert.Equal(t, 1, restored.get(fakePair2.Path).UseCount)
+	assert.Equal(t, "/kubernetes", restored.get("/k8s").Path)
+
+	assert.Error(t, restored.Restore(io.NopCloser(bytes.NewBufferString("invalid"))))
+}
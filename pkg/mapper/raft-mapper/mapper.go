@@ -0,0 +1,144 @@
+package raft_mapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	_ types.Mapper              = (*RaftMapper)(nil)
+	_ types.MapperPinger        = (*RaftMapper)(nil)
+	_ types.MapperCounter       = (*RaftMapper)(nil)
+	_ types.MapperTargetCounter = (*RaftMapper)(nil)
+)
+
+// RaftMapper is one node of a cluster that replicates pairs with raft.
+// Reads are served from the local copy, and may briefly lag behind the leader.
+// Writes are applied by the leader; a follower forwards them to the leader's API address.
+type RaftMapper struct {
+	name         string
+	raft         *raft.Raft
+	store        *raftboltdb.BoltStore
+	fsm          *fsm
+	peers        map[raft.ServerID]RaftPeer
+	secret       string
+	insecure     bool
+	applyTimeout time.Duration
+	api          *http.Server
+	client       *http.Client
+}
+
+func (r *RaftMapper) GetName() string {
+	return r.name
+}
+
+func (r *RaftMapper) GetType() string {
+	return RaftMapperConfigType
+}
+
+func (r *RaftMapper) Readonly() bool {
+	return false
+}
+
+func (r *RaftMapper) Teardown() error {
+	apiErr := r.api.Close()
+	raftErr := r.raft.Shutdown().Error()
+	storeErr := r.store.Close()
+	return errors.Join(apiErr, raftErr, storeErr)
+}
+
+// Ping fails while the node does not know of any leader, since writes cannot be applied then.
+func (r *RaftMapper) Ping(ctx context.Context) error {
+	if addr, _ := r.raft.LeaderWithID(); addr == "" {
+		return fmt.Errorf("raft mapper %s has no leader", r.name)
+	}
+	return nil
+}
+
+func (r *RaftMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	pair := r.fsm.get(path)
+	if pair != nil {
+		pair.Mapper = r.name
+	}
+	return pair, nil
+}
+
+func (r *RaftMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	pairs, err := r.fsm.list(pagination)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		pair.Mapper = r.name
+	}
+	return pairs, nil
+}
+
+func (r *RaftMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	result, err := r.apply(ctx, &command{Op: opPut, Pair: pair})
+	if err != nil {
+		return nil, err
+	}
+	return result.Pair, nil
+}
+
+func (r *RaftMapper) DeleteUrl(ctx context.Context, path string) error {
+	_, err := r.apply(ctx, &command{Op: opDelete, Path: path})
+	return err
+}
+
+func (r *RaftMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	result, err := r.apply(ctx, &command{Op: opIncrement, Path: path})
+	if err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+func (r *RaftMapper) IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error) {
+	result, err := r.apply(ctx, &command{Op: opIncrementTarget, Path: path, Url: url})
+	if err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// apply runs cmd on the leader, either here or by forwarding it.
+func (r *RaftMapper) apply(ctx context.Context, cmd *command) (*commandResult, error) {
+	if r.raft.State() == raft.Leader {
+		return r.applyLocally(ctx, cmd)
+	}
+	return r.forward(ctx, cmd)
+}
+
+func (r *RaftMapper) applyLocally(ctx context.Context, cmd *command) (*commandResult, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	future := r.raft.Apply(data, r.applyTimeout)
+	done := make(chan error, 1)
+	go func() {
+		done <- future.Error()
+	}()
+	select {
+	case <-ctx.Done():
+		// the command may still be committed later
+		return nil, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := future.Response().(*commandResult)
+	return result, result.err()
+}
@@ -0,0 +1,229 @@
+package raft_mapper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func fastElections(c *raft.Config) {
+	c.HeartbeatTimeout = 100 * time.Millisecond
+	c.ElectionTimeout = 100 * time.Millisecond
+	c.LeaderLeaseTimeout = 50 * time.Millisecond
+	c.CommitTimeout = 5 * time.Millisecond
+}
+
+// newClusterConfigs returns the configuration of every node of an n-node cluster.
+func newClusterConfigs(t *testing.T, n int) []*RaftMapperConfig {
+	peers := make([]RaftPeer, n)
+	for i := range peers {
+		peers[i] = RaftPeer{Id: fmt.Sprintf("node%d", i), RaftAddress: freeAddress(t), ApiAddress: freeAddress(t)}
+	}
+	configs := make([]*RaftMapperConfig, n)
+	for i, self := range peers {
+		others := make([]RaftPeer, 0, n-1)
+		for j, peer := range peers {
+			if j != i {
+				others = append(others, peer)
+			}
+		}
+		configs[i] = &RaftMapperConfig{
+			Name:        "raft",
+			NodeId:      self.Id,
+			RaftAddress: self.RaftAddress,
+			ApiAddress:  self.ApiAddress,
+			DataDir:     t.TempDir(),
+			Peers:       others,
+			Secret:      "secret",
+			tune:        fastElections,
+		}
+	}
+	return configs
+}
+
+func startNode(t *testing.T, config *RaftMapperConfig) *RaftMapper {
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	return m.(*RaftMapper)
+}
+
+func waitForLeader(t *testing.T, nodes ...*RaftMapper) *RaftMapper {
+	var leader *RaftMapper
+	require.Eventually(t, func() bool {
+		for _, node := range nodes {
+			if node.raft.State() == raft.Leader {
+				leader = node
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 20*time.Millisecond)
+	for _, node := range nodes {
+		require.Eventually(t, func() bool { return node.Ping(context.Background()) == nil }, 10*time.Second, 20*time.Millisecond)
+	}
+	return leader
+}
+
+func waitForPair(t *testing.T, node *RaftMapper, path string, want func(*types.PathUrlPair) bool) {
+	require.Eventually(t, func() bool {
+		pair, err := node.GetUrl(context.Background(), path)
+		return err == nil && want(pair)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRaftMapperConfig_GetMapper_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RaftMapperConfig
+	}{
+		{name: "missing node id", config: &RaftMapperConfig{Name: "raft", RaftAddress: "127.0.0.1:1", ApiAddress: "127.0.0.1:2", DataDir: "data"}},
+		{name: "missing data dir", config: &RaftMapperConfig{Name: "raft", NodeId: "a", RaftAddress: "127.0.0.1:1", ApiAddress: "127.0.0.1:2"}},
+		{name: "incomplete peer", config: &RaftMapperConfig{Name: "raft", NodeId: "a", RaftAddress: "127.0.0.1:1", ApiAddress: "127.0.0.1:2", DataDir: "data",
+			Peers: []RaftPeer{{Id: "b", RaftAddress: "127.0.0.1:3"}}}},
+		{name: "duplicate node id", config: &RaftMapperConfig{Name: "raft", NodeId: "a", RaftAddress: "127.0.0.1:1", ApiAddress: "127.0.0.1:2", DataDir: "data",
+			Peers: []RaftPeer{{Id: "a", RaftAddress: "127.0.0.1:3", ApiAddress: "127.0.0.1:4"}}}},
+		{name: "peers without a secret", config: &RaftMapperConfig{Name: "raft", NodeId: "a", RaftAddress: "127.0.0.1:1", ApiAddress: "127.0.0.1:2", DataDir: "data",
+			Peers: []RaftPeer{{Id: "b", RaftAddress: "127.0.0.1:3", ApiAddress: "127.0.0.1:4"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.config.GetMapper()
+			assert.Error(t, err)
+			assert.Nil(t, m)
+		})
+	}
+}
+
+func TestRaftMapper_Cluster(t *testing.T) {
+	ctx := context.Background()
+	configs := newClusterConfigs(t, 3)
+	nodes := make([]*RaftMapper, len(configs))
+	for i, config := range configs {
+		nodes[i] = startNode(t, config)
+	}
+	defer func() {
+		for _, node := range nodes {
+			if node != nil {
+				node.Teardown()
+			}
+		}
+	}()
+	leader := waitForLeader(t, nodes...)
+	var follower *RaftMapper
+	for _, node := range nodes {
+		if node != leader {
+			follower = node
+			break
+		}
+	}
+
+	// writes through a follower are forwarded to the leader, and replicated everywhere
+	put, err := follower.PutUrl(ctx, fakePair.Clone())
+	require.NoError(t, err)
+	assert.True(t, fakePair.Equals(put))
+	for _, node := range nodes {
+		waitForPair(t, node, fakePair.Path, func(pair *types.PathUrlPair) bool { return fakePair.Equals(pair) })
+	}
+
+	count, err := follower.IncrementUseCount(ctx, fakePair.Path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = follower.IncrementUseCount(ctx, "/invalid")
+	assert.Error(t, err)
+
+	_, err = leader.PutUrl(ctx, fakePair2.Clone())
+	require.NoError(t, err)
+	waitForPair(t, follower, fakePair2.Path, func(pair *types.PathUrlPair) bool { return pair != nil })
+	pairs, err := follower.ListUrls(ctx, types.Pagination{Offset: 0, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(pairs))
+	assert.Equal(t, "raft", pairs[0].Mapper)
+
+	// the cluster survives losing its leader
+	for i, node := range nodes {
+		if node == leader {
+			require.NoError(t, node.Teardown())
+			nodes[i] = nil
+		}
+	}
+	remaining := []*RaftMapper{}
+	for _, node := range nodes {
+		if node != nil {
+			remaining = append(remaining, node)
+		}
+	}
+	newLeader := waitForLeader(t, remaining...)
+	for _, node := range remaining {
+		require.NoError(t, node.DeleteUrl(ctx, fakePair2.Path))
+	}
+	for _, node := range remaining {
+		waitForPair(t, node, fakePair2.Path, func(pair *types.PathUrlPair) bool { return pair == nil })
+	}
+	assert.NotSame(t, leader, newLeader)
+}
+
+func TestRaftMapper_RestartRestoresState(t *testing.T) {
+	ctx := context.Background()
+	config := newClusterConfigs(t, 1)[0]
+	node := startNode(t, config)
+	waitForLeader(t, node)
+	_, err := node.PutUrl(ctx, fakePair.Clone())
+	require.NoError(t, err)
+	require.NoError(t, node.raft.Snapshot().Error())
+	_, err = node.PutUrl(ctx, fakePair2.Clone())
+	require.NoError(t, err)
+	require.NoError(t, node.Teardown())
+
+	// restored from the snapshot, then from the log after it
+	node = startNode(t, config)
+	defer node.Teardown()
+	waitForPair(t, node, fakePair.Path, func(pair *types.PathUrlPair) bool { return fakePair.Equals(pair) })
+	waitForPair(t, node, fakePair2.Path, func(pair *types.PathUrlPair) bool { return fakePair2.Equals(pair) })
+}
+
+func TestRaftMapper_ForwardRequiresSecret(t *testing.T) {
+	ctx := context.Background()
+	configs := newClusterConfigs(t, 2)
+	configs[1].Secret = "invalid"
+	nodes := []*RaftMapper{startNode(t, configs[0]), startNode(t, configs[1])}
+	defer nodes[0].Teardown()
+	defer nodes[1].Teardown()
+	leader := waitForLeader(t, nodes...)
+	follower := nodes[0]
+	if leader == follower {
+		follower = nodes[1]
+	}
+	// both secrets differ from each other, so forwarding fails whichever node leads
+	_, err := follower.PutUrl(ctx, fakePair.Clone())
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestRaftMapper_ApiWithoutSecret(t *testing.T) {
+	// a node without a secret refuses forwarded writes, unless it is insecure
+	m := &RaftMapper{name: "raft"}
+	rr := httptest.NewRecorder()
+	m.apiHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, applyPath, strings.NewReader("{}")))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	m.insecure = true
+	assert.True(t, m.authorized(httptest.NewRequest(http.MethodPost, applyPath, nil)))
+}
@@ -0,0 +1,158 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// ReaperSettings configure the removal of expired pairs from the writable mappers.
+type ReaperSettings struct {
+	Interval int    `mapstructure:"interval"` // in seconds; the reaper is off when not positive
+	Grace    int    `mapstructure:"grace"`    // in seconds that a pair is kept after it expires, so that it can be renewed
+	Archive  string `mapstructure:"archive"`  // a writable mapper that expired pairs are moved to; they are deleted otherwise
+}
+
+type reaper struct {
+	grace   time.Duration
+	archive types.Mapper
+}
+
+// WithReaper removes the pairs that expired more than the grace period ago from every writable mapper,
+// every interval, moving them to the archive mapper if there is one.
+// Mirrors are left to the persistor, which replicates its deletes to them.
+// Expired pairs keep answering lookups, with their state, until they are reaped.
+func WithReaper(settings ReaperSettings) ManagerOption {
+	return func(m *MapperManager) error {
+		if settings.Interval <= 0 {
+			return nil
+		}
+		if settings.Grace < 0 {
+			return ErrMapConfigSetup("negative grace period for the reaper")
+		}
+		r := &reaper{grace: time.Duration(settings.Grace) * time.Second}
+		if settings.Archive != "" {
+			r.archive = findMapper(m.mappers, settings.Archive)
+			if r.archive == nil {
+				return ErrMapConfigSetup(fmt.Sprintf("archive not found: %s", settings.Archive))
+			}
+			if r.archive.Readonly() {
+				return ErrMapConfigSetup(fmt.Sprintf("archive is readonly: %s", settings.Archive))
+			}
+			if r.archive == m.persistor || m.mirrorOf(r.archive) != nil {
+				return ErrMapConfigSetup(fmt.Sprintf("archive cannot be the persistor or a mirror: %s", settings.Archive))
+			}
+		}
+		m.reaper = r
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(settings.Interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					reaped, err := m.ReapExpired(ctx)
+					if err != nil {
+						m.logger.Errorf("Failed to reap expired pairs: %v", err)
+					}
+					if reaped > 0 {
+						m.logger.Infof("Reaped %d expired pairs", reaped)
+					}
+				}
+			}
+		}()
+		m.stopReaper = func() {
+			cancel()
+			wg.Wait()
+		}
+		return nil
+	}
+}
+
+// ReapExpired removes the pairs that expired more than the grace period ago, and returns how many it removed.
+// A mapper that fails does not keep the others from being reaped.
+func (m *MapperManager) ReapExpired(ctx context.Context) (int, error) {
+	if m.reaper == nil {
+		return 0, nil
+	}
+	reaped := 0
+	var errs []error
+	for _, mapper := range m.mappers {
+		if mapper.Readonly() || m.mirrorOf(mapper) != nil || m.isArchive(mapper) {
+			continue
+		}
+		n, err := m.reap(ctx, mapper)
+		reaped += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mapper %s: %w", mapper.GetName(), err))
+		}
+	}
+	return reaped, errors.Join(errs...)
+}
+
+func (m *MapperManager) reap(ctx context.Context, mapper types.Mapper) (int, error) {
+	pairs, err := m.listAll(ctx, mapper)
+	if err != nil {
+		return 0, err
+	}
+	reaped := 0
+	for path, pair := range pairs {
+		if !m.reapable(pair) {
+			continue
+		}
+		// the pair may have been renewed since it was listed
+		current, err := m.getFromMapper(ctx, mapper, path)
+		if err != nil {
+			return reaped, err
+		}
+		if current == nil || !m.reapable(current) {
+			continue
+		}
+		if m.reaper.archive != nil {
+			archived := current.Clone()
+			archived.Mapper = m.reaper.archive.GetName()
+			if _, err := m.putToMapper(ctx, m.reaper.archive, archived); err != nil {
+				return reaped, err
+			}
+		}
+		if err := m.deleteFromMapper(ctx, mapper, path); err != nil {
+			return reaped, err
+		}
+		m.invalidate(append([]string{path}, current.Aliases...)...)
+		m.forgetChecks(ctx, path)
+		if mapper == m.getPersistor() {
+			if err := m.replicate(ctx, path, nil); err != nil {
+				return reaped, err
+			}
+		}
+		m.logger.Debugf("Reaped expired pair %s from mapper %s", path, mapper.GetName())
+		reaped++
+	}
+	return reaped, nil
+}
+
+func (m *MapperManager) reapable(pair *types.PathUrlPair) bool {
+	return pair.ExpiresAt != nil && !time.Now().Before(pair.ExpiresAt.Add(m.reaper.grace))
+}
+
+func (m *MapperManager) isArchive(mapper types.Mapper) bool {
+	return m.reaper != nil && m.reaper.archive != nil && m.reaper.archive == mapper
+}
+
+// unarchive removes the archived copy of a path that was written again.
+func (m *MapperManager) unarchive(ctx context.Context, path string) error {
+	if err := m.deleteFromMapper(ctx, m.reaper.archive, path); err != nil {
+		return fmt.Errorf("restored %s, but failed to remove it from archive %s: %w", path, m.reaper.archive.GetName(), err)
+	}
+	return nil
+}
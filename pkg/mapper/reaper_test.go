@@ -0,0 +1,136 @@
+package mapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func hoursFromNow(hours int) *time.Time {
+	t := time.Now().Add(time.Duration(hours) * time.Hour).UTC().Truncate(time.Second)
+	return &t
+}
+
+// newReapedManager sets up mockConfigurer as the persistor, with an expired pair, archiving to mockConfigurer2 if asked to.
+func newReapedManager(t *testing.T, settings ReaperSettings, opts ...ManagerOption) (*MapperManager, *MockMapper, *MockMapper) {
+	opts = append(opts, WithReaper(settings))
+	mm, err := NewMapperManager(mockConfigurer.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2}), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	persistor := mm.mappers[0].(*MockMapper)
+	_, err = mm.PutUrl(context.Background(), &types.PathUrlPair{Path: "old", Url: "https://old.com", ExpiresAt: hoursFromNow(-2)})
+	require.NoError(t, err)
+	return mm, persistor, mm.mappers[1].(*MockMapper)
+}
+
+func TestWithReaper(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings ReaperSettings
+		wantErr  bool
+	}{
+		{name: "happy path", settings: ReaperSettings{Interval: 3600, Grace: 60, Archive: mockConfigurer2.Name}},
+		{name: "disabled", settings: ReaperSettings{Archive: "invalid"}},
+		{name: "negative grace should fail", settings: ReaperSettings{Interval: 3600, Grace: -1}, wantErr: true},
+		{name: "unknown archive should fail", settings: ReaperSettings{Interval: 3600, Archive: "invalid"}, wantErr: true},
+		{name: "readonly archive should fail", settings: ReaperSettings{Interval: 3600, Archive: mockConfigurerReadonly.Name}, wantErr: true},
+		{name: "persistor archive should fail", settings: ReaperSettings{Interval: 3600, Archive: mockConfigurer.Name}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configurers := CloneConfigurers([]*MockMapperConfigurer{mockConfigurer, mockConfigurer2, mockConfigurerReadonly})
+			mm, err := NewMapperManager(mockConfigurer.Name, configurers, WithReaper(test.settings))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, mm)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, mm.Teardown())
+		})
+	}
+}
+
+func TestMapperManager_ReapExpired(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, _ := newReapedManager(t, ReaperSettings{Interval: 3600})
+	_, err := mm.PutUrl(ctx, &types.PathUrlPair{Path: "recent", Url: "https://recent.com", ExpiresAt: hoursFromNow(0)})
+	require.NoError(t, err)
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "later", Url: "https://later.com", ExpiresAt: hoursFromNow(1)})
+	require.NoError(t, err)
+
+	reaped, err := mm.ReapExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reaped)
+	assert.NotContains(t, persistor.Pairs, canonical(t, "old"))
+	assert.NotContains(t, persistor.Pairs, canonical(t, "recent"))
+	assert.Contains(t, persistor.Pairs, canonical(t, "later"))
+	assert.Contains(t, persistor.Pairs, canonical(t, "fk"), "pairs without expiry are kept")
+}
+
+func TestMapperManager_ReapExpiredGrace(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, _ := newReapedManager(t, ReaperSettings{Interval: 3600, Grace: 3 * 3600})
+
+	reaped, err := mm.ReapExpired(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, reaped)
+
+	// an expired pair still answers lookups, and can be renewed
+	pair, err := mm.GetUrl(ctx, "old", true)
+	assert.NoError(t, err)
+	assert.Equal(t, types.LinkState_Expired, pair.State(time.Now()))
+	assert.Zero(t, persistor.Pairs[canonical(t, "old")].UseCount, "expired pairs are not counted")
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "old", Url: "https://old.com", ExpiresAt: hoursFromNow(1)})
+	assert.NoError(t, err)
+	pair, err = mm.GetUrl(ctx, "old", false)
+	assert.NoError(t, err)
+	assert.Equal(t, types.LinkState_Active, pair.State(time.Now()))
+}
+
+func TestMapperManager_ReapExpiredArchive(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, archive := newReapedManager(t, ReaperSettings{Interval: 3600, Archive: mockConfigurer2.Name})
+	old := canonical(t, "old")
+
+	reaped, err := mm.ReapExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reaped)
+	assert.NotContains(t, persistor.Pairs, old)
+	assert.Equal(t, "https://old.com", archive.Pairs[old].Url)
+	assert.Equal(t, archive.Name, archive.Pairs[old].Mapper)
+
+	// archived pairs are not reaped again, and still answer lookups
+	reaped, err = mm.ReapExpired(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, reaped)
+	pair, err := mm.GetUrl(ctx, "old", false)
+	assert.NoError(t, err)
+	assert.Equal(t, types.LinkState_Expired, pair.State(time.Now()))
+
+	// writing an archived path restores it to the persistor
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "old", Url: "https://restored.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://restored.com", persistor.Pairs[old].Url)
+	assert.NotContains(t, archive.Pairs, old)
+}
+
+func TestMapperManager_ReapExpiredMirrors(t *testing.T) {
+	ctx := context.Background()
+	mm, persistor, mirror := newReapedManager(t, ReaperSettings{Interval: 3600},
+		WithMirrors([]MirrorSettings{{Name: mockConfigurer2.Name}}, 0))
+	old := canonical(t, "old")
+	require.Contains(t, mirror.Pairs, old)
+
+	reaped, err := mm.ReapExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reaped, "mirrors are not reaped on their own")
+	assert.NotContains(t, persistor.Pairs, old)
+	assert.NotContains(t, mirror.Pairs, old)
+}
@@ -0,0 +1,78 @@
+package redis_mapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	RedisMapperConfigType = "REDIS"
+	defaultKeyPrefix      = "golinks:"
+	connectTimeout        = 5 * time.Second
+)
+
+var _ types.MapperConfigurer = (*RedisMapperConfig)(nil)
+
+func init() {
+	mapper.Register(RedisMapperConfigType, func() types.MapperConfigurer { return &RedisMapperConfig{} })
+}
+
+type RedisMapperConfig struct {
+	Name      string `mapstructure:"name"`
+	Address   string `mapstructure:"address"` // host:port
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"keyPrefix"` // defaults to "golinks:"
+}
+
+func (r *RedisMapperConfig) GetName() string {
+	return r.Name
+}
+
+func (r *RedisMapperConfig) GetType() string {
+	return RedisMapperConfigType
+}
+
+// Several redis mappers can share a server, as long as their key prefixes differ.
+func (r *RedisMapperConfig) Singleton() bool {
+	return false
+}
+
+func (r *RedisMapperConfig) GetMapper() (types.Mapper, error) {
+	if r.Address == "" {
+		return nil, fmt.Errorf("missing address for redis mapper %s", r.Name)
+	}
+	prefix := r.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     r.Address,
+		Username: r.Username,
+		Password: r.Password,
+		DB:       r.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", r.Address, err)
+	}
+	m := &RedisMapper{
+		name:   r.Name,
+		client: client,
+		prefix: prefix,
+	}
+	if err := m.buildIndex(context.Background()); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to index redis mapper %s: %w", r.Name, err)
+	}
+	return m, nil
+}
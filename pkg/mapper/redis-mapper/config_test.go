@@ -0,0 +1,73 @@
+package redis_mapper
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisMapperConfig_GetName(t *testing.T) {
+	config := &RedisMapperConfig{Name: "redis"}
+	assert.Equal(t, "redis", config.GetName())
+}
+
+func TestRedisMapperConfig_GetType(t *testing.T) {
+	config := &RedisMapperConfig{Name: "redis"}
+	assert.Equal(t, RedisMapperConfigType, config.GetType())
+}
+
+func TestRedisMapperConfig_Singleton(t *testing.T) {
+	config := &RedisMapperConfig{Name: "redis"}
+	assert.False(t, config.Singleton())
+}
+
+func TestRedisMapperConfig_GetMapper(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	tests := []struct {
+		name       string
+		config     *RedisMapperConfig
+		wantPrefix string
+		wantErr    bool
+	}{
+		{
+			name:       "default prefix",
+			config:     &RedisMapperConfig{Name: "redis", Address: server.Addr(), Password: "secret"},
+			wantPrefix: defaultKeyPrefix,
+		},
+		{
+			name:       "custom prefix",
+			config:     &RedisMapperConfig{Name: "redis", Address: server.Addr(), Password: "secret", KeyPrefix: "team:"},
+			wantPrefix: "team:",
+		},
+		{
+			name:    "missing address",
+			config:  &RedisMapperConfig{Name: "redis"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong password",
+			config:  &RedisMapperConfig{Name: "redis", Address: server.Addr(), Password: "invalid"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.GetMapper()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			redisMapper, ok := got.(*RedisMapper)
+			assert.True(t, ok, "Expected *RedisMapper, got %T", got)
+			assert.Equal(t, tt.config.Name, redisMapper.GetName())
+			assert.Equal(t, tt.wantPrefix, redisMapper.prefix)
+			assert.NoError(t, redisMapper.Teardown())
+		})
+	}
+}
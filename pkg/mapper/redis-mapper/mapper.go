@@ -0,0 +1,456 @@
+package redis_mapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	_ types.Mapper              = (*RedisMapper)(nil)
+	_ types.MapperPinger        = (*RedisMapper)(nil)
+	_ types.MapperCounter       = (*RedisMapper)(nil)
+	_ types.MapperTargetCounter = (*RedisMapper)(nil)
+	_ types.MapperLinkChecks    = (*RedisMapper)(nil)
+)
+
+// Every pair is stored as a hash under the key prefix + path,
+// so that the use counts of the pair and of its targets can be incremented in place.
+// Every alias is stored as a string under the key prefix + aliasKeyPrefix + alias, holding the path of its pair.
+// Every path is a member of the sorted set under the key prefix + indexKey, all with a score of 0,
+// so that pages are read in path order with ZRANGEBYLEX, from where the previous one ended.
+// The last checks of the links are stored as JSON in the hash under the key prefix + checksKey, by path.
+// Paths start with a slash, and regexes with a caret, so neither alias keys nor the index or checks keys collide with pair keys.
+const (
+	fieldPath       = "path"
+	fieldUrl        = "url"
+	fieldUseCount   = "useCount"
+	fieldActiveFrom = "activeFrom" // RFC 3339, absent when not set
+	fieldExpiresAt  = "expiresAt"
+	fieldRules      = "rules"   // JSON, absent when there are none
+	fieldTargets    = "targets" // JSON without use counts, absent when there are none
+	fieldSticky     = "sticky"
+	fieldAliases    = "aliases" // JSON, absent when there are none
+	// fieldTargetUseCount followed by the url of a target holds its use count
+	fieldTargetUseCount = "targetUseCount:"
+
+	aliasKeyPrefix = "alias:"
+	indexKey       = "index"
+	checksKey      = "checks"
+
+	// scanBatchSize is a hint of how many keys a single SCAN call looks at, when the index is built.
+	scanBatchSize = 100
+)
+
+// incrementScript increments the use count only if the pair still exists;
+// a bare HINCRBY would create a hash without a url for a pair deleted in the meantime.
+var incrementScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+return redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+`)
+
+type RedisMapper struct {
+	name   string
+	client *redis.Client
+	prefix string
+}
+
+func (r *RedisMapper) GetName() string {
+	return r.name
+}
+
+func (r *RedisMapper) GetType() string {
+	return RedisMapperConfigType
+}
+
+func (r *RedisMapper) Readonly() bool {
+	return false
+}
+
+func (r *RedisMapper) Teardown() error {
+	return r.client.Close()
+}
+
+func (r *RedisMapper) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisMapper) key(path string) string {
+	return r.prefix + path
+}
+
+func (r *RedisMapper) aliasKey(alias string) string {
+	return r.prefix + aliasKeyPrefix + alias
+}
+
+func (r *RedisMapper) indexKey() string {
+	return r.prefix + indexKey
+}
+
+func (r *RedisMapper) checksKey() string {
+	return r.prefix + checksKey
+}
+
+// escapeGlob escapes the characters of s that a SCAN pattern would take as wildcards.
+func escapeGlob(s string) string {
+	var escaped strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
+
+// buildIndex adds the pairs stored before the index existed to it. It walks the whole key space with SCAN,
+// so it only runs when the index is missing, i.e. when the mapper is new, empty, or was written by an older version.
+func (r *RedisMapper) buildIndex(ctx context.Context) error {
+	exists, err := r.client.Exists(ctx, r.indexKey()).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	// only the keys of pairs, whose paths start with a slash or a caret, and not those of a longer prefix
+	match := escapeGlob(r.prefix) + `[/^]*`
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, match, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			members := make([]redis.Z, len(keys))
+			for i, key := range keys {
+				members[i] = redis.Z{Member: strings.TrimPrefix(key, r.prefix)}
+			}
+			if err := r.client.ZAdd(ctx, r.indexKey(), members...).Err(); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (r *RedisMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	fields, err := r.client.HGetAll(ctx, r.key(path)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		return r.toPair(fields)
+	}
+	owner, err := r.client.Get(ctx, r.aliasKey(path)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields, err = r.client.HGetAll(ctx, r.key(owner)).Result()
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	pair, err := r.toPair(fields)
+	if err != nil {
+		return nil, err
+	}
+	// the pair may have dropped the alias since it was read
+	if !slices.Contains(pair.Aliases, path) {
+		return nil, nil
+	}
+	return pair, nil
+}
+
+// ListUrls pages the index in path order. A cursor seeks to where the previous page ended,
+// so a page costs as much as its own pairs, while an offset is skipped by Redis.
+func (r *RedisMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	after, err := pagination.After()
+	if err != nil {
+		return nil, err
+	}
+	from, offset := "-", max(pagination.Offset, 0)
+	if after != "" {
+		from, offset = "("+after, 0
+	}
+	pairs := make(types.PathUrlPairList, 0, max(pagination.Limit, 0))
+	for len(pairs) < pagination.Limit {
+		count := pagination.Limit - len(pairs)
+		paths, err := r.client.ZRangeByLex(ctx, r.indexKey(), &redis.ZRangeBy{Min: from, Max: "+", Offset: int64(offset), Count: int64(count)}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			break
+		}
+		pipe := r.client.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(paths))
+		for i, path := range paths {
+			cmds[i] = pipe.HGetAll(ctx, r.key(path))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			fields := cmd.Val()
+			if len(fields) == 0 {
+				continue // deleted by hand, or between ZRANGEBYLEX and HGETALL
+			}
+			pair, err := r.toPair(fields)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair)
+		}
+		if len(paths) < count {
+			break
+		}
+		// the pairs that were gone are made up for by the next ones
+		from, offset = "("+paths[len(paths)-1], 0
+	}
+	return pairs, nil
+}
+
+func (r *RedisMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	key := r.key(pair.Path)
+	values := []any{
+		fieldPath, pair.Path,
+		fieldUrl, pair.Url,
+	}
+	var cleared []string
+	for field, t := range map[string]*time.Time{fieldActiveFrom: pair.ActiveFrom, fieldExpiresAt: pair.ExpiresAt} {
+		if t == nil {
+			cleared = append(cleared, field)
+		} else {
+			values = append(values, field, t.Format(time.RFC3339Nano))
+		}
+	}
+	if len(pair.Rules) == 0 {
+		cleared = append(cleared, fieldRules)
+	} else {
+		rules, err := json.Marshal(pair.Rules)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fieldRules, string(rules))
+	}
+	if pair.Sticky == "" {
+		cleared = append(cleared, fieldSticky)
+	} else {
+		values = append(values, fieldSticky, pair.Sticky)
+	}
+	if len(pair.Aliases) == 0 {
+		cleared = append(cleared, fieldAliases)
+	} else {
+		aliases, err := json.Marshal(pair.Aliases)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fieldAliases, string(aliases))
+	}
+	dropped, err := r.aliasesOf(ctx, pair.Path)
+	if err != nil {
+		return nil, err
+	}
+	// the counts of targets that are gone must go too, or they would come back with their url
+	existing, err := r.client.HKeys(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool, len(pair.Targets))
+	for _, target := range pair.Targets {
+		kept[target.Url] = true
+	}
+	for _, field := range existing {
+		if url, ok := strings.CutPrefix(field, fieldTargetUseCount); ok && !kept[url] {
+			cleared = append(cleared, field)
+		}
+	}
+	if len(pair.Targets) == 0 {
+		cleared = append(cleared, fieldTargets)
+	} else {
+		targets := make([]types.WeightedTarget, len(pair.Targets))
+		for i, target := range pair.Targets {
+			targets[i] = types.WeightedTarget{Url: target.Url, Weight: target.Weight}
+			values = append(values, fieldTargetUseCount+target.Url, target.UseCount)
+		}
+		encoded, err := json.Marshal(targets)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fieldTargets, string(encoded))
+	}
+	// the optional fields of the previous pair must go along with the write, so that readers never see a mix of both
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, values...)
+	// the stored count is kept, as it may have been incremented since the pair was read
+	pipe.HSetNX(ctx, key, fieldUseCount, pair.UseCount)
+	if len(cleared) > 0 {
+		pipe.HDel(ctx, key, cleared...)
+	}
+	for _, alias := range dropped {
+		if !slices.Contains(pair.Aliases, alias) {
+			pipe.Del(ctx, r.aliasKey(alias))
+		}
+	}
+	for _, alias := range pair.Aliases {
+		pipe.Set(ctx, r.aliasKey(alias), pair.Path, 0)
+	}
+	pipe.ZAdd(ctx, r.indexKey(), redis.Z{Member: pair.Path})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (r *RedisMapper) DeleteUrl(ctx context.Context, path string) error {
+	aliases, err := r.aliasesOf(ctx, path)
+	if err != nil {
+		return err
+	}
+	keys := []string{r.key(path)}
+	for _, alias := range aliases {
+		keys = append(keys, r.aliasKey(alias))
+	}
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.ZRem(ctx, r.indexKey(), path)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// aliasesOf returns the aliases of the pair stored at path.
+func (r *RedisMapper) aliasesOf(ctx context.Context, path string) ([]string, error) {
+	encoded, err := r.client.HGet(ctx, r.key(path), fieldAliases).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var aliases []string
+	if err := json.Unmarshal([]byte(encoded), &aliases); err != nil {
+		return nil, fmt.Errorf("invalid aliases of %s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+func (r *RedisMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	count, err := incrementScript.Run(ctx, r.client, []string{r.key(path)}, fieldUseCount).Int()
+	if err == redis.Nil {
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	return count, err
+}
+
+func (r *RedisMapper) IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error) {
+	count, err := incrementScript.Run(ctx, r.client, []string{r.key(path)}, fieldTargetUseCount+url).Int()
+	if err == redis.Nil {
+		return 0, fmt.Errorf("path %s not found", path)
+	}
+	return count, err
+}
+
+func (r *RedisMapper) toPair(fields map[string]string) (*types.PathUrlPair, error) {
+	pair := &types.PathUrlPair{
+		Path:   fields[fieldPath],
+		Url:    fields[fieldUrl],
+		Mapper: r.name,
+	}
+	if count, ok := fields[fieldUseCount]; ok {
+		useCount, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return nil, fmt.Errorf("invalid use count of %s: %w", pair.Path, err)
+		}
+		pair.UseCount = useCount
+	}
+	for field, t := range map[string]**time.Time{fieldActiveFrom: &pair.ActiveFrom, fieldExpiresAt: &pair.ExpiresAt} {
+		value, ok := fields[field]
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of %s: %w", field, pair.Path, err)
+		}
+		*t = &parsed
+	}
+	if rules, ok := fields[fieldRules]; ok {
+		if err := json.Unmarshal([]byte(rules), &pair.Rules); err != nil {
+			return nil, fmt.Errorf("invalid rules of %s: %w", pair.Path, err)
+		}
+	}
+	pair.Sticky = fields[fieldSticky]
+	if aliases, ok := fields[fieldAliases]; ok {
+		if err := json.Unmarshal([]byte(aliases), &pair.Aliases); err != nil {
+			return nil, fmt.Errorf("invalid aliases of %s: %w", pair.Path, err)
+		}
+	}
+	if targets, ok := fields[fieldTargets]; ok {
+		if err := json.Unmarshal([]byte(targets), &pair.Targets); err != nil {
+			return nil, fmt.Errorf("invalid targets of %s: %w", pair.Path, err)
+		}
+		for i, target := range pair.Targets {
+			count, ok := fields[fieldTargetUseCount+target.Url]
+			if !ok {
+				continue
+			}
+			useCount, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil {
+				return nil, fmt.Errorf("invalid use count of target %s of %s: %w", target.Url, pair.Path, err)
+			}
+			pair.Targets[i].UseCount = useCount
+		}
+	}
+	return pair, nil
+}
+
+func (r *RedisMapper) PutLinkChecks(ctx context.Context, checks []types.LinkCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	values := make([]any, 0, 2*len(checks))
+	for _, check := range checks {
+		encoded, err := json.Marshal(check)
+		if err != nil {
+			return err
+		}
+		values = append(values, check.Path, string(encoded))
+	}
+	return r.client.HSet(ctx, r.checksKey(), values...).Err()
+}
+
+func (r *RedisMapper) ListLinkChecks(ctx context.Context) ([]types.LinkCheck, error) {
+	fields, err := r.client.HGetAll(ctx, r.checksKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	checks := make([]types.LinkCheck, 0, len(fields))
+	for path, encoded := range fields {
+		var check types.LinkCheck
+		if err := json.Unmarshal([]byte(encoded), &check); err != nil {
+			return nil, fmt.Errorf("invalid link check of %s: %w", path, err)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (r *RedisMapper) DeleteLinkChecks(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return r.client.HDel(ctx, r.checksKey(), paths...).Err()
+}
@@ -0,0 +1,378 @@
+package redis_mapper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "/fk",
+		Url:  "https://fake.com",
+	}
+	fakePair2 = &types.PathUrlPair{
+		Path: "/fk2",
+		Url:  "https://fake2.com",
+	}
+)
+
+func newTestMapper(t *testing.T, server *miniredis.Miniredis, prefix string) *RedisMapper {
+	config := &RedisMapperConfig{Name: "redis", Address: server.Addr(), KeyPrefix: prefix}
+	m, err := config.GetMapper()
+	assert.NoError(t, err)
+	t.Cleanup(func() { m.Teardown() })
+	return m.(*RedisMapper)
+}
+
+func TestRedisMapper_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "redis"}, got)
+
+	// stored as a hash under the prefix
+	assert.Equal(t, fakePair.Url, server.HGet(defaultKeyPrefix+fakePair.Path, fieldUrl))
+
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestRedisMapper_Times(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	activeFrom, expiresAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	timed := &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "redis", ActiveFrom: &activeFrom, ExpiresAt: &expiresAt}
+	_, err := m.PutUrl(ctx, timed.Clone())
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, timed, got)
+
+	// clearing the times removes them from the hash
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got.ActiveFrom)
+	assert.Nil(t, got.ExpiresAt)
+	keys, err := server.HKeys(defaultKeyPrefix + fakePair.Path)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{fieldPath, fieldUrl, fieldUseCount}, keys)
+
+	server.HSet(defaultKeyPrefix+fakePair.Path, fieldExpiresAt, "tomorrow")
+	_, err = m.GetUrl(ctx, fakePair.Path)
+	assert.Error(t, err)
+}
+
+func TestRedisMapper_Rules(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	ruled := &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "redis",
+		Rules: []types.RedirectRule{{Url: "https://fake.com/office", CIDRs: []string{"10.0.0.0/8"}}}}
+	_, err := m.PutUrl(ctx, ruled.Clone())
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, ruled, got)
+
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	keys, err := server.HKeys(defaultKeyPrefix + fakePair.Path)
+	assert.NoError(t, err)
+	assert.NotContains(t, keys, fieldRules, "clearing the rules removes them from the hash")
+
+	server.HSet(defaultKeyPrefix+fakePair.Path, fieldRules, "[")
+	_, err = m.GetUrl(ctx, fakePair.Path)
+	assert.Error(t, err)
+}
+
+func TestRedisMapper_KeyPrefix(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	a := newTestMapper(t, server, "a:")
+	b := newTestMapper(t, server, "b:")
+
+	_, err := a.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+
+	got, err := b.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	pairs, err := b.ListUrls(ctx, types.Pagination{Offset: 0, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, pairs)
+
+	// neither a prefix that another one starts with, nor one with glob characters, picks up foreign keys
+	for _, prefix := range []string{"golinks", "golinks2", "go*", "go?", "[g]"} {
+		m := newTestMapper(t, server, prefix)
+		_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: "/" + prefix, Url: "https://fake.com"})
+		assert.NoError(t, err)
+	}
+	for _, prefix := range []string{"golinks", "golinks2", "go*", "go?", "[g]"} {
+		server.Del(prefix + indexKey)
+		m := newTestMapper(t, server, prefix)
+		pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+		assert.NoError(t, err)
+		if assert.Len(t, pairs, 1, prefix) {
+			assert.Equal(t, "/"+prefix, pairs[0].Path)
+		}
+	}
+}
+
+func TestRedisMapper_IncrementUseCount(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+	_, err := m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.IncrementUseCount(ctx, fakePair.Path)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	count, err := m.IncrementUseCount(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 21, count)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 21, got.UseCount)
+
+	// a write of the pair as read before the clicks does not undo them
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: fakePair.Path, Url: "https://fake3.com", UseCount: 1})
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fake3.com", got.Url)
+	assert.Equal(t, 21, got.UseCount)
+
+	// a missing pair is not created by the increment
+	_, err = m.IncrementUseCount(ctx, "/invalid")
+	assert.Error(t, err)
+	assert.False(t, server.Exists(defaultKeyPrefix+"/invalid"))
+}
+
+func TestRedisMapper_ListUrls(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+	for i := 0; i < 250; i++ {
+		_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: fmt.Sprintf("/p%d", i), Url: "https://fake.com"})
+		assert.NoError(t, err)
+	}
+	// keys outside the prefix are ignored
+	server.Set("other", "value")
+
+	tests := []struct {
+		name       string
+		pagination types.Pagination
+		want       int
+	}{
+		{name: "first page", pagination: types.Pagination{Offset: 0, Limit: 100}, want: 100},
+		{name: "across scan batches", pagination: types.Pagination{Offset: 90, Limit: 120}, want: 120},
+		{name: "last page", pagination: types.Pagination{Offset: 200, Limit: 100}, want: 50},
+		{name: "past the end", pagination: types.Pagination{Offset: 300, Limit: 100}, want: 0},
+		{name: "cursor", pagination: types.Pagination{Cursor: types.NewCursor("/p98"), Limit: 100}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := m.ListUrls(ctx, tt.pagination)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, len(pairs))
+		})
+	}
+
+	// pages do not overlap
+	seen := make(map[string]bool)
+	for offset := 0; offset < 250; offset += 100 {
+		pairs, err := m.ListUrls(ctx, types.Pagination{Offset: offset, Limit: 100})
+		assert.NoError(t, err)
+		for _, pair := range pairs {
+			assert.False(t, seen[pair.Path], pair.Path)
+			seen[pair.Path] = true
+		}
+	}
+	assert.Equal(t, 250, len(seen))
+
+	// pairs deleted behind the index are made up for
+	server.Del(defaultKeyPrefix + "/p0")
+	server.Del(defaultKeyPrefix + "/p1")
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 3})
+	assert.NoError(t, err)
+	var paths []string
+	for _, pair := range pairs {
+		paths = append(paths, pair.Path)
+	}
+	assert.Equal(t, []string{"/p10", "/p100", "/p101"}, paths)
+}
+
+func TestRedisMapper_BuildIndex(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	// pairs stored before the index existed
+	server.HSet(defaultKeyPrefix+fakePair.Path, fieldPath, fakePair.Path, fieldUrl, fakePair.Url)
+	server.HSet(defaultKeyPrefix+fakePair2.Path, fieldPath, fakePair2.Path, fieldUrl, fakePair2.Url)
+	assert.NoError(t, server.Set(defaultKeyPrefix+aliasKeyPrefix+"/fake", fakePair.Path))
+	m := newTestMapper(t, server, "")
+
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+	members, err := server.ZMembers(defaultKeyPrefix + indexKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fakePair.Path, fakePair2.Path}, members)
+
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	members, err = server.ZMembers(defaultKeyPrefix + indexKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fakePair2.Path}, members)
+}
+
+func TestRedisMapper_LinkChecks(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+	checkedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	broken := types.LinkCheck{Path: fakePair.Path, Mapper: "redis", Status: types.LinkStatusBroken, CheckedAt: checkedAt,
+		Url: fakePair.Url, StatusCode: 404, Reason: "404 Not Found"}
+	ok := types.LinkCheck{Path: fakePair2.Path, Mapper: "redis", Status: types.LinkStatusOk, CheckedAt: checkedAt}
+
+	assert.NoError(t, m.PutLinkChecks(ctx, []types.LinkCheck{broken, ok}))
+	checks, err := m.ListLinkChecks(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.LinkCheck{broken, ok}, checks)
+	// not taken for pairs
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, pairs)
+
+	broken.Status, broken.Reason = types.LinkStatusOk, ""
+	assert.NoError(t, m.PutLinkChecks(ctx, []types.LinkCheck{broken}))
+	assert.NoError(t, m.DeleteLinkChecks(ctx, ok.Path, "/missing"))
+	checks, err = m.ListLinkChecks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.LinkCheck{broken}, checks)
+}
+
+func TestRedisMapper_Ping(t *testing.T) {
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+	assert.NoError(t, m.Ping(context.Background()))
+	server.Close()
+	assert.Error(t, m.Ping(context.Background()))
+}
+
+func TestRedisMapper_Targets(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	split := &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Mapper: "redis", Sticky: types.StickyClient,
+		Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 9}, {Url: "https://b.com", Weight: 1}}}
+	_, err := m.PutUrl(ctx, split.Clone())
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		count, err := m.IncrementTargetUseCount(ctx, fakePair.Path, "https://b.com")
+		assert.NoError(t, err)
+		assert.Equal(t, i+1, count)
+	}
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.True(t, split.Equals(got))
+	assert.Equal(t, []types.WeightedTarget{{Url: "https://a.com", Weight: 9}, {Url: "https://b.com", Weight: 1, UseCount: 3}}, got.Targets)
+
+	// the counts of removed targets are removed too
+	split.Targets = split.Targets[:1]
+	_, err = m.PutUrl(ctx, split.Clone())
+	assert.NoError(t, err)
+	keys, err := server.HKeys(defaultKeyPrefix + fakePair.Path)
+	assert.NoError(t, err)
+	assert.NotContains(t, keys, fieldTargetUseCount+"https://b.com")
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	keys, err = server.HKeys(defaultKeyPrefix + fakePair.Path)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{fieldPath, fieldUrl, fieldUseCount}, keys)
+
+	_, err = m.IncrementTargetUseCount(ctx, "/invalid", "https://a.com")
+	assert.Error(t, err)
+}
+
+func TestRedisMapper_Aliases(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	aliased := &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}}
+	_, err := m.PutUrl(ctx, aliased.Clone())
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.True(t, aliased.Equals(got), "Expected %v, got %v", aliased, got)
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 1, "alias keys are not listed")
+
+	aliased.Aliases = []string{"/kube"}
+	_, err = m.PutUrl(ctx, aliased.Clone())
+	assert.NoError(t, err)
+	assert.False(t, server.Exists(defaultKeyPrefix+aliasKeyPrefix+"/k8s"), "dropped aliases are deleted")
+
+	// an alias key left behind by a concurrent write does not resolve
+	assert.NoError(t, server.Set(defaultKeyPrefix+aliasKeyPrefix+"/k8s", "/kubernetes"))
+	got, err = m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	assert.NoError(t, m.DeleteUrl(ctx, "/kubernetes"))
+	assert.False(t, server.Exists(defaultKeyPrefix+aliasKeyPrefix+"/kube"))
+}
+
+func TestRedisMapper_Patterns(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	m := newTestMapper(t, server, "")
+
+	for _, path := range []string{`^bug(\d+)$`, "/pr/*", "/fk"} {
+		_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: path, Url: "https://fake.com/$1"})
+		assert.NoError(t, err)
+	}
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	var paths []string
+	for _, pair := range pairs {
+		paths = append(paths, pair.Path)
+	}
+	assert.Equal(t, []string{"/fk", "/pr/*", `^bug(\d+)$`}, paths, "regexes are listed along with paths")
+}
@@ -0,0 +1,131 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// ConfigurerFactory returns an empty configurer of a mapper type, for a mapper block of the config file to be decoded into.
+type ConfigurerFactory func() types.MapperConfigurer
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ConfigurerFactory)
+)
+
+// Register makes a mapper type available to the config file under typ, which is case-insensitive.
+// Mapper packages call it from an init function, so importing a package is enough to enable its mapper.
+// It panics if typ is registered twice, as two packages would be fighting over the same config blocks.
+func Register(typ string, factory ConfigurerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	typ = strings.ToUpper(typ)
+	if typ == "" || factory == nil {
+		panic("mapper: Register needs a type and a factory")
+	}
+	if _, ok := registry[typ]; ok {
+		panic(fmt.Sprintf("mapper: Register called twice for type %s", typ))
+	}
+	registry[typ] = factory
+}
+
+// NewConfigurer returns an empty configurer of the registered type typ.
+func NewConfigurer(typ string) (types.MapperConfigurer, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[strings.ToUpper(typ)]
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// RegisteredTypes returns the registered mapper types, sorted.
+func RegisteredTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ConfigField describes a field of a mapper block in the config file.
+type ConfigField struct {
+	Name string // as written in the config file; fields of lists and objects are prefixed with the parent, e.g. peers[].id
+	Type string // string, int, bool, time, ...; object and []object for nested blocks, whose fields follow
+}
+
+// ConfigSchema describes the fields of the registered type typ, in declaration order.
+func ConfigSchema(typ string) ([]ConfigField, error) {
+	configurer, ok := NewConfigurer(typ)
+	if !ok {
+		return nil, fmt.Errorf("unknown mapper type: %s", typ)
+	}
+	return SchemaOf(configurer), nil
+}
+
+// SchemaOf describes the fields of the config struct v, or of the struct it points to.
+// Fields are named after their mapstructure tag, or their yaml tag for the types shared with the links files;
+// untagged fields are not configurable and left out, and squashed structs are inlined.
+func SchemaOf(v any) []ConfigField {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return appendSchema(nil, "", t)
+}
+
+func appendSchema(fields []ConfigField, prefix string, t reflect.Type) []ConfigField {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.Contains(field.Tag.Get("mapstructure"), ",squash") {
+			fields = appendSchema(fields, prefix, field.Type)
+			continue
+		}
+		name := tagName(field, "mapstructure")
+		if name == "" {
+			name = tagName(field, "yaml")
+		}
+		if name == "" || !field.IsExported() {
+			continue
+		}
+		name = prefix + name
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch {
+		case ft == reflect.TypeOf(time.Time{}):
+			fields = append(fields, ConfigField{Name: name, Type: "time"}) // RFC 3339
+		case ft.Kind() == reflect.Struct:
+			fields = append(fields, ConfigField{Name: name, Type: "object"})
+			fields = appendSchema(fields, name+".", ft)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			fields = append(fields, ConfigField{Name: name, Type: "[]object"})
+			fields = appendSchema(fields, name+"[].", ft.Elem())
+		default:
+			fields = append(fields, ConfigField{Name: name, Type: ft.String()})
+		}
+	}
+	return fields
+}
+
+func tagName(field reflect.StructField, key string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
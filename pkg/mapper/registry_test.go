@@ -0,0 +1,84 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+type registryTestConfig struct {
+	Name    string `mapstructure:"name"`
+	Timeout int    `mapstructure:"timeout"`
+	Peers   []struct {
+		Id string `mapstructure:"id"`
+	} `mapstructure:"peers"`
+	Pairs []types.PathUrlPair `mapstructure:"pairs"`
+	Tls   *struct {
+		Insecure bool `mapstructure:"insecure"`
+	} `mapstructure:"tls"`
+	internal string `mapstructure:"internal"`
+	Untagged string
+}
+
+func (c *registryTestConfig) GetName() string                  { return c.Name }
+func (c *registryTestConfig) GetType() string                  { return "REGISTRY_TEST" }
+func (c *registryTestConfig) Singleton() bool                  { return false }
+func (c *registryTestConfig) GetMapper() (types.Mapper, error) { return nil, nil }
+
+func TestRegistry(t *testing.T) {
+	Register("registry_test", func() types.MapperConfigurer { return &registryTestConfig{} })
+
+	configurer, ok := NewConfigurer("Registry_Test")
+	assert.True(t, ok)
+	assert.IsType(t, &registryTestConfig{}, configurer)
+	other, _ := NewConfigurer("REGISTRY_TEST")
+	assert.NotSame(t, configurer, other, "every mapper block gets a configurer of its own")
+
+	_, ok = NewConfigurer("unknown")
+	assert.False(t, ok)
+	assert.Contains(t, RegisteredTypes(), "REGISTRY_TEST")
+
+	assert.Panics(t, func() {
+		Register("REGISTRY_TEST", func() types.MapperConfigurer { return &registryTestConfig{} })
+	})
+	assert.Panics(t, func() { Register("", nil) })
+}
+
+func TestConfigSchema(t *testing.T) {
+	Register("schema_test", func() types.MapperConfigurer { return &registryTestConfig{} })
+
+	fields, err := ConfigSchema("schema_test")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConfigField{
+		{Name: "name", Type: "string"},
+		{Name: "timeout", Type: "int"},
+		{Name: "peers", Type: "[]object"},
+		{Name: "peers[].id", Type: "string"},
+		{Name: "pairs", Type: "[]object"},
+		{Name: "pairs[].path", Type: "string"},
+		{Name: "pairs[].url", Type: "string"},
+		{Name: "pairs[].activeFrom", Type: "time"},
+		{Name: "pairs[].expiresAt", Type: "time"},
+		{Name: "pairs[].rules", Type: "[]object"},
+		{Name: "pairs[].rules[].url", Type: "string"},
+		{Name: "pairs[].rules[].headers", Type: "map[string]string"},
+		{Name: "pairs[].rules[].os", Type: "[]string"},
+		{Name: "pairs[].rules[].query", Type: "map[string]string"},
+		{Name: "pairs[].rules[].cidrs", Type: "[]string"},
+		{Name: "pairs[].rules[].hours", Type: "string"},
+		{Name: "pairs[].rules[].timezone", Type: "string"},
+		{Name: "pairs[].targets", Type: "[]object"},
+		{Name: "pairs[].targets[].url", Type: "string"},
+		{Name: "pairs[].targets[].weight", Type: "int"},
+		{Name: "pairs[].targets[].useCount", Type: "int"},
+		{Name: "pairs[].sticky", Type: "string"},
+		{Name: "pairs[].aliases", Type: "[]string"},
+		{Name: "tls", Type: "object"},
+		{Name: "tls.insecure", Type: "bool"},
+	}, fields)
+
+	_, err = ConfigSchema("unknown")
+	assert.Error(t, err)
+}
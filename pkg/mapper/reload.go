@@ -0,0 +1,25 @@
+package mapper
+
+import "sync"
+
+// ReloadHooks implements types.MapperReloader for the mappers that embed it, which call Reloaded after they reload.
+type ReloadHooks struct {
+	mu    sync.Mutex
+	hooks []func()
+}
+
+func (h *ReloadHooks) OnReload(hook func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+}
+
+// Reloaded calls the hooks, in the order they were registered.
+func (h *ReloadHooks) Reloaded() {
+	h.mu.Lock()
+	hooks := h.hooks
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
@@ -0,0 +1,78 @@
+package remote_mapper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	RemoteMapperConfigType = "REMOTE"
+
+	ProtocolGrpc = "GRPC"
+	ProtocolHttp = "HTTP"
+
+	defaultTimeout = 2000 // in milliseconds
+)
+
+var _ types.MapperConfigurer = (*RemoteMapperConfig)(nil)
+
+func init() {
+	mapper.Register(RemoteMapperConfigType, func() types.MapperConfigurer { return &RemoteMapperConfig{} })
+}
+
+// RemoteMapperConfig points to the crud (gRPC) or crud_http (REST) service of another golinks server.
+type RemoteMapperConfig struct {
+	Name      string `mapstructure:"name"`
+	Protocol  string `mapstructure:"protocol"`  // grpc or http
+	Address   string `mapstructure:"address"`   // host:port for grpc, base url for http
+	Tls       bool   `mapstructure:"tls"`       // grpc only; for http, use an https address
+	Token     string `mapstructure:"token"`     // sent as a bearer token with every call
+	ReadWrite bool   `mapstructure:"readWrite"` // readonly unless set
+	Timeout   int    `mapstructure:"timeout"`   // in milliseconds, per call
+}
+
+func (r *RemoteMapperConfig) GetName() string {
+	return r.Name
+}
+
+func (r *RemoteMapperConfig) GetType() string {
+	return RemoteMapperConfigType
+}
+
+func (r *RemoteMapperConfig) Singleton() bool {
+	return false
+}
+
+func (r *RemoteMapperConfig) GetMapper() (types.Mapper, error) {
+	if r.Address == "" {
+		return nil, fmt.Errorf("missing address for remote mapper %s", r.Name)
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	var c client
+	var err error
+	switch strings.ToUpper(r.Protocol) {
+	case ProtocolGrpc, "":
+		c, err = newGrpcClient(r.Address, r.Tls, r.Token)
+	case ProtocolHttp:
+		c, err = newHttpClient(r.Address, r.Token)
+	default:
+		return nil, fmt.Errorf("unsupported protocol for remote mapper %s: %s", r.Name, r.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteMapper{
+		name:     r.Name,
+		client:   c,
+		readonly: !r.ReadWrite,
+		timeout:  time.Duration(timeout) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,186 @@
+package remote_mapper
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/reimirno/golinks/pkg/pb"
+	"github.com/reimirno/golinks/pkg/tracing"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+type grpcClient struct {
+	conn   *grpc.ClientConn
+	client pb.GolinksClient
+	token  string
+}
+
+func newGrpcClient(address string, useTls bool, token string) (*grpcClient, error) {
+	creds := insecure.NewCredentials()
+	if useTls {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds), tracing.GrpcClientOption())
+	if err != nil {
+		return nil, err
+	}
+	return &grpcClient{conn: conn, client: pb.NewGolinksClient(conn), token: token}, nil
+}
+
+// withAuth sends the token, and the actor of the request so that upstream writes are attributed to them.
+func (c *grpcClient) withAuth(ctx context.Context) context.Context {
+	if actor := utils.ActorFromContext(ctx); actor != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(utils.ActorHeader), actor)
+	}
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+func (c *grpcClient) get(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	resp, err := c.client.GetUrl(c.withAuth(ctx), &pb.GetUrlRequest{Path: path})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return fromProto(resp), nil
+}
+
+func (c *grpcClient) list(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	resp, err := c.client.ListUrls(c.withAuth(ctx), &pb.ListUrlsRequest{
+		Pagination: &pb.Pagination{Offset: int32(pagination.Offset), Limit: int32(pagination.Limit), Cursor: pagination.Cursor},
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	pairs := make(types.PathUrlPairList, 0, len(resp.Pairs))
+	for _, pair := range resp.Pairs {
+		pairs = append(pairs, fromProto(pair))
+	}
+	return pairs, nil
+}
+
+func (c *grpcClient) put(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	resp, err := c.client.PutUrl(c.withAuth(ctx), &pb.PathUrlPair{
+		Path:       pair.Path,
+		Url:        pair.Url,
+		ActiveFrom: toTimestamp(pair.ActiveFrom),
+		ExpiresAt:  toTimestamp(pair.ExpiresAt),
+		Rules:      toRules(pair.Rules),
+		Targets:    toTargets(pair.Targets),
+		Sticky:     pair.Sticky,
+		Aliases:    pair.Aliases,
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return fromProto(resp), nil
+}
+
+func (c *grpcClient) delete(ctx context.Context, path string) error {
+	_, err := c.client.DeleteUrl(c.withAuth(ctx), &pb.DeleteUrlRequest{Path: path})
+	return fromStatus(err)
+}
+
+func (c *grpcClient) close() error {
+	return c.conn.Close()
+}
+
+// fromStatus turns deadline and cancellation statuses back into context errors,
+// so that the manager treats them like any other interrupted call.
+func fromStatus(err error) error {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Canceled:
+		return context.Canceled
+	}
+	return err
+}
+
+func fromProto(p *pb.PathUrlPair) *types.PathUrlPair {
+	return &types.PathUrlPair{
+		Path:       p.Path,
+		Url:        p.Url,
+		UseCount:   int(p.UseCount),
+		ActiveFrom: fromTimestamp(p.ActiveFrom),
+		ExpiresAt:  fromTimestamp(p.ExpiresAt),
+		Rules:      fromRules(p.Rules),
+		Targets:    fromTargets(p.Targets),
+		Sticky:     p.Sticky,
+		Aliases:    p.Aliases,
+	}
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromTimestamp(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+	s := t.AsTime()
+	return &s
+}
+
+func toRules(rules []types.RedirectRule) []*pb.RedirectRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]*pb.RedirectRule, len(rules))
+	for i, r := range rules {
+		out[i] = &pb.RedirectRule{Url: r.Url, Headers: r.Headers, Os: r.OS, Query: r.Query, Cidrs: r.CIDRs, Hours: r.Hours, Timezone: r.Timezone}
+	}
+	return out
+}
+
+func fromRules(rules []*pb.RedirectRule) []types.RedirectRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]types.RedirectRule, len(rules))
+	for i, r := range rules {
+		out[i] = types.RedirectRule{Url: r.Url, Headers: r.Headers, OS: r.Os, Query: r.Query, CIDRs: r.Cidrs, Hours: r.Hours, Timezone: r.Timezone}
+	}
+	return out
+}
+
+func toTargets(targets []types.WeightedTarget) []*pb.WeightedTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+	out := make([]*pb.WeightedTarget, len(targets))
+	for i, t := range targets {
+		out[i] = &pb.WeightedTarget{Url: t.Url, Weight: int32(t.Weight)}
+	}
+	return out
+}
+
+func fromTargets(targets []*pb.WeightedTarget) []types.WeightedTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+	out := make([]types.WeightedTarget, len(targets))
+	for i, t := range targets {
+		out[i] = types.WeightedTarget{Url: t.Url, Weight: int(t.Weight), UseCount: int(t.UseCount)}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package remote_mapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+// httpClient talks to the crud_http service.
+// Paths are sent as a single url segment, so paths containing a slash are only supported over grpc.
+type httpClient struct {
+	base   *url.URL
+	client *http.Client
+	token  string
+}
+
+func newHttpClient(address string, token string) (*httpClient, error) {
+	base, err := url.Parse(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("remote http address must start with http:// or https://: %s", address)
+	}
+	return &httpClient{
+		base:   base,
+		client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		token:  token,
+	}, nil
+}
+
+func (c *httpClient) pathUrl(path string) string {
+	return c.base.String() + "/go/" + url.PathEscape(strings.TrimPrefix(path, "/")) + "/"
+}
+
+func (c *httpClient) do(ctx context.Context, method string, target string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if actor := utils.ActorFromContext(ctx); actor != "" {
+		req.Header.Set(utils.ActorHeader, actor)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *httpClient) get(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.pathUrl(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	var pair types.PathUrlPair
+	if err := decode(resp, http.StatusOK, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+func (c *httpClient) list(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	query := url.Values{}
+	query.Set("offset", strconv.Itoa(pagination.Offset))
+	query.Set("limit", strconv.Itoa(pagination.Limit))
+	if pagination.Cursor != "" {
+		query.Set("cursor", pagination.Cursor)
+	}
+	resp, err := c.do(ctx, http.MethodGet, c.base.String()+"/go/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var pairs types.PathUrlPairList
+	if err := decode(resp, http.StatusOK, &pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+func (c *httpClient) put(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	body := &types.PathUrlPair{
+		Path:       pair.Path,
+		Url:        pair.Url,
+		ActiveFrom: pair.ActiveFrom,
+		ExpiresAt:  pair.ExpiresAt,
+		Rules:      pair.Rules,
+		Targets:    pair.Targets,
+		Sticky:     pair.Sticky,
+		Aliases:    pair.Aliases,
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.base.String()+"/go/", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var put types.PathUrlPair
+	if err := decode(resp, http.StatusAccepted, &put); err != nil {
+		return nil, err
+	}
+	return &put, nil
+}
+
+func (c *httpClient) delete(ctx context.Context, path string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.pathUrl(path), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decode(resp, http.StatusNoContent, nil)
+}
+
+func (c *httpClient) close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func decode(resp *http.Response, want int, v any) error {
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("remote answered %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,117 @@
+package remote_mapper
+
+import (
+	"context"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+var (
+	_ types.Mapper        = (*RemoteMapper)(nil)
+	_ types.MapperCounter = (*RemoteMapper)(nil)
+)
+
+// client is the API of another golinks server.
+// get returns nil without error when the path does not exist there.
+type client interface {
+	get(ctx context.Context, path string) (*types.PathUrlPair, error)
+	list(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error)
+	put(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error)
+	delete(ctx context.Context, path string) error
+	close() error
+}
+
+// RemoteMapper resolves links through another golinks server, so that a local instance can fall back to a central one.
+// The remote server applies its own mappers, sanitization and conflict resolution.
+// Put a `cache` in front of it to avoid a round trip on every redirect.
+type RemoteMapper struct {
+	name     string
+	client   client
+	readonly bool
+	timeout  time.Duration
+}
+
+func (r *RemoteMapper) GetName() string {
+	return r.name
+}
+
+func (r *RemoteMapper) GetType() string {
+	return RemoteMapperConfigType
+}
+
+func (r *RemoteMapper) Readonly() bool {
+	return r.readonly
+}
+
+func (r *RemoteMapper) Teardown() error {
+	return r.client.close()
+}
+
+func (r *RemoteMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	pair, err := r.client.get(ctx, path)
+	if err != nil || pair == nil {
+		return nil, err
+	}
+	// the upstream matches its patterns too, but the manager matches them itself, once every mapper missed path
+	if patterns.IsPattern(pair.Path) && !patterns.IsPattern(path) {
+		return nil, nil
+	}
+	return r.own(pair), nil
+}
+
+func (r *RemoteMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	pairs, err := r.client.list(ctx, pagination)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		r.own(pair)
+	}
+	return pairs, nil
+}
+
+func (r *RemoteMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	if r.readonly {
+		return nil, mapper.ErrOperationNotSupported("put")
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	put, err := r.client.put(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	return r.own(put), nil
+}
+
+func (r *RemoteMapper) DeleteUrl(ctx context.Context, path string) error {
+	if r.readonly {
+		return mapper.ErrOperationNotSupported("delete")
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.client.delete(ctx, path)
+}
+
+// IncrementUseCount does not count the click upstream: the remote API has no way to, and writing
+// the pair back would reset its count. The remote server only counts its own redirects.
+func (r *RemoteMapper) IncrementUseCount(ctx context.Context, path string) (int, error) {
+	pair, err := r.GetUrl(ctx, path)
+	if err != nil || pair == nil {
+		return 0, err
+	}
+	return pair.UseCount, nil
+}
+
+// own marks a pair as coming from this mapper rather than from the remote server's mapper,
+// so that the manager sends updates back here.
+func (r *RemoteMapper) own(pair *types.PathUrlPair) *types.PathUrlPair {
+	pair.Mapper = r.name
+	return pair
+}
@@ -0,0 +1,260 @@
+package remote_mapper
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+	"github.com/reimirno/golinks/svr/crud"
+	"github.com/reimirno/golinks/svr/crud_http"
+)
+
+var (
+	fakePair = &types.PathUrlPair{
+		Path: "fk",
+		Url:  "https://fake.com",
+	}
+	fakePair2 = &types.PathUrlPair{
+		Path: "fk2",
+		Url:  "https://fake2.com",
+	}
+
+	// When using it, please clone it first
+	upstreamConfigurer = &mapper.MockMapperConfigurer{
+		Name: "central",
+		StarterPairs: types.PathUrlPairMap{
+			"fk":  fakePair,
+			"fk2": fakePair2,
+		},
+	}
+)
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startUpstream runs the crud and crud_http services of a golinks server,
+// and returns the remote mapper configuration for each of them.
+func startUpstream(t *testing.T) []*RemoteMapperConfig {
+	mm, err := mapper.NewMapperManager(upstreamConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{upstreamConfigurer}))
+	require.NoError(t, err)
+	grpcPort, httpPort := freePort(t), freePort(t)
+	grpcServer, err := crud.NewServer(mm, grpcPort, false)
+	require.NoError(t, err)
+	httpServer, err := crud_http.NewServer(mm, httpPort)
+	require.NoError(t, err)
+	errChan := make(chan error, 2)
+	grpcServer.Start(errChan)
+	httpServer.Start(errChan)
+	t.Cleanup(func() {
+		grpcServer.Stop()
+		httpServer.Stop()
+	})
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + httpPort + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return []*RemoteMapperConfig{
+		{Name: "remote", Protocol: "grpc", Address: "127.0.0.1:" + grpcPort, ReadWrite: true},
+		{Name: "remote", Protocol: "http", Address: "http://127.0.0.1:" + httpPort, ReadWrite: true},
+	}
+}
+
+func TestRemoteMapper(t *testing.T) {
+	for _, config := range startUpstream(t) {
+		t.Run(config.Protocol, func(t *testing.T) {
+			ctx := context.Background()
+			m, err := config.GetMapper()
+			require.NoError(t, err)
+			defer m.Teardown()
+			assert.False(t, m.Readonly())
+
+			got, err := m.GetUrl(ctx, "/fk")
+			assert.NoError(t, err)
+			assert.Equal(t, fakePair.Url, got.Url)
+			assert.Equal(t, "remote", got.Mapper)
+
+			got, err = m.GetUrl(ctx, "/invalid")
+			assert.NoError(t, err)
+			assert.Nil(t, got)
+
+			pairs, err := m.ListUrls(ctx, types.Pagination{Offset: 0, Limit: 10})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(pairs))
+			assert.Equal(t, "remote", pairs[0].Mapper)
+
+			written := &types.PathUrlPair{Path: "/new" + config.Protocol, Url: "https://new.com", Sticky: types.StickyClient,
+				Aliases: []string{"/next" + config.Protocol},
+				Rules:   []types.RedirectRule{{Url: "https://new.com/mac", OS: []string{"macos"}}},
+				Targets: []types.WeightedTarget{{Url: "https://new.com", Weight: 9}, {Url: "https://next.com", Weight: 1}}}
+			put, err := m.PutUrl(ctx, written.Clone())
+			assert.NoError(t, err)
+			assert.Equal(t, "https://new.com", put.Url)
+			got, err = m.GetUrl(ctx, "/new"+config.Protocol)
+			assert.NoError(t, err)
+			assert.True(t, written.Equals(got), "Expected %+v, got %+v", written, got)
+			got, err = m.GetUrl(ctx, "/next"+config.Protocol)
+			assert.NoError(t, err)
+			assert.True(t, written.Equals(got), "Expected %+v, got %+v", written, got)
+
+			assert.NoError(t, m.DeleteUrl(ctx, "/new"+config.Protocol))
+			got, err = m.GetUrl(ctx, "/new"+config.Protocol)
+			assert.NoError(t, err)
+			assert.Nil(t, got)
+		})
+	}
+}
+
+func TestRemoteMapper_Readonly(t *testing.T) {
+	ctx := context.Background()
+	config := startUpstream(t)[0]
+	config.ReadWrite = false
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	defer m.Teardown()
+
+	assert.True(t, m.Readonly())
+	_, err = m.PutUrl(ctx, fakePair.Clone())
+	assert.Error(t, err)
+	assert.Error(t, m.DeleteUrl(ctx, "/fk"))
+	got, err := m.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+}
+
+func TestRemoteMapper_UpstreamPatterns(t *testing.T) {
+	ctx := context.Background()
+	// over gRPC, which supports paths containing a slash
+	config := startUpstream(t)[0]
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	defer m.Teardown()
+
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: "/pr/*", Url: "https://github.com/org/repo/pull/$1"})
+	require.NoError(t, err)
+	// the pattern is served as a pair of its own, but is not matched upstream
+	got, err := m.GetUrl(ctx, "/pr/*")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/pull/$1", got.Url)
+	got, err = m.GetUrl(ctx, "/pr/1")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestRemoteMapper_IncrementUseCountLeavesRemoteUntouched(t *testing.T) {
+	ctx := context.Background()
+	config := startUpstream(t)[0]
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	defer m.Teardown()
+
+	count, err := m.(types.MapperCounter).IncrementUseCount(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	got, err := m.GetUrl(ctx, "/fk")
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+}
+
+func TestRemoteMapper_HttpAuthAndTimeout(t *testing.T) {
+	var gotAuth, gotActor string
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotActor = r.Header.Get(utils.ActorHeader)
+		if r.URL.Path == "/go/slow/" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if r.URL.Path == "/go/broken/" {
+			http.Error(rw, "boom", http.StatusInternalServerError)
+			return
+		}
+		http.Error(rw, "not found", http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	config := &RemoteMapperConfig{Name: "remote", Protocol: "http", Address: upstream.URL, Token: "secret", Timeout: 50}
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	defer m.Teardown()
+
+	got, err := m.GetUrl(utils.WithActor(context.Background(), "alice"), "/fk")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	assert.Equal(t, "Bearer secret", gotAuth)
+	assert.Equal(t, "alice", gotActor)
+
+	_, err = m.GetUrl(context.Background(), "/broken")
+	assert.ErrorContains(t, err, "boom")
+
+	_, err = m.GetUrl(context.Background(), "/slow")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRemoteMapperConfig_GetMapper(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RemoteMapperConfig
+		wantErr bool
+	}{
+		{name: "grpc by default", config: &RemoteMapperConfig{Name: "remote", Address: "localhost:8081"}},
+		{name: "http", config: &RemoteMapperConfig{Name: "remote", Protocol: "http", Address: "https://golinks.example.com/"}},
+		{name: "missing address", config: &RemoteMapperConfig{Name: "remote"}, wantErr: true},
+		{name: "http without scheme", config: &RemoteMapperConfig{Name: "remote", Protocol: "http", Address: "localhost:8082"}, wantErr: true},
+		{name: "unknown protocol", config: &RemoteMapperConfig{Name: "remote", Protocol: "ftp", Address: "localhost:21"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, RemoteMapperConfigType, tt.config.GetType())
+			assert.False(t, tt.config.Singleton())
+			m, err := tt.config.GetMapper()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, m.Readonly())
+			assert.NoError(t, m.Teardown())
+		})
+	}
+}
+
+func TestRemoteMapper_LocalLinksTakePrecedence(t *testing.T) {
+	ctx := context.Background()
+	remote := startUpstream(t)[0]
+	remote.ReadWrite = false
+	local := &mapper.MockMapperConfigurer{
+		Name:         "local",
+		StarterPairs: types.PathUrlPairMap{"fk": &types.PathUrlPair{Path: "fk", Url: "https://local.com"}},
+	}
+	mm, err := mapper.NewMapperManager(local.Name, append(mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{local}), remote))
+	require.NoError(t, err)
+	defer mm.Teardown()
+
+	got, err := mm.GetUrl(ctx, "fk", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://local.com", got.Url)
+	got, err = mm.GetUrl(ctx, "fk2", true)
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair2.Url, got.Url)
+	assert.Equal(t, "remote", got.Mapper)
+}
@@ -0,0 +1,93 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/orsinium-labs/enum"
+)
+
+// MapperSettings are applied by the manager to a mapper regardless of its type.
+// They are configured next to the type-specific fields of each mapper in the config file.
+type MapperSettings struct {
+	RequestTimeout int             `mapstructure:"requestTimeout"` // in milliseconds; 0 means bounded only by the caller
+	OnError        string          `mapstructure:"onError"`        // fail, skip or stale; defaults to fail
+	Breaker        BreakerSettings `mapstructure:"breaker"`
+}
+
+type BreakerSettings struct {
+	Failures int `mapstructure:"failures"` // consecutive failures before the mapper is bypassed; 0 disables the breaker
+	Cooldown int `mapstructure:"cooldown"` // in seconds
+}
+
+// FailurePolicy decides what a lookup does when a mapper fails.
+type FailurePolicy enum.Member[string]
+
+var (
+	// FailurePolicy_FailFast aborts the whole lookup with the mapper's error.
+	FailurePolicy_FailFast = FailurePolicy{"fail"}
+	// FailurePolicy_Skip moves on to the next mapper and flags the result as incomplete.
+	FailurePolicy_Skip = FailurePolicy{"skip"}
+	// FailurePolicy_Stale answers with the last successful result from the mapper if there is one, and skips it otherwise.
+	FailurePolicy_Stale = FailurePolicy{"stale"}
+
+	failurePolicies = enum.New(FailurePolicy_FailFast, FailurePolicy_Skip, FailurePolicy_Stale)
+)
+
+const defaultBreakerCooldown = 30 * time.Second
+
+// mapperState holds what the manager keeps per mapper on top of the mapper itself.
+type mapperState struct {
+	settings MapperSettings
+	policy   FailurePolicy
+	breaker  *circuitBreaker
+	stale    *staleStore
+}
+
+func newMapperState(settings MapperSettings) (*mapperState, error) {
+	if settings.RequestTimeout < 0 {
+		return nil, fmt.Errorf("negative request timeout")
+	}
+	policy := FailurePolicy_FailFast
+	if settings.OnError != "" {
+		parsed := failurePolicies.Parse(strings.ToLower(settings.OnError))
+		if parsed == nil {
+			return nil, fmt.Errorf("unknown failure policy %q, expected one of %v", settings.OnError, failurePolicies.Values())
+		}
+		policy = *parsed
+	}
+	if settings.Breaker.Failures < 0 || settings.Breaker.Cooldown < 0 {
+		return nil, fmt.Errorf("negative breaker settings")
+	}
+	cooldown := defaultBreakerCooldown
+	if settings.Breaker.Cooldown > 0 {
+		cooldown = time.Duration(settings.Breaker.Cooldown) * time.Second
+	}
+	state := &mapperState{
+		settings: settings,
+		policy:   policy,
+		breaker:  newCircuitBreaker(settings.Breaker.Failures, cooldown),
+	}
+	if policy == FailurePolicy_Stale {
+		state.stale = newStaleStore(defaultStaleCapacity)
+	}
+	return state, nil
+}
+
+type ManagerOption func(*MapperManager) error
+
+// WithMapperSettings attaches settings to the mapper with the given name.
+func WithMapperSettings(name string, settings MapperSettings) ManagerOption {
+	return func(m *MapperManager) error {
+		if findMapper(m.mappers, name) == nil {
+			return ErrMapConfigSetup(fmt.Sprintf("settings given for unknown mapper: %s", name))
+		}
+		state, err := newMapperState(settings)
+		if err != nil {
+			return ErrMapConfigSetup(fmt.Sprintf("invalid settings for mapper %s: %v", name, err))
+		}
+		m.states[name] = state
+		return nil
+	}
+}
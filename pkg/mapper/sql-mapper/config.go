@@ -1,7 +1,10 @@
 package sql_mapper
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -9,19 +12,35 @@ import (
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 
+	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
 const (
 	SqlMapperConfigType = "SQL"
+	defaultTable        = "path_url_pairs" // the name AutoMigrate used to give the table
 )
 
-var _ types.MapperConfigurer = (*SqlMapperConfig)(nil)
+var (
+	_ types.MapperConfigurer = (*SqlMapperConfig)(nil)
+
+	identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func init() {
+	mapper.Register(SqlMapperConfigType, func() types.MapperConfigurer { return &SqlMapperConfig{} })
+}
 
 type SqlMapperConfig struct {
-	Name   string `mapstructure:"name"`
-	Driver string `mapstructure:"driver"`
-	DSN    string `mapstructure:"dsn"`
+	Name            string   `mapstructure:"name"`
+	Driver          string   `mapstructure:"driver"`
+	DSN             string   `mapstructure:"dsn"`
+	Replicas        []string `mapstructure:"replicas"`        // dsns of read replicas, serving GetUrl and ListUrls in turn
+	Table           string   `mapstructure:"table"`           // path_url_pairs by default
+	Schema          string   `mapstructure:"schema"`          // the default schema of the connection by default
+	MaxOpenConns    int      `mapstructure:"maxOpenConns"`    // per pool, unlimited by default
+	MaxIdleConns    int      `mapstructure:"maxIdleConns"`    // per pool, 2 by default
+	ConnMaxLifetime int      `mapstructure:"connMaxLifetime"` // in seconds, unlimited by default
 }
 
 func (m *SqlMapperConfig) GetName() string {
@@ -33,31 +52,85 @@ func (m *SqlMapperConfig) GetType() string {
 }
 
 func (m *SqlMapperConfig) GetMapper() (types.Mapper, error) {
-	var db *gorm.DB
-	var err error
+	table, err := m.qualify(m.Table, defaultTable)
+	if err != nil {
+		return nil, err
+	}
+	schemaTable, err := m.qualify(schemaTableName, schemaTableName)
+	if err != nil {
+		return nil, err
+	}
+	db, err := m.open(m.DSN)
+	if err != nil {
+		return nil, err
+	}
+	mapper := &SqlMapper{name: m.Name, table: table, aliasTable: aliasTableOf(table), checkTable: checkTableOf(table), db: db}
+	for _, dsn := range m.Replicas {
+		replica, err := m.open(dsn)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to open replica of sql mapper %s: %w", m.Name, err), mapper.Teardown())
+		}
+		mapper.replicas = append(mapper.replicas, replica)
+	}
+	if err := migrate(db, schemaTable, table); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to migrate sql mapper %s: %w", m.Name, err), mapper.Teardown())
+	}
+	return mapper, nil
+}
+
+func (m *SqlMapperConfig) Singleton() bool {
+	return false
+}
+
+// qualify prefixes table with the configured schema. Names are checked, as they end up in DDL statements.
+func (m *SqlMapperConfig) qualify(table string, fallback string) (string, error) {
+	if table == "" {
+		table = fallback
+	}
+	if !identifier.MatchString(table) {
+		return "", fmt.Errorf("invalid table name for sql mapper %s: %q", m.Name, table)
+	}
+	if m.Schema == "" {
+		return table, nil
+	}
+	if !identifier.MatchString(m.Schema) {
+		return "", fmt.Errorf("invalid schema name for sql mapper %s: %q", m.Name, m.Schema)
+	}
+	return m.Schema + "." + table, nil
+}
+
+// open connects to dsn with its own connection pool, sized by the configuration.
+func (m *SqlMapperConfig) open(dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
 	switch m.Driver {
 	case "sqlite3":
-		db, err = gorm.Open(sqlite.Open(m.DSN), &gorm.Config{})
+		dialector = sqlite.Open(dsn)
 	case "mysql":
-		db, err = gorm.Open(mysql.Open(m.DSN), &gorm.Config{})
+		dialector = mysql.Open(dsn)
 	case "postgres":
 		// disable prepared statement cache, otherwise auto-migration fails on the second run forward for some reason
-		db, err = gorm.Open(postgres.New(postgres.Config{DSN: m.DSN, PreferSimpleProtocol: true}), &gorm.Config{})
+		dialector = postgres.New(postgres.Config{DSN: dsn, PreferSimpleProtocol: true})
 	case "sqlserver":
-		db, err = gorm.Open(sqlserver.Open(m.DSN), &gorm.Config{})
+		dialector = sqlserver.Open(dsn)
 	default:
 		return nil, fmt.Errorf("unsupported driver: %s", m.Driver)
 	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
-	err = db.AutoMigrate(&types.PathUrlPair{})
+	pool, err := db.DB()
 	if err != nil {
 		return nil, err
 	}
-	return &SqlMapper{name: m.Name, db: db}, nil
-}
-
-func (m *SqlMapperConfig) Singleton() bool {
-	return false
+	if m.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(m.MaxOpenConns)
+	}
+	if m.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(m.MaxIdleConns)
+	}
+	if m.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(time.Duration(m.ConnMaxLifetime) * time.Second)
+	}
+	return db, nil
 }
@@ -1,17 +1,34 @@
 package sql_mapper
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/reimirno/golinks/pkg/types"
 )
 
+// SqlMapper keeps its links in a table of a SQL database, and their aliases and the checks of their urls
+// in two more tables next to it.
+// Reads are spread over the replicas if there are any, which may lag behind the primary.
 type SqlMapper struct {
-	name string
-	db   *gorm.DB
+	name       string
+	table      string // qualified with the schema, if any
+	aliasTable string
+	checkTable string
+	db         *gorm.DB
+	replicas   []*gorm.DB
+	next       atomic.Uint32 // replica serving the next read
 }
 
-var _ types.Mapper = (*SqlMapper)(nil)
+var (
+	_ types.Mapper           = (*SqlMapper)(nil)
+	_ types.MapperPinger     = (*SqlMapper)(nil)
+	_ types.MapperLinkChecks = (*SqlMapper)(nil)
+)
 
 func (m *SqlMapper) GetName() string {
 	return m.name
@@ -21,13 +38,83 @@ func (m *SqlMapper) GetType() string {
 	return SqlMapperConfigType
 }
 
+// Teardown closes the connection pools of the mapper. Other mappers on the same database have pools of their own.
 func (m *SqlMapper) Teardown() error {
-	return nil
+	var errs []error
+	for _, db := range append([]*gorm.DB{m.db}, m.replicas...) {
+		pool, err := db.DB()
+		if err == nil {
+			err = pool.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Ping fails if the primary or any replica cannot be reached.
+func (m *SqlMapper) Ping(ctx context.Context) error {
+	var errs []error
+	for _, db := range append([]*gorm.DB{m.db}, m.replicas...) {
+		pool, err := db.DB()
+		if err == nil {
+			err = pool.PingContext(ctx)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *SqlMapper) writer(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(ctx).Table(m.table)
+}
+
+func (m *SqlMapper) reader(ctx context.Context) *gorm.DB {
+	return m.replica(ctx).Table(m.table)
+}
+
+// replica is the database serving the next read, without a table.
+func (m *SqlMapper) replica(ctx context.Context) *gorm.DB {
+	if len(m.replicas) == 0 {
+		return m.db.WithContext(ctx)
+	}
+	return m.replicas[m.next.Add(1)%uint32(len(m.replicas))].WithContext(ctx)
+}
+
+// aliasRow is a row of the alias table: an alias, and the path of its pair.
+type aliasRow struct {
+	Alias string
+	Path  string
+}
+
+func aliasTableOf(table string) string {
+	return table + "_aliases"
+}
+
+func checkTableOf(table string) string {
+	return table + "_checks"
+}
+
+// GetUrl reads the pair, or else its alias then the pair, from the same replica.
+func (m *SqlMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
+	db := m.replica(ctx)
+	pair, err := take(db.Table(m.table), path)
+	if err != nil || pair != nil {
+		return pair, err
+	}
+	var alias aliasRow
+	err = db.Table(m.aliasTable).Where(&aliasRow{Alias: path}).Take(&alias).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return take(db.Table(m.table), alias.Path)
 }
 
-func (m *SqlMapper) GetUrl(path string) (*types.PathUrlPair, error) {
+func take(db *gorm.DB, path string) (*types.PathUrlPair, error) {
 	var pair types.PathUrlPair
-	err := m.db.Where("path = ?", path).Take(&pair).Error
+	err := db.Where("path = ?", path).Take(&pair).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
@@ -37,25 +124,61 @@ func (m *SqlMapper) GetUrl(path string) (*types.PathUrlPair, error) {
 	return &pair, nil
 }
 
-func (m *SqlMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
-	err := m.db.Save(pair).Error
+// PutUrl saves pair and replaces the aliases of the pair it replaces with its own, in one transaction.
+func (m *SqlMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.table).Save(pair).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(m.aliasTable).Where(&aliasRow{Path: pair.Path}).Delete(&aliasRow{}).Error; err != nil {
+			return err
+		}
+		if len(pair.Aliases) == 0 {
+			return nil
+		}
+		rows := make([]aliasRow, len(pair.Aliases))
+		for i, alias := range pair.Aliases {
+			rows[i] = aliasRow{Alias: alias, Path: pair.Path}
+		}
+		return tx.Table(m.aliasTable).Create(&rows).Error
+	})
 	if err != nil {
 		return nil, err
 	}
 	return pair, nil
 }
 
-func (m *SqlMapper) DeleteUrl(path string) error {
-	err := m.db.Where("path = ?", path).Delete(&types.PathUrlPair{}).Error
-	if err != nil {
-		return err
-	}
-	return nil
+// DeleteUrl deletes the pair at path along with its aliases, in one transaction.
+func (m *SqlMapper) DeleteUrl(ctx context.Context, path string) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.aliasTable).Where(&aliasRow{Path: path}).Delete(&aliasRow{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.table).Where("path = ?", path).Delete(&types.PathUrlPair{}).Error
+	})
 }
 
-func (m *SqlMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
+// ListUrls pages by primary key: after the cursor if there is one, which uses the index,
+// at the offset otherwise, which the database has to count through.
+// Paths are ordered bytewise, as the manager expects of every mapper (see binaryPathCollation);
+// SQL Server, whose column keeps its collation, is asked for that order, at the cost of the index.
+func (m *SqlMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
+	after, err := pagination.After()
+	if err != nil {
+		return nil, err
+	}
+	path := "path"
+	if m.db.Dialector.Name() == "sqlserver" {
+		path = "path COLLATE Latin1_General_BIN2"
+	}
+	query := m.reader(ctx).Order(path).Limit(pagination.Limit)
+	if after != "" {
+		query = query.Where(path+" > ?", after)
+	} else {
+		query = query.Offset(pagination.Offset)
+	}
 	var pairs types.PathUrlPairList
-	err := m.db.Offset(pagination.Offset).Limit(pagination.Limit).Find(&pairs).Error
+	err = query.Find(&pairs).Error
 	if err != nil {
 		return nil, err
 	}
@@ -65,3 +188,27 @@ func (m *SqlMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList
 func (m *SqlMapper) Readonly() bool {
 	return false
 }
+
+// PutLinkChecks replaces the checks of the same paths, on the primary.
+func (m *SqlMapper) PutLinkChecks(ctx context.Context, checks []types.LinkCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	return m.db.WithContext(ctx).Table(m.checkTable).Clauses(clause.OnConflict{UpdateAll: true}).Create(&checks).Error
+}
+
+// ListLinkChecks reads the checks from the primary, so that they are the ones the last run saved.
+func (m *SqlMapper) ListLinkChecks(ctx context.Context) ([]types.LinkCheck, error) {
+	var checks []types.LinkCheck
+	if err := m.db.WithContext(ctx).Table(m.checkTable).Find(&checks).Error; err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+func (m *SqlMapper) DeleteLinkChecks(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return m.db.WithContext(ctx).Table(m.checkTable).Where("path IN ?", paths).Delete(&types.LinkCheck{}).Error
+}
@@ -0,0 +1,306 @@
+package sql_mapper
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+var fakePair = &types.PathUrlPair{
+	Path: "/fk",
+	Url:  "https://fake.com",
+}
+
+func newTestMapper(t *testing.T, config *SqlMapperConfig) *SqlMapper {
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Teardown() })
+	return m.(*SqlMapper)
+}
+
+func openTestDB(t *testing.T, dsn string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		pool, _ := db.DB()
+		pool.Close()
+	})
+	return db
+}
+
+func appliedVersions(t *testing.T, db *gorm.DB, table string) []int {
+	var versions []int
+	err := db.Table(schemaTableName).Where("links_table = ?", table).Order("version").Pluck("version", &versions).Error
+	require.NoError(t, err)
+	return versions
+}
+
+func TestSqlMapper_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "links.db")})
+
+	_, err := m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+
+	pairs, err := m.ListUrls(ctx, types.Pagination{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 1)
+
+	assert.NoError(t, m.DeleteUrl(ctx, fakePair.Path))
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestSqlMapper_Aliases(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "links.db")})
+
+	_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}})
+	assert.NoError(t, err)
+	got, err := m.GetUrl(ctx, "/kube")
+	assert.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "/kubernetes", got.Path)
+	assert.Equal(t, []string{"/k8s", "/kube"}, got.Aliases)
+
+	// the aliases the pair no longer has are dropped
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s"}})
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, "/kube")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	// an alias is unique
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: "/k3s", Url: "https://k3s.io", Aliases: []string{"/k8s"}})
+	assert.Error(t, err)
+	got, err = m.GetUrl(ctx, "/k3s")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	// and goes with its pair
+	assert.NoError(t, m.DeleteUrl(ctx, "/kubernetes"))
+	got, err = m.GetUrl(ctx, "/k8s")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestSqlMapper_ListUrlsOrder(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "links.db")})
+	paths := []string{"/b", "/B", "/a/b", "/a-b", "/a", "/A/z", "/a_b", "/a.b", "/~alice/x", "/Z", "/a/B"}
+	for _, path := range paths {
+		_, err := m.PutUrl(ctx, &types.PathUrlPair{Path: path, Url: "https://fake.com"})
+		require.NoError(t, err)
+	}
+	want := slices.Clone(paths)
+	slices.Sort(want)
+
+	// paged by cursor, in the order of Go strings
+	var got []string
+	pagination := types.Pagination{Limit: 3}
+	for {
+		pairs, err := m.ListUrls(ctx, pagination)
+		require.NoError(t, err)
+		for _, pair := range pairs {
+			got = append(got, pair.Path)
+		}
+		cursor := utils.NextCursor(pairs, pagination)
+		if cursor == "" {
+			break
+		}
+		pagination.Cursor = cursor
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestBinaryPathCollation(t *testing.T) {
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{dialect: "mysql", want: "ALTER TABLE links.pairs MODIFY path VARCHAR(191) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL"},
+		{dialect: "postgres", want: `ALTER TABLE links.pairs ALTER COLUMN path TYPE text COLLATE "C"`},
+		{dialect: "sqlite"},
+		{dialect: "sqlserver"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dialect, func(t *testing.T) {
+			assert.Equal(t, test.want, binaryPathCollation(test.dialect, "links.pairs"))
+		})
+	}
+}
+
+func TestSqlMapper_LinkChecks(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "links.db")})
+	checkedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	broken := types.LinkCheck{Path: "/fk", Mapper: "sql", Status: types.LinkStatusBroken, CheckedAt: checkedAt,
+		Url: fakePair.Url, StatusCode: 404, Reason: "404 Not Found"}
+	ok := types.LinkCheck{Path: "/fk2", Mapper: "sql", Status: types.LinkStatusOk, CheckedAt: checkedAt}
+
+	assert.NoError(t, m.PutLinkChecks(ctx, []types.LinkCheck{broken, ok}))
+	checks, err := m.ListLinkChecks(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.LinkCheck{broken, ok}, checks)
+
+	// checks replace those of the same paths
+	broken.Status, broken.StatusCode, broken.Reason = types.LinkStatusOk, 0, ""
+	assert.NoError(t, m.PutLinkChecks(ctx, []types.LinkCheck{broken}))
+	assert.NoError(t, m.DeleteLinkChecks(ctx, ok.Path, "/missing"))
+	checks, err = m.ListLinkChecks(ctx)
+	assert.NoError(t, err)
+	require.Len(t, checks, 1)
+	assert.Equal(t, broken.Status, checks[0].Status)
+	assert.Equal(t, broken.Reason, checks[0].Reason)
+	assert.True(t, checkedAt.Equal(checks[0].CheckedAt))
+}
+
+func TestSqlMapper_Migrations(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "links.db")
+	latest := migrations[len(migrations)-1].version
+	all := make([]int, 0, len(migrations))
+	for _, m := range migrations {
+		all = append(all, m.version)
+	}
+
+	// two mappers keep their links apart in one database
+	team := newTestMapper(t, &SqlMapperConfig{Name: "team", Driver: "sqlite3", DSN: dsn, Table: "team_links"})
+	other := newTestMapper(t, &SqlMapperConfig{Name: "other", Driver: "sqlite3", DSN: dsn, Table: "other_links"})
+	_, err := team.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+	got, err := other.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	db := openTestDB(t, dsn)
+	assert.True(t, db.Migrator().HasTable("team_links"))
+	assert.True(t, db.Migrator().HasTable("team_links_aliases"))
+	assert.True(t, db.Migrator().HasTable("team_links_checks"))
+	assert.Equal(t, all, appliedVersions(t, db, "team_links"))
+	assert.Equal(t, all, appliedVersions(t, db, "other_links"))
+
+	// migrations already applied are not applied again
+	_ = newTestMapper(t, &SqlMapperConfig{Name: "team", Driver: "sqlite3", DSN: dsn, Table: "team_links"})
+	assert.Equal(t, all, appliedVersions(t, db, "team_links"))
+	got, err = team.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+
+	// a table migrated by a newer golinks is refused
+	err = db.Table(schemaTableName).Create(&schemaMigration{LinksTable: "other_links", Version: latest + 1}).Error
+	require.NoError(t, err)
+	_, err = (&SqlMapperConfig{Name: "other", Driver: "sqlite3", DSN: dsn, Table: "other_links"}).GetMapper()
+	assert.Error(t, err)
+}
+
+func TestSqlMapper_AdoptsAutoMigratedTable(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "links.db")
+	db := openTestDB(t, dsn)
+	// what AutoMigrate made of PathUrlPair before it had times
+	type pathUrlPair struct {
+		Path     string `gorm:"primaryKey"`
+		Url      string `gorm:"not null"`
+		UseCount int    `gorm:"not null;default:0"`
+	}
+	require.NoError(t, db.AutoMigrate(&pathUrlPair{}))
+	require.NoError(t, db.Create(&pathUrlPair{Path: fakePair.Path, Url: fakePair.Url}).Error)
+
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: dsn})
+	got, err := m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, fakePair.Url, got.Url)
+	assert.Nil(t, got.ExpiresAt)
+	assert.Len(t, appliedVersions(t, db, defaultTable), len(migrations))
+
+	// the times and rules were added to the adopted table
+	expiresAt := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	rules := []types.RedirectRule{{Url: "https://fake.com/de", Headers: map[string]string{"Accept-Language": "de*"}}}
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, ExpiresAt: &expiresAt, Rules: rules})
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+	assert.Equal(t, rules, got.Rules)
+
+	// and so were the targets, with their use counts
+	targets := []types.WeightedTarget{{Url: "https://a.com", Weight: 9, UseCount: 3}, {Url: "https://b.com", Weight: 1}}
+	_, err = m.PutUrl(ctx, &types.PathUrlPair{Path: fakePair.Path, Url: fakePair.Url, Targets: targets, Sticky: types.StickyCookie})
+	assert.NoError(t, err)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, targets, got.Targets)
+	assert.Equal(t, types.StickyCookie, got.Sticky)
+}
+
+func TestSqlMapper_Replicas(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "primary.db")
+	replica := filepath.Join(dir, "replica.db")
+	// the replica is not replicated here: it only has the schema and what the test writes to it
+	replicaDB := openTestDB(t, replica)
+	require.NoError(t, migrate(replicaDB, schemaTableName, defaultTable))
+	require.NoError(t, replicaDB.Table(defaultTable).Create(&types.PathUrlPair{Path: "/replicated", Url: "https://replicated.com"}).Error)
+
+	m := newTestMapper(t, &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: primary, Replicas: []string{replica}})
+	_, err := m.PutUrl(ctx, fakePair.Clone())
+	assert.NoError(t, err)
+
+	// reads go to the replica, writes to the primary
+	got, err := m.GetUrl(ctx, "/replicated")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+	got, err = m.GetUrl(ctx, fakePair.Path)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	assert.NoError(t, m.DeleteUrl(ctx, "/replicated"))
+	got, err = m.GetUrl(ctx, "/replicated")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+}
+
+func TestSqlMapper_Teardown(t *testing.T) {
+	ctx := context.Background()
+	config := &SqlMapperConfig{Name: "sql", Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "links.db"), MaxOpenConns: 2}
+	m, err := config.GetMapper()
+	require.NoError(t, err)
+	assert.NoError(t, m.(*SqlMapper).Ping(ctx))
+
+	assert.NoError(t, m.Teardown())
+	assert.Error(t, m.(*SqlMapper).Ping(ctx))
+}
+
+func TestSqlMapperConfig_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *SqlMapperConfig
+	}{
+		{name: "unsupported driver", config: &SqlMapperConfig{Name: "sql", Driver: "oracle"}},
+		{name: "invalid table", config: &SqlMapperConfig{Name: "sql", Driver: "sqlite3", Table: "links; drop table x"}},
+		{name: "invalid schema", config: &SqlMapperConfig{Name: "sql", Driver: "sqlite3", Schema: "a.b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.DSN = filepath.Join(t.TempDir(), "links.db")
+			_, err := test.config.GetMapper()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package sql_mapper
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaTableName records the migrations applied to every links table of the database,
+// so that several sql mappers can keep their tables in one database.
+const schemaTableName = "golinks_schema_migrations"
+
+type schemaMigration struct {
+	LinksTable string `gorm:"primaryKey;size:191"`
+	Version    int    `gorm:"primaryKey;autoIncrement:false"`
+	AppliedAt  time.Time
+}
+
+type migration struct {
+	version     int
+	description string
+	up          func(tx *gorm.DB) error // tx is scoped to the links table
+}
+
+// migrations are applied in order, once per links table. Each one describes the columns it deals with
+// in a struct of its own, since the current one would not be what the migration was written against.
+// Never edit a migration once released; add a new one.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create the links table",
+		up: func(tx *gorm.DB) error {
+			// without a size, MySQL makes Path a longtext, which cannot be a primary key,
+			// so no table was ever created there without it
+			type pair struct {
+				Path     string `gorm:"primaryKey;size:191"`
+				Url      string `gorm:"not null"`
+				UseCount int    `gorm:"not null;default:0"`
+			}
+			// tables created by AutoMigrate before migrations were versioned are adopted as they are
+			if tx.Migrator().HasTable(&pair{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&pair{})
+		},
+	},
+	{
+		version:     2,
+		description: "add activation and expiry times",
+		up: func(tx *gorm.DB) error {
+			type pair struct {
+				ActiveFrom *time.Time
+				ExpiresAt  *time.Time
+			}
+			for _, column := range []string{"ActiveFrom", "ExpiresAt"} {
+				if tx.Migrator().HasColumn(&pair{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&pair{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     3,
+		description: "add redirect rules",
+		up: func(tx *gorm.DB) error {
+			type pair struct {
+				Rules string `gorm:"type:text"` // json
+			}
+			if tx.Migrator().HasColumn(&pair{}, "Rules") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&pair{}, "Rules")
+		},
+	},
+	{
+		version:     4,
+		description: "add weighted targets",
+		up: func(tx *gorm.DB) error {
+			type pair struct {
+				Targets string `gorm:"type:text"` // json, with the use count of every target
+				Sticky  string
+			}
+			for _, column := range []string{"Targets", "Sticky"} {
+				if tx.Migrator().HasColumn(&pair{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&pair{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     5,
+		description: "add aliases",
+		up: func(tx *gorm.DB) error {
+			type pair struct {
+				Aliases string `gorm:"type:text"` // json
+			}
+			if !tx.Migrator().HasColumn(&pair{}, "Aliases") {
+				if err := tx.Migrator().AddColumn(&pair{}, "Aliases"); err != nil {
+					return err
+				}
+			}
+			// the aliases of the pairs are indexed in a table of their own, which keeps them unique;
+			// it is only looked up by path when a pair is written, so it has no index on path
+			type alias struct {
+				Alias string `gorm:"primaryKey;size:191"`
+				Path  string `gorm:"not null;size:191"`
+			}
+			aliases := tx.Table(aliasTableOf(tx.Statement.Table))
+			if aliases.Migrator().HasTable(&alias{}) {
+				return nil
+			}
+			return aliases.Migrator().CreateTable(&alias{})
+		},
+	},
+	{
+		version:     6,
+		description: "add link checks",
+		up: func(tx *gorm.DB) error {
+			type check struct {
+				Path       string `gorm:"primaryKey;size:191"`
+				Mapper     string
+				Status     string `gorm:"not null"`
+				CheckedAt  time.Time
+				Url        string `gorm:"type:text"`
+				StatusCode int
+				Reason     string `gorm:"type:text"`
+			}
+			checks := tx.Table(checkTableOf(tx.Statement.Table))
+			if checks.Migrator().HasTable(&check{}) {
+				return nil
+			}
+			return checks.Migrator().CreateTable(&check{})
+		},
+	},
+	{
+		version:     7,
+		description: "order paths bytewise",
+		up: func(tx *gorm.DB) error {
+			statement := binaryPathCollation(tx.Dialector.Name(), tx.Statement.Table)
+			if statement == "" {
+				return nil
+			}
+			return tx.Exec(statement).Error
+		},
+	},
+}
+
+// binaryPathCollation returns the statement that makes the path column of table compare bytewise, like Go strings,
+// so that the pages listed by path follow on from one another wherever the manager resumes them.
+// The default collations of MySQL ignore case, and the locale collations of Postgres skip punctuation.
+// SQLite compares bytewise already, and SQL Server cannot alter a primary key column in place (see SqlMapper.ListUrls).
+func binaryPathCollation(dialect string, table string) string {
+	switch dialect {
+	case "mysql":
+		return fmt.Sprintf("ALTER TABLE %s MODIFY path VARCHAR(191) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL", table)
+	case "postgres":
+		return fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN path TYPE text COLLATE "C"`, table)
+	default:
+		return ""
+	}
+}
+
+// migrate brings table up to the latest version, applying each missing migration in a transaction
+// along with its record in schemaTable.
+func migrate(db *gorm.DB, schemaTable string, table string) error {
+	if err := db.Table(schemaTable).AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	var applied []int
+	err := db.Table(schemaTable).Where("links_table = ?", table).Pluck("version", &applied).Error
+	if err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	latest := migrations[len(migrations)-1].version
+	for _, version := range applied {
+		if version > latest {
+			return fmt.Errorf("table %s is at schema version %d, newer than the latest known version %d", table, version, latest)
+		}
+		done[version] = true
+	}
+	for _, m := range migrations {
+		if done[m.version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx.Table(table)); err != nil {
+				return err
+			}
+			return tx.Table(schemaTable).Create(&schemaMigration{LinksTable: table, Version: m.version, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) of table %s failed: %w", m.version, m.description, table, err)
+		}
+	}
+	return nil
+}
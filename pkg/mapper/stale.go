@@ -0,0 +1,74 @@
+package mapper
+
+import (
+	"sync"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const defaultStaleCapacity = 10000
+
+// staleStore remembers the last successful answers of a mapper,
+// so that they can be served while the mapper is failing.
+// When full, an arbitrary entry is dropped to make room.
+type staleStore struct {
+	mu       sync.Mutex
+	capacity int
+	pairs    map[string]*types.PathUrlPair
+	lists    map[types.Pagination]types.PathUrlPairList
+}
+
+func newStaleStore(capacity int) *staleStore {
+	return &staleStore{
+		capacity: capacity,
+		pairs:    make(map[string]*types.PathUrlPair),
+		lists:    make(map[types.Pagination]types.PathUrlPairList),
+	}
+}
+
+func (s *staleStore) putPair(path string, pair *types.PathUrlPair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pair == nil {
+		delete(s.pairs, path)
+		return
+	}
+	if _, ok := s.pairs[path]; !ok && len(s.pairs) >= s.capacity {
+		for k := range s.pairs {
+			delete(s.pairs, k)
+			break
+		}
+	}
+	s.pairs[path] = pair.Clone()
+}
+
+func (s *staleStore) getPair(path string) *types.PathUrlPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pair, ok := s.pairs[path]; ok {
+		return pair.Clone()
+	}
+	return nil
+}
+
+func (s *staleStore) putList(pagination types.Pagination, pairs types.PathUrlPairList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lists[pagination]; !ok && len(s.lists) >= s.capacity {
+		for k := range s.lists {
+			delete(s.lists, k)
+			break
+		}
+	}
+	s.lists[pagination] = *pairs.Clone()
+}
+
+func (s *staleStore) getList(pagination types.Pagination) (types.PathUrlPairList, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pairs, ok := s.lists[pagination]
+	if !ok {
+		return nil, false
+	}
+	return *pairs.Clone(), true
+}
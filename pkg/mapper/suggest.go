@@ -0,0 +1,282 @@
+package mapper
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 100
+)
+
+// Suggestion is a keyword that a prefix may be completed to, with the pair that it resolves to.
+type Suggestion struct {
+	Keyword  string     `json:"keyword"` // the path or alias to type, without the namespace it is looked up in by default
+	Path     string     `json:"path"`
+	Url      string     `json:"url"`
+	UseCount int        `json:"useCount"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"` // redirected to, since the manager started
+}
+
+// suggestIndex keeps the paths and aliases of the pairs of every mapper in order, so that those that start with
+// a prefix are found without listing the mappers. Patterns are left out, as nobody types them as they are.
+// It is loaded along with the patterns, and kept up to date by the writes through the manager,
+// by the reloads of the mappers that reload their own source, and by its own refresh (see WithSuggestRefresh).
+type suggestIndex struct {
+	mu      sync.RWMutex
+	entries map[string][]suggestEntry // by mapper name, in key order; never modified in place
+	usedAt  map[string]time.Time      // by path
+}
+
+// suggestEntry is the path or an alias of a pair.
+type suggestEntry struct {
+	key  string
+	pair *types.PathUrlPair
+}
+
+func newSuggestIndex() *suggestIndex {
+	return &suggestIndex{entries: make(map[string][]suggestEntry), usedAt: make(map[string]time.Time)}
+}
+
+func compareKey(entry suggestEntry, key string) int {
+	return cmp.Compare(entry.key, key)
+}
+
+// entriesOf returns the entries of pair, under its path and every alias.
+func entriesOf(pair *types.PathUrlPair) []suggestEntry {
+	entries := make([]suggestEntry, 0, 1+len(pair.Aliases))
+	entries = append(entries, suggestEntry{key: pair.Path, pair: pair})
+	for _, alias := range pair.Aliases {
+		entries = append(entries, suggestEntry{key: alias, pair: pair})
+	}
+	return entries
+}
+
+// set replaces the pairs of mapper with those of pairs.
+func (s *suggestIndex) set(mapper string, pairs types.PathUrlPairMap) {
+	indexed := make([]suggestEntry, 0, len(pairs))
+	for path, pair := range pairs {
+		if !patterns.IsPattern(path) {
+			indexed = append(indexed, entriesOf(pair.Clone())...)
+		}
+	}
+	slices.SortFunc(indexed, func(a, b suggestEntry) int { return cmp.Compare(a.key, b.key) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[mapper] = indexed
+}
+
+func (s *suggestIndex) put(mapper string, pair *types.PathUrlPair) {
+	if patterns.IsPattern(pair.Path) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexed := unindex(s.entries[mapper], pair.Path)
+	for _, entry := range entriesOf(pair.Clone()) {
+		i, found := slices.BinarySearchFunc(indexed, entry.key, compareKey)
+		if found {
+			indexed[i] = entry
+		} else {
+			indexed = slices.Insert(indexed, i, entry)
+		}
+	}
+	s.entries[mapper] = indexed
+}
+
+func (s *suggestIndex) delete(mapper string, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[mapper] = unindex(s.entries[mapper], path)
+}
+
+// unindex returns a copy of indexed without the entries of the pair at path.
+func unindex(indexed []suggestEntry, path string) []suggestEntry {
+	indexed = slices.Clone(indexed)
+	i, found := slices.BinarySearchFunc(indexed, path, compareKey)
+	if !found || indexed[i].pair.Path != path {
+		return indexed
+	}
+	for _, entry := range entriesOf(indexed[i].pair) {
+		if i, found := slices.BinarySearchFunc(indexed, entry.key, compareKey); found && indexed[i].pair.Path == path {
+			indexed = slices.Delete(indexed, i, i+1)
+		}
+	}
+	return indexed
+}
+
+// used records that the pair at path was just redirected to.
+func (s *suggestIndex) used(path string) {
+	if patterns.IsPattern(path) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usedAt[path] = time.Now()
+}
+
+// prefixed returns the distinct paths and aliases of every mapper that start with prefix, in order.
+func (s *suggestIndex) prefixed(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for _, indexed := range s.entries {
+		i, _ := slices.BinarySearchFunc(indexed, prefix, compareKey)
+		for ; i < len(indexed) && strings.HasPrefix(indexed[i].key, prefix); i++ {
+			keys = append(keys, indexed[i].key)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// get returns the pair that key is the path or an alias of, in the first of mappers that has one, or nil,
+// with the last time it was used.
+func (s *suggestIndex) get(mappers []types.Mapper, key string) (*types.PathUrlPair, *time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, mapper := range mappers {
+		indexed := s.entries[mapper.GetName()]
+		if i, found := slices.BinarySearchFunc(indexed, key, compareKey); found {
+			pair := indexed[i].pair
+			if t, ok := s.usedAt[pair.Path]; ok {
+				return pair, &t
+			}
+			return pair, nil
+		}
+	}
+	return nil, nil
+}
+
+// WithSuggestRefresh reloads the index that Suggest reads every refresh interval if it is positive,
+// for the mappers that do not reload their own source: those that other servers may write to, such as a shared database.
+// It lists these mappers in full, so keep the interval long for large ones.
+func WithSuggestRefresh(refreshInterval time.Duration) ManagerOption {
+	return func(m *MapperManager) error {
+		if refreshInterval <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(refreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					m.loadSuggestIndex(ctx)
+				}
+			}
+		}()
+		m.stopSuggest = func() {
+			cancel()
+			wg.Wait()
+		}
+		return nil
+	}
+}
+
+// loadSuggestIndex lists the mappers that do not reload their own source for the index that Suggest reads.
+// A mapper that fails keeps the paths it had.
+func (m *MapperManager) loadSuggestIndex(ctx context.Context) {
+	for _, mapper := range m.mappers {
+		if _, ok := mapper.(types.MapperReloader); ok {
+			continue
+		}
+		pairs, err := m.listAll(ctx, mapper)
+		if err != nil {
+			m.logger.Warnf("Failed to load the suggestions of mapper %s: %v", mapper.GetName(), err)
+			continue
+		}
+		m.suggestIndex.set(mapper.GetName(), pairs)
+	}
+}
+
+// Suggest returns up to limit keywords that prefix may be completed to, the most used first, then the most recently used.
+// The keywords are what the actor of ctx would type, so that a path shadowed by one among their personal links
+// or in their default namespace is suggested as the latter. A pair is suggested once, under its path if the prefix
+// matches it, under a matching alias otherwise. Paths that do not redirect now, patterns,
+// and the pairs of the private namespaces that the actor is not a member of are left out.
+// The pairs are read from an index loaded along with the patterns (see WithPatterns and WithSuggestRefresh).
+func (m *MapperManager) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+	canonicalPrefix, err := m.ownPath(ctx, sanitizer.CanonicalizePrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := m.candidates(ctx, canonicalPrefix)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	suggestions := []Suggestion{}
+	keywords := make(map[string]bool)
+	paths := make(map[string]bool)
+	for _, candidate := range candidates {
+		// what the candidate adds to the prefix is left out of its keywords
+		added := strings.TrimSuffix(candidate, strings.TrimPrefix(canonicalPrefix, "/"))
+		for _, key := range m.suggestIndex.prefixed(candidate) {
+			keyword := strings.TrimPrefix(key, added)
+			if keywords[keyword] {
+				continue
+			}
+			ns := m.namespaceOf(key)
+			if m.authorize(ctx, ns, false) != nil {
+				continue
+			}
+			pair, usedAt := m.suggestIndex.get(m.mappersOf(ns), key)
+			if pair == nil || paths[pair.Path] || pair.State(now) != types.LinkState_Active {
+				continue
+			}
+			// an alias is only suggested when the path of its pair is not
+			if key != pair.Path && strings.HasPrefix(pair.Path, candidate) {
+				continue
+			}
+			keywords[keyword], paths[pair.Path] = true, true
+			suggestions = append(suggestions, Suggestion{Keyword: keyword, Path: pair.Path, Url: pair.Url, UseCount: pair.UseCount, LastUsed: usedAt})
+		}
+	}
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		if c := cmp.Compare(b.UseCount, a.UseCount); c != 0 {
+			return c
+		}
+		if c := compareLastUsed(b.LastUsed, a.LastUsed); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Keyword, b.Keyword)
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// compareLastUsed orders never used before anything else.
+func compareLastUsed(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	default:
+		return a.Compare(*b)
+	}
+}
@@ -0,0 +1,256 @@
+package mapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+func keywords(suggestions []Suggestion) []string {
+	out := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		out = append(out, suggestion.Keyword)
+	}
+	return out
+}
+
+// newSuggestingManager sets up a shared persistor and a team-a namespace of alice, with its own mapper,
+// and uses deploy 3 times, design then docs twice and team-a/deploy once.
+func newSuggestingManager(t *testing.T) *MapperManager {
+	shared := &MockMapperConfigurer{
+		Name: "shared",
+		StarterPairs: types.PathUrlPairMap{
+			"/docs":        {Path: "/docs", Url: "https://docs.com"},
+			"/deploy":      {Path: "/deploy", Url: "https://deploy.com"},
+			"/design":      {Path: "/design", Url: "https://design.com"},
+			"/dev/*":       {Path: "/dev/*", Url: "https://dev.com/$1"},
+			"/dead":        {Path: "/dead", Url: "https://dead.com", ExpiresAt: hoursFromNow(-1)},
+			"/secret/docs": {Path: "/secret/docs", Url: "https://secret.com/docs"},
+		},
+	}
+	teamA := &MockMapperConfigurer{
+		Name: "teama",
+		StarterPairs: types.PathUrlPairMap{
+			"/teama/deploy": {Path: "/teama/deploy", Url: "https://deploy.com/team-a"},
+			"/teama/dash":   {Path: "/teama/dash", Url: "https://dash.com/team-a"},
+		},
+	}
+	shadow := &MockMapperConfigurer{
+		Name: "shadow",
+		StarterPairs: types.PathUrlPairMap{
+			"/docs": {Path: "/docs", Url: "https://shadow.com"},
+		},
+	}
+	mm, err := NewMapperManager(shared.Name, CloneConfigurers([]*MockMapperConfigurer{shared, teamA, shadow}),
+		WithNamespaces([]NamespaceSettings{
+			{Name: "team-a", Mappers: []string{"teama"}, Persistor: "teama", Members: []string{"alice"}},
+			{Name: "secret", Members: []string{"bob"}, Private: true},
+		}),
+		WithPatterns(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	for path, uses := range map[string]int{"deploy": 3, "design": 2, "teama/deploy": 1} {
+		for i := 0; i < uses; i++ {
+			_, err := mm.GetUrl(context.Background(), path, true)
+			require.NoError(t, err)
+		}
+	}
+	// used last, so that it ranks before design
+	for i := 0; i < 2; i++ {
+		_, err := mm.GetUrl(context.Background(), "docs", true)
+		require.NoError(t, err)
+	}
+	return mm
+}
+
+func TestMapperManager_Suggest(t *testing.T) {
+	mm := newSuggestingManager(t)
+	anonymous := context.Background()
+	alice := utils.WithActor(anonymous, "alice")
+	bob := utils.WithActor(anonymous, "bob")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		prefix  string
+		limit   int
+		want    []string
+		wantErr bool
+	}{
+		{name: "ranked by use count then recency", ctx: anonymous, prefix: "d", want: []string{"deploy", "docs", "design"}},
+		{name: "limited", ctx: anonymous, prefix: "d", limit: 1, want: []string{"deploy"}},
+		{name: "canonicalized", ctx: anonymous, prefix: "De-", want: []string{}},
+		{name: "namespace", ctx: anonymous, prefix: "team-a/", want: []string{"teama/deploy", "teama/dash"}},
+		{name: "default namespace first", ctx: alice, prefix: "d", want: []string{"docs", "design", "deploy", "dash"}},
+		{name: "private namespace", ctx: bob, prefix: "secret/", want: []string{"secret/docs"}},
+		{name: "private namespace left out", ctx: anonymous, prefix: "secret/", want: []string{}},
+		{name: "private namespace should fail", ctx: anonymous, prefix: "secret/d", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suggestions, err := mm.Suggest(test.ctx, test.prefix, test.limit)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, keywords(suggestions))
+		})
+	}
+
+	suggestions, err := mm.Suggest(alice, "dep", 0)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "/teama/deploy", suggestions[0].Path, "the default namespace of alice shadows the shared path")
+	assert.Equal(t, "https://deploy.com/team-a", suggestions[0].Url)
+	assert.Equal(t, 1, suggestions[0].UseCount)
+	assert.NotNil(t, suggestions[0].LastUsed)
+	suggestions, err = mm.Suggest(anonymous, "doc", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://docs.com", suggestions[0].Url, "the first mapper wins")
+}
+
+func TestMapperManager_SuggestUpdates(t *testing.T) {
+	mm := newSuggestingManager(t)
+	ctx := context.Background()
+	alice := utils.WithActor(ctx, "alice")
+
+	_, err := mm.PutUrl(ctx, &types.PathUrlPair{Path: "diary", Url: "https://diary.com"})
+	require.NoError(t, err)
+	_, err = mm.PutUrl(alice, &types.PathUrlPair{Path: "~/docs", Url: "https://alice.com/docs"})
+	require.NoError(t, err)
+	require.NoError(t, mm.DeleteUrl(ctx, "design"))
+	suggestions, err := mm.Suggest(ctx, "d", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deploy", "docs", "diary"}, keywords(suggestions))
+
+	// used pairs rank first among equals
+	_, err = mm.GetUrl(ctx, "diary", true)
+	require.NoError(t, err)
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "dojo", Url: "https://dojo.com", UseCount: 1})
+	require.NoError(t, err)
+	suggestions, err = mm.Suggest(ctx, "di", 0)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, 1, suggestions[0].UseCount)
+	assert.NotNil(t, suggestions[0].LastUsed)
+	suggestions, err = mm.Suggest(ctx, "d", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deploy", "docs", "diary", "dojo"}, keywords(suggestions))
+
+	// personal links shadow the shared ones for their actor
+	suggestions, err = mm.Suggest(alice, "doc", 0)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "/~alice/docs", suggestions[0].Path)
+	_, err = mm.Suggest(ctx, "~/d", 0)
+	assert.Error(t, err)
+}
+
+func TestMapperManager_SuggestAliases(t *testing.T) {
+	ctx := context.Background()
+	readonly := &MockMapperConfigurer{
+		Name:       "readonly",
+		IsReadOnly: true,
+		StarterPairs: types.PathUrlPairMap{
+			"/kubernetes": {Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}},
+			"/kafka":      {Path: "/kafka", Url: "https://kafka.apache.org"},
+		},
+	}
+	shared := &MockMapperConfigurer{Name: "shared"}
+	mm, err := NewMapperManager(shared.Name, CloneConfigurers([]*MockMapperConfigurer{shared, readonly}), WithPatterns(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+
+	suggestions, err := mm.Suggest(ctx, "k8", 0)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "k8s", suggestions[0].Keyword)
+	assert.Equal(t, "/kubernetes", suggestions[0].Path)
+	assert.Equal(t, "https://kubernetes.io", suggestions[0].Url)
+	suggestions, err = mm.Suggest(ctx, "kub", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubernetes"}, keywords(suggestions), "a pair is suggested once, under its path")
+
+	// redirects through readonly mappers are not counted, but are recent
+	_, err = mm.GetUrl(ctx, "kube", true)
+	require.NoError(t, err)
+	suggestions, err = mm.Suggest(ctx, "k", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubernetes", "kafka"}, keywords(suggestions))
+	assert.Equal(t, 0, suggestions[0].UseCount)
+	assert.NotNil(t, suggestions[0].LastUsed)
+	assert.Nil(t, suggestions[1].LastUsed)
+
+	// the aliases go with their pair
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "/docker", Url: "https://docker.com", Aliases: []string{"/kontainer"}})
+	require.NoError(t, err)
+	suggestions, err = mm.Suggest(ctx, "kon", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kontainer"}, keywords(suggestions))
+	_, err = mm.PutUrl(ctx, &types.PathUrlPair{Path: "/docker", Url: "https://docker.com", Aliases: []string{"/dkr"}})
+	require.NoError(t, err)
+	suggestions, err = mm.Suggest(ctx, "kon", 0)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+	require.NoError(t, mm.DeleteUrl(ctx, "docker"))
+	suggestions, err = mm.Suggest(ctx, "dk", 0)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+}
+
+// reloadingMapper is a MockMapper that reloads its pairs from a source of its own.
+type reloadingMapper struct {
+	*MockMapper
+	ReloadHooks
+}
+
+type reloadingConfigurer struct {
+	*MockMapperConfigurer
+}
+
+func (c *reloadingConfigurer) GetMapper() (types.Mapper, error) {
+	mapper, err := c.MockMapperConfigurer.GetMapper()
+	if err != nil {
+		return nil, err
+	}
+	return &reloadingMapper{MockMapper: mapper.(*MockMapper)}, nil
+}
+
+func TestMapperManager_SuggestReloads(t *testing.T) {
+	configurers := CloneConfigurers([]*MockMapperConfigurer{{Name: "shared"}, {Name: "file"}})
+	configurers[1] = &reloadingConfigurer{configurers[1].(*MockMapperConfigurer)}
+	mm, err := NewMapperManager("shared", configurers, WithPatterns(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	shared, file := mm.mappers[0].(*MockMapper), mm.mappers[1].(*reloadingMapper)
+	ctx := context.Background()
+
+	// written by another server
+	shared.Pairs["/deploy"] = &types.PathUrlPair{Path: "/deploy", Url: "https://deploy.com", Mapper: "shared"}
+	// edited in the source of the mapper, which the refresh does not list
+	file.Pairs["/docs"] = &types.PathUrlPair{Path: "/docs", Url: "https://docs.com", Mapper: "file"}
+	file.Pairs["/dev/*"] = &types.PathUrlPair{Path: "/dev/*", Url: "https://dev.com/$1", Mapper: "file"}
+	mm.loadSuggestIndex(ctx)
+	suggestions, err := mm.Suggest(ctx, "de", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deploy"}, keywords(suggestions))
+	suggestions, err = mm.Suggest(ctx, "do", 0)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+
+	file.Reloaded()
+	suggestions, err = mm.Suggest(ctx, "do", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, keywords(suggestions))
+	pair, err := mm.MatchPattern(ctx, "dev/api")
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	assert.Equal(t, "https://dev.com/api", pair.Url)
+}
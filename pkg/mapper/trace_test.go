@@ -0,0 +1,53 @@
+package mapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/reimirno/golinks/pkg/tracing"
+)
+
+func TestMapperManager_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	mm, err := NewMapperManager(mockConfigurer2.Name, CloneConfigurers([]*MockMapperConfigurer{mockConfigurerAlt, mockConfigurer2}))
+	assert.NoError(t, err)
+	pair, err := mm.GetUrl(context.Background(), "fk3", false)
+	assert.NoError(t, err)
+	assert.NotNil(t, pair)
+
+	spans := recorder.Ended()
+	// one span per mapper tried, then the manager span
+	assert.Len(t, spans, 3)
+	wantMappers := []string{mockConfigurerAlt.Name, mockConfigurer2.Name}
+	for i, want := range wantMappers {
+		assert.Equal(t, "Mapper.GetUrl", spans[i].Name())
+		assert.Equal(t, spans[2].SpanContext().SpanID(), spans[i].Parent().SpanID())
+		attrs := attributeMap(spans[i])
+		assert.Equal(t, want, attrs[tracing.AttrMapperName])
+		assert.Equal(t, "/fk3", attrs[tracing.AttrCanonicalPath])
+	}
+	assert.Equal(t, "MapperManager.GetUrl", spans[2].Name())
+	attrs := attributeMap(spans[2])
+	assert.Equal(t, "fk3", attrs[tracing.AttrPath])
+	assert.Equal(t, "/fk3", attrs[tracing.AttrCanonicalPath])
+	assert.Equal(t, mockConfigurer2.Name, attrs[tracing.AttrMapperName])
+}
+
+func attributeMap(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	m := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value.Emit()
+	}
+	return m
+}
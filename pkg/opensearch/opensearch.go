@@ -0,0 +1,67 @@
+// Package opensearch speaks the OpenSearch formats that browsers use to add golinks as a search engine.
+package opensearch
+
+import (
+	"encoding/xml"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+)
+
+const (
+	// SuggestionsContentType is the content type of the suggestions that browsers read.
+	SuggestionsContentType = "application/x-suggestions+json"
+	// DescriptionContentType is the content type of the description that browsers add a search engine from.
+	DescriptionContentType = "application/opensearchdescription+xml"
+
+	// Where the redirector serves search, under /d/, which the sanitizer reserves, so that no link is shadowed.
+	SearchPath      = "/d/search"
+	SuggestPath     = "/d/suggest"
+	DescriptionPath = "/d/opensearch.xml"
+)
+
+type description struct {
+	XMLName       xml.Name         `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string           `xml:"ShortName"`
+	Description   string           `xml:"Description"`
+	InputEncoding string           `xml:"InputEncoding"`
+	Urls          []descriptionUrl `xml:"Url"`
+}
+
+type descriptionUrl struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// Description returns the OpenSearch description of the redirector served at baseUrl, such as https://go.example.com,
+// which tells browsers where to search from and where to get suggestions.
+func Description(baseUrl string) ([]byte, error) {
+	d := description{
+		ShortName:     "golinks",
+		Description:   "Go links",
+		InputEncoding: "UTF-8",
+		Urls: []descriptionUrl{
+			{Type: "text/html", Method: "get", Template: baseUrl + SearchPath + "?q={searchTerms}"},
+			{Type: SuggestionsContentType, Method: "get", Template: baseUrl + SuggestPath + "?q={searchTerms}"},
+		},
+	}
+	out, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// Suggestions returns the suggestions for query in the OpenSearch suggestions format:
+// the query, then the completions, their descriptions and their urls, in the same order.
+func Suggestions(query string, suggestions []mapper.Suggestion) []any {
+	completions := make([]string, 0, len(suggestions))
+	descriptions := make([]string, 0, len(suggestions))
+	urls := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		completions = append(completions, suggestion.Keyword)
+		descriptions = append(descriptions, suggestion.Url)
+		urls = append(urls, suggestion.Url)
+	}
+	return []any{query, completions, descriptions, urls}
+}
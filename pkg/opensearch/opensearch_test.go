@@ -0,0 +1,52 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+)
+
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		suggestions []mapper.Suggestion
+		want        string
+	}{
+		{name: "empty", query: "x", want: `["x",[],[],[]]`},
+		{
+			name:  "happy path",
+			query: "d",
+			suggestions: []mapper.Suggestion{
+				{Keyword: "docs", Path: "/docs", Url: "https://docs.com"},
+				{Keyword: "deploy", Path: "/teama/deploy", Url: "https://deploy.com"},
+			},
+			want: `["d",["docs","deploy"],["https://docs.com","https://deploy.com"],["https://docs.com","https://deploy.com"]]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := json.Marshal(Suggestions(test.query, test.suggestions))
+			require.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
+
+func TestDescription(t *testing.T) {
+	got, err := Description("https://go.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>golinks</ShortName>
+  <Description>Go links</Description>
+  <InputEncoding>UTF-8</InputEncoding>
+  <Url type="text/html" method="get" template="https://go.example.com/d/search?q={searchTerms}"></Url>
+  <Url type="application/x-suggestions+json" method="get" template="https://go.example.com/d/suggest?q={searchTerms}"></Url>
+</OpenSearchDescription>`, string(got))
+}
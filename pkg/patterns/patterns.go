@@ -0,0 +1,99 @@
+// Package patterns matches request paths against pattern pairs, whose path is a pattern instead of a path:
+// a glob, in which every * captures one or more characters, or a regular expression, which starts with ^.
+// The captures are expanded in the urls of the pair as $1, $2 or ${name}.
+package patterns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// IsPattern tells whether path is the path of a pattern pair rather than of a link of its own.
+func IsPattern(path string) bool {
+	return IsRegex(path) || strings.Contains(path, "*")
+}
+
+// IsRegex tells whether path is a regular expression.
+func IsRegex(path string) bool {
+	return strings.HasPrefix(path, "^")
+}
+
+// Pattern is the compiled path of a pattern pair.
+type Pattern struct {
+	Path string
+	re   *regexp.Regexp
+}
+
+// Compile compiles the path of a pattern pair, which must be canonical: a glob canonicalized like a path,
+// or a regex, which is matched against the canonical path of a request without its leading slash.
+func Compile(path string) (*Pattern, error) {
+	if IsRegex(path) {
+		re, err := regexp.Compile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Path: path, re: re}, nil
+	}
+	if !IsPattern(path) {
+		return nil, fmt.Errorf("%s is not a pattern", path)
+	}
+	parts := strings.Split(path, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re, err := regexp.Compile("^" + strings.Join(parts, "(.+)") + "$")
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{Path: path, re: re}, nil
+}
+
+// subject is what the pattern is matched against, for the canonical path of a request.
+func (p *Pattern) subject(path string) string {
+	if IsRegex(p.Path) {
+		return strings.TrimPrefix(path, "/")
+	}
+	return path
+}
+
+// Matches tells whether the canonical path of a request matches the pattern.
+func (p *Pattern) Matches(path string) bool {
+	return p.re.MatchString(p.subject(path))
+}
+
+// Apply returns a copy of pair, the pair of the pattern, with the captures of the canonical path of a request
+// expanded in its url and the urls of its rules, or nil if path does not match the pattern.
+func (p *Pattern) Apply(pair *types.PathUrlPair, path string) *types.PathUrlPair {
+	subject := p.subject(path)
+	match := p.re.FindStringSubmatchIndex(subject)
+	if match == nil {
+		return nil
+	}
+	expand := func(url string) string {
+		return string(p.re.ExpandString(nil, url, subject, match))
+	}
+	applied := pair.Clone()
+	applied.Url = expand(applied.Url)
+	for i := range applied.Rules {
+		applied.Rules[i].Url = expand(applied.Rules[i].Url)
+	}
+	return applied
+}
+
+// Compare orders the patterns of a mapper by precedence: globs before regexes, then longer patterns,
+// which tend to be the more specific ones, before shorter ones, then by path so that the order is total.
+func Compare(a, b *Pattern) int {
+	if IsRegex(a.Path) != IsRegex(b.Path) {
+		if IsRegex(a.Path) {
+			return 1
+		}
+		return -1
+	}
+	if len(a.Path) != len(b.Path) {
+		return len(b.Path) - len(a.Path)
+	}
+	return strings.Compare(a.Path, b.Path)
+}
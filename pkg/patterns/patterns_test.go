@@ -0,0 +1,93 @@
+package patterns
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func TestIsPattern(t *testing.T) {
+	tests := []struct {
+		path    string
+		pattern bool
+		regex   bool
+	}{
+		{path: "/pr", pattern: false, regex: false},
+		{path: "/pr/*", pattern: true, regex: false},
+		{path: `^bug(\d+)$`, pattern: true, regex: true},
+		{path: "^.*$", pattern: true, regex: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			assert.Equal(t, test.pattern, IsPattern(test.path))
+			assert.Equal(t, test.regex, IsRegex(test.path))
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	_, err := Compile("/pr")
+	assert.Error(t, err)
+	_, err = Compile("^bug(")
+	assert.Error(t, err)
+	_, err = Compile("/pr/*")
+	assert.NoError(t, err)
+}
+
+func TestPattern_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		url     string
+		path    string
+		want    string
+		matches bool
+	}{
+		{name: "glob", pattern: "/pr/*", url: "https://github.com/org/repo/pull/$1", path: "/pr/123", want: "https://github.com/org/repo/pull/123", matches: true},
+		{name: "glob across slashes", pattern: "/pr/*", url: "https://github.com/org/repo/pull/$1", path: "/pr/123/files", want: "https://github.com/org/repo/pull/123/files", matches: true},
+		{name: "glob with several stars", pattern: "/gh/*/*", url: "https://github.com/$1/$2", path: "/gh/org/repo", want: "https://github.com/org/repo", matches: true},
+		{name: "glob is anchored", pattern: "/pr/*", path: "/mypr/123", matches: false},
+		{name: "star matches something", pattern: "/pr/*", path: "/pr/", matches: false},
+		{name: "glob metacharacters are literal", pattern: "/a+b/*", url: "https://a.com/$1", path: "/a+b/c", want: "https://a.com/c", matches: true},
+		{name: "regex", pattern: `^bug(\d+)$`, url: "https://tracker/issue/$1", path: "/bug42", want: "https://tracker/issue/42", matches: true},
+		{name: "regex with named capture", pattern: `^bug(?P<id>\d+)$`, url: "https://tracker/issue/${id}?x=1", path: "/bug42", want: "https://tracker/issue/42?x=1", matches: true},
+		{name: "regex does not match", pattern: `^bug(\d+)$`, path: "/bugs", matches: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Compile(test.pattern)
+			require.NoError(t, err)
+			pair := &types.PathUrlPair{Path: test.pattern, Url: test.url, Rules: []types.RedirectRule{{Url: test.url, OS: []string{"linux"}}}}
+			assert.Equal(t, test.matches, p.Matches(test.path))
+			got := p.Apply(pair, test.path)
+			if !test.matches {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, test.pattern, got.Path)
+			assert.Equal(t, test.want, got.Url)
+			assert.Equal(t, test.want, got.Rules[0].Url)
+			assert.Equal(t, test.url, pair.Url, "the pair of the pattern is left alone")
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	var compiled []*Pattern
+	for _, path := range []string{`^pr(\d+)$`, "/pr/*", `^p.*$`, "/pr/*/files", "/p*"} {
+		p, err := Compile(path)
+		require.NoError(t, err)
+		compiled = append(compiled, p)
+	}
+	slices.SortFunc(compiled, Compare)
+	var got []string
+	for _, p := range compiled {
+		got = append(got, p.Path)
+	}
+	assert.Equal(t, []string{"/pr/*/files", "/pr/*", "/p*", `^pr(\d+)$`, `^p.*$`}, got)
+}
@@ -0,0 +1,240 @@
+// Package rules evaluates the redirect rules of pairs against requests, and splits requests between their targets.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// Operating systems that rules can match on, as told by the user agent.
+const (
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSAndroid  = "android"
+	OSIOS      = "ios"
+	OSChromeOS = "chromeos"
+)
+
+var knownOS = []string{OSWindows, OSMacOS, OSLinux, OSAndroid, OSIOS, OSChromeOS}
+
+// Request holds what rules match on.
+type Request struct {
+	Header http.Header
+	Query  url.Values
+	IP     netip.Addr // invalid if unknown, which no address range matches
+	Time   time.Time
+	// SplitKey sends the client to the same target of a split pair every time; targets are picked at random without it.
+	SplitKey string
+}
+
+// FromHttp describes r, received at now. The client address is the one the request came from;
+// behind a proxy, that is the address of the proxy.
+func FromHttp(r *http.Request, now time.Time) Request {
+	req := Request{Header: r.Header, Query: r.URL.Query(), Time: now}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		req.IP = ip.Unmap()
+	}
+	return req
+}
+
+// Resolve returns the url that req is redirected to: the one of the first rule of pair that matches req,
+// or else the one of the target that req is split to, or else the url of pair.
+// target is the index of the target picked, or -1 if none was.
+// Rules are expected to be canonical; a rule that cannot be evaluated does not match.
+func Resolve(pair *types.PathUrlPair, req Request) (url string, target int) {
+	for _, rule := range pair.Rules {
+		if Match(rule, req) {
+			return rule.Url, -1
+		}
+	}
+	if i := Pick(pair, req.SplitKey); i >= 0 {
+		return pair.Targets[i].Url, i
+	}
+	return pair.Url, -1
+}
+
+// Match tells whether req meets every condition of rule.
+func Match(rule types.RedirectRule, req Request) bool {
+	for name, pattern := range rule.Headers {
+		if !matchAny(pattern, req.Header.Values(name), true) {
+			return false
+		}
+	}
+	for name, pattern := range rule.Query {
+		if !matchAny(pattern, req.Query[name], false) {
+			return false
+		}
+	}
+	if len(rule.OS) > 0 && !slices.Contains(rule.OS, DetectOS(req.Header.Get("User-Agent"))) {
+		return false
+	}
+	if len(rule.CIDRs) > 0 && !inRanges(rule.CIDRs, req.IP) {
+		return false
+	}
+	if rule.Hours != "" {
+		within, err := withinHours(rule.Hours, rule.Timezone, req.Time)
+		if err != nil || !within {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonicalize checks rules and puts them in canonical form: urls are trimmed, header names canonicalized,
+// operating systems lower-cased and address ranges masked.
+func Canonicalize(rules []types.RedirectRule) error {
+	for i := range rules {
+		if err := canonicalize(&rules[i]); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func canonicalize(rule *types.RedirectRule) error {
+	rule.Url = strings.TrimSpace(rule.Url)
+	if rule.Url == "" {
+		return errors.New("url is required")
+	}
+	if len(rule.Headers) == 0 && len(rule.Query) == 0 && len(rule.OS) == 0 && len(rule.CIDRs) == 0 && rule.Hours == "" {
+		return errors.New("at least one condition is required")
+	}
+	if len(rule.Headers) > 0 {
+		headers := make(map[string]string, len(rule.Headers))
+		for name, pattern := range rule.Headers {
+			if err := checkPattern(pattern); err != nil {
+				return fmt.Errorf("header %s: %w", name, err)
+			}
+			headers[http.CanonicalHeaderKey(name)] = pattern
+		}
+		rule.Headers = headers
+	}
+	for name, pattern := range rule.Query {
+		if err := checkPattern(pattern); err != nil {
+			return fmt.Errorf("query parameter %s: %w", name, err)
+		}
+	}
+	for i, os := range rule.OS {
+		rule.OS[i] = strings.ToLower(strings.TrimSpace(os))
+		if !slices.Contains(knownOS, rule.OS[i]) {
+			return fmt.Errorf("unknown os %q, expected one of %v", os, knownOS)
+		}
+	}
+	for i, cidr := range rule.CIDRs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("invalid address range %q: %w", cidr, err)
+		}
+		rule.CIDRs[i] = prefix.Masked().String()
+	}
+	if rule.Timezone != "" && rule.Hours == "" {
+		return errors.New("timezone is only used with hours")
+	}
+	if rule.Hours != "" {
+		if _, err := withinHours(rule.Hours, rule.Timezone, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+func matchAny(pattern string, values []string, foldCase bool) bool {
+	if foldCase {
+		pattern = strings.ToLower(pattern)
+	}
+	for _, value := range values {
+		if foldCase {
+			value = strings.ToLower(value)
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func inRanges(cidrs []string, ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinHours tells whether t falls in hours, a range such as 09:00-17:00 in the given timezone.
+// The start is inclusive and the end exclusive; a range whose end is before its start wraps past midnight.
+func withinHours(hours string, timezone string, t time.Time) (bool, error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return false, fmt.Errorf("invalid hours %q, expected HH:MM-HH:MM", hours)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return false, fmt.Errorf("invalid hours %q: %w", hours, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return false, fmt.Errorf("invalid hours %q: %w", hours, err)
+	}
+	location := time.UTC
+	if timezone != "" {
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return false, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+	}
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute, endMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if startMinute <= endMinute {
+		return startMinute <= minute && minute < endMinute, nil
+	}
+	return minute >= startMinute || minute < endMinute, nil
+}
+
+// DetectOS tells the operating system of a user agent, or an empty string if it is not one of the known ones.
+// Order matters, as user agents mention the systems they are derived from or compatible with.
+func DetectOS(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "android"):
+		return OSAndroid
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return OSIOS
+	case strings.Contains(ua, "cros"):
+		return OSChromeOS
+	case strings.Contains(ua, "windows"):
+		return OSWindows
+	case strings.Contains(ua, "mac os"), strings.Contains(ua, "macintosh"):
+		return OSMacOS
+	case strings.Contains(ua, "linux"):
+		return OSLinux
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,210 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+const (
+	uaWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	uaMac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+	uaIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
+	uaAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	uaCrOS    = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	uaLinux   = "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+)
+
+func TestDetectOS(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{uaWindows, OSWindows},
+		{uaMac, OSMacOS},
+		{uaIPhone, OSIOS},
+		{uaAndroid, OSAndroid},
+		{uaCrOS, OSChromeOS},
+		{uaLinux, OSLinux},
+		{"curl/8.0", ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, DetectOS(test.userAgent), test.userAgent)
+	}
+}
+
+func TestFromHttp(t *testing.T) {
+	now := time.Now()
+	r := httptest.NewRequest("GET", "/vpn?team=infra", nil)
+	r.RemoteAddr = "[::ffff:10.1.2.3]:4567"
+	req := FromHttp(r, now)
+	assert.Equal(t, netip.MustParseAddr("10.1.2.3"), req.IP)
+	assert.Equal(t, "infra", req.Query.Get("team"))
+	assert.Equal(t, now, req.Time)
+
+	r.RemoteAddr = "pipe"
+	assert.False(t, FromHttp(r, now).IP.IsValid())
+}
+
+func TestMatch(t *testing.T) {
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newRequest := func(userAgent string, headers map[string]string, query string, ip string, at time.Time) Request {
+		r := httptest.NewRequest("GET", "/docs?"+query, nil)
+		r.Header.Set("User-Agent", userAgent)
+		for name, value := range headers {
+			r.Header.Add(name, value)
+		}
+		r.RemoteAddr = ip + ":1234"
+		return FromHttp(r, at)
+	}
+	tests := []struct {
+		name string
+		rule types.RedirectRule
+		req  Request
+		want bool
+	}{
+		{
+			name: "header glob, case-insensitively",
+			rule: types.RedirectRule{Headers: map[string]string{"Accept-Language": "de*"}},
+			req:  newRequest(uaLinux, map[string]string{"Accept-Language": "DE-de,en;q=0.5"}, "", "10.0.0.1", noon),
+			want: true,
+		},
+		{
+			name: "missing header",
+			rule: types.RedirectRule{Headers: map[string]string{"Accept-Language": "*"}},
+			req:  newRequest(uaLinux, nil, "", "10.0.0.1", noon),
+		},
+		{
+			name: "os",
+			rule: types.RedirectRule{OS: []string{OSMacOS, OSIOS}},
+			req:  newRequest(uaIPhone, nil, "", "10.0.0.1", noon),
+			want: true,
+		},
+		{
+			name: "other os",
+			rule: types.RedirectRule{OS: []string{OSWindows}},
+			req:  newRequest(uaMac, nil, "", "10.0.0.1", noon),
+		},
+		{
+			name: "query",
+			rule: types.RedirectRule{Query: map[string]string{"team": "infra"}},
+			req:  newRequest(uaLinux, nil, "team=web&team=infra", "10.0.0.1", noon),
+			want: true,
+		},
+		{
+			name: "query is case-sensitive",
+			rule: types.RedirectRule{Query: map[string]string{"team": "infra"}},
+			req:  newRequest(uaLinux, nil, "team=Infra", "10.0.0.1", noon),
+		},
+		{
+			name: "cidr",
+			rule: types.RedirectRule{CIDRs: []string{"192.168.0.0/16", "10.0.0.0/8"}},
+			req:  newRequest(uaLinux, nil, "", "10.20.30.40", noon),
+			want: true,
+		},
+		{
+			name: "outside cidr",
+			rule: types.RedirectRule{CIDRs: []string{"10.0.0.0/8"}},
+			req:  newRequest(uaLinux, nil, "", "172.16.0.1", noon),
+		},
+		{
+			name: "hours",
+			rule: types.RedirectRule{Hours: "09:00-17:00"},
+			req:  newRequest(uaLinux, nil, "", "10.0.0.1", noon),
+			want: true,
+		},
+		{
+			name: "hours end is exclusive",
+			rule: types.RedirectRule{Hours: "09:00-12:00"},
+			req:  newRequest(uaLinux, nil, "", "10.0.0.1", noon),
+		},
+		{
+			name: "hours in timezone",
+			rule: types.RedirectRule{Hours: "09:00-17:00", Timezone: "Asia/Tokyo"},
+			req:  newRequest(uaLinux, nil, "", "10.0.0.1", noon), // 21:00 in Tokyo
+		},
+		{
+			name: "hours past midnight",
+			rule: types.RedirectRule{Hours: "22:00-06:00"},
+			req:  newRequest(uaLinux, nil, "", "10.0.0.1", noon.Add(-9*time.Hour)),
+			want: true,
+		},
+		{
+			name: "every condition must match",
+			rule: types.RedirectRule{OS: []string{OSLinux}, CIDRs: []string{"10.0.0.0/8"}},
+			req:  newRequest(uaLinux, nil, "", "172.16.0.1", noon),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Match(test.rule, test.req))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	pair := &types.PathUrlPair{
+		Url: "https://vpn.example.com",
+		Rules: []types.RedirectRule{
+			{Url: "https://vpn.example.com/windows", OS: []string{OSWindows}},
+			{Url: "https://vpn.example.com/office", CIDRs: []string{"10.0.0.0/8"}},
+		},
+	}
+	request := func(userAgent string, ip string) Request {
+		return Request{Header: http.Header{"User-Agent": {userAgent}}, IP: netip.MustParseAddr(ip)}
+	}
+	resolve := func(req Request) string {
+		url, _ := Resolve(pair, req)
+		return url
+	}
+	assert.Equal(t, "https://vpn.example.com/windows", resolve(request(uaWindows, "10.0.0.1")), "the first match wins")
+	assert.Equal(t, "https://vpn.example.com/office", resolve(request(uaMac, "10.0.0.1")))
+	assert.Equal(t, "https://vpn.example.com", resolve(request(uaMac, "172.16.0.1")))
+
+	// requests that no rule matches are split
+	pair.Targets = []types.WeightedTarget{{Url: "https://vpn.example.com/old", Weight: 0}, {Url: "https://vpn.example.com/new", Weight: 1}}
+	url, target := Resolve(pair, request(uaMac, "172.16.0.1"))
+	assert.Equal(t, "https://vpn.example.com/new", url)
+	assert.Equal(t, 1, target)
+	_, target = Resolve(pair, request(uaWindows, "172.16.0.1"))
+	assert.Equal(t, -1, target)
+}
+
+func TestCanonicalize(t *testing.T) {
+	rules := []types.RedirectRule{{
+		Url:     " https://example.com ",
+		Headers: map[string]string{"accept-language": "de*"},
+		OS:      []string{"MacOS"},
+		CIDRs:   []string{"10.1.2.3/8"},
+		Hours:   "09:00-17:00",
+	}}
+	assert.NoError(t, Canonicalize(rules))
+	assert.Equal(t, types.RedirectRule{
+		Url:     "https://example.com",
+		Headers: map[string]string{"Accept-Language": "de*"},
+		OS:      []string{OSMacOS},
+		CIDRs:   []string{"10.0.0.0/8"},
+		Hours:   "09:00-17:00",
+	}, rules[0])
+
+	invalid := []types.RedirectRule{
+		{OS: []string{OSLinux}},
+		{Url: "https://example.com"},
+		{Url: "https://example.com", Headers: map[string]string{"Accept": "["}},
+		{Url: "https://example.com", Query: map[string]string{"q": "["}},
+		{Url: "https://example.com", OS: []string{"beos"}},
+		{Url: "https://example.com", CIDRs: []string{"10.0.0.1"}},
+		{Url: "https://example.com", Hours: "9-5"},
+		{Url: "https://example.com", Hours: "09:00-17:00", Timezone: "Mars/Olympus"},
+		{Url: "https://example.com", OS: []string{OSLinux}, Timezone: "UTC"},
+	}
+	for _, rule := range invalid {
+		assert.Error(t, Canonicalize([]types.RedirectRule{rule}), "%+v", rule)
+	}
+}
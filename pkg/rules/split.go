@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// ClientCookie keeps the random client id that pairs with types.StickyCookie send to the same target.
+const ClientCookie = "golinks_client"
+
+// Pick returns the index of the target of pair that a client with key is sent to, or -1 if pair is not split.
+// A key is sent to the same target as long as the targets of pair do not change; an empty key picks at random.
+// Targets are picked by weight either way, and different pairs split the same key independently.
+func Pick(pair *types.PathUrlPair, key string) int {
+	total := 0
+	for _, target := range pair.Targets {
+		total += max(target.Weight, 0)
+	}
+	if total == 0 {
+		return -1
+	}
+	var n int
+	if key == "" {
+		n = rand.IntN(total)
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(pair.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		n = int(h.Sum64() % uint64(total))
+	}
+	for i, target := range pair.Targets {
+		if n < max(target.Weight, 0) {
+			return i
+		}
+		n -= max(target.Weight, 0)
+	}
+	return -1
+}
+
+// ClientKey identifies the client of req for pairs with types.StickyClient: its address and user agent.
+// Clients behind the same address with the same browser are sent to the same target.
+func ClientKey(req Request) string {
+	if !req.IP.IsValid() && req.Header.Get("User-Agent") == "" {
+		return ""
+	}
+	return req.IP.String() + " " + req.Header.Get("User-Agent")
+}
+
+// CanonicalizeSplit checks the targets and sticky mode of pair and puts them in canonical form:
+// urls are trimmed and the sticky mode lower-cased.
+func CanonicalizeSplit(pair *types.PathUrlPair) error {
+	pair.Sticky = strings.ToLower(strings.TrimSpace(pair.Sticky))
+	if len(pair.Targets) == 0 {
+		if pair.Sticky != "" {
+			return errors.New("sticky is only used with targets")
+		}
+		return nil
+	}
+	switch pair.Sticky {
+	case "", types.StickyCookie, types.StickyClient:
+	default:
+		return fmt.Errorf("unknown sticky mode %q, expected %s or %s", pair.Sticky, types.StickyCookie, types.StickyClient)
+	}
+	total := 0
+	seen := make(map[string]bool, len(pair.Targets))
+	for i := range pair.Targets {
+		target := &pair.Targets[i]
+		target.Url = strings.TrimSpace(target.Url)
+		if target.Url == "" {
+			return fmt.Errorf("target %d: url is required", i+1)
+		}
+		if seen[target.Url] {
+			return fmt.Errorf("target %d: duplicate url %s", i+1, target.Url)
+		}
+		seen[target.Url] = true
+		if target.Weight < 0 {
+			return fmt.Errorf("target %d: negative weight", i+1)
+		}
+		total += target.Weight
+	}
+	if total == 0 {
+		return errors.New("at least one target needs a positive weight")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func TestPick(t *testing.T) {
+	pair := &types.PathUrlPair{
+		Path: "/metrics",
+		Targets: []types.WeightedTarget{
+			{Url: "https://old.com", Weight: 90},
+			{Url: "https://new.com", Weight: 10},
+			{Url: "https://off.com", Weight: 0},
+		},
+	}
+	counts := make([]int, len(pair.Targets))
+	for i := 0; i < 10000; i++ {
+		counts[Pick(pair, fmt.Sprintf("client-%d", i))]++
+	}
+	assert.InDelta(t, 9000, counts[0], 300)
+	assert.InDelta(t, 1000, counts[1], 300)
+	assert.Zero(t, counts[2], "targets without weight are never picked")
+
+	// a key sticks to its target, but not across pairs
+	first := Pick(pair, "client-1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, Pick(pair, "client-1"))
+	}
+	other := &types.PathUrlPair{Path: "/other", Targets: pair.Targets}
+	differs := false
+	for i := 0; i < 100 && !differs; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		differs = Pick(pair, key) != Pick(other, key)
+	}
+	assert.True(t, differs)
+
+	random := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		random[Pick(pair, "")] = true
+	}
+	assert.Equal(t, map[int]bool{0: true, 1: true}, random)
+
+	assert.Equal(t, -1, Pick(&types.PathUrlPair{Path: "/plain"}, "client-1"))
+}
+
+func TestClientKey(t *testing.T) {
+	req := Request{Header: http.Header{"User-Agent": {uaLinux}}, IP: netip.MustParseAddr("10.0.0.1")}
+	assert.Equal(t, "10.0.0.1 "+uaLinux, ClientKey(req))
+	assert.Empty(t, ClientKey(Request{Header: http.Header{}}))
+}
+
+func TestCanonicalizeSplit(t *testing.T) {
+	pair := &types.PathUrlPair{
+		Targets: []types.WeightedTarget{{Url: " https://a.com ", Weight: 1}, {Url: "https://b.com"}},
+		Sticky:  " Cookie",
+	}
+	assert.NoError(t, CanonicalizeSplit(pair))
+	assert.Equal(t, "https://a.com", pair.Targets[0].Url)
+	assert.Equal(t, types.StickyCookie, pair.Sticky)
+	assert.NoError(t, CanonicalizeSplit(&types.PathUrlPair{}))
+
+	invalid := []*types.PathUrlPair{
+		{Sticky: types.StickyClient},
+		{Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}}, Sticky: "session"},
+		{Targets: []types.WeightedTarget{{Weight: 1}}},
+		{Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}, {Url: "https://a.com", Weight: 1}}},
+		{Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: -1}, {Url: "https://b.com", Weight: 2}}},
+		{Targets: []types.WeightedTarget{{Url: "https://a.com"}}},
+	}
+	for _, pair := range invalid {
+		assert.Error(t, CanonicalizeSplit(pair), "%+v", pair)
+	}
+}
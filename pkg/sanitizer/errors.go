@@ -1,9 +1,34 @@
 package sanitizer
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrInvalidInput is wrapped by every error about a pair that cannot be written as given,
+// so that servers can tell them apart from failures of the mappers.
+var ErrInvalidInput = errors.New("invalid input")
+
 func ErrInvalidPath(path string, message string) error {
-	return fmt.Errorf("invalid path: %s - %s", path, message)
+	return fmt.Errorf("%w: invalid path: %s - %s", ErrInvalidInput, path, message)
+}
+
+func ErrInvalidTimes(path string, message string) error {
+	return fmt.Errorf("%w: invalid times for path: %s - %s", ErrInvalidInput, path, message)
+}
+
+func ErrInvalidRules(path string, err error) error {
+	return fmt.Errorf("%w: invalid rules for path: %s - %v", ErrInvalidInput, path, err)
+}
+
+func ErrInvalidTargets(path string, err error) error {
+	return fmt.Errorf("%w: invalid targets for path: %s - %v", ErrInvalidInput, path, err)
+}
+
+func ErrInvalidAliases(path string, message string) error {
+	return fmt.Errorf("%w: invalid aliases for path: %s - %s", ErrInvalidInput, path, message)
+}
+
+func ErrInvalidPattern(path string, message string) error {
+	return fmt.Errorf("%w: invalid pattern: %s - %s", ErrInvalidInput, path, message)
 }
@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/rules"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
@@ -24,7 +29,22 @@ func SanitizeInput(m types.Mapper, pair *types.PathUrlPair) error {
 	}
 	pair.Url = canonicalUrl
 	pair.UseCount = 0
-	return nil
+	for i := range pair.Targets {
+		pair.Targets[i].UseCount = 0
+	}
+	if err := rules.Canonicalize(pair.Rules); err != nil {
+		return ErrInvalidRules(pair.Path, err)
+	}
+	if err := rules.CanonicalizeSplit(pair); err != nil {
+		return ErrInvalidTargets(pair.Path, err)
+	}
+	if err := CanonicalizeAliases(pair); err != nil {
+		return err
+	}
+	if err := CheckPattern(pair); err != nil {
+		return err
+	}
+	return CanonicalizeTimes(pair)
 }
 
 // Since we always sanitize input before persisting it
@@ -33,6 +53,9 @@ func SanitizeInput(m types.Mapper, pair *types.PathUrlPair) error {
 func SanitizeOutput(m types.Mapper, pair *types.PathUrlPair) {
 	if m.Readonly() {
 		pair.UseCount = 0
+		for i := range pair.Targets {
+			pair.Targets[i].UseCount = 0
+		}
 	}
 }
 
@@ -50,6 +73,18 @@ func SanitizeInputMap(m types.Mapper, mapIn *types.PathUrlPairMap) error {
 		}
 		clone[canonicalPath] = pair
 	}
+	owners := make(map[string]string)
+	for path, pair := range clone {
+		for _, alias := range pair.Aliases {
+			if _, ok := clone[alias]; ok {
+				return ErrInvalidAliases(path, fmt.Sprintf("alias %s is also a path", alias))
+			}
+			if owner, ok := owners[alias]; ok {
+				return ErrInvalidAliases(path, fmt.Sprintf("alias %s is also an alias of %s", alias, owner))
+			}
+			owners[alias] = path
+		}
+	}
 	*mapIn = clone
 	return nil
 }
@@ -60,10 +95,21 @@ func SanitizeInputMap(m types.Mapper, mapIn *types.PathUrlPairMap) error {
 // - removes underscore, hyphen and dot in string
 // - ensures path begins with a slash
 // - replaces multiple consecutive slashes with a single slash
+// - leaves regexes (see pkg/patterns) as they are, but for surrounding spaces
+// The first segment of a path of several segments names its namespace (see NamespaceOf),
+// so that a namespace is canonicalized like the paths in it.
 // Validates path:
-// - ensures path is not "/" or "/d"
+// - ensures path is not "/", "/d" or under "/d/"
 // - ensures path are all properly escaped using url.Parse
+// - ensures regexes compile
 func CanonicalizePath(path string) (string, error) {
+	if trimmed := strings.TrimSpace(path); patterns.IsRegex(trimmed) {
+		if _, err := patterns.Compile(trimmed); err != nil {
+			return "", ErrInvalidPath(trimmed, fmt.Sprintf("path is invalid regex: %s", err.Error()))
+		}
+		return trimmed, nil
+	}
+
 	// process path
 	path = strings.Trim(path, "/")
 	path = regexp.MustCompile("[_.-]").ReplaceAllString(path, "")
@@ -82,6 +128,115 @@ func CanonicalizePath(path string) (string, error) {
 	return urlParsed.String(), nil
 }
 
+// CanonicalizePrefix canonicalizes the beginning of a path, as it is being typed, like CanonicalizePath,
+// so that it is a prefix of the canonical paths that it may become. A trailing slash is kept,
+// as it tells that the segment before it is complete.
+func CanonicalizePrefix(prefix string) string {
+	prefix = strings.TrimLeft(strings.TrimSpace(prefix), "/")
+	prefix = regexp.MustCompile("[_.-]").ReplaceAllString(prefix, "")
+	prefix = regexp.MustCompile("/+").ReplaceAllString(prefix, "/")
+	return "/" + prefix
+}
+
+// CanonicalizeNamespace canonicalizes the name of a namespace like a path of a single segment,
+// and returns it without its leading slash.
+func CanonicalizeNamespace(name string) (string, error) {
+	path, err := CanonicalizePath(name)
+	if err != nil {
+		return "", err
+	}
+	if patterns.IsPattern(path) || strings.Count(path, "/") > 1 {
+		return "", ErrInvalidPath(path, "namespace must be a single segment")
+	}
+	return strings.TrimPrefix(path, "/"), nil
+}
+
+// PersonalPrefix starts the namespaces of personal links, which is followed by the actor they belong to.
+// Alone, it stands for the personal namespace of the actor of a request.
+const PersonalPrefix = "~"
+
+// PersonalNamespace returns the canonical name of the namespace of the personal links of actor.
+// The actor is encoded losslessly, unlike a path, so that actors such as j.doe and jdoe get namespaces of their own:
+// letters and digits are kept, and every other byte is escaped as ~ followed by its two hex digits, in lower case.
+func PersonalNamespace(actor string) (string, error) {
+	if strings.TrimSpace(actor) == "" {
+		return "", ErrInvalidPath(PersonalPrefix, "personal links need an actor")
+	}
+	var name strings.Builder
+	name.WriteString(PersonalPrefix)
+	for i := 0; i < len(actor); i++ {
+		if c := actor[i]; isAlphanumeric(c) {
+			name.WriteByte(c)
+		} else {
+			fmt.Fprintf(&name, "%s%02x", PersonalPrefix, c)
+		}
+	}
+	return name.String(), nil
+}
+
+// PersonalActor returns the actor that a canonical personal namespace belongs to,
+// or false if namespace is not the name that PersonalNamespace gives to any actor.
+func PersonalActor(namespace string) (string, bool) {
+	if !IsPersonal(namespace) {
+		return "", false
+	}
+	encoded := strings.TrimPrefix(namespace, PersonalPrefix)
+	var actor strings.Builder
+	for i := 0; i < len(encoded); i++ {
+		if !strings.HasPrefix(encoded[i:], PersonalPrefix) {
+			actor.WriteByte(encoded[i])
+			continue
+		}
+		i += len(PersonalPrefix)
+		if i+2 > len(encoded) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(encoded[i:i+2], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		actor.WriteByte(byte(c))
+		i++
+	}
+	// only one name stands for an actor: no upper case hex digits, nor escaped letters
+	if name, err := PersonalNamespace(actor.String()); err != nil || name != namespace {
+		return "", false
+	}
+	return actor.String(), true
+}
+
+func isAlphanumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// IsPersonal tells whether a canonical namespace holds personal links.
+func IsPersonal(namespace string) bool {
+	return strings.HasPrefix(namespace, PersonalPrefix)
+}
+
+// NamespaceOf returns the namespace of a canonical path: its first segment if it has several,
+// or an empty string for the paths of a single segment, which belong to no namespace.
+// A regex belongs to the namespace that every path it matches starts with, if any.
+func NamespaceOf(path string) string {
+	if patterns.IsRegex(path) {
+		re, err := regexp.Compile(path)
+		if err != nil {
+			return ""
+		}
+		prefix, _ := re.LiteralPrefix()
+		namespace, _, found := strings.Cut(prefix, "/")
+		if !found {
+			return ""
+		}
+		return namespace
+	}
+	namespace, rest, found := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !found || rest == "" {
+		return ""
+	}
+	return namespace
+}
+
 // CanonicalizeUrl trims spaces from the url
 // It does not do too much, because we just blindly send it to user
 // It is up to the user to ensure the url is correct
@@ -89,3 +244,65 @@ func CanonicalizeUrl(url string) (string, error) {
 	url = strings.Trim(url, " ")
 	return url, nil
 }
+
+// CanonicalizeAliases canonicalizes the aliases of pair like paths and drops the repeated ones.
+// Pair must have a canonical path, which cannot be one of its aliases.
+func CanonicalizeAliases(pair *types.PathUrlPair) error {
+	if len(pair.Aliases) == 0 {
+		pair.Aliases = nil
+		return nil
+	}
+	aliases := make([]string, 0, len(pair.Aliases))
+	for _, alias := range pair.Aliases {
+		canonicalAlias, err := CanonicalizePath(alias)
+		if err != nil {
+			return ErrInvalidAliases(pair.Path, err.Error())
+		}
+		if patterns.IsPattern(canonicalAlias) {
+			return ErrInvalidAliases(pair.Path, fmt.Sprintf("alias %s is a pattern", canonicalAlias))
+		}
+		if canonicalAlias == pair.Path {
+			return ErrInvalidAliases(pair.Path, "a path cannot be its own alias")
+		}
+		if !slices.Contains(aliases, canonicalAlias) {
+			aliases = append(aliases, canonicalAlias)
+		}
+	}
+	pair.Aliases = aliases
+	return nil
+}
+
+// CheckPattern ensures that a pattern pair, with a canonical path, has neither aliases nor targets:
+// it already matches many paths, and its urls are expanded for each of them.
+func CheckPattern(pair *types.PathUrlPair) error {
+	if !patterns.IsPattern(pair.Path) {
+		return nil
+	}
+	if len(pair.Aliases) > 0 {
+		return ErrInvalidPattern(pair.Path, "a pattern cannot have aliases")
+	}
+	if len(pair.Targets) > 0 {
+		return ErrInvalidPattern(pair.Path, "a pattern cannot split its requests between targets")
+	}
+	return nil
+}
+
+// CanonicalizeTimes stores ActiveFrom and ExpiresAt in UTC, to the second,
+// which every mapper can hold without losing precision,
+// and ensures the pair does not expire before it becomes active.
+func CanonicalizeTimes(pair *types.PathUrlPair) error {
+	pair.ActiveFrom = canonicalizeTime(pair.ActiveFrom)
+	pair.ExpiresAt = canonicalizeTime(pair.ExpiresAt)
+	if pair.ActiveFrom != nil && pair.ExpiresAt != nil && !pair.ExpiresAt.After(*pair.ActiveFrom) {
+		return ErrInvalidTimes(pair.Path, "expiresAt must be after activeFrom")
+	}
+	return nil
+}
+
+func canonicalizeTime(t *time.Time) *time.Time {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	c := t.UTC().Truncate(time.Second)
+	return &c
+}
@@ -1,9 +1,12 @@
 package sanitizer
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/reimirno/golinks/pkg/types"
 )
@@ -25,19 +28,19 @@ func (m *NameOnlyMapper) Readonly() bool {
 	return m.IsReadOnly
 }
 
-func (m *NameOnlyMapper) GetUrl(path string) (*types.PathUrlPair, error) {
+func (m *NameOnlyMapper) GetUrl(ctx context.Context, path string) (*types.PathUrlPair, error) {
 	return nil, nil
 }
 
-func (m *NameOnlyMapper) ListUrls(pagination types.Pagination) (types.PathUrlPairList, error) {
+func (m *NameOnlyMapper) ListUrls(ctx context.Context, pagination types.Pagination) (types.PathUrlPairList, error) {
 	return nil, nil
 }
 
-func (m *NameOnlyMapper) PutUrl(pair *types.PathUrlPair) (*types.PathUrlPair, error) {
+func (m *NameOnlyMapper) PutUrl(ctx context.Context, pair *types.PathUrlPair) (*types.PathUrlPair, error) {
 	return nil, nil
 }
 
-func (m *NameOnlyMapper) DeleteUrl(path string) error {
+func (m *NameOnlyMapper) DeleteUrl(ctx context.Context, path string) error {
 	return nil
 }
 
@@ -81,22 +84,161 @@ func TestSanitizeInput(t *testing.T) {
 			&types.PathUrlPair{Path: "/example/path", Url: "https://example.com"},
 			false,
 		},
+		{
+			"Truncate times to UTC seconds",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/timed", Url: "https://example.com", ActiveFrom: timeAt(1, 500*time.Millisecond), ExpiresAt: &time.Time{}},
+			&types.PathUrlPair{Path: "/timed", Url: "https://example.com", ActiveFrom: timeAt(1, 0)},
+			false,
+		},
+		{
+			"Expire before activation",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/timed", Url: "https://example.com", ActiveFrom: timeAt(2, 0), ExpiresAt: timeAt(1, 0)},
+			nil,
+			true,
+		},
+		{
+			"Canonicalize rules",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/vpn", Url: "https://example.com", Rules: []types.RedirectRule{{Url: "https://example.com/mac", OS: []string{"MacOS"}}}},
+			&types.PathUrlPair{Path: "/vpn", Url: "https://example.com", Rules: []types.RedirectRule{{Url: "https://example.com/mac", OS: []string{"macos"}}}},
+			false,
+		},
+		{
+			"Canonicalize targets and zero out their use counts",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/split", Url: "https://a.com", Sticky: "Cookie", Targets: []types.WeightedTarget{{Url: " https://a.com", Weight: 1, UseCount: 4}}},
+			&types.PathUrlPair{Path: "/split", Url: "https://a.com", Sticky: types.StickyCookie, Targets: []types.WeightedTarget{{Url: "https://a.com", Weight: 1}}},
+			false,
+		},
+		{
+			"Targets without weight",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/split", Url: "https://a.com", Targets: []types.WeightedTarget{{Url: "https://a.com"}}},
+			nil,
+			true,
+		},
+		{
+			"Canonicalize aliases and drop repeated ones",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"k8s/", "/k-8-s", "kube"}},
+			&types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}},
+			false,
+		},
+		{
+			"Alias of itself",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/kubernetes/"}},
+			nil,
+			true,
+		},
+		{
+			"Reserved alias",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/d/healthz"}},
+			nil,
+			true,
+		},
+		{
+			"Glob",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "pr/*", Url: "https://github.com/org/repo/pull/$1"},
+			&types.PathUrlPair{Path: "/pr/*", Url: "https://github.com/org/repo/pull/$1"},
+			false,
+		},
+		{
+			"Regex",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: ` ^bug(\d+)$ `, Url: "https://tracker/issue/$1"},
+			&types.PathUrlPair{Path: `^bug(\d+)$`, Url: "https://tracker/issue/$1"},
+			false,
+		},
+		{
+			"Invalid regex",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: `^bug(\d+$`, Url: "https://tracker/issue/$1"},
+			nil,
+			true,
+		},
+		{
+			"Pattern with aliases",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "pr/*", Url: "https://github.com/org/repo/pull/$1", Aliases: []string{"pull/1"}},
+			nil,
+			true,
+		},
+		{
+			"Pattern with targets",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "pr/*", Url: "https://a.com/$1", Targets: []types.WeightedTarget{{Url: "https://b.com/$1", Weight: 1}}},
+			nil,
+			true,
+		},
+		{
+			"Alias that is a pattern",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/pr", Url: "https://github.com/org/repo/pulls", Aliases: []string{"pull/*"}},
+			nil,
+			true,
+		},
+		{
+			"Rule without conditions",
+			nameOnlyMapper,
+			&types.PathUrlPair{Path: "/vpn", Url: "https://example.com", Rules: []types.RedirectRule{{Url: "https://example.com/mac"}}},
+			nil,
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := SanitizeInput(tt.mapper, tt.input)
 			if tt.wantErr {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrInvalidInput)
 			} else {
 				assert.NoError(t, err)
 				assert.True(t, tt.expected.Equals(tt.input), "Expected %v, got %v", tt.expected, tt.input)
 				assert.Equal(t, tt.mapper.GetName(), tt.input.Mapper)
 				assert.Equal(t, 0, tt.input.UseCount)
+				for _, target := range tt.input.Targets {
+					assert.Equal(t, 0, target.UseCount)
+				}
+				if tt.input.ActiveFrom != nil {
+					assert.Equal(t, time.UTC, tt.input.ActiveFrom.Location())
+				}
 			}
 		})
 	}
 }
 
+func TestSanitizeInputMap(t *testing.T) {
+	pairs := types.PathUrlPairMap{
+		"kubernetes": &types.PathUrlPair{Path: "kubernetes", Url: "https://kubernetes.io", Aliases: []string{"k8s"}},
+		"/docs":      &types.PathUrlPair{Path: "/docs", Url: "https://docs.example.com"},
+	}
+	assert.NoError(t, SanitizeInputMap(nameOnlyMapper, &pairs))
+	assert.Equal(t, []string{"/k8s"}, pairs["/kubernetes"].Aliases)
+
+	conflicts := []types.PathUrlPairMap{
+		{
+			"/kubernetes": &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/docs"}},
+			"/docs":       &types.PathUrlPair{Path: "/docs", Url: "https://docs.example.com"},
+		},
+		{
+			"/kubernetes": &types.PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s"}},
+			"/kube":       &types.PathUrlPair{Path: "/kube", Url: "https://kube.example.com", Aliases: []string{"/k8s"}},
+		},
+	}
+	for _, pairs := range conflicts {
+		assert.ErrorIs(t, SanitizeInputMap(nameOnlyMapper, &pairs), ErrInvalidInput)
+	}
+}
+
+func timeAt(hours int, extra time.Duration) *time.Time {
+	t := time.Date(2024, 1, 1, hours, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60)).Add(extra)
+	return &t
+}
+
 func TestSanitizeOutput(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -142,7 +284,15 @@ func TestCanonicalizePath(t *testing.T) {
 		{"Reserved path /d", "/d", "", true},
 		{"Reserved path /d/", "/d/example", "", true},
 		{"Not a reserved path /dd/", "/dd/example", "/dd/example", false},
+		{"Not a reserved path /healthz", "/health_z/", "/healthz", false},
+		{"Reserved path /d/readyz", "d/readyz", "", true},
+		{"Reserved path /d/search", "/d/search", "", true},
+		{"Not a reserved path /search", "search/", "/search", false},
+		{"Not a reserved path /search/", "/search/opensearch.xml", "/search/opensearchxml", false},
 		{"Invalid characters escaped", "/example/path with spaces", "/example/path%20with%20spaces", false},
+		{"Glob", "/pr-s/*/", "/prs/*", false},
+		{"Regex left as is", ` ^pr_(\d+)\.html$`, `^pr_(\d+)\.html$`, false},
+		{"Invalid regex", "^pr(", "", true},
 	}
 
 	for _, tt := range tests {
@@ -159,6 +309,144 @@ func TestCanonicalizePath(t *testing.T) {
 	}
 }
 
+func TestCanonicalizeNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"Noop", "teama", "teama", false},
+		{"Canonicalized like a path", "/Team_A/", "TeamA", false},
+		{"Hyphen removed", "team-a", "teama", false},
+		{"Several segments", "team/a", "", true},
+		{"Reserved", "d", "", true},
+		{"Pattern", "team*", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CanonicalizeNamespace(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestPersonalNamespace(t *testing.T) {
+	tests := []struct {
+		actor    string
+		expected string
+		wantErr  bool
+	}{
+		{"alice", "~alice", false},
+		{"alice.smith@corp.com", "~alice~2esmith~40corp~2ecom", false},
+		{"alice/admin", "~alice~2fadmin", false},
+		{"~alice", "~~7ealice", false},
+		{"", "", true},
+		{" ", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.actor, func(t *testing.T) {
+			result, err := PersonalNamespace(tt.actor)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+			assert.True(t, IsPersonal(result))
+			canonicalPath, err := CanonicalizePath(result + "/x")
+			assert.NoError(t, err)
+			assert.Equal(t, "/"+result+"/x", canonicalPath, "personal namespaces are canonical")
+			actor, ok := PersonalActor(result)
+			assert.True(t, ok)
+			assert.Equal(t, tt.actor, actor)
+		})
+	}
+}
+
+func TestPersonalNamespace_Distinct(t *testing.T) {
+	names := map[string]string{}
+	for _, actor := range []string{"jdoe", "j.doe", "j-doe", "j_doe", "J.doe", "j~2edoe"} {
+		name, err := PersonalNamespace(actor)
+		require.NoError(t, err)
+		assert.NotContains(t, names, name, "%s and %s share a namespace", actor, names[name])
+		names[name] = actor
+	}
+}
+
+func TestPersonalActor(t *testing.T) {
+	tests := []struct {
+		namespace string
+		actor     string
+		ok        bool
+	}{
+		{"~alice", "alice", true},
+		{"~j~2edoe", "j.doe", true},
+		{"~j~2Edoe", "", false},
+		{"~~61lice", "", false},
+		{"~alice~2", "", false},
+		{"~alice~zz", "", false},
+		{"~", "", false},
+		{"alice", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			actor, ok := PersonalActor(tt.namespace)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.actor, actor)
+		})
+	}
+}
+
+func TestNamespaceOf(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/deploy", ""},
+		{"/teama/deploy", "teama"},
+		{"/teama/deploy/prod", "teama"},
+		{"/teama/*", "teama"},
+		{"/~alice/me", "~alice"},
+		{`^teama/(\d+)$`, "teama"},
+		{`^teama(\d+)$`, ""},
+		{`^(teama)/x$`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NamespaceOf(tt.path))
+		})
+	}
+}
+
+func TestCanonicalizePrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"", "/"},
+		{"gh", "/gh"},
+		{" /go-ogle", "/google"},
+		{"team-a/", "/teama/"},
+		{"//team_a//de.p", "/teama/dep"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CanonicalizePrefix(tt.prefix))
+		})
+	}
+}
+
 func TestCanonicalizeUrl(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const (
+	instrumentationPrefix = "github.com/reimirno/golinks/"
+
+	ExporterStdout = "STDOUT"
+	ExporterFile   = "FILE"
+	ExporterOtlp   = "OTLP"
+)
+
+// Span attributes shared across services and mappers.
+const (
+	AttrPath          = attribute.Key("golinks.path")
+	AttrCanonicalPath = attribute.Key("golinks.path.canonical")
+	AttrMapperName    = attribute.Key("golinks.mapper.name")
+	AttrMapperType    = attribute.Key("golinks.mapper.type")
+	AttrFound         = attribute.Key("golinks.found")
+	AttrIncomplete    = attribute.Key("golinks.incomplete")
+	AttrCacheHit      = attribute.Key("golinks.cache.hit")
+)
+
+type Config struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"`    // stdout, file or otlp
+	Path        string  `mapstructure:"path"`        // output file for the file exporter
+	Endpoint    string  `mapstructure:"endpoint"`    // collector address for the otlp exporter
+	Insecure    bool    `mapstructure:"insecure"`    // disable TLS for the otlp exporter
+	SampleRatio float64 `mapstructure:"sampleRatio"` // 0 or unset means always sample
+}
+
+// Initialize installs the global tracer provider and propagator.
+// The returned function flushes pending spans and must be called on shutdown.
+// When tracing is disabled, the global no-op provider is kept and the shutdown function does nothing.
+func Initialize(cfg Config, serviceName string, serviceVersion string) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closer, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+func newExporter(cfg Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch strings.ToUpper(cfg.Exporter) {
+	case ExporterStdout, "":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case ExporterFile:
+		if cfg.Path == "" {
+			return nil, nil, fmt.Errorf("missing path for %s trace exporter", cfg.Exporter)
+		}
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	case ExporterOtlp:
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(context.Background(), opts...)
+		return exporter, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter: %s", cfg.Exporter)
+	}
+}
+
+// Tracer returns a named tracer from the global provider.
+// It is safe to call before Initialize; spans become no-ops until a provider is installed.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(instrumentationPrefix + name)
+}
+
+// RecordError marks the span as failed if err is not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// HttpMiddleware starts a server span for every request, named after the matched mux route.
+func HttpMiddleware(serviceName string) mux.MiddlewareFunc {
+	return otelhttp.NewMiddleware(serviceName,
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tpl, err := route.GetPathTemplate(); err == nil {
+					return fmt.Sprintf("%s %s", r.Method, tpl)
+				}
+			}
+			return fmt.Sprintf("%s %s", r.Method, operation)
+		}),
+	)
+}
+
+// GrpcServerOption starts a server span for every gRPC call.
+func GrpcServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// GrpcClientOption starts a client span for every outgoing gRPC call and propagates the trace.
+func GrpcClientOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
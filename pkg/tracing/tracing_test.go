@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitialize(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "disabled", cfg: Config{Enabled: false}},
+		{name: "disabled ignores bad exporter", cfg: Config{Enabled: false, Exporter: "invalid"}},
+		{name: "stdout", cfg: Config{Enabled: true, Exporter: "stdout"}},
+		{name: "file without path", cfg: Config{Enabled: true, Exporter: "file"}, wantErr: true},
+		{name: "unknown exporter", cfg: Config{Enabled: true, Exporter: "invalid"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Initialize(tt.cfg, "test", "0.0.0")
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, shutdown)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func TestInitialize_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Initialize(Config{Enabled: true, Exporter: "file", Path: path}, "test", "0.0.0")
+	assert.NoError(t, err)
+
+	_, span := Tracer("test").Start(context.Background(), "test-span")
+	span.SetAttributes(AttrMapperName.String("fake"))
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "test-span")
+	assert.Contains(t, string(content), "golinks.mapper.name")
+}
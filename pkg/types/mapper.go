@@ -1,6 +1,11 @@
 package types
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
 	"github.com/orsinium-labs/enum"
 )
 
@@ -10,14 +15,15 @@ type MapperIdentityProvider interface {
 }
 
 type MapperBasicOperator interface {
-	GetUrl(path string) (*PathUrlPair, error)
-	ListUrls(pagination Pagination) (PathUrlPairList, error)
-	PutUrl(pair *PathUrlPair) (*PathUrlPair, error)
-	DeleteUrl(path string) error
+	// GetUrl returns the pair at path or, if there is none, the pair that has path among its aliases.
+	GetUrl(ctx context.Context, path string) (*PathUrlPair, error)
+	ListUrls(ctx context.Context, pagination Pagination) (PathUrlPairList, error)
+	PutUrl(ctx context.Context, pair *PathUrlPair) (*PathUrlPair, error)
+	DeleteUrl(ctx context.Context, path string) error
 }
 
 type MapperExtendedOperator interface {
-	SearchUrls(query string, mode SearchMode, pagination Pagination) (PathUrlPairList, error)
+	SearchUrls(ctx context.Context, query string, mode SearchMode, pagination Pagination) (PathUrlPairList, error)
 }
 
 type MapperConfigurer interface {
@@ -35,9 +41,118 @@ type Mapper interface {
 	Teardown() error
 }
 
+// MapperPinger is implemented by mappers that can tell whether their backend is usable.
+// Mappers that do not implement it are always considered healthy.
+type MapperPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// MapperCounter is implemented by mappers that can increment a use count atomically.
+// The manager prefers it over reading the pair and writing it back,
+// which loses increments when several replicas share the mapper.
+// A mapper that does not count clicks at all, rather than have them written back, fails with errors.ErrUnsupported.
+type MapperCounter interface {
+	IncrementUseCount(ctx context.Context, path string) (int, error)
+}
+
+// MapperTargetCounter is implemented by mappers that can increment the use count of a target of a split pair atomically.
+// Mappers that count atomically but do not implement it do not count targets, rather than lose the atomic counts
+// by writing the pair back.
+type MapperTargetCounter interface {
+	IncrementTargetUseCount(ctx context.Context, path string, url string) (int, error)
+}
+
+// MapperReloader is implemented by mappers that reload their pairs from a source of their own, such as a file,
+// so that the manager can rebuild what it derives from the pairs of the mapper, like its patterns, after a reload.
+type MapperReloader interface {
+	// OnReload registers hook, called after every successful reload that may have changed the pairs, outside of any lock of the mapper.
+	OnReload(hook func())
+}
+
+// MapperHistory is implemented by mappers that keep a history of changes to their pairs.
+type MapperHistory interface {
+	// History returns the changes to path, most recent first, at most limit of them.
+	History(ctx context.Context, path string, limit int) ([]HistoryEntry, error)
+}
+
+type HistoryEntry struct {
+	Mapper   string    `json:"mapper"`
+	Revision string    `json:"revision"`
+	Author   string    `json:"author"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+	Url      string    `json:"url"` // empty when the change deleted the path
+}
+
+// MapperLinkChecks is implemented by mappers that can keep the last checks of the urls of pairs,
+// so that they outlive restarts and are shared by the servers sharing the mapper.
+// A mapper that wraps another one fails with errors.ErrUnsupported if the latter does not keep them.
+type MapperLinkChecks interface {
+	// PutLinkChecks saves checks, in place of the checks of the same paths.
+	PutLinkChecks(ctx context.Context, checks []LinkCheck) error
+	ListLinkChecks(ctx context.Context) ([]LinkCheck, error)
+	// DeleteLinkChecks drops the checks of paths, if there are any.
+	DeleteLinkChecks(ctx context.Context, paths ...string) error
+}
+
+const (
+	LinkStatusOk     = "ok"
+	LinkStatusBroken = "broken"
+)
+
+// LinkCheck is the outcome of the last check of the urls of a pair.
+type LinkCheck struct {
+	Path       string    `json:"path"`
+	Mapper     string    `json:"mapper"`
+	Status     string    `json:"status"` // ok or broken
+	CheckedAt  time.Time `json:"checkedAt"`
+	Url        string    `json:"url,omitempty"`        // the first broken url
+	StatusCode int       `json:"statusCode,omitempty"` // the status it answered with, if it answered
+	Reason     string    `json:"reason,omitempty"`
+}
+
+func (c LinkCheck) Broken() bool {
+	return c.Status == LinkStatusBroken
+}
+
+// MapperCache is implemented by mappers that keep copies of pairs from another store.
+// The manager invalidates them whenever a path is written through it.
+type MapperCache interface {
+	Invalidate(path string)
+	CacheStats() CacheStats
+}
+
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	NegativeHits int64 `json:"negativeHits"`
+	Evictions    int64 `json:"evictions"`
+	Size         int   `json:"size"`
+}
+
 type Pagination struct {
 	Offset int
 	Limit  int
+	// Cursor resumes listing after the last pair of a previous page, in path order.
+	// It is opaque to clients; when it is set, Offset is ignored.
+	Cursor string
+}
+
+// NewCursor returns the cursor that resumes listing after path.
+func NewCursor(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+// After returns the path that the cursor resumes after, or an empty string if there is no cursor.
+func (p Pagination) After() (string, error) {
+	if p.Cursor == "" {
+		return "", nil
+	}
+	path, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil || len(path) == 0 {
+		return "", fmt.Errorf("invalid cursor: %s", p.Cursor)
+	}
+	return string(path), nil
 }
 
 type SearchMode enum.Member[string]
@@ -2,7 +2,13 @@ package types
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"sort"
+	"strings"
+	"time"
+
+	"github.com/orsinium-labs/enum"
 )
 
 type PathUrlPairMap map[string]*PathUrlPair
@@ -14,6 +20,93 @@ type PathUrlPair struct {
 	Url      string `yaml:"url" json:"url" gorm:"not null"`
 	Mapper   string `gorm:"-"`
 	UseCount int    `gorm:"not null;default:0"`
+	// ActiveFrom and ExpiresAt bound the time the pair redirects; nil leaves that side open.
+	ActiveFrom *time.Time `yaml:"activeFrom,omitempty" json:"activeFrom,omitempty"`
+	ExpiresAt  *time.Time `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// Rules are tried in order; the first one that matches a request picks its target, Url is the default.
+	Rules []RedirectRule `yaml:"rules,omitempty" json:"rules,omitempty" gorm:"serializer:json"`
+	// Targets split the requests that no rule matched between several urls, by weight; Url is left to the other clients.
+	Targets []WeightedTarget `yaml:"targets,omitempty" json:"targets,omitempty" gorm:"serializer:json"`
+	// Sticky tells how a client keeps being sent to the same target: StickyCookie or StickyClient. Empty picks anew every time.
+	Sticky string `yaml:"sticky,omitempty" json:"sticky,omitempty"`
+	// Aliases are other paths that resolve to the pair, as if they were its own path.
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty" gorm:"serializer:json"`
+}
+
+// Ways a client keeps being sent to the same target of a split pair.
+const (
+	StickyCookie = "cookie" // a random client id kept in a cookie
+	StickyClient = "client" // a hash of the client address and user agent
+)
+
+// WeightedTarget is one of the urls that a pair splits requests between, with its own use count.
+type WeightedTarget struct {
+	Url      string `yaml:"url" json:"url"`
+	Weight   int    `yaml:"weight" json:"weight"` // relative to the sum of the weights of the pair; 0 disables the target
+	UseCount int    `yaml:"useCount,omitempty" json:"useCount,omitempty"`
+}
+
+// RedirectRule sends the requests that match all of its conditions to its own url. See pkg/rules.
+type RedirectRule struct {
+	Url      string            `yaml:"url" json:"url"`
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`   // header name -> glob matched against each value, case-insensitively
+	OS       []string          `yaml:"os,omitempty" json:"os,omitempty"`             // any of windows, macos, linux, android, ios, chromeos, as told by the user agent
+	Query    map[string]string `yaml:"query,omitempty" json:"query,omitempty"`       // query parameter -> glob matched against each value
+	CIDRs    []string          `yaml:"cidrs,omitempty" json:"cidrs,omitempty"`       // any of these client address ranges
+	Hours    string            `yaml:"hours,omitempty" json:"hours,omitempty"`       // time of day, e.g. 09:00-17:00, which may wrap past midnight
+	Timezone string            `yaml:"timezone,omitempty" json:"timezone,omitempty"` // of hours, UTC by default
+}
+
+func (r RedirectRule) Clone() RedirectRule {
+	r.Headers = maps.Clone(r.Headers)
+	r.OS = slices.Clone(r.OS)
+	r.Query = maps.Clone(r.Query)
+	r.CIDRs = slices.Clone(r.CIDRs)
+	return r
+}
+
+func (r RedirectRule) Equals(other RedirectRule) bool {
+	return r.Url == other.Url && maps.Equal(r.Headers, other.Headers) && slices.Equal(r.OS, other.OS) &&
+		maps.Equal(r.Query, other.Query) && slices.Equal(r.CIDRs, other.CIDRs) && r.Hours == other.Hours && r.Timezone == other.Timezone
+}
+
+type LinkState enum.Member[string]
+
+var (
+	LinkState_Active    = LinkState{"active"}
+	LinkState_Scheduled = LinkState{"scheduled"} // not active yet
+	LinkState_Expired   = LinkState{"expired"}
+	LinkStates          = enum.New(LinkState_Active, LinkState_Scheduled, LinkState_Expired)
+)
+
+// ParseLinkStates parses state names, which may also be given as comma-separated lists.
+func ParseLinkStates(names []string) ([]LinkState, error) {
+	var states []LinkState
+	for _, name := range names {
+		for _, part := range strings.Split(name, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if part == "" {
+				continue
+			}
+			state := LinkStates.Parse(part)
+			if state == nil {
+				return nil, fmt.Errorf("unknown link state %q, expected one of %v", part, LinkStates.Values())
+			}
+			states = append(states, *state)
+		}
+	}
+	return states, nil
+}
+
+// State tells whether the pair redirects at now.
+func (p *PathUrlPair) State(now time.Time) LinkState {
+	if p.ActiveFrom != nil && now.Before(*p.ActiveFrom) {
+		return LinkState_Scheduled
+	}
+	if p.ExpiresAt != nil && !now.Before(*p.ExpiresAt) {
+		return LinkState_Expired
+	}
+	return LinkState_Active
 }
 
 func (p PathUrlPair) String() string {
@@ -22,11 +115,43 @@ func (p PathUrlPair) String() string {
 
 func (p *PathUrlPair) Clone() *PathUrlPair {
 	return &PathUrlPair{
-		Path:     p.Path,
-		Url:      p.Url,
-		Mapper:   p.Mapper,
-		UseCount: p.UseCount,
+		Path:       p.Path,
+		Url:        p.Url,
+		Mapper:     p.Mapper,
+		UseCount:   p.UseCount,
+		ActiveFrom: cloneTime(p.ActiveFrom),
+		ExpiresAt:  cloneTime(p.ExpiresAt),
+		Rules:      cloneRules(p.Rules),
+		Targets:    slices.Clone(p.Targets),
+		Sticky:     p.Sticky,
+		Aliases:    slices.Clone(p.Aliases),
+	}
+}
+
+func cloneRules(rules []RedirectRule) []RedirectRule {
+	if rules == nil {
+		return nil
+	}
+	c := make([]RedirectRule, len(rules))
+	for i, rule := range rules {
+		c[i] = rule.Clone()
+	}
+	return c
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func timeEquals(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return a.Equal(*b)
 }
 
 func (p PathUrlPairMap) ToList() PathUrlPairList {
@@ -37,6 +162,17 @@ func (p PathUrlPairMap) ToList() PathUrlPairList {
 	return l
 }
 
+// Aliases maps every alias of the pairs to the path of its pair.
+func (p PathUrlPairMap) Aliases() map[string]string {
+	aliases := make(map[string]string)
+	for path, pair := range p {
+		for _, alias := range pair.Aliases {
+			aliases[alias] = path
+		}
+	}
+	return aliases
+}
+
 func (p PathUrlPairList) ToMap() PathUrlPairMap {
 	m := make(PathUrlPairMap)
 	for _, pair := range p {
@@ -62,14 +198,18 @@ func (p *PathUrlPairMap) Clone() *PathUrlPairMap {
 }
 
 func (p *PathUrlPair) Equals(other *PathUrlPair) bool {
-	// ignore Mapper and UseCount
+	// ignore Mapper and UseCount, also of targets
 	if p == nil && other == nil {
 		return true
 	}
 	if p == nil || other == nil {
 		return false
 	}
-	return p.Path == other.Path && p.Url == other.Url
+	return p.Path == other.Path && p.Url == other.Url &&
+		timeEquals(p.ActiveFrom, other.ActiveFrom) && timeEquals(p.ExpiresAt, other.ExpiresAt) &&
+		slices.EqualFunc(p.Rules, other.Rules, RedirectRule.Equals) &&
+		slices.EqualFunc(p.Targets, other.Targets, func(a, b WeightedTarget) bool { return a.Url == b.Url && a.Weight == b.Weight }) &&
+		p.Sticky == other.Sticky && slices.Equal(p.Aliases, other.Aliases)
 }
 
 func (m *PathUrlPairMap) Equals(other *PathUrlPairMap) bool {
@@ -109,7 +249,8 @@ func (l *PathUrlPairList) Equals(other *PathUrlPairList) bool {
 		return (*other)[i].Path < (*other)[j].Path
 	})
 	for i, pair := range *l {
-		if *pair != *(*other)[i] {
+		otherPair := (*other)[i]
+		if !pair.Equals(otherPair) || pair.Mapper != otherPair.Mapper || pair.UseCount != otherPair.UseCount {
 			return false
 		}
 	}
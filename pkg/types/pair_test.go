@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +43,26 @@ func TestPathUrlPair_Clone(t *testing.T) {
 			name:     "full pair",
 			original: &PathUrlPair{Path: "/test", Url: "https://example.com", Mapper: "testMapper", UseCount: 5},
 		},
+		{
+			name:     "timed pair",
+			original: &PathUrlPair{Path: "/test", Url: "https://example.com", ActiveFrom: timeAt(1), ExpiresAt: timeAt(2)},
+		},
+		{
+			name: "pair with rules",
+			original: &PathUrlPair{Path: "/test", Url: "https://example.com", Rules: []RedirectRule{
+				{Url: "https://example.com/de", Headers: map[string]string{"Accept-Language": "de*"}, OS: []string{"linux"}},
+			}},
+		},
+		{
+			name: "split pair",
+			original: &PathUrlPair{Path: "/test", Url: "https://example.com", Sticky: StickyCookie, Targets: []WeightedTarget{
+				{Url: "https://a.com", Weight: 9, UseCount: 3}, {Url: "https://b.com", Weight: 1},
+			}},
+		},
+		{
+			name:     "pair with aliases",
+			original: &PathUrlPair{Path: "/test", Url: "https://example.com", Aliases: []string{"/t", "/tst"}},
+		},
 		{
 			name:     "empty pair",
 			original: &PathUrlPair{},
@@ -53,6 +74,23 @@ func TestPathUrlPair_Clone(t *testing.T) {
 			clone := tt.original.Clone()
 			assert.NotSame(t, tt.original, clone, "Clone should return a new object")
 			assert.True(t, tt.original.Equals(clone), "Clone should be equal to original")
+			if len(tt.original.Aliases) > 0 {
+				clone.Aliases[0] = "/other"
+				assert.False(t, tt.original.Equals(clone), "Clone should copy aliases")
+			}
+			if tt.original.ExpiresAt != nil {
+				assert.NotSame(t, tt.original.ExpiresAt, clone.ExpiresAt, "Clone should copy times")
+			}
+			if len(tt.original.Rules) > 0 {
+				clone.Rules[0].Headers["Accept-Language"] = "fr*"
+				clone.Rules[0].OS[0] = "ios"
+				assert.False(t, tt.original.Equals(clone), "Clone should copy rules")
+			}
+			if len(tt.original.Targets) > 0 {
+				assert.Equal(t, tt.original.Targets, clone.Targets, "Clone should keep use counts of targets")
+				clone.Targets[0].Weight = 0
+				assert.False(t, tt.original.Equals(clone), "Clone should copy targets")
+			}
 		})
 	}
 }
@@ -152,6 +190,15 @@ func TestPathUrlPairMap_ToList(t *testing.T) {
 	}
 }
 
+func TestPathUrlPairMap_Aliases(t *testing.T) {
+	m := PathUrlPairMap{
+		"/kubernetes": &PathUrlPair{Path: "/kubernetes", Url: "https://kubernetes.io", Aliases: []string{"/k8s", "/kube"}},
+		"/docs":       &PathUrlPair{Path: "/docs", Url: "https://docs.example.com"},
+	}
+	assert.Equal(t, map[string]string{"/k8s": "/kubernetes", "/kube": "/kubernetes"}, m.Aliases())
+	assert.Empty(t, PathUrlPairMap{}.Aliases())
+}
+
 func TestPathUrlPairList_ToMap(t *testing.T) {
 	tests := []struct {
 		name string
@@ -207,6 +254,48 @@ func TestPathUrlPair_Equals(t *testing.T) {
 			p2:   &PathUrlPair{Path: "/test2", Url: "https://example2.com"},
 			want: false,
 		},
+		{
+			name: "equal times in different zones",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", ExpiresAt: timeAt(1)},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", ExpiresAt: inZone(timeAt(1))},
+			want: true,
+		},
+		{
+			name: "different times",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", ActiveFrom: timeAt(1)},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com"},
+			want: false,
+		},
+		{
+			name: "different rules",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", Rules: []RedirectRule{{Url: "https://a.com", OS: []string{"ios"}}}},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", Rules: []RedirectRule{{Url: "https://a.com", OS: []string{"android"}}}},
+			want: false,
+		},
+		{
+			name: "equal targets with different use counts",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", Targets: []WeightedTarget{{Url: "https://a.com", Weight: 1, UseCount: 3}}},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", Targets: []WeightedTarget{{Url: "https://a.com", Weight: 1}}},
+			want: true,
+		},
+		{
+			name: "different weights",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", Targets: []WeightedTarget{{Url: "https://a.com", Weight: 1}}},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", Targets: []WeightedTarget{{Url: "https://a.com", Weight: 2}}},
+			want: false,
+		},
+		{
+			name: "different sticky modes",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", Sticky: StickyClient},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", Sticky: StickyCookie},
+			want: false,
+		},
+		{
+			name: "different aliases",
+			p1:   &PathUrlPair{Path: "/test", Url: "https://example.com", Aliases: []string{"/t"}},
+			p2:   &PathUrlPair{Path: "/test", Url: "https://example.com", Aliases: []string{"/t", "/tst"}},
+			want: false,
+		},
 		{
 			name: "empty pairs",
 			p1:   &PathUrlPair{},
@@ -370,3 +459,49 @@ func TestPathUrlPairList_Equals(t *testing.T) {
 		})
 	}
 }
+
+func TestPathUrlPair_State(t *testing.T) {
+	now := *timeAt(2)
+	tests := []struct {
+		name string
+		pair *PathUrlPair
+		want LinkState
+	}{
+		{name: "no times", pair: &PathUrlPair{}, want: LinkState_Active},
+		{name: "within window", pair: &PathUrlPair{ActiveFrom: timeAt(1), ExpiresAt: timeAt(3)}, want: LinkState_Active},
+		{name: "activated just now", pair: &PathUrlPair{ActiveFrom: timeAt(2)}, want: LinkState_Active},
+		{name: "not active yet", pair: &PathUrlPair{ActiveFrom: timeAt(3)}, want: LinkState_Scheduled},
+		{name: "expired just now", pair: &PathUrlPair{ExpiresAt: timeAt(2)}, want: LinkState_Expired},
+		{name: "expired", pair: &PathUrlPair{ActiveFrom: timeAt(0), ExpiresAt: timeAt(1)}, want: LinkState_Expired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.pair.State(now))
+		})
+	}
+}
+
+func TestParseLinkStates(t *testing.T) {
+	states, err := ParseLinkStates([]string{"active, Expired", "", "scheduled"})
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkState{LinkState_Active, LinkState_Expired, LinkState_Scheduled}, states)
+
+	states, err = ParseLinkStates(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, states)
+
+	_, err = ParseLinkStates([]string{"dead"})
+	assert.Error(t, err)
+}
+
+// timeAt returns a time the given number of hours into 2024, in UTC.
+func timeAt(hours int) *time.Time {
+	t := time.Date(2024, 1, 1, hours, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func inZone(t *time.Time) *time.Time {
+	z := t.In(time.FixedZone("UTC+8", 8*60*60))
+	return &z
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ActorHeader names the user on whose behalf a request is made.
+// Golinks does not authenticate users itself: the header is expected to be set by a trusted proxy in front of it.
+const ActorHeader = "X-Golinks-Actor"
+
+// ErrPermissionDenied is wrapped by every error about an actor that may not do what it asked,
+// so that servers can tell them apart from invalid input and from failures of the mappers.
+var ErrPermissionDenied = errors.New("permission denied")
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the request, or an empty string if it is anonymous.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+func HttpActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if actor := strings.TrimSpace(r.Header.Get(ActorHeader)); actor != "" {
+			r = r.WithContext(WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func GrpcActorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(strings.ToLower(ActorHeader)); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+				ctx = WithActor(ctx, strings.TrimSpace(values[0]))
+			}
+		}
+		return handler(ctx, req)
+	}
+}
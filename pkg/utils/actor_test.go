@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHttpActorMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "with actor", header: "alice", want: "alice"},
+		{name: "blank actor", header: "  ", want: ""},
+		{name: "anonymous", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+			handler := HttpActorMiddleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got = ActorFromContext(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			if test.header != "" {
+				req.Header.Set(ActorHeader, test.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestGrpcActorInterceptor(t *testing.T) {
+	interceptor := GrpcActorInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return ActorFromContext(ctx), nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-golinks-actor", "alice"))
+	got, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", got)
+
+	got, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "", got)
+}
@@ -1,6 +1,10 @@
 package utils
 
-import "github.com/reimirno/golinks/pkg/types"
+import (
+	"sort"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
 
 func Paginate[T any](list []T, pagination types.Pagination) []T {
 	if pagination.Offset >= len(list) {
@@ -16,4 +20,30 @@ func Paginate[T any](list []T, pagination types.Pagination) []T {
 	return list[pagination.Offset:rightBound]
 }
 
+// PaginatePairs returns a page of pairs in path order, after the cursor if there is one, at the offset otherwise.
+// pairs may be in any order; it is left as is.
+func PaginatePairs(pairs types.PathUrlPairList, pagination types.Pagination) (types.PathUrlPairList, error) {
+	after, err := pagination.After()
+	if err != nil {
+		return nil, err
+	}
+	sorted := make(types.PathUrlPairList, len(pairs))
+	copy(sorted, pairs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	if after == "" {
+		return Paginate(sorted, pagination), nil
+	}
+	start := sort.Search(len(sorted), func(i int) bool { return sorted[i].Path > after })
+	return Paginate(sorted[start:], types.Pagination{Offset: 0, Limit: pagination.Limit}), nil
+}
+
+// NextCursor returns the cursor of the page after pairs, or an empty string if pairs is the last page.
+// A full page may be followed by an empty one.
+func NextCursor(pairs types.PathUrlPairList, pagination types.Pagination) string {
+	if len(pairs) == 0 || len(pairs) < pagination.Limit {
+		return ""
+	}
+	return types.NewCursor(pairs[len(pairs)-1].Path)
+}
+
 var DefaultPagination = types.Pagination{Offset: 0, Limit: 100}
@@ -90,3 +90,72 @@ func TestPaginate(t *testing.T) {
 		})
 	}
 }
+
+func TestPaginatePairs(t *testing.T) {
+	pairs := types.PathUrlPairList{
+		{Path: "/c", Url: "https://c.com"},
+		{Path: "/a", Url: "https://a.com"},
+		{Path: "/b", Url: "https://b.com"},
+	}
+	tests := []struct {
+		name       string
+		pagination types.Pagination
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "Offset",
+			pagination: types.Pagination{Offset: 1, Limit: 5},
+			want:       []string{"/b", "/c"},
+		},
+		{
+			name:       "Cursor",
+			pagination: types.Pagination{Cursor: types.NewCursor("/a"), Limit: 1},
+			want:       []string{"/b"},
+		},
+		{
+			name:       "Cursor between paths",
+			pagination: types.Pagination{Cursor: types.NewCursor("/aa"), Limit: 5},
+			want:       []string{"/b", "/c"},
+		},
+		{
+			name:       "Cursor takes precedence over offset",
+			pagination: types.Pagination{Offset: 2, Cursor: types.NewCursor("/a"), Limit: 5},
+			want:       []string{"/b", "/c"},
+		},
+		{
+			name:       "Cursor past the end",
+			pagination: types.Pagination{Cursor: types.NewCursor("/c"), Limit: 5},
+			want:       []string{},
+		},
+		{
+			name:       "Invalid cursor",
+			pagination: types.Pagination{Cursor: "!!", Limit: 5},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PaginatePairs(pairs, tt.pagination)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			paths := []string{}
+			for _, pair := range got {
+				paths = append(paths, pair.Path)
+			}
+			assert.Equal(t, tt.want, paths)
+			assert.Equal(t, "/c", pairs[0].Path, "input should be left as is")
+		})
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	pairs := types.PathUrlPairList{{Path: "/a"}, {Path: "/b"}}
+	assert.Equal(t, types.NewCursor("/b"), NextCursor(pairs, types.Pagination{Limit: 2}))
+	assert.Equal(t, "", NextCursor(pairs, types.Pagination{Limit: 3}))
+	assert.Equal(t, "", NextCursor(types.PathUrlPairList{}, types.Pagination{Limit: 0}))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/reimirno/golinks/pkg/sanitizer"
+)
+
+// HttpStatusFromError tells a request that ran out of time apart from one that failed,
+// so that a slow backend surfaces as 504 rather than as a generic 500,
+// invalid input as 400, and a denied actor as 403.
+func HttpStatusFromError(err error) int {
+	switch {
+	case errors.Is(err, sanitizer.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reimirno/golinks/pkg/sanitizer"
+)
+
+func TestHttpStatusFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "generic error", err: errors.New("boom"), want: http.StatusInternalServerError},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: http.StatusGatewayTimeout},
+		{name: "wrapped deadline exceeded", err: fmt.Errorf("mapper sql: %w", context.DeadlineExceeded), want: http.StatusGatewayTimeout},
+		{name: "canceled", err: context.Canceled, want: http.StatusServiceUnavailable},
+		{name: "invalid input", err: fmt.Errorf("mapper sql: %w", sanitizer.ErrInvalidRules("/vpn", errors.New("boom"))), want: http.StatusBadRequest},
+		{name: "permission denied", err: fmt.Errorf("%w: alice is not a member of teama", ErrPermissionDenied), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HttpStatusFromError(tt.err))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// Mapper types are registered by the packages that implement them, when they are imported
+// (see mapper.Register); the built-in ones are imported by pkg/mapper/builtin.
+//
+// To build golinks with a mapper kept out of this tree, add a file next to this one that imports
+// its package for its side effects, behind a build tag of its own:
+//
+//	//go:build golinks_acme
+//
+//	package main
+//
+//	import _ "example.com/acme/golinks-mapper"
+//
+// then add the module with `go get example.com/acme/golinks-mapper` and build with `go build -tags golinks_acme`.
+// Builds without the tag are left as they are.
@@ -2,19 +2,26 @@ package crud
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/reimirno/golinks/pkg/health"
 	"github.com/reimirno/golinks/pkg/logging"
 	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/pb"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
 	"github.com/reimirno/golinks/pkg/utils"
 )
@@ -63,7 +70,8 @@ func NewServer(m *mapper.MapperManager, port string, debug bool) (*Server, error
 	logger := logging.NewLogger(crudServiceName)
 
 	server := grpc.NewServer(
-		grpc.UnaryInterceptor(logging.GrpcInterceptor(logger)),
+		tracing.GrpcServerOption(),
+		grpc.ChainUnaryInterceptor(logging.GrpcInterceptor(logger), utils.GrpcActorInterceptor()),
 	)
 	service := &Server{
 		manager: m,
@@ -72,6 +80,7 @@ func NewServer(m *mapper.MapperManager, port string, debug bool) (*Server, error
 		server:  server,
 	}
 	pb.RegisterGolinksServer(server, service)
+	healthpb.RegisterHealthServer(server, health.NewGrpcServer(m, pb.Golinks_ServiceDesc.ServiceName))
 	if debug {
 		reflection.Register(server)
 	}
@@ -80,10 +89,11 @@ func NewServer(m *mapper.MapperManager, port string, debug bool) (*Server, error
 }
 
 func (s *Server) GetUrl(ctx context.Context, req *pb.GetUrlRequest) (*pb.PathUrlPair, error) {
-	pair, err := s.manager.GetUrl(req.Path, false)
+	pair, lookup, err := s.manager.GetUrlWithStatus(ctx, req.Path, false)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get url: %v", err)
+		return nil, errorStatus("failed to get url", err)
 	}
+	setLookupHeader(ctx, lookup)
 	if pair == nil {
 		return nil, status.Errorf(codes.NotFound, "path %s not found", req.Path)
 	}
@@ -92,17 +102,17 @@ func (s *Server) GetUrl(ctx context.Context, req *pb.GetUrlRequest) (*pb.PathUrl
 
 func (s *Server) PutUrl(ctx context.Context, req *pb.PathUrlPair) (*pb.PathUrlPair, error) {
 	pair := getStruct(req)
-	pair, err := s.manager.PutUrl(pair)
+	pair, err := s.manager.PutUrl(ctx, pair)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to put url: %v", err)
+		return nil, errorStatus("failed to put url", err)
 	}
 	return getProto(pair), nil
 }
 
 func (s *Server) DeleteUrl(ctx context.Context, req *pb.DeleteUrlRequest) (*emptypb.Empty, error) {
-	err := s.manager.DeleteUrl(req.Path)
+	err := s.manager.DeleteUrl(ctx, req.Path)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete url: %v", err)
+		return nil, errorStatus("failed to delete url", err)
 	}
 	return &emptypb.Empty{}, nil
 }
@@ -118,15 +128,68 @@ func (s *Server) ListUrls(ctx context.Context, req *pb.ListUrlsRequest) (*pb.Lis
 	if pagination.Limit == 0 {
 		pagination.Limit = utils.DefaultPagination.Limit
 	}
-	pairs, err := s.manager.ListUrls(*pagination)
+	if _, err := pagination.After(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	states, err := types.ParseLinkStates(req.States)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pairs, lookup, err := s.manager.ListUrlsInNamespace(ctx, req.Namespace, *pagination, states)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to list urls: %v", err)
+		return nil, errorStatus("failed to list urls", err)
 	}
 	result := make([]*pb.PathUrlPair, 0, len(pairs))
 	for _, pair := range pairs {
 		result = append(result, getProto(pair))
 	}
 	return &pb.ListUrlsResponse{
-		Pairs: result,
+		Pairs:          result,
+		Incomplete:     lookup.Incomplete(),
+		SkippedMappers: lookup.Skipped,
+		StaleMappers:   lookup.Stale,
+		NextCursor:     utils.NextCursor(pairs, *pagination),
 	}, nil
 }
+
+func (s *Server) Suggest(ctx context.Context, req *pb.SuggestRequest) (*pb.SuggestResponse, error) {
+	suggestions, err := s.manager.Suggest(ctx, req.Prefix, int(req.Limit))
+	if err != nil {
+		return nil, errorStatus("failed to suggest", err)
+	}
+	result := make([]*pb.Suggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		result = append(result, getSuggestionProto(suggestion))
+	}
+	return &pb.SuggestResponse{Suggestions: result}, nil
+}
+
+// errorStatus reports interrupted requests, invalid input and denied actors with their own codes, so that clients can tell
+// a deadline, a cancellation, a bad request or a forbidden one apart from a failure in a mapper.
+func errorStatus(msg string, err error) error {
+	code := codes.Internal
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		code = status.FromContextError(err).Code()
+	} else if errors.Is(err, sanitizer.ErrInvalidInput) {
+		code = codes.InvalidArgument
+	} else if errors.Is(err, utils.ErrPermissionDenied) {
+		code = codes.PermissionDenied
+	}
+	return status.Errorf(code, "%s: %v", msg, err)
+}
+
+// setLookupHeader reports an incomplete lookup in the response header metadata,
+// for responses that have no field of their own to carry it.
+func setLookupHeader(ctx context.Context, lookup mapper.LookupStatus) {
+	if !lookup.Incomplete() {
+		return
+	}
+	md := metadata.Pairs(strings.ToLower(mapper.HeaderIncomplete), "true")
+	for _, name := range lookup.Skipped {
+		md.Append(strings.ToLower(mapper.HeaderSkippedMappers), name)
+	}
+	for _, name := range lookup.Stale {
+		md.Append(strings.ToLower(mapper.HeaderStaleMappers), name)
+	}
+	_ = grpc.SetHeader(ctx, md)
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/pb"
@@ -29,6 +31,22 @@ var (
 		Path: "fk3",
 		Url:  "https://fake3.com",
 	}
+	fakePairRules = &types.PathUrlPair{
+		Path:  "vpn",
+		Url:   "https://vpn.com",
+		Rules: []types.RedirectRule{{Url: "https://vpn.com/office", CIDRs: []string{"10.0.0.0/8"}}},
+	}
+	fakePairSplit = &types.PathUrlPair{
+		Path:    "metrics",
+		Url:     "https://old.com",
+		Targets: []types.WeightedTarget{{Url: "https://old.com", Weight: 9}, {Url: "https://new.com", Weight: 1}},
+		Sticky:  types.StickyCookie,
+	}
+	fakePairAliased = &types.PathUrlPair{
+		Path:    "kubernetes",
+		Url:     "https://kubernetes.io",
+		Aliases: []string{"/k8s", "/kube"},
+	}
 
 	// When using it, please clone it first
 	mockConfigurer = &mapper.MockMapperConfigurer{
@@ -150,6 +168,9 @@ func TestServer_ListUrls(t *testing.T) {
 		wantErr       bool
 		numPairs      int
 		pagination    *types.Pagination
+		states        []string
+		namespace     string
+		wantCursor    string
 	}{
 		{
 			name:          "happy path",
@@ -166,6 +187,56 @@ func TestServer_ListUrls(t *testing.T) {
 			numPairs:      0,
 			pagination:    &types.Pagination{Offset: 10},
 		},
+		{
+			name:          "full page",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			numPairs:      1,
+			pagination:    &types.Pagination{Limit: 1},
+			wantCursor:    types.NewCursor("/fk"),
+		},
+		{
+			name:          "cursor",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			numPairs:      1,
+			pagination:    &types.Pagination{Cursor: types.NewCursor("/fk")},
+		},
+		{
+			name:          "invalid cursor",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantErr:       true,
+			pagination:    &types.Pagination{Cursor: "!!"},
+		},
+		{
+			name:          "states",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			numPairs:      2,
+			states:        []string{"active"},
+		},
+		{
+			name:          "states with no match",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			numPairs:      0,
+			states:        []string{"expired", "scheduled"},
+		},
+		{
+			name:          "invalid state",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantErr:       true,
+			states:        []string{"dead"},
+		},
+		{
+			name:          "unknown namespace",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantErr:       true,
+			namespace:     "team-a",
+		},
 	}
 
 	for _, test := range tests {
@@ -175,9 +246,14 @@ func TestServer_ListUrls(t *testing.T) {
 			server, err := NewServer(mm, "8081", false)
 			assert.NoError(t, err)
 			resp, err := server.ListUrls(context.Background(),
-				&pb.ListUrlsRequest{Pagination: getPaginationProto(test.pagination)})
+				&pb.ListUrlsRequest{Pagination: getPaginationProto(test.pagination), States: test.states, Namespace: test.namespace})
+			if test.wantErr {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
+			}
 			assert.NoError(t, err)
 			assert.Equal(t, test.numPairs, len(resp.GetPairs()))
+			assert.Equal(t, test.wantCursor, resp.GetNextCursor())
 		})
 	}
 }
@@ -207,6 +283,58 @@ func TestServer_PutUrl(t *testing.T) {
 			wantErr:       false,
 			want:          fakePair3,
 		},
+		{
+			name:          "happy path with rules",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          fakePairRules,
+			wantErr:       false,
+			want:          fakePairRules,
+		},
+		{
+			name:          "invalid rules should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          &types.PathUrlPair{Path: "vpn", Url: "https://vpn.com", Rules: []types.RedirectRule{{Url: "https://vpn.com/mac"}}},
+			wantErr:       true,
+		},
+		{
+			name:          "happy path with targets",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          fakePairSplit,
+			wantErr:       false,
+			want:          fakePairSplit,
+		},
+		{
+			name:          "invalid sticky mode should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          &types.PathUrlPair{Path: "metrics", Url: "https://old.com", Sticky: types.StickyClient},
+			wantErr:       true,
+		},
+		{
+			name:          "happy path with aliases",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          fakePairAliased,
+			wantErr:       false,
+			want:          fakePairAliased,
+		},
+		{
+			name:          "alias taken by another path should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          &types.PathUrlPair{Path: "kubernetes", Url: "https://kubernetes.io", Aliases: []string{"fk2"}},
+			wantErr:       true,
+		},
+		{
+			name:          "put by alias should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          &types.PathUrlPair{Path: "fk", Url: "https://fake.com", Aliases: []string{"fk"}},
+			wantErr:       true,
+		},
 	}
 
 	for _, test := range tests {
@@ -217,25 +345,38 @@ func TestServer_PutUrl(t *testing.T) {
 			assert.NoError(t, err)
 
 			resp, err := server.PutUrl(context.Background(), &pb.PathUrlPair{
-				Path: test.pair.Path,
-				Url:  test.pair.Url,
+				Path:    test.pair.Path,
+				Url:     test.pair.Url,
+				Rules:   getRulesProto(test.pair.Rules),
+				Targets: getTargetsProto(test.pair.Targets),
+				Sticky:  test.pair.Sticky,
+				Aliases: test.pair.Aliases,
 			})
 			if test.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				canonicalPath, err := sanitizer.CanonicalizePath(test.want.Path)
-				assert.NoError(t, err)
-				assert.Equal(t, canonicalPath, resp.GetPath())
-				assert.Equal(t, test.want.Url, resp.GetUrl())
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
 			}
-
-			resp, err = server.GetUrl(context.Background(), &pb.GetUrlRequest{Path: test.pair.Path})
 			assert.NoError(t, err)
 			canonicalPath, err := sanitizer.CanonicalizePath(test.want.Path)
 			assert.NoError(t, err)
 			assert.Equal(t, canonicalPath, resp.GetPath())
 			assert.Equal(t, test.want.Url, resp.GetUrl())
+
+			resp, err = server.GetUrl(context.Background(), &pb.GetUrlRequest{Path: test.pair.Path})
+			assert.NoError(t, err)
+			assert.Equal(t, canonicalPath, resp.GetPath())
+			assert.Equal(t, test.want.Url, resp.GetUrl())
+			assert.Equal(t, test.want.Rules, getRulesStruct(resp.GetRules()))
+			assert.Equal(t, test.want.Targets, getTargetsStruct(resp.GetTargets()))
+			assert.Equal(t, test.want.Sticky, resp.GetSticky())
+			assert.Equal(t, test.want.Aliases, resp.GetAliases())
+
+			// the aliases resolve to the pair
+			for _, alias := range test.want.Aliases {
+				resp, err = server.GetUrl(context.Background(), &pb.GetUrlRequest{Path: alias})
+				assert.NoError(t, err)
+				assert.Equal(t, canonicalPath, resp.GetPath())
+			}
 		})
 	}
 }
@@ -291,3 +432,75 @@ func TestServer_DeleteUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_Suggest(t *testing.T) {
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer}), mapper.WithPatterns(0))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8081", false)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      *pb.SuggestRequest
+		want     []string
+		wantCode codes.Code
+	}{
+		{name: "happy path", req: &pb.SuggestRequest{Prefix: "f"}, want: []string{"fk", "fk2"}},
+		{name: "limited", req: &pb.SuggestRequest{Prefix: "f", Limit: 1}, want: []string{"fk"}},
+		{name: "no match", req: &pb.SuggestRequest{Prefix: "x"}, want: []string{}},
+		{name: "personal without actor should fail", req: &pb.SuggestRequest{Prefix: "~/f"}, wantCode: codes.PermissionDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := server.Suggest(context.Background(), test.req)
+			if test.wantCode != codes.OK {
+				assert.Equal(t, test.wantCode, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			keywords := []string{}
+			for _, suggestion := range resp.Suggestions {
+				keywords = append(keywords, suggestion.Keyword)
+			}
+			assert.Equal(t, test.want, keywords)
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "generic error", err: assert.AnError, want: codes.Internal},
+		{name: "deadline exceeded", err: mapper.ErrMapperInterrupted("slow", context.DeadlineExceeded), want: codes.DeadlineExceeded},
+		{name: "canceled", err: context.Canceled, want: codes.Canceled},
+		{name: "invalid input", err: sanitizer.ErrInvalidRules("/vpn", assert.AnError), want: codes.InvalidArgument},
+		{name: "permission denied", err: mapper.ErrNotMember("bob", "teama"), want: codes.PermissionDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := errorStatus("failed", test.err)
+			assert.Equal(t, test.want, status.Code(err))
+		})
+	}
+}
+
+func TestServer_ListUrls_Incomplete(t *testing.T) {
+	failingConfigurer := &mapper.MockMapperConfigurer{Name: "failing", Err: assert.AnError}
+	mm, err := mapper.NewMapperManager("mock", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{failingConfigurer, mockConfigurer}),
+		mapper.WithMapperSettings(failingConfigurer.Name, mapper.MapperSettings{OnError: "skip"}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8081", false)
+	assert.NoError(t, err)
+
+	resp, err := server.ListUrls(context.Background(), &pb.ListUrlsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Pairs, len(mockConfigurer.StarterPairs))
+	assert.True(t, resp.Incomplete)
+	assert.Equal(t, []string{failingConfigurer.Name}, resp.SkippedMappers)
+	assert.Empty(t, resp.StaleMappers)
+}
@@ -1,26 +1,128 @@
 package crud
 
 import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/pb"
 	"github.com/reimirno/golinks/pkg/types"
 )
 
 func getProto(s *types.PathUrlPair) *pb.PathUrlPair {
 	return &pb.PathUrlPair{
+		Path:       s.Path,
+		Url:        s.Url,
+		Mapper:     s.Mapper,
+		UseCount:   int32(s.UseCount),
+		ActiveFrom: getTimeProto(s.ActiveFrom),
+		ExpiresAt:  getTimeProto(s.ExpiresAt),
+		Rules:      getRulesProto(s.Rules),
+		Targets:    getTargetsProto(s.Targets),
+		Sticky:     s.Sticky,
+		Aliases:    s.Aliases,
+	}
+}
+
+func getStruct(p *pb.PathUrlPair) *types.PathUrlPair {
+	return &types.PathUrlPair{
+		Path:       p.Path,
+		Url:        p.Url,
+		Mapper:     p.Mapper,
+		UseCount:   int(p.UseCount),
+		ActiveFrom: getTimeStruct(p.ActiveFrom),
+		ExpiresAt:  getTimeStruct(p.ExpiresAt),
+		Rules:      getRulesStruct(p.Rules),
+		Targets:    getTargetsStruct(p.Targets),
+		Sticky:     p.Sticky,
+		Aliases:    p.Aliases,
+	}
+}
+
+func getSuggestionProto(s mapper.Suggestion) *pb.Suggestion {
+	return &pb.Suggestion{
+		Keyword:  s.Keyword,
 		Path:     s.Path,
 		Url:      s.Url,
-		Mapper:   s.Mapper,
 		UseCount: int32(s.UseCount),
+		LastUsed: getTimeProto(s.LastUsed),
 	}
 }
 
-func getStruct(p *pb.PathUrlPair) *types.PathUrlPair {
-	return &types.PathUrlPair{
-		Path:     p.Path,
-		Url:      p.Url,
-		Mapper:   p.Mapper,
-		UseCount: int(p.UseCount),
+func getTimeProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func getTimeStruct(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+	s := t.AsTime()
+	return &s
+}
+
+func getRulesProto(rules []types.RedirectRule) []*pb.RedirectRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]*pb.RedirectRule, len(rules))
+	for i, r := range rules {
+		out[i] = &pb.RedirectRule{
+			Url:      r.Url,
+			Headers:  r.Headers,
+			Os:       r.OS,
+			Query:    r.Query,
+			Cidrs:    r.CIDRs,
+			Hours:    r.Hours,
+			Timezone: r.Timezone,
+		}
+	}
+	return out
+}
+
+func getRulesStruct(rules []*pb.RedirectRule) []types.RedirectRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]types.RedirectRule, len(rules))
+	for i, r := range rules {
+		out[i] = types.RedirectRule{
+			Url:      r.Url,
+			Headers:  r.Headers,
+			OS:       r.Os,
+			Query:    r.Query,
+			CIDRs:    r.Cidrs,
+			Hours:    r.Hours,
+			Timezone: r.Timezone,
+		}
+	}
+	return out
+}
+
+func getTargetsProto(targets []types.WeightedTarget) []*pb.WeightedTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+	out := make([]*pb.WeightedTarget, len(targets))
+	for i, t := range targets {
+		out[i] = &pb.WeightedTarget{Url: t.Url, Weight: int32(t.Weight), UseCount: int32(t.UseCount)}
+	}
+	return out
+}
+
+func getTargetsStruct(targets []*pb.WeightedTarget) []types.WeightedTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+	out := make([]types.WeightedTarget, len(targets))
+	for i, t := range targets {
+		out[i] = types.WeightedTarget{Url: t.Url, Weight: int(t.Weight), UseCount: int(t.UseCount)}
 	}
+	return out
 }
 
 func getPaginationProto(p *types.Pagination) *pb.Pagination {
@@ -30,6 +132,7 @@ func getPaginationProto(p *types.Pagination) *pb.Pagination {
 	return &pb.Pagination{
 		Offset: int32(p.Offset),
 		Limit:  int32(p.Limit),
+		Cursor: p.Cursor,
 	}
 }
 
@@ -40,5 +143,6 @@ func getPaginationStruct(p *pb.Pagination) *types.Pagination {
 	return &types.Pagination{
 		Offset: int(p.Offset),
 		Limit:  int(p.Limit),
+		Cursor: p.Cursor,
 	}
 }
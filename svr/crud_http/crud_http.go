@@ -10,13 +10,23 @@ import (
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
+	"github.com/reimirno/golinks/pkg/health"
 	"github.com/reimirno/golinks/pkg/logging"
 	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/opensearch"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
 	"github.com/reimirno/golinks/pkg/utils"
 )
 
-const crudHttpServiceName = "crud_http"
+const (
+	crudHttpServiceName = "crud_http"
+	defaultHistoryLimit = 20
+
+	// HeaderNextCursor is set on a page of pairs when there may be more; pass it as the cursor query parameter
+	// to get the next page.
+	HeaderNextCursor = "X-Golinks-Next-Cursor"
+)
 
 type Server struct {
 	manager *mapper.MapperManager
@@ -48,7 +58,9 @@ func (s *Server) Stop() error {
 func NewServer(m *mapper.MapperManager, port string) (*Server, error) {
 	r := mux.NewRouter()
 	l := logging.NewLogger(crudHttpServiceName)
+	r.Use(tracing.HttpMiddleware(crudHttpServiceName))
 	r.Use(logging.HttpMiddleware(l))
+	r.Use(utils.HttpActorMiddleware)
 	s := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
 		Handler: r,
@@ -59,10 +71,19 @@ func NewServer(m *mapper.MapperManager, port string) (*Server, error) {
 		manager: m,
 		port:    port,
 	}
-	r.HandleFunc("/go/{path}/", svr.handleGetUrl).Methods("GET")
+	health.RegisterHttp(r, m, "")
+	// paths may span several segments, e.g. those of namespaces, so history has a prefix of its own
+	r.HandleFunc("/go/{path:.+}/", svr.handleGetUrl).Methods("GET")
 	r.HandleFunc("/go/", svr.handleListUrls).Methods("GET")
 	r.HandleFunc("/go/", svr.handlePutUrl).Methods("PUT")
-	r.HandleFunc("/go/{path}/", svr.handleDeleteUrl).Methods("DELETE")
+	r.HandleFunc("/go/{path:.+}/", svr.handleDeleteUrl).Methods("DELETE")
+	r.HandleFunc("/history/{path:.+}/", svr.handleHistory).Methods("GET")
+	r.HandleFunc("/stats/cache/", svr.handleCacheStats).Methods("GET")
+	r.HandleFunc("/stats/mirrors/", svr.handleMirrorStats).Methods("GET")
+	r.HandleFunc("/stats/checks/", svr.handleCheckerStats).Methods("GET")
+	r.HandleFunc("/checks/broken/", svr.handleBrokenLinks).Methods("GET")
+	r.HandleFunc("/patterns/match/", svr.handleMatchPattern).Methods("GET")
+	r.HandleFunc("/suggest/", svr.handleSuggest).Methods("GET")
 	return svr, nil
 }
 
@@ -70,11 +91,12 @@ func (s *Server) handleGetUrl(rw http.ResponseWriter, r *http.Request) {
 	fmt.Println("handleGetUrl")
 	vars := mux.Vars(r)
 	path := vars["path"]
-	pair, err := s.manager.GetUrl(path, false)
+	pair, lookup, err := s.manager.GetUrlWithStatus(r.Context(), path, false)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
 		return
 	}
+	lookup.WriteHeaders(rw.Header())
 	if pair == nil {
 		http.Error(rw, fmt.Sprintf("path %s not found", path), http.StatusNotFound)
 		return
@@ -103,11 +125,25 @@ func (s *Server) handleListUrls(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	pairs, err := s.manager.ListUrls(pagination)
+	pagination.Cursor = r.URL.Query().Get("cursor")
+	if _, err := pagination.After(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	states, err := types.ParseLinkStates(r.URL.Query()["state"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pairs, lookup, err := s.manager.ListUrlsInNamespace(r.Context(), r.URL.Query().Get("namespace"), pagination, states)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
 		return
 	}
+	lookup.WriteHeaders(rw.Header())
+	if cursor := utils.NextCursor(pairs, pagination); cursor != "" {
+		rw.Header().Set(HeaderNextCursor, cursor)
+	}
 	rw.WriteHeader(http.StatusOK)
 	rw.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(rw).Encode(pairs)
@@ -120,9 +156,9 @@ func (s *Server) handlePutUrl(rw http.ResponseWriter, r *http.Request) {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
-	pairPut, err := s.manager.PutUrl(&pair)
+	pairPut, err := s.manager.PutUrl(r.Context(), &pair)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
 		return
 	}
 	rw.WriteHeader(http.StatusAccepted)
@@ -133,10 +169,110 @@ func (s *Server) handlePutUrl(rw http.ResponseWriter, r *http.Request) {
 func (s *Server) handleDeleteUrl(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	path := vars["path"]
-	err := s.manager.DeleteUrl(path)
+	err := s.manager.DeleteUrl(r.Context(), path)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
 		return
 	}
 	rw.WriteHeader(http.StatusNoContent)
 }
+
+func (s *Server) handleHistory(rw http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := s.manager.History(r.Context(), path, limit)
+	if err != nil {
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(entries)
+}
+
+// handleMatchPattern shows the pattern that the path query parameter would hit, with its urls expanded,
+// whether or not a path or an alias takes precedence over it.
+func (s *Server) handleMatchPattern(rw http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(rw, "missing path", http.StatusBadRequest)
+		return
+	}
+	pair, err := s.manager.MatchPattern(r.Context(), path)
+	if err != nil {
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
+		return
+	}
+	if pair == nil {
+		http.Error(rw, fmt.Sprintf("no pattern matches %s", path), http.StatusNotFound)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(pair)
+}
+
+// handleSuggest suggests the keywords that the q query parameter may be completed to, as JSON,
+// or in the OpenSearch suggestions format that browsers read if the format query parameter is opensearch.
+func (s *Server) handleSuggest(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	suggestions, err := s.manager.Suggest(r.Context(), query, limit)
+	if err != nil {
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
+		return
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(suggestions)
+	case "opensearch":
+		rw.Header().Set("Content-Type", opensearch.SuggestionsContentType)
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(opensearch.Suggestions(query, suggestions))
+	default:
+		http.Error(rw, fmt.Sprintf("unknown format: %s", format), http.StatusBadRequest)
+	}
+}
+
+func (s *Server) handleCacheStats(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(s.manager.CacheStats())
+}
+
+func (s *Server) handleMirrorStats(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(s.manager.MirrorStatus())
+}
+
+// handleCheckerStats sums up the last link checks, or shows null if the checker is off.
+func (s *Server) handleCheckerStats(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(s.manager.CheckerStatus())
+}
+
+// handleBrokenLinks lists the pairs whose urls were found broken by their last check.
+func (s *Server) handleBrokenLinks(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(s.manager.BrokenLinks(r.Context()))
+}
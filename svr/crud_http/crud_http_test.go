@@ -2,6 +2,7 @@ package crud_http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +18,7 @@ import (
 	"github.com/reimirno/golinks/pkg/mapper"
 	"github.com/reimirno/golinks/pkg/sanitizer"
 	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
 )
 
 var (
@@ -154,6 +157,9 @@ func TestServer_ListUrls(t *testing.T) {
 		numPairs      int
 		offset        string
 		limit         string
+		cursor        string
+		state         string
+		wantCursor    string
 	}{
 		{
 			name:          "happy path with default pagination",
@@ -177,6 +183,33 @@ func TestServer_ListUrls(t *testing.T) {
 			wantStatus:    http.StatusOK,
 			numPairs:      1,
 			limit:         "1",
+			wantCursor:    types.NewCursor("/fk"),
+		},
+		{
+			name:          "happy path with cursor",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusOK,
+			numPairs:      1,
+			cursor:        types.NewCursor("/fk"),
+		},
+		{
+			name:          "cursor takes precedence over offset",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusOK,
+			numPairs:      1,
+			offset:        "10",
+			limit:         "1",
+			cursor:        types.NewCursor("/fk"),
+			wantCursor:    types.NewCursor("/fk2"),
+		},
+		{
+			name:          "invalid cursor",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusBadRequest,
+			cursor:        "!!",
 		},
 		{
 			name:          "happy path with offset and limit",
@@ -186,6 +219,7 @@ func TestServer_ListUrls(t *testing.T) {
 			numPairs:      1,
 			offset:        "1",
 			limit:         "1",
+			wantCursor:    types.NewCursor("/fk2"), // full page, there may be more
 		},
 		{
 			name:          "offset exceeds list length",
@@ -209,6 +243,29 @@ func TestServer_ListUrls(t *testing.T) {
 			wantStatus:    http.StatusBadRequest,
 			limit:         "abc",
 		},
+		{
+			name:          "happy path with state",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusOK,
+			numPairs:      2,
+			state:         "active",
+		},
+		{
+			name:          "happy path with states and no match",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusOK,
+			numPairs:      0,
+			state:         "expired,scheduled",
+		},
+		{
+			name:          "happy path with invalid state",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			wantStatus:    http.StatusBadRequest,
+			state:         "dead",
+		},
 	}
 
 	for _, test := range tests {
@@ -228,6 +285,12 @@ func TestServer_ListUrls(t *testing.T) {
 			if test.limit != "" {
 				query.Add("limit", test.limit)
 			}
+			if test.cursor != "" {
+				query.Add("cursor", test.cursor)
+			}
+			if test.state != "" {
+				query.Add("state", test.state)
+			}
 			reqUrl.RawQuery = query.Encode()
 			urlStr := reqUrl.String()
 			req, err := http.NewRequest("GET", urlStr, nil)
@@ -248,6 +311,7 @@ func TestServer_ListUrls(t *testing.T) {
 				err = json.Unmarshal(body, &got)
 				assert.NoError(t, err)
 				assert.Equal(t, test.numPairs, len(got))
+				assert.Equal(t, test.wantCursor, rr.Header().Get(HeaderNextCursor))
 			}
 		})
 	}
@@ -278,6 +342,13 @@ func TestServer_PutUrl(t *testing.T) {
 			wantStatus:    http.StatusAccepted,
 			finalPair:     fakePair3,
 		},
+		{
+			name:          "invalid rules should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			pair:          &types.PathUrlPair{Path: "vpn", Url: "https://vpn.com", Rules: []types.RedirectRule{{Url: "https://vpn.com/mac", OS: []string{"beos"}}}},
+			wantStatus:    http.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -361,3 +432,226 @@ func TestServer_DeleteUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_CacheStats(t *testing.T) {
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/stats/cache/", server.handleCacheStats).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/stats/cache/", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var got map[string]types.CacheStats
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Empty(t, got)
+}
+
+func TestServer_MatchPattern(t *testing.T) {
+	patterned := &mapper.MockMapperConfigurer{
+		Name: "patterned",
+		StarterPairs: types.PathUrlPairMap{
+			"/fk/*": {Path: "/fk/*", Url: "https://fake.com/$1"},
+		},
+	}
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer, patterned}), mapper.WithPatterns(0))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		want       *types.PathUrlPair
+	}{
+		{name: "match", query: "?path=fk/docs", statusCode: http.StatusOK, want: &types.PathUrlPair{Path: "/fk/*", Url: "https://fake.com/docs"}},
+		{name: "no match", query: "?path=fk2", statusCode: http.StatusNotFound},
+		{name: "missing path", query: "", statusCode: http.StatusBadRequest},
+		{name: "invalid path", query: "?path=d/readyz", statusCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/patterns/match/"+test.query, nil))
+			assert.Equal(t, test.statusCode, rr.Code)
+			if test.want == nil {
+				return
+			}
+			var got types.PathUrlPair
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.True(t, test.want.Equals(&got), "Expected %v, got %v", test.want, got)
+		})
+	}
+}
+
+func TestServer_MirrorStats(t *testing.T) {
+	mirror := &mapper.MockMapperConfigurer{Name: "mirror"}
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer, mirror}),
+		mapper.WithMirrors([]mapper.MirrorSettings{{Name: mirror.Name, Mode: "async"}}, 0))
+	assert.NoError(t, err)
+	defer mm.Teardown()
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/stats/mirrors/", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var got []mapper.MirrorStatus
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, []mapper.MirrorStatus{{Name: mirror.Name, Mode: "async"}}, got)
+}
+
+func TestServer_History(t *testing.T) {
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	// mock mappers keep no history
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/history/fk/?limit=5", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var got []types.HistoryEntry
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Empty(t, got)
+
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/history/fk/?limit=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// a link whose last segment is history is read like any other
+	_, err = mm.PutUrl(context.Background(), &types.PathUrlPair{Path: "docs/history", Url: "https://docs.com/history"})
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/go/docs/history/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://docs.com/history")
+}
+
+func TestServer_Namespaces(t *testing.T) {
+	teamA := &mapper.MockMapperConfigurer{
+		Name: "teama",
+		StarterPairs: types.PathUrlPairMap{
+			"/teama/fk": {Path: "/teama/fk", Url: "https://a.com/fk"},
+		},
+	}
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer, teamA}),
+		mapper.WithNamespaces([]mapper.NamespaceSettings{{Name: "team-a", Mappers: []string{teamA.Name}, Persistor: teamA.Name, Members: []string{"alice"}, Private: true}}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		actor      string
+		statusCode int
+		want       []string
+	}{
+		{name: "get in a namespace", method: "GET", target: "/go/team-a/fk/", actor: "alice", statusCode: http.StatusOK},
+		{name: "get in a private namespace as a stranger", method: "GET", target: "/go/team-a/fk/", actor: "bob", statusCode: http.StatusForbidden},
+		{name: "history in a namespace", method: "GET", target: "/history/team-a/fk/", actor: "alice", statusCode: http.StatusOK},
+		{name: "list a namespace", method: "GET", target: "/go/?namespace=team-a", actor: "alice", statusCode: http.StatusOK, want: []string{"/teama/fk"}},
+		{name: "list a private namespace as a stranger", method: "GET", target: "/go/?namespace=team-a", actor: "bob", statusCode: http.StatusForbidden},
+		{name: "list an unknown namespace", method: "GET", target: "/go/?namespace=team-b", actor: "alice", statusCode: http.StatusBadRequest},
+		{name: "delete in a namespace as a stranger", method: "DELETE", target: "/go/team-a/fk/", actor: "bob", statusCode: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, nil)
+			req.Header.Set(utils.ActorHeader, test.actor)
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, req)
+			assert.Equal(t, test.statusCode, rr.Code)
+			if test.want == nil {
+				return
+			}
+			var got types.PathUrlPairList
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			var paths []string
+			for _, pair := range got {
+				paths = append(paths, pair.Path)
+			}
+			assert.Equal(t, test.want, paths)
+		})
+	}
+}
+
+func TestServer_BrokenLinks(t *testing.T) {
+	target := httptest.NewServer(http.NotFoundHandler())
+	defer target.Close()
+	checked := &mapper.MockMapperConfigurer{
+		Name: "checked",
+		StarterPairs: types.PathUrlPairMap{
+			"gone": {Path: "gone", Url: target.URL + "/gone"},
+		},
+	}
+	mm, err := mapper.NewMapperManager(checked.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{checked}),
+		mapper.WithChecker(mapper.CheckerSettings{Interval: 3600, HostDelay: 1, AllowPrivate: true}))
+	assert.NoError(t, err)
+	defer mm.Teardown()
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return mm.CheckerStatus().LastRun != nil }, 5*time.Second, 10*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/checks/broken/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var broken []types.LinkCheck
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &broken))
+	if assert.Len(t, broken, 1) {
+		assert.Equal(t, "/gone", broken[0].Path)
+		assert.Equal(t, http.StatusNotFound, broken[0].StatusCode)
+	}
+
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/stats/checks/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var stats mapper.CheckerStatus
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Checked)
+	assert.Equal(t, 1, stats.Broken)
+}
+
+func TestServer_Suggest(t *testing.T) {
+	mm, err := mapper.NewMapperManager(mockConfigurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer}), mapper.WithPatterns(0))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8082")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		query       string
+		statusCode  int
+		contentType string
+		want        string
+	}{
+		{name: "json", query: "?q=f&limit=1", statusCode: http.StatusOK, contentType: "application/json",
+			want: `[{"keyword":"fk","path":"/fk","url":"https://fake.com","useCount":0}]`},
+		{name: "opensearch", query: "?q=fk2&format=opensearch", statusCode: http.StatusOK, contentType: "application/x-suggestions+json",
+			want: `["fk2",["fk2"],["https://fake2.com"],["https://fake2.com"]]`},
+		{name: "invalid limit", query: "?q=f&limit=x", statusCode: http.StatusBadRequest},
+		{name: "unknown format", query: "?q=f&format=xml", statusCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/suggest/"+test.query, nil))
+			assert.Equal(t, test.statusCode, rr.Code)
+			if test.statusCode == http.StatusOK {
+				assert.Equal(t, test.contentType, rr.Header().Get("Content-Type"))
+				assert.JSONEq(t, test.want, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package redirector
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+// brokenNoticeDelay is how long, in seconds, the notice of a broken link is shown before following it anyway.
+const brokenNoticeDelay = 5
+
+var brokenNoticePage = template.Must(template.New("broken").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Delay}};url={{.Url}}">
+<title>{{.Path}} may be broken - golinks</title>
+</head>
+<body>
+<p>The last check of {{.Path}}, on {{.CheckedAt}}, found {{.Check.Url}} broken: {{.Check.Reason}}.</p>
+<p>It may be back since. You are taken to <a href="{{.Url}}">{{.Url}}</a> in {{.Delay}} seconds.</p>
+</body>
+</html>
+`))
+
+type brokenNotice struct {
+	Path      string
+	Url       string
+	Check     *types.LinkCheck
+	CheckedAt string
+	Delay     int
+}
+
+// wantsPage tells whether the client of r shows pages, as browsers do, rather than following redirects unseen.
+func wantsPage(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// writeBrokenNotice tells that path, which redirects to url, was found broken by check, then follows it.
+func (s *Server) writeBrokenNotice(rw http.ResponseWriter, path string, url string, check *types.LinkCheck) {
+	notice := brokenNotice{Path: path, Url: url, Check: check, CheckedAt: check.CheckedAt.Format(time.RFC3339), Delay: brokenNoticeDelay}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := brokenNoticePage.Execute(rw, notice); err != nil {
+		s.logger.Errorf("Failed to render the broken link notice of %s: %v", path, err)
+	}
+}
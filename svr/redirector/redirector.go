@@ -2,24 +2,44 @@ package redirector
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
+	"github.com/reimirno/golinks/pkg/health"
 	"github.com/reimirno/golinks/pkg/logging"
 	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/opensearch"
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/rules"
+	"github.com/reimirno/golinks/pkg/tracing"
 	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
 )
 
-const redirectorServiceName = "redirector"
+const (
+	redirectorServiceName = "redirector"
+
+	clientCookieMaxAge = 365 * 24 * 60 * 60 // in seconds
+
+	// the health probes are served under /d/, like search, so that links can be named healthz or readyz
+	probesPrefix = "/d"
+)
 
 type Server struct {
-	server  *http.Server
-	logger  *zap.SugaredLogger
-	manager *mapper.MapperManager
-	port    string
+	server    *http.Server
+	logger    *zap.SugaredLogger
+	manager   *mapper.MapperManager
+	port      string
+	publicUrl string // without a trailing slash; empty to use the host of each request
 }
 
 var _ types.Service = (*Server)(nil)
@@ -45,40 +65,132 @@ func (s *Server) Stop() error {
 	return err
 }
 
-func NewServer(m *mapper.MapperManager, port string) (*Server, error) {
+// NewServer serves the links of m on port. The OpenSearch description points browsers to publicUrl,
+// which must be set behind a proxy that terminates TLS; the scheme and host of each request are used when it is empty.
+func NewServer(m *mapper.MapperManager, port string, publicUrl string) (*Server, error) {
+	publicUrl = strings.TrimSuffix(publicUrl, "/")
+	if publicUrl != "" {
+		if u, err := url.Parse(publicUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid public url %q: must be an absolute http or https url", publicUrl)
+		}
+	}
 	r := mux.NewRouter()
 	l := logging.NewLogger(redirectorServiceName)
+	r.Use(tracing.HttpMiddleware(redirectorServiceName))
 	r.Use(logging.HttpMiddleware(l))
+	r.Use(utils.HttpActorMiddleware)
 	s := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
 		Handler: r,
 	}
 	svr := &Server{
-		server:  s,
-		logger:  l,
-		manager: m,
-		port:    port,
+		server:    s,
+		logger:    l,
+		manager:   m,
+		port:      port,
+		publicUrl: publicUrl,
 	}
-	r.HandleFunc("/{path}", svr.handleRedirect).Methods("GET")
+	health.RegisterHttp(r, m, probesPrefix)
+	r.HandleFunc(opensearch.SearchPath, svr.handleSearch).Methods("GET")
+	r.HandleFunc(opensearch.SuggestPath, svr.handleSearchSuggest).Methods("GET")
+	r.HandleFunc(opensearch.DescriptionPath, svr.handleOpenSearchDescription).Methods("GET")
+	// paths may span several segments, e.g. namespaced links of a dir mapper
+	r.HandleFunc("/{path:.+}", svr.handleRedirect).Methods("GET")
 	return svr, nil
 }
 
 func (s *Server) handleRedirect(rw http.ResponseWriter, r *http.Request) {
 	path := mux.Vars(r)["path"]
-	pair, err := s.manager.GetUrl(path, true)
-
 	handleError := func(rw http.ResponseWriter, msg string, err error, statusCode int) {
 		s.logger.Errorf("%s: %v", msg, err)
 		http.Error(rw, msg, statusCode)
 	}
+	// a pattern does not redirect itself, only the paths that match it do
+	if patterns.IsPattern(strings.TrimSpace(path)) {
+		handleError(rw, fmt.Sprintf("Mapping not found: %s", path), nil, http.StatusNotFound)
+		return
+	}
+	pair, lookup, err := s.manager.GetUrlWithStatus(r.Context(), path, true)
 	if err != nil {
-		handleError(rw, fmt.Sprintf("Error occurred when resolving path: %v", err), err, http.StatusInternalServerError)
+		handleError(rw, fmt.Sprintf("Error occurred when resolving path: %v", err), err, utils.HttpStatusFromError(err))
 		return
 	}
+	lookup.WriteHeaders(rw.Header())
 	if pair != nil {
-		s.logger.Infof("Mapping found: %s -> %s", path, pair.Url)
-		http.Redirect(rw, r, pair.Url, http.StatusFound)
+		s.redirect(rw, r, path, pair, lookup)
+		return
+	}
+	if lookup.Incomplete() {
+		handleError(rw, fmt.Sprintf("Mapping not found: %s (some mappers are unavailable, it may exist there)", path), nil, http.StatusNotFound)
 		return
 	}
 	handleError(rw, fmt.Sprintf("Mapping not found: %s", path), nil, http.StatusNotFound)
 }
+
+// redirect answers a request for path with pair, the pair that it was resolved to,
+// or tells why it does not redirect now.
+func (s *Server) redirect(rw http.ResponseWriter, r *http.Request, path string, pair *types.PathUrlPair, lookup mapper.LookupStatus) {
+	now := time.Now()
+	switch pair.State(now) {
+	case types.LinkState_Expired:
+		s.logger.Infof("Mapping expired: %s", path)
+		http.Error(rw, fmt.Sprintf("Link %s expired on %s", path, pair.ExpiresAt.Format(time.RFC3339)), http.StatusGone)
+		return
+	case types.LinkState_Scheduled:
+		s.logger.Infof("Mapping not active yet: %s", path)
+		http.Error(rw, fmt.Sprintf("Link %s is coming soon: it is active from %s", path, pair.ActiveFrom.Format(time.RFC3339)), http.StatusNotFound)
+		return
+	}
+	req := rules.FromHttp(r, now)
+	if len(pair.Targets) > 0 {
+		req.SplitKey = splitKey(rw, r, pair, req)
+	}
+	url, target := rules.Resolve(pair, req)
+	// a pair answered from stale data cannot be counted, as its mapper is failing
+	if target >= 0 && !slices.Contains(lookup.Stale, pair.Mapper) {
+		if err := s.manager.IncrementTargetUseCount(r.Context(), pair, url); err != nil {
+			s.logger.Errorf("Failed to count target %s of %s: %v", url, path, err)
+		}
+	}
+	if check := s.manager.LinkCheck(pair.Path); check != nil && check.Broken() {
+		// still redirected, as the url may be back since it was checked; browsers are told first
+		s.logger.Warnf("Mapping %s was found broken at %s: %s", path, check.Url, check.Reason)
+		rw.Header().Set(mapper.HeaderBrokenUrl, fmt.Sprintf("%s: %s", check.Url, check.Reason))
+		if wantsPage(r) {
+			s.logger.Infof("Mapping found: %s -> %s, after a notice", path, url)
+			s.writeBrokenNotice(rw, path, url, check)
+			return
+		}
+	}
+	s.logger.Infof("Mapping found: %s -> %s", path, url)
+	http.Redirect(rw, r, url, http.StatusFound)
+}
+
+// splitKey identifies the client for the sticky mode of a split pair, or returns an empty string to pick at random.
+// With types.StickyCookie, a client without the cookie is given a new random id.
+func splitKey(rw http.ResponseWriter, r *http.Request, pair *types.PathUrlPair, req rules.Request) string {
+	switch pair.Sticky {
+	case types.StickyCookie:
+		if cookie, err := r.Cookie(rules.ClientCookie); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return ""
+		}
+		cookie := &http.Cookie{
+			Name:     rules.ClientCookie,
+			Value:    hex.EncodeToString(id),
+			Path:     "/",
+			MaxAge:   clientCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		http.SetCookie(rw, cookie)
+		return cookie.Value
+	case types.StickyClient:
+		return rules.ClientKey(req)
+	default:
+		return ""
+	}
+}
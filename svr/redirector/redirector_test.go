@@ -1,15 +1,20 @@
 package redirector
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/rules"
 	"github.com/reimirno/golinks/pkg/types"
+	"github.com/reimirno/golinks/pkg/utils"
 )
 
 var (
@@ -53,6 +58,7 @@ func TestNewServer(t *testing.T) {
 		configurers   []*mapper.MockMapperConfigurer
 		persistorName string
 		port          string
+		publicUrl     string
 		wantErr       bool
 	}{
 		{
@@ -62,13 +68,28 @@ func TestNewServer(t *testing.T) {
 			port:          "8080",
 			wantErr:       false,
 		},
+		{
+			name:          "public url",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			port:          "8080",
+			publicUrl:     "https://go.example.com/",
+		},
+		{
+			name:          "relative public url should fail",
+			configurers:   []*mapper.MockMapperConfigurer{mockConfigurer},
+			persistorName: "mock",
+			port:          "8080",
+			publicUrl:     "go.example.com",
+			wantErr:       true,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			mm, err := mapper.NewMapperManager(test.persistorName, mapper.CloneConfigurers(test.configurers))
 			assert.NoError(t, err)
 			assert.NotNil(t, mm)
-			server, err := NewServer(mm, test.port)
+			server, err := NewServer(mm, test.port, test.publicUrl)
 			if test.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, server)
@@ -134,7 +155,7 @@ func TestServer_handleRedirect(t *testing.T) {
 			mm, err := mapper.NewMapperManager(test.persistorName, mapper.CloneConfigurers(test.configurers))
 			assert.NoError(t, err)
 			assert.NotNil(t, mm)
-			server, err := NewServer(mm, "8080")
+			server, err := NewServer(mm, "8080", "")
 			assert.NoError(t, err)
 			assert.NotNil(t, server)
 
@@ -155,3 +176,319 @@ func TestServer_handleRedirect(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_handleRedirect_Timed(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	configurer := &mapper.MockMapperConfigurer{
+		Name: "timed",
+		StarterPairs: types.PathUrlPairMap{
+			"expired":   {Path: "expired", Url: "https://expired.com", ExpiresAt: &past},
+			"scheduled": {Path: "scheduled", Url: "https://scheduled.com", ActiveFrom: &future},
+			"window":    {Path: "window", Url: "https://window.com", ActiveFrom: &past, ExpiresAt: &future},
+		},
+	}
+	tests := []struct {
+		path       string
+		statusCode int
+		message    string
+	}{
+		{path: "expired", statusCode: http.StatusGone, message: "expired on"},
+		{path: "scheduled", statusCode: http.StatusNotFound, message: "coming soon"},
+		{path: "window", statusCode: http.StatusFound},
+	}
+
+	mm, err := mapper.NewMapperManager(configurer.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{configurer}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+test.path, nil)
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.statusCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), test.message)
+		})
+	}
+}
+
+func TestServer_handleRedirect_Incomplete(t *testing.T) {
+	failingConfigurer := &mapper.MockMapperConfigurer{Name: "failing", StarterPairs: mockConfigurerAlt.StarterPairs, Err: assert.AnError}
+	mm, err := mapper.NewMapperManager("mock", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{failingConfigurer, mockConfigurer}),
+		mapper.WithMapperSettings(failingConfigurer.Name, mapper.MapperSettings{OnError: "skip"}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+	r := mux.NewRouter()
+	r.HandleFunc("/{path}", server.handleRedirect).Methods("GET")
+
+	// the failing mapper would take precedence for "fk"
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/fk", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, fakePair.Url, rr.Header().Get("Location"))
+	assert.Equal(t, "true", rr.Header().Get(mapper.HeaderIncomplete))
+	assert.Equal(t, failingConfigurer.Name, rr.Header().Get(mapper.HeaderSkippedMappers))
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/invalid", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "some mappers are unavailable")
+}
+
+func TestServer_HealthRoutes(t *testing.T) {
+	mm, err := mapper.NewMapperManager("mock", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{mockConfigurer}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	// probes are matched before paths
+	for _, path := range []string{"/d/healthz", "/d/readyz"} {
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+	}
+	// and leave the paths of their names to links
+	_, err = mm.PutUrl(context.Background(), &types.PathUrlPair{Path: "healthz", Url: "https://status.example.com"})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://status.example.com", rr.Header().Get("Location"))
+
+	mm.BeginShutdown()
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/d/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestServer_NestedPath(t *testing.T) {
+	nested := &mapper.MockMapperConfigurer{
+		Name: "nested",
+		StarterPairs: types.PathUrlPairMap{
+			"/team/wiki": {Path: "/team/wiki", Url: "https://wiki.com"},
+		},
+	}
+	mm, err := mapper.NewMapperManager("nested", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{nested}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/team/wiki", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://wiki.com", rr.Header().Get("Location"))
+}
+
+func TestServer_Patterns(t *testing.T) {
+	patterned := &mapper.MockMapperConfigurer{
+		Name: "patterned",
+		StarterPairs: types.PathUrlPairMap{
+			"/pr/1":      {Path: "/pr/1", Url: "https://first.com"},
+			"/pr/*":      {Path: "/pr/*", Url: "https://github.com/org/repo/pull/$1"},
+			`^bug(\d+)$`: {Path: `^bug(\d+)$`, Url: "https://tracker/issue/$1"},
+		},
+	}
+	mm, err := mapper.NewMapperManager("patterned", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{patterned}), mapper.WithPatterns(0))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path        string
+		statusCode  int
+		redirectUrl string
+	}{
+		{"/pr/12", http.StatusFound, "https://github.com/org/repo/pull/12"},
+		{"/pr/1", http.StatusFound, "https://first.com"},
+		{"/bug-7", http.StatusFound, "https://tracker/issue/7"},
+		{"/bugs", http.StatusNotFound, ""},
+		{"/pr/*", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		assert.Equal(t, test.statusCode, rr.Code, test.path)
+		assert.Equal(t, test.redirectUrl, rr.Header().Get("Location"), test.path)
+	}
+
+	// the clicks on the paths that match a pattern are counted by the pattern
+	pair, err := mm.GetUrl(context.Background(), "/pr/*", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pair.UseCount)
+}
+
+func TestServer_PersonalLinks(t *testing.T) {
+	shared := &mapper.MockMapperConfigurer{
+		Name: "shared",
+		StarterPairs: types.PathUrlPairMap{
+			"/me":        {Path: "/me", Url: "https://wiki.com/people"},
+			"/~alice/me": {Path: "/~alice/me", Url: "https://wiki.com/people/alice"},
+		},
+	}
+	mm, err := mapper.NewMapperManager("shared", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{shared}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path        string
+		actor       string
+		statusCode  int
+		redirectUrl string
+	}{
+		{"/me", "alice", http.StatusFound, "https://wiki.com/people/alice"},
+		{"/me", "bob", http.StatusFound, "https://wiki.com/people"},
+		{"/me", "", http.StatusFound, "https://wiki.com/people"},
+		{"/~/me", "alice", http.StatusFound, "https://wiki.com/people/alice"},
+		{"/~/me", "", http.StatusForbidden, ""},
+		{"/~alice/me", "bob", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set(utils.ActorHeader, test.actor)
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, test.statusCode, rr.Code, test.path+" as "+test.actor)
+		assert.Equal(t, test.redirectUrl, rr.Header().Get("Location"), test.path+" as "+test.actor)
+	}
+}
+
+func TestServer_BrokenLinks(t *testing.T) {
+	target := httptest.NewServer(http.NotFoundHandler())
+	defer target.Close()
+	checked := &mapper.MockMapperConfigurer{
+		Name: "checked",
+		StarterPairs: types.PathUrlPairMap{
+			"/gone": {Path: "/gone", Url: target.URL + "/gone"},
+			"/fk":   {Path: "/fk", Url: "mailto:fake@fake.com"},
+		},
+	}
+	mm, err := mapper.NewMapperManager(checked.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{checked}),
+		mapper.WithChecker(mapper.CheckerSettings{Interval: 3600, HostDelay: 1, AllowPrivate: true}))
+	assert.NoError(t, err)
+	defer mm.Teardown()
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return mm.CheckerStatus().LastRun != nil }, 5*time.Second, 10*time.Millisecond)
+
+	tests := []struct {
+		path       string
+		wantBroken string
+	}{
+		{"/gone", target.URL + "/gone: Not Found"},
+		{"/fk", ""},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		assert.Equal(t, http.StatusFound, rr.Code, test.path)
+		assert.Equal(t, test.wantBroken, rr.Header().Get(mapper.HeaderBrokenUrl), test.path)
+	}
+
+	// browsers are shown a notice before they are taken to the link
+	req := httptest.NewRequest("GET", "/gone", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "found "+target.URL+"/gone broken: Not Found")
+	assert.Contains(t, rr.Body.String(), `<meta http-equiv="refresh" content="5;url=`+target.URL+`/gone">`)
+	rr = httptest.NewRecorder()
+	req.URL.Path = "/fk"
+	server.server.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusFound, rr.Code)
+}
+
+func TestServer_Rules(t *testing.T) {
+	ruled := &mapper.MockMapperConfigurer{
+		Name: "ruled",
+		StarterPairs: types.PathUrlPairMap{
+			"/vpn": {Path: "/vpn", Url: "https://vpn.com", Rules: []types.RedirectRule{
+				{Url: "https://vpn.com/windows", OS: []string{rules.OSWindows}},
+				{Url: "https://vpn.com/office", CIDRs: []string{"10.0.0.0/8"}},
+			}},
+		},
+	}
+	mm, err := mapper.NewMapperManager("ruled", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{ruled}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		userAgent   string
+		remoteAddr  string
+		redirectUrl string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "10.1.1.1:1234", "https://vpn.com/windows"},
+		{"Mozilla/5.0 (X11; Linux x86_64)", "10.1.1.1:1234", "https://vpn.com/office"},
+		{"Mozilla/5.0 (X11; Linux x86_64)", "192.168.1.1:1234", "https://vpn.com"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/vpn", nil)
+		req.Header.Set("User-Agent", test.userAgent)
+		req.RemoteAddr = test.remoteAddr
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, test.redirectUrl, rr.Header().Get("Location"), test)
+	}
+}
+
+func TestServer_Split(t *testing.T) {
+	split := &mapper.MockMapperConfigurer{
+		Name: "split",
+		StarterPairs: types.PathUrlPairMap{
+			"/metrics": {Path: "/metrics", Url: "https://old.com", Sticky: types.StickyCookie, Targets: []types.WeightedTarget{
+				{Url: "https://old.com", Weight: 0},
+				{Url: "https://new.com", Weight: 1},
+			}},
+			"/dash": {Path: "/dash", Url: "https://a.com", Sticky: types.StickyClient, Targets: []types.WeightedTarget{
+				{Url: "https://a.com", Weight: 1},
+				{Url: "https://b.com", Weight: 1},
+			}},
+		},
+	}
+	mm, err := mapper.NewMapperManager("split", mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{split}))
+	assert.NoError(t, err)
+	server, err := NewServer(mm, "8080", "")
+	assert.NoError(t, err)
+
+	// a new client is given a cookie, and the pick is counted
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://new.com", rr.Header().Get("Location"))
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, rules.ClientCookie, cookies[0].Name)
+	}
+	pair, err := mm.GetUrl(context.Background(), "metrics", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pair.UseCount)
+	assert.Equal(t, []int{0, 1}, []int{pair.Targets[0].UseCount, pair.Targets[1].UseCount})
+
+	// a client with a cookie keeps it
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	assert.Empty(t, rr.Result().Cookies())
+
+	// a client sticks to its target
+	var first string
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "/dash", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+		rr := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rr, req)
+		if first == "" {
+			first = rr.Header().Get("Location")
+		}
+		assert.Equal(t, first, rr.Header().Get("Location"))
+	}
+	pair, err = mm.GetUrl(context.Background(), "dash", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, pair.Targets[0].UseCount+pair.Targets[1].UseCount)
+}
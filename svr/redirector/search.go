@@ -0,0 +1,132 @@
+package redirector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/opensearch"
+	"github.com/reimirno/golinks/pkg/patterns"
+	"github.com/reimirno/golinks/pkg/sanitizer"
+	"github.com/reimirno/golinks/pkg/utils"
+)
+
+// searchResultsLimit is how many links the search results page suggests.
+const searchResultsLimit = 20
+
+var searchResultsPage = template.Must(template.New("search").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Query}}{{.Query}} - {{end}}golinks</title>
+<link rel="search" type="application/opensearchdescription+xml" title="golinks" href="{{.DescriptionPath}}">
+</head>
+<body>
+<form action="{{.SearchPath}}"><input name="q" value="{{.Query}}" autofocus> <button>Go</button></form>
+{{if .Query}}<p>No link for {{.Query}}.</p>{{end}}
+{{if .Suggestions}}<ul>
+{{range .Suggestions}}<li><a href="/{{.Keyword}}">{{.Keyword}}</a> {{.Url}}</li>
+{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+type searchResults struct {
+	Query           string
+	Suggestions     []mapper.Suggestion
+	SearchPath      string
+	DescriptionPath string
+}
+
+// searchPath returns the path that a search query stands for: its words are the segments of the path,
+// so that the words after a keyword are the arguments of its pattern, e.g. "gh golang go" for gh/*.
+// The go/ that the query may be pasted with is left out.
+func searchPath(query string) string {
+	query = strings.TrimPrefix(strings.TrimSpace(query), "go/")
+	return strings.Join(strings.Fields(query), "/")
+}
+
+// handleSearch resolves the q query parameter like a path typed after go/, with its words as segments,
+// and redirects to the link it resolves to, or shows the links it may be completed to.
+func (s *Server) handleSearch(rw http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	path := searchPath(query)
+	// a pattern does not redirect itself, only the paths that match it do
+	if path != "" && !patterns.IsPattern(path) {
+		pair, lookup, err := s.manager.GetUrlWithStatus(r.Context(), path, true)
+		if err != nil && !errors.Is(err, sanitizer.ErrInvalidInput) {
+			s.logger.Errorf("Error occurred when searching %s: %v", query, err)
+			http.Error(rw, fmt.Sprintf("Error occurred when resolving path: %v", err), utils.HttpStatusFromError(err))
+			return
+		}
+		lookup.WriteHeaders(rw.Header())
+		if pair != nil {
+			s.redirect(rw, r, path, pair, lookup)
+			return
+		}
+	}
+
+	results := searchResults{Query: query, SearchPath: opensearch.SearchPath, DescriptionPath: opensearch.DescriptionPath}
+	prefixes := []string{path}
+	if first, _, found := strings.Cut(path, "/"); found {
+		prefixes = append(prefixes, first)
+	}
+	for _, prefix := range prefixes {
+		suggestions, err := s.manager.Suggest(r.Context(), prefix, searchResultsLimit)
+		if err != nil {
+			s.logger.Warnf("Failed to suggest links for %s: %v", prefix, err)
+			continue
+		}
+		if results.Suggestions = suggestions; len(suggestions) > 0 {
+			break
+		}
+	}
+	s.logger.Infof("No link for search %s, %d suggested", query, len(results.Suggestions))
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if query != "" {
+		rw.WriteHeader(http.StatusNotFound)
+	}
+	if err := searchResultsPage.Execute(rw, results); err != nil {
+		s.logger.Errorf("Failed to render search results for %s: %v", query, err)
+	}
+}
+
+// handleSearchSuggest suggests the keywords that the q query parameter may be completed to,
+// in the OpenSearch suggestions format.
+func (s *Server) handleSearchSuggest(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	suggestions, err := s.manager.Suggest(r.Context(), searchPath(query), 0)
+	if err != nil {
+		http.Error(rw, err.Error(), utils.HttpStatusFromError(err))
+		return
+	}
+	rw.Header().Set("Content-Type", opensearch.SuggestionsContentType)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(opensearch.Suggestions(query, suggestions))
+}
+
+// handleOpenSearchDescription serves the description that browsers add the redirector as a search engine from,
+// pointing back to the public url of the redirector, or else to the host it was requested from.
+// Forwarded headers are not trusted, as any client may set them.
+func (s *Server) handleOpenSearchDescription(rw http.ResponseWriter, r *http.Request) {
+	baseUrl := s.publicUrl
+	if baseUrl == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		baseUrl = scheme + "://" + r.Host
+	}
+	description, err := opensearch.Description(baseUrl)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", opensearch.DescriptionContentType)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(description)
+}
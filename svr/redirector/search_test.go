@@ -0,0 +1,133 @@
+package redirector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reimirno/golinks/pkg/mapper"
+	"github.com/reimirno/golinks/pkg/types"
+)
+
+func newSearchServer(t *testing.T, publicUrl string) *Server {
+	searched := &mapper.MockMapperConfigurer{
+		Name: "searched",
+		StarterPairs: types.PathUrlPairMap{
+			"/fk":     fakePair,
+			"/fk2":    fakePair2,
+			"/gh/*":   {Path: "/gh/*", Url: "https://github.com/$1"},
+			"/search": {Path: "/search", Url: "https://search.com"},
+		},
+	}
+	mm, err := mapper.NewMapperManager(searched.Name, mapper.CloneConfigurers([]*mapper.MockMapperConfigurer{searched}), mapper.WithPatterns(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { mm.Teardown() })
+	server, err := NewServer(mm, "8080", publicUrl)
+	require.NoError(t, err)
+	return server
+}
+
+func TestSearchPath(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{" fk ", "fk"},
+		{"gh golang  go", "gh/golang/go"},
+		{"go/fk", "fk"},
+		{"team-a/deploy prod", "team-a/deploy/prod"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			assert.Equal(t, test.want, searchPath(test.query))
+		})
+	}
+}
+
+func TestServer_handleSearch(t *testing.T) {
+	server := newSearchServer(t, "")
+
+	tests := []struct {
+		name        string
+		query       string
+		statusCode  int
+		redirectUrl string
+		contains    []string
+	}{
+		{name: "keyword", query: "fk", statusCode: http.StatusFound, redirectUrl: "https://fake.com"},
+		{name: "pasted", query: "go/fk2", statusCode: http.StatusFound, redirectUrl: "https://fake2.com"},
+		{name: "arguments", query: "gh golang go", statusCode: http.StatusFound, redirectUrl: "https://github.com/golang/go"},
+		{name: "suggested", query: "f", statusCode: http.StatusNotFound, contains: []string{"No link for f.", `<a href="/fk">fk</a>`, `<a href="/fk2">fk2</a>`}},
+		{name: "suggested by keyword", query: "fk nothing", statusCode: http.StatusNotFound, contains: []string{"No link for fk nothing.", `<a href="/fk">fk</a>`}},
+		{name: "pattern is not redirected", query: "gh/*", statusCode: http.StatusNotFound},
+		{name: "reserved", query: "d/readyz", statusCode: http.StatusNotFound},
+		{name: "not reserved", query: "search", statusCode: http.StatusFound, redirectUrl: "https://search.com"},
+		{name: "empty", query: "", statusCode: http.StatusOK, contains: []string{`href="/d/opensearch.xml"`, `<a href="/fk">fk</a>`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/d/search?q="+url.QueryEscape(test.query), nil))
+			assert.Equal(t, test.statusCode, rr.Code)
+			assert.Equal(t, test.redirectUrl, rr.Header().Get("Location"))
+			if test.redirectUrl == "" {
+				assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			}
+			for _, s := range test.contains {
+				assert.Contains(t, rr.Body.String(), s)
+			}
+		})
+	}
+}
+
+func TestServer_searchLeavesLinksAlone(t *testing.T) {
+	server := newSearchServer(t, "")
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/search", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://search.com", rr.Header().Get("Location"))
+}
+
+func TestServer_handleSearchSuggest(t *testing.T) {
+	server := newSearchServer(t, "")
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/d/suggest?q=fk", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-suggestions+json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `["fk",["fk","fk2"],["https://fake.com","https://fake2.com"],["https://fake.com","https://fake2.com"]]`, rr.Body.String())
+}
+
+func TestServer_handleOpenSearchDescription(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicUrl string
+		headers   map[string]string
+		want      string
+	}{
+		{name: "host", want: `template="http://go.example.com/d/search?q={searchTerms}"`},
+		{name: "forwarded headers are not trusted", headers: map[string]string{"X-Forwarded-Proto": "javascript"}, want: `template="http://go.example.com/d/suggest?q={searchTerms}"`},
+		{name: "public url", publicUrl: "https://go.corp.com/", want: `template="https://go.corp.com/d/suggest?q={searchTerms}"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newSearchServer(t, test.publicUrl)
+			req := httptest.NewRequest("GET", "/d/opensearch.xml", nil)
+			req.Host = "go.example.com"
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "application/opensearchdescription+xml", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), test.want)
+		})
+	}
+}